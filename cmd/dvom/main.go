@@ -2,49 +2,320 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	units "github.com/docker/go-units"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/ypeckstadt/dvom/internal/backup"
+	"github.com/ypeckstadt/dvom/internal/crypto"
+	"github.com/ypeckstadt/dvom/internal/docker"
+	"github.com/ypeckstadt/dvom/internal/history"
+	"github.com/ypeckstadt/dvom/internal/models"
 	"github.com/ypeckstadt/dvom/internal/storage"
 	"github.com/ypeckstadt/dvom/pkg/version"
+	"gopkg.in/yaml.v3"
 )
 
 // Global variables for CLI flags
 var (
-	backupDir    string
-	verbose      bool
-	quiet        bool
-	dryRun       bool
-	force        bool
-	snapshotName string
-	volumeName   string
-	targetVolume string
-	versionFlag  string
+	backupDir     string
+	verbose       bool
+	quiet         bool
+	dryRun        bool
+	force         bool
+	snapshotName  string
+	volumeNames   []string
+	targetVolumes []string
+	versionFlag   string
+	fromFile      string
 	// Storage flags
-	storageType  string
-	gcsBucket    string
-	gcsProject   string
-	gcsCredsFile string
-	s3Bucket     string
-	s3Region     string
-	s3Endpoint   string
-	s3AccessKey  string
-	s3SecretKey  string
+	storageType    string
+	gcsBucket      string
+	gcsProject     string
+	gcsCredsFile   string
+	gcsImpersonate string
+	gcsAccessToken string
+	s3Bucket       string
+	s3Region       string
+	s3Endpoint     string
+	s3AccessKey    string
+	s3SecretKey    string
+	s3CreateBucket bool
+	// S3 multipart upload part size and parallel part uploads
+	s3PartSize          string
+	gcsChunkSize        string
+	s3UploadConcurrency int
+	// Parallel metadata reads when listing S3/GCS
+	readConcurrency int
 	// Container management flags
 	stopContainers []string
+	// Restart health check flags
+	waitHealthy        time.Duration
+	retryFailedRestart int
+	noRestart          bool
+	// Container stop flags
+	stopTimeout time.Duration
+	forceStop   bool
+	// Archive compression of new backups
+	compression      string
+	compressionLevel int
+	// Upload the archive while it is produced instead of buffering it in a temp file
+	streamBackup bool
 	// Encryption flags
-	encrypt  bool
-	password string
+	encrypt         bool
+	password        string
+	encryptMetadata bool
+	// Repository history flags
+	sinceVersion int
+	sinceTime    string
+	// Prune flags
+	pruneIndex bool
+	// History flags
+	historyFile  string
+	outputFormat string
+	// Local path restore-file writes to
+	outputPath string
+	// Snapshot naming
+	versionSeparator string
+	// Helper container diagnostics
+	contextLines int
+	// Image the temporary backup and restore containers run in
+	helperImage string
+	noPull      bool
+	// Storage transfer rate limit, e.g. 10MB/s, and its parsed value in bytes per second
+	rateLimit      string
+	rateLimitBytes int64
+	// Expand ${VAR} references in --name, --backup-dir and the restore-file --output path
+	expandEnv bool
+	// Log output: format, errors-only mode and the logger built from them
+	logFormat       string
+	quietErrorsOnly bool
+	appLogger, _    = backup.NewLogger(backup.LevelInfo, backup.LogFormatText, os.Stdout, os.Stderr)
+	// Time limit of the whole command and the function releasing its deadline
+	commandTimeout time.Duration
+	cancelTimeout  context.CancelFunc
+	// List flags
+	listTree bool
+	// Restore flags
+	stripComponents     int
+	onlyVolume          string
+	backupBeforeRestore bool
+	createVolume        bool
+	copyDriver          bool
+	// Empty volume guard flags
+	failOnEmpty bool
+	minSize     string
+	// Idempotent re-run flag
+	skipIfUnchanged bool
+	// Skip backups of volumes with no files modified since the previous version
+	sinceLastModified bool
+	// Back up only the files modified since the previous version
+	incremental bool
+	// Post-backup retention flags
+	keepLast    int
+	keepWithin  time.Duration
+	maxVersions int
+	// Post-backup verification flags
+	verifyAfterBackup bool
+	verifyChecksum    bool
+	deleteUnverified  bool
+	// Check the restored files against the manifest captured at backup time
+	verifyAfterRestore bool
+	// Number of files a restore dry run lists per kind of change
+	dryRunLimit int
+	// Encryption chunk size flag
+	cryptoChunkSize string
+	// Key derivation of new encrypted backups
+	kdf string
+	// Keyfile used as key material instead of a password
+	keyfile string
+	// Backup strategy flags
+	snapshotStrategy string
+	// Repair flags
+	overwriteMetadata bool
+	// Verify flags
+	allBackends bool
+	// Sync flags
+	syncFrom string
+	syncTo   string
+	// Tag flags
+	tags        []string
+	listFilters []string
+	// Exclude flags
+	excludes []string
+	// List time window flags
+	listSince string
+	listUntil string
+	// Config file flags
+	configFile  string
+	profileName string
 )
 
+// configFileSettings are the flags that can be set from environment variables and config file
+// profiles. Profiles use the flag names as keys; the environment variable of a flag is its name
+// in upper case with a DVOM_ prefix, e.g. DVOM_S3_BUCKET for --s3-bucket.
+var configFileSettings = []string{
+	"storage",
+	"backup-dir",
+	"gcs-bucket",
+	"gcs-project",
+	"gcs-creds",
+	"gcs-impersonate",
+	"gcs-access-token",
+	"gcs-chunk-size",
+	"s3-bucket",
+	"s3-region",
+	"s3-endpoint",
+	"s3-access-key",
+	"s3-secret-key",
+	"list-concurrency",
+	"s3-create-bucket",
+	"s3-part-size",
+	"s3-upload-concurrency",
+	"keyfile",
+	"helper-image",
+	"no-pull",
+	"rate-limit",
+	"schedule",
+}
+
+// configApplied records the settings applyConfig took from the environment or config file
+// rather than the command line
+var configApplied = map[string]bool{}
+
+// dvomConfig is the layout of the dvom config file
+type dvomConfig struct {
+	// DefaultProfile is used when --profile is not given
+	DefaultProfile string                       `yaml:"default_profile"`
+	Profiles       map[string]map[string]string `yaml:"profiles"`
+}
+
+// defaultConfigPath returns the default location of the dvom config file
+func defaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".dvom", "config.yaml")
+	}
+	return filepath.Join(home, ".dvom", "config.yaml")
+}
+
+// applyConfig fills the storage flags that were not given on the command line from DVOM_*
+// environment variables and then from the selected config file profile, so the precedence is
+// flags > environment > config file > defaults
+func applyConfig(flags *pflag.FlagSet) error {
+	profile, err := loadConfigProfile()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range configFileSettings {
+		flag := flags.Lookup(name)
+		if flag == nil || flag.Changed {
+			continue
+		}
+
+		envName := "DVOM_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		value, ok := os.LookupEnv(envName)
+		source := envName
+		if !ok {
+			value, ok = profile[name]
+			source = "config file"
+		}
+		if !ok {
+			continue
+		}
+
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("failed to apply %s setting: %w", source, err)
+		}
+		configApplied[name] = true
+	}
+
+	return nil
+}
+
+// loadConfigProfile reads the config file and returns the settings of the selected profile.
+// A missing default config file is not an error; it simply provides no settings.
+func loadConfigProfile() (map[string]string, error) {
+	path := configFile
+	if path == "" {
+		path = defaultConfigPath()
+	}
+
+	data, err := os.ReadFile(path) // #nosec G304 - user configured config path
+	if err != nil {
+		if os.IsNotExist(err) && configFile == "" {
+			if profileName != "" {
+				return nil, fmt.Errorf("--profile %s given but no config file found at %s", profileName, path)
+			}
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var config dvomConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	for name, settings := range config.Profiles {
+		for key := range settings {
+			if !isConfigFileSetting(key) {
+				return nil, fmt.Errorf("unknown setting %q in profile %q of %s (supported: %s)", key, name, path, strings.Join(configFileSettings, ", "))
+			}
+		}
+	}
+
+	selected := profileName
+	if selected == "" {
+		selected = config.DefaultProfile
+	}
+	if selected == "" {
+		selected = "default"
+		if _, ok := config.Profiles[selected]; !ok {
+			return nil, nil
+		}
+	}
+
+	profile, ok := config.Profiles[selected]
+	if !ok {
+		return nil, fmt.Errorf("profile %q not found in %s", selected, path)
+	}
+	return profile, nil
+}
+
+// isConfigFileSetting reports whether name can be set from a config file profile
+func isConfigFileSetting(name string) bool {
+	for _, setting := range configFileSettings {
+		if setting == name {
+			return true
+		}
+	}
+	return false
+}
+
 func buildStorageConfig() (*storage.Config, error) {
+	return buildStorageConfigFor(storageType)
+}
+
+// buildStorageConfigFor builds the storage configuration of the given backend type from the CLI flags
+func buildStorageConfigFor(backendType string) (*storage.Config, error) {
 	config := &storage.Config{
-		Type: storageType,
+		Type: backendType,
 	}
 
-	switch storageType {
+	switch backendType {
 	case "local":
 		config.Local = &storage.LocalConfig{
 			BasePath: backupDir,
@@ -53,29 +324,114 @@ func buildStorageConfig() (*storage.Config, error) {
 		if gcsBucket == "" {
 			return nil, fmt.Errorf("GCS bucket is required when using GCS storage")
 		}
+		// Fall back to the standard credentials variable so the path need not be passed as a flag
+		credsFile := gcsCredsFile
+		if credsFile == "" && gcsAccessToken == "" {
+			credsFile = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+		}
+		var chunkSize int64
+		if gcsChunkSize != "" {
+			var err error
+			chunkSize, err = units.RAMInBytes(gcsChunkSize)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --gcs-chunk-size value %q: %w", gcsChunkSize, err)
+			}
+			if err := storage.ValidateGCSChunkSize(chunkSize); err != nil {
+				return nil, fmt.Errorf("invalid --gcs-chunk-size: %w", err)
+			}
+		}
 		config.GCS = &storage.GCSConfig{
-			Bucket:      gcsBucket,
-			ProjectID:   gcsProject,
-			Credentials: gcsCredsFile,
+			Bucket:          gcsBucket,
+			ProjectID:       gcsProject,
+			Credentials:     credsFile,
+			Impersonate:     gcsImpersonate,
+			AccessToken:     gcsAccessToken,
+			ReadConcurrency: readConcurrency,
+			ChunkSize:       int(chunkSize),
 		}
 	case "s3":
 		if s3Bucket == "" {
 			return nil, fmt.Errorf("S3 bucket is required when using S3 storage")
 		}
+		// Fall back to the standard AWS variables so secrets stay out of shell history and
+		// process listings
+		accessKey, secretKey, sessionToken := s3AccessKey, s3SecretKey, ""
+		if accessKey == "" && secretKey == "" {
+			accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+			secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+			sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		}
+		var partSize int64
+		if s3PartSize != "" {
+			var err error
+			partSize, err = units.RAMInBytes(s3PartSize)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --s3-part-size value %q: %w", s3PartSize, err)
+			}
+			if err := storage.ValidateS3PartSize(partSize); err != nil {
+				return nil, fmt.Errorf("invalid --s3-part-size: %w", err)
+			}
+		}
 		config.S3 = &storage.S3Config{
-			Bucket:    s3Bucket,
-			Region:    s3Region,
-			Endpoint:  s3Endpoint,
-			AccessKey: s3AccessKey,
-			SecretKey: s3SecretKey,
+			Bucket:            s3Bucket,
+			Region:            s3Region,
+			Endpoint:          s3Endpoint,
+			AccessKey:         accessKey,
+			SecretKey:         secretKey,
+			SessionToken:      sessionToken,
+			ReadConcurrency:   readConcurrency,
+			CreateBucket:      s3CreateBucket,
+			PartSize:          partSize,
+			UploadConcurrency: s3UploadConcurrency,
 		}
 	default:
-		return nil, fmt.Errorf("unsupported storage type: %s", storageType)
+		return nil, fmt.Errorf("unsupported storage type: %s", backendType)
 	}
 
 	return config, nil
 }
 
+// configureLogger sets up the logger of dvom and its packages from --log-format and the
+// verbosity flags. Structured formats take over reporting the command's error from cobra.
+func configureLogger(cmd *cobra.Command) error {
+	if quietErrorsOnly {
+		quiet = true
+	}
+	level := backup.LevelInfo
+	switch {
+	case quietErrorsOnly:
+		level = backup.LevelError
+	case quiet:
+		level = backup.LevelWarn
+	case verbose:
+		level = backup.LevelDebug
+	}
+
+	logger, err := backup.NewLogger(level, logFormat, os.Stdout, os.Stderr)
+	if err != nil {
+		return err
+	}
+	appLogger = logger
+	backup.SetLogger(logger)
+	if logFormat != backup.LogFormatText {
+		cmd.Root().SilenceErrors = true
+		cmd.SilenceUsage = true
+	}
+	return nil
+}
+
+// configuredStorageTypes returns the backend types that have their required flags set
+func configuredStorageTypes() []string {
+	types := []string{"local"}
+	if s3Bucket != "" {
+		types = append(types, "s3")
+	}
+	if gcsBucket != "" {
+		types = append(types, "gcs")
+	}
+	return types
+}
+
 func main() {
 	var rootCmd = &cobra.Command{
 		Use:     "dvom",
@@ -83,9 +439,42 @@ func main() {
 		Long:    "DVOM (Docker Volume Manager) - A simple tool for backing up and restoring Docker container volumes with support for local and cloud storage backends",
 		Version: version.Version,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := applyConfig(cmd.Flags()); err != nil {
+				return err
+			}
+
+			if err := configureLogger(cmd); err != nil {
+				return err
+			}
+
+			if commandTimeout < 0 {
+				return fmt.Errorf("--timeout cannot be negative")
+			}
+			// The daemon runs indefinitely, it applies the timeout to each scheduled run instead
+			if commandTimeout > 0 && cmd.Name() != "daemon" {
+				ctx, cancel := context.WithTimeout(cmd.Context(), commandTimeout)
+				cmd.SetContext(ctx)
+				cancelTimeout = cancel
+			}
+
+			if err := storage.SetVersionSeparator(versionSeparator); err != nil {
+				return err
+			}
+
+			var err error
+			if rateLimitBytes, err = parseRateLimit(rateLimit); err != nil {
+				return err
+			}
+
+			if expandEnv {
+				if err := expandFlagEnv(); err != nil {
+					return err
+				}
+			}
+
 			// Skip backup directory validation for commands that don't need storage
 			cmdName := cmd.Name()
-			if cmdName == "volumes" {
+			if cmdName == "volumes" || cmdName == "du" || cmdName == "cleanup" || cmdName == "capabilities" || cmdName == "normalize-name" || cmd.CommandPath() == "dvom history" {
 				return nil
 			}
 
@@ -104,7 +493,22 @@ func main() {
 	// Global flags
 	rootCmd.PersistentFlags().StringVar(&backupDir, "backup-dir", "./backups", "Directory to store backups (for local storage)")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+	rootCmd.PersistentFlags().DurationVar(&commandTimeout, "timeout", 0, "Cancel the command if it has not finished within this duration (e.g. 2h); helper containers are still removed")
+	rootCmd.PersistentFlags().BoolVar(&expandEnv, "expand-env", false, "Expand ${VAR} environment references in --name, --backup-dir and the --output path of restore-file")
 	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Quiet output")
+	rootCmd.PersistentFlags().BoolVar(&quietErrorsOnly, "quiet-errors-only", false, "Like --quiet, and also suppress warnings so only errors are written")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", backup.LogFormatText, "Format of errors, warnings and log messages (text, logfmt, json); logfmt and json write one record per line to stderr")
+	rootCmd.PersistentFlags().StringVar(&versionSeparator, "version-separator", storage.LegacyVersionSeparator, "Separator between snapshot name and version in new snapshot IDs (existing name@version snapshots stay readable)")
+	rootCmd.PersistentFlags().StringVar(&historyFile, "history-file", "", "Path of the local operation history log (default ~/.dvom/history.log)")
+	rootCmd.PersistentFlags().StringVar(&outputFormat, "output", "table", "Output format of list, info, versions, volumes, du, history and capabilities (table, json, yaml)")
+	rootCmd.PersistentFlags().IntVar(&contextLines, "context-lines", 20, "Number of stderr lines shown when a backup/restore helper container fails")
+	rootCmd.PersistentFlags().StringVar(&helperImage, "helper-image", backup.DefaultHelperImage, "Image the temporary backup/restore containers run in (must provide sh and tar)")
+	rootCmd.PersistentFlags().BoolVar(&noPull, "no-pull", false, "Fail instead of pulling the helper image when it is not present on the Docker host")
+	rootCmd.PersistentFlags().StringVar(&rateLimit, "rate-limit", "", "Cap the upload/download rate to the storage backend (e.g. 10MB/s, default unlimited)")
+
+	// Config file flags
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Path of the dvom config file (default ~/.dvom/config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "Config file profile to use for the storage settings (default: the file's default_profile, or \"default\")")
 
 	// Storage backend flags
 	rootCmd.PersistentFlags().StringVar(&storageType, "storage", "local", "Storage backend type (local, gcs, s3)")
@@ -113,6 +517,9 @@ func main() {
 	rootCmd.PersistentFlags().StringVar(&gcsBucket, "gcs-bucket", "", "GCS bucket name")
 	rootCmd.PersistentFlags().StringVar(&gcsProject, "gcs-project", "", "GCS project ID")
 	rootCmd.PersistentFlags().StringVar(&gcsCredsFile, "gcs-creds", "", "Path to GCS credentials file")
+	rootCmd.PersistentFlags().StringVar(&gcsImpersonate, "gcs-impersonate", "", "GCS service account to impersonate")
+	rootCmd.PersistentFlags().StringVar(&gcsAccessToken, "gcs-access-token", "", "GCS OAuth2 access token (instead of credentials file or ADC)")
+	rootCmd.PersistentFlags().StringVar(&gcsChunkSize, "gcs-chunk-size", "16MB", "Size of the chunks backups are uploaded to GCS in, each retried on its own (a multiple of 256KB)")
 
 	// S3 flags
 	rootCmd.PersistentFlags().StringVar(&s3Bucket, "s3-bucket", "", "S3 bucket name")
@@ -120,31 +527,92 @@ func main() {
 	rootCmd.PersistentFlags().StringVar(&s3Endpoint, "s3-endpoint", "", "S3 endpoint (for S3-compatible services)")
 	rootCmd.PersistentFlags().StringVar(&s3AccessKey, "s3-access-key", "", "S3 access key")
 	rootCmd.PersistentFlags().StringVar(&s3SecretKey, "s3-secret-key", "", "S3 secret key")
+	rootCmd.PersistentFlags().BoolVar(&s3CreateBucket, "s3-create-bucket", false, "Create the S3 bucket if it does not exist (e.g. on a fresh MinIO server)")
+	rootCmd.PersistentFlags().StringVar(&s3PartSize, "s3-part-size", "16MB", "Size of the parts backups are uploaded to S3 in (5MB to 5GB; a backup can have at most 10000 parts)")
+	rootCmd.PersistentFlags().IntVar(&s3UploadConcurrency, "s3-upload-concurrency", storage.DefaultS3UploadConcurrency, "Number of parts uploaded to S3 in parallel")
+	rootCmd.PersistentFlags().IntVar(&readConcurrency, "list-concurrency", storage.DefaultReadConcurrency, "Number of metadata objects read in parallel when listing S3/GCS; throttled reads are retried with backoff")
+	rootCmd.SetGlobalNormalizationFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		// --read-concurrency is the original name of --list-concurrency
+		if name == "read-concurrency" {
+			name = "list-concurrency"
+		}
+		return pflag.NormalizedName(name)
+	})
 
 	// Add commands
 	rootCmd.AddCommand(createBackupCommand())
+	rootCmd.AddCommand(createBackupAllCommand())
 	rootCmd.AddCommand(createRestoreCommand())
+	rootCmd.AddCommand(createRestoreFileCommand())
+	rootCmd.AddCommand(createTestRestoreCommand())
 	rootCmd.AddCommand(createListCommand())
 	rootCmd.AddCommand(createInfoCommand())
 	rootCmd.AddCommand(createVersionsCommand())
 	rootCmd.AddCommand(createDeleteCommand())
+	rootCmd.AddCommand(createRenameCommand())
+	rootCmd.AddCommand(createShareCommand())
 	rootCmd.AddCommand(createVolumesCommand())
+	rootCmd.AddCommand(createDuCommand())
 	rootCmd.AddCommand(createRepositoryCommand())
+	rootCmd.AddCommand(createPruneCommand())
+	rootCmd.AddCommand(createRepairCommand())
+	rootCmd.AddCommand(createMetadataCommand())
+	rootCmd.AddCommand(createExistsCommand())
+	rootCmd.AddCommand(createNormalizeNameCommand())
+	rootCmd.AddCommand(createVerifyCommand())
+	rootCmd.AddCommand(createSyncCommand())
+	rootCmd.AddCommand(createOperationHistoryCommand())
+	rootCmd.AddCommand(createImportLegacyCommand())
+	rootCmd.AddCommand(createCapabilitiesCommand())
+	rootCmd.AddCommand(createDoctorCommand())
+	rootCmd.AddCommand(createCleanupCommand())
+	rootCmd.AddCommand(createDaemonCommand())
+
+	// The first SIGINT or SIGTERM cancels the command so it can remove its helper containers and
+	// restart stopped ones; a second one terminates immediately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			stop()
+			fmt.Fprintln(os.Stderr, "Interrupted, cleaning up (interrupt again to exit immediately)")
+		case <-done:
+		}
+	}()
 
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	err := rootCmd.ExecuteContext(ctx)
+	close(done)
+	if cancelTimeout != nil {
+		cancelTimeout()
+	}
+	stop()
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && commandTimeout > 0 {
+			err = fmt.Errorf("timed out after %s: %w", commandTimeout, err)
+		}
+		appLogger.Errorf("%v", err)
+		os.Exit(backup.ExitCode(err))
 	}
 }
 
 func createBackupCommand() *cobra.Command {
+	var (
+		parallel      int
+		containerName string
+		allVolumes    bool
+		includeBinds  bool
+		resume        bool
+		autoStopUsers bool
+	)
+
 	cmd := &cobra.Command{
 		Use:   "backup",
 		Short: "Create a backup of a volume",
 		Long:  "Create a backup of a Docker volume by name",
 		Args:  cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := context.Background()
+			ctx := cmd.Context()
 
 			storageConfig, err := buildStorageConfig()
 			if err != nil {
@@ -153,7 +621,7 @@ func createBackupCommand() *cobra.Command {
 
 			storageBackend, err := storage.NewBackend(ctx, storageConfig)
 			if err != nil {
-				return err
+				return backup.StorageError(err)
 			}
 
 			client, err := backup.NewClientWithStorage(ctx, storageBackend, verbose && !quiet)
@@ -161,34 +629,243 @@ func createBackupCommand() *cobra.Command {
 				return err
 			}
 			client.SetQuiet(quiet)
+			client.SetContextLines(contextLines)
+			client.SetHelperImage(helperImage)
+			client.SetNoPull(noPull)
+			if err := client.SetRateLimit(rateLimitBytes); err != nil {
+				return err
+			}
 
 			// Validate required flags
 			if snapshotName == "" {
 				return fmt.Errorf("--name is required to name the volume backup")
 			}
-			if volumeName == "" {
+			if resume {
+				if len(volumeNames) > 0 || containerName != "" || allVolumes {
+					return fmt.Errorf("--resume cannot be combined with --volume or --container, it uploads the archive of the interrupted backup")
+				}
+				if err := configureBackupClient(client); err != nil {
+					return err
+				}
+				err = client.ResumeBackup(snapshotName)
+				recordBackupHistory("backup", snapshotName, "", storageType, nil, false, err)
+				return err
+			}
+			if containerName != "" || allVolumes {
+				if containerName == "" || !allVolumes {
+					return fmt.Errorf("--container and --all-volumes must be used together")
+				}
+				if len(volumeNames) > 0 {
+					return fmt.Errorf("--volume cannot be combined with --container, its volumes are discovered")
+				}
+			} else if len(volumeNames) == 0 {
 				return fmt.Errorf("--volume is required to specify which volume to backup")
 			}
 
-			// Set encryption options
-			if encrypt || password != "" {
-				client.SetEncryption(true, password)
+			if err := configureBackupClient(client); err != nil {
+				return err
+			}
+			client.SetIncludeBinds(includeBinds)
+			client.SetAutoStopUsers(autoStopUsers)
+
+			if containerName != "" {
+				if volumeNames, err = client.ContainerVolumes(containerName); err != nil {
+					return err
+				}
+			}
+
+			// Several volumes are captured together in one multi-volume snapshot
+			if len(volumeNames) > 1 {
+				if err := client.SetVolumeParallelism(parallel); err != nil {
+					return fmt.Errorf("invalid --parallel: %w", err)
+				}
+				err = client.BackupVolumesWithContainers(volumeNames, snapshotName, stopContainers)
+				recordBackupHistory("backup", snapshotName, strings.Join(volumeNames, ","), storageType, client.ContainerResults(), false, err)
+				return err
 			}
 
 			// Direct volume backup
-			return client.BackupDirectVolumeWithContainers(volumeName, snapshotName, stopContainers)
+			err = client.BackupDirectVolumeWithContainers(volumeNames[0], snapshotName, stopContainers)
+			recordBackupHistory("backup", snapshotName, volumeNames[0], storageType, client.ContainerResults(), client.LastBackupUnchanged(), err)
+			return err
 		},
 	}
 
 	cmd.Flags().StringVarP(&snapshotName, "name", "n", "", "Name for the volume backup")
-	cmd.Flags().StringVar(&volumeName, "volume", "", "Volume name to backup")
-	cmd.Flags().StringSliceVar(&stopContainers, "stop-containers", []string{}, "Container names/IDs to stop during backup (comma-separated)")
+	cmd.Flags().StringSliceVar(&volumeNames, "volume", []string{}, "Volume name to backup; repeat to back up several volumes into one snapshot")
+	cmd.Flags().IntVar(&parallel, "parallel", 1, "Number of volumes of a multi-volume backup archived at the same time")
+	cmd.Flags().StringVar(&containerName, "container", "", "Container whose volumes to back up (requires --all-volumes)")
+	cmd.Flags().BoolVar(&allVolumes, "all-volumes", false, "Back up every named volume mounted by --container into one snapshot, recording the container's config")
+	cmd.Flags().BoolVar(&includeBinds, "include-binds", false, "Also back up host paths: the bind mounts of --container, or absolute paths given to --volume (read as root, restored only into volumes)")
+	cmd.Flags().BoolVar(&autoStopUsers, "auto-stop-users", false, "Stop the running containers using the volumes during the backup and restart them afterwards")
+	cmd.Flags().BoolVar(&resume, "resume", false, "Retry the failed or interrupted upload of the backup named by --name (S3 and GCS)")
+	addBackupOptionFlags(cmd)
+
+	return cmd
+}
+
+// addBackupOptionFlags registers the backup flags shared by backup and backup-all
+func addBackupOptionFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&stopContainers, "stop-containers", []string{}, "Container names/IDs to stop during backup, in stop order; restarted in reverse (comma-separated)")
+	cmd.Flags().DurationVar(&waitHealthy, "wait-healthy", 0, "After restarting stopped containers, wait up to this long for them to become healthy (e.g. 60s)")
+	cmd.Flags().IntVar(&retryFailedRestart, "retry-failed-restart", 0, "Restart a container up to this many more times if it does not become healthy (requires --wait-healthy)")
+	cmd.Flags().BoolVar(&noRestart, "no-restart", false, "Leave the stopped containers stopped afterwards instead of restarting them")
+	cmd.Flags().DurationVar(&stopTimeout, "stop-timeout", 30*time.Second, "How long a stopped container is given to exit after SIGTERM before it is killed")
+	cmd.Flags().BoolVar(&forceStop, "force-stop", false, "Kill a container with SIGKILL if stopping it fails or it is still running after --stop-timeout")
 	cmd.Flags().BoolVar(&encrypt, "encrypt", false, "Encrypt the backup with AES-256")
+	cmd.Flags().StringVar(&cryptoChunkSize, "crypto-chunk-size", "", "Plaintext size of each encrypted chunk, recorded in the backup (default 64KB, e.g. 1MB)")
+	cmd.Flags().StringVar(&kdf, "kdf", crypto.KDF, "Key derivation for the encryption password (pbkdf2-sha256, argon2id), recorded in the backup")
+	cmd.Flags().BoolVar(&encryptMetadata, "encrypt-metadata", false, "Also encrypt the backup metadata with the encryption password")
 	cmd.Flags().StringVar(&password, "password", "", "Password for encryption (will prompt if not provided)")
+	cmd.Flags().StringVar(&keyfile, "keyfile", "", "Encrypt with the contents of this keyfile instead of a password (at least 32 bytes)")
+	cmd.Flags().BoolVar(&failOnEmpty, "fail-on-empty", false, "Fail the backup if the volume contains no files")
+	cmd.Flags().StringVar(&minSize, "min-size", "", "Fail the backup if the volume's files total less than this size (e.g. 10MB)")
+	cmd.Flags().BoolVar(&skipIfUnchanged, "skip-if-unchanged", false, "Skip the upload if a version with identical content already exists")
+	cmd.Flags().BoolVar(&sinceLastModified, "since-last-modified", false, "Skip the backup without archiving if no file in the volume was modified since the previous version")
+	cmd.Flags().BoolVar(&incremental, "incremental", false, "Store only the files modified since the previous version (a full backup is made if there is none)")
+	cmd.Flags().IntVar(&keepLast, "keep-last", 0, "After a successful backup, keep only the newest N versions of the snapshot")
+	cmd.Flags().DurationVar(&keepWithin, "keep-within", 0, "After a successful backup, keep only versions created within this duration (e.g. 168h)")
+	cmd.Flags().BoolVar(&verifyAfterBackup, "verify-after-backup", false, "Read back the start of the stored backup and check it decrypts (or decompresses) before reporting success")
+	cmd.Flags().BoolVar(&verifyChecksum, "verify", false, "Read back all of the stored backup and check its size and checksum match the upload before reporting success")
+	cmd.Flags().BoolVar(&deleteUnverified, "delete-on-verify-failure", false, "Delete a stored backup that fails verification")
+	cmd.Flags().IntVar(&maxVersions, "max-versions", 0, "After a successful backup, delete the oldest versions beyond this count")
+	cmd.Flags().StringVar(&compression, "compression", "gzip", "Compression of the volume archive (gzip, zstd, none), recorded in the backup")
+	cmd.Flags().BoolVar(&streamBackup, "stream", false, "Upload the archive while it is created instead of writing it to a local temp file first")
+	cmd.Flags().IntVar(&compressionLevel, "compression-level", 0, "Compression level (gzip 1-9, zstd 1-22); 0 uses the algorithm's default")
+	cmd.Flags().StringVar(&snapshotStrategy, "strategy", "auto", "Snapshot strategy (auto, btrfs, zfs, tar); auto uses a driver snapshot when the volume driver supports it")
+	cmd.Flags().StringArrayVar(&tags, "tag", nil, "Tag the backup with key=value metadata (repeatable)")
+	cmd.Flags().StringArrayVar(&excludes, "exclude", nil, "Leave out files matching this pattern, relative to the volume root if it contains a '/' (e.g. 'cache/*', '*.tmp'; repeatable)")
+}
+
+func createBackupAllCommand() *cobra.Command {
+	var (
+		nameTemplate string
+		denyPatterns []string
+		parallel     int
+		keepGoing    bool
+
+		stopUsingContainers bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "backup-all",
+		Short: "Back up every Docker volume on the host",
+		Long:  "Back up every Docker volume on the host as its own snapshot, named from --name-template. Volumes matching a --deny pattern are skipped. Prints a coverage summary and fails if any volume backup failed.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			opts := backup.SweepOptions{
+				NameTemplate:        nameTemplate,
+				Deny:                denyPatterns,
+				Parallel:            parallel,
+				KeepGoing:           keepGoing,
+				StopContainers:      stopContainers,
+				StopUsingContainers: stopUsingContainers,
+			}
+			if parallel < 1 {
+				return fmt.Errorf("--parallel must be at least 1")
+			}
+			if err := backup.ValidateSweepOptions(opts); err != nil {
+				return err
+			}
+
+			// With --output jsonl, stdout carries only the result records
+			streaming := false
+			switch outputFormat {
+			case "table":
+			case "jsonl":
+				streaming = true
+				encoder := json.NewEncoder(os.Stdout)
+				opts.OnResult = func(result backup.SweepResult) {
+					if err := encoder.Encode(newSweepRecord(result)); err != nil {
+						appLogger.Warnf("failed to write result record: %v", err)
+					}
+				}
+			default:
+				return fmt.Errorf("unsupported output format %q (use table or jsonl)", outputFormat)
+			}
+
+			storageConfig, err := buildStorageConfig()
+			if err != nil {
+				return err
+			}
+
+			storageBackend, err := storage.NewBackend(ctx, storageConfig)
+			if err != nil {
+				return backup.StorageError(err)
+			}
+
+			client, err := backup.NewClientWithStorage(ctx, storageBackend, verbose && !quiet && !streaming)
+			if err != nil {
+				return err
+			}
+			client.SetQuiet(quiet || streaming)
+			client.SetContextLines(contextLines)
+			client.SetHelperImage(helperImage)
+			client.SetNoPull(noPull)
+			if err := client.SetRateLimit(rateLimitBytes); err != nil {
+				return err
+			}
+
+			if err := configureBackupClient(client); err != nil {
+				return err
+			}
+
+			results, err := client.BackupAllVolumes(opts)
+			for _, result := range results {
+				if !result.Skipped {
+					recordBackupHistory("backup", result.Snapshot, result.Volume, storageType, client.ContainerResults(), result.Unchanged, result.Err)
+				}
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&nameTemplate, "name-template", "{volume}", "Snapshot name for each volume; {volume} is replaced by the volume name and {date} by the date (YYYYMMDD)")
+	cmd.Flags().StringSliceVar(&denyPatterns, "deny", []string{}, "Skip volumes whose name matches any of these glob patterns (comma-separated)")
+	cmd.Flags().IntVar(&parallel, "parallel", 1, "Number of volumes backed up at the same time")
+	cmd.Flags().BoolVar(&keepGoing, "keep-going", false, "Keep backing up the remaining volumes after a volume fails")
+	cmd.Flags().BoolVar(&stopUsingContainers, "stop-using-containers", false, "Stop every container using one of the volumes, once for the whole sweep, and restart it afterwards")
+	cmd.Flags().StringVar(&outputFormat, "output", "table", "Output format (table, jsonl); jsonl writes one result record per volume to stdout as it completes")
+	addBackupOptionFlags(cmd)
 
 	return cmd
 }
 
+// sweepRecord is the result record of one volume written by backup-all --output jsonl
+type sweepRecord struct {
+	Target     string `json:"target"`
+	Volume     string `json:"volume"`
+	ID         string `json:"id,omitempty"`
+	Status     string `json:"status"`
+	Size       int64  `json:"size"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// newSweepRecord converts a volume result of a backup sweep to its result record
+func newSweepRecord(result backup.SweepResult) sweepRecord {
+	record := sweepRecord{
+		Target:     result.Snapshot,
+		Volume:     result.Volume,
+		ID:         result.ID,
+		Status:     "success",
+		Size:       result.Size,
+		DurationMs: result.Duration.Milliseconds(),
+	}
+	switch {
+	case result.Skipped:
+		record.Status = "skipped"
+	case result.Err != nil:
+		record.Status = "failure"
+		record.Error = result.Err.Error()
+	case result.Unchanged:
+		record.Status = "unchanged"
+	}
+	return record
+}
+
 func createRestoreCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "restore",
@@ -196,7 +873,69 @@ func createRestoreCommand() *cobra.Command {
 		Long:  "Restore a volume backup directly to a Docker volume by name",
 		Args:  cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := context.Background()
+			ctx := cmd.Context()
+
+			if copyDriver && !createVolume {
+				return fmt.Errorf("--copy-driver requires --create-volume")
+			}
+			if verifyAfterRestore && fromFile != "" {
+				return fmt.Errorf("--verify-after cannot be combined with --from-file: a backup file has no file manifest")
+			}
+			if verifyAfterRestore && stripComponents > 0 {
+				return fmt.Errorf("--verify-after cannot be combined with --strip-components")
+			}
+
+			// Restoring a local archive doesn't need a storage backend
+			if fromFile != "" {
+				if snapshotName != "" {
+					return fmt.Errorf("--from-file cannot be combined with --snapshot")
+				}
+				if onlyVolume != "" {
+					return fmt.Errorf("--from-file cannot be combined with --only-volume")
+				}
+				if backupBeforeRestore {
+					return fmt.Errorf("--from-file cannot be combined with --backup-before-restore")
+				}
+				if copyDriver {
+					return fmt.Errorf("--from-file cannot be combined with --copy-driver: a backup file records no volume driver")
+				}
+				if len(targetVolumes) != 1 || strings.Contains(targetVolumes[0], "=") {
+					return fmt.Errorf("--target-volume is required to specify which single volume to restore to")
+				}
+				targetVolume := targetVolumes[0]
+
+				client, err := backup.NewClientWithStorage(ctx, nil, verbose && !quiet)
+				if err != nil {
+					return err
+				}
+				client.SetQuiet(quiet)
+				client.SetContextLines(contextLines)
+				client.SetHelperImage(helperImage)
+				client.SetNoPull(noPull)
+				if err := client.SetRateLimit(rateLimitBytes); err != nil {
+					return err
+				}
+				if err := client.SetStripComponents(stripComponents); err != nil {
+					return err
+				}
+				client.SetCreateVolume(createVolume, false)
+
+				if password != "" {
+					client.SetEncryption(true, password)
+				}
+				if err := applyKeyfile(client); err != nil {
+					return err
+				}
+				if err := configureRestartHealthCheck(client); err != nil {
+					return err
+				}
+
+				err = client.RestoreFromFileWithContainers(targetVolume, fromFile, dryRun, force, stopContainers)
+				if !dryRun {
+					recordContainerHistory("restore", fromFile, targetVolume, "file", client.ContainerResults(), err)
+				}
+				return err
+			}
 
 			storageConfig, err := buildStorageConfig()
 			if err != nil {
@@ -205,7 +944,7 @@ func createRestoreCommand() *cobra.Command {
 
 			storageBackend, err := storage.NewBackend(ctx, storageConfig)
 			if err != nil {
-				return err
+				return backup.StorageError(err)
 			}
 
 			client, err := backup.NewClientWithStorage(ctx, storageBackend, verbose && !quiet)
@@ -213,49 +952,147 @@ func createRestoreCommand() *cobra.Command {
 				return err
 			}
 			client.SetQuiet(quiet)
+			client.SetContextLines(contextLines)
+			client.SetHelperImage(helperImage)
+			client.SetNoPull(noPull)
+			if err := client.SetRateLimit(rateLimitBytes); err != nil {
+				return err
+			}
+			if err := client.SetStripComponents(stripComponents); err != nil {
+				return err
+			}
+
+			client.SetOnlyVolume(onlyVolume)
+			client.SetBackupBeforeRestore(backupBeforeRestore)
+			client.SetVerifyAfterRestore(verifyAfterRestore)
+			if dryRunLimit < 0 {
+				return fmt.Errorf("--dry-run-limit cannot be negative")
+			}
+			client.SetDryRunLimit(dryRunLimit)
+			client.SetCreateVolume(createVolume, copyDriver)
 
 			// Validate required flags
 			if snapshotName == "" {
 				return fmt.Errorf("--snapshot is required to specify which backup to restore")
 			}
-			if targetVolume == "" {
+			if len(targetVolumes) == 0 {
 				return fmt.Errorf("--target-volume is required to specify which volume to restore to")
 			}
+			mappings, err := parseVolumeMappings(targetVolumes)
+			if err != nil {
+				return err
+			}
+			if mappings != nil && onlyVolume != "" {
+				return fmt.Errorf("--only-volume cannot be combined with --target-volume <volume>=<target> mappings")
+			}
+			if mappings != nil && verifyAfterRestore {
+				return fmt.Errorf("--verify-after cannot be combined with --target-volume <volume>=<target> mappings")
+			}
 
-			// Build versioned snapshot name if version is specified
+			// Resolve the version selector to a versioned snapshot name
 			finalSnapshotName := snapshotName
 			if versionFlag != "" {
-				finalSnapshotName = fmt.Sprintf("%s@%s", snapshotName, versionFlag)
+				finalSnapshotName, err = client.ResolveVersion(snapshotName, versionFlag)
+				if err != nil {
+					return err
+				}
 			}
 
 			// Set password for decryption if provided
 			if password != "" {
 				client.SetEncryption(true, password)
 			}
+			if err := applyKeyfile(client); err != nil {
+				return err
+			}
+
+			if err := configureRestartHealthCheck(client); err != nil {
+				return err
+			}
+
+			// Restore the mapped volumes of a multi-volume snapshot
+			if mappings != nil {
+				targets := make([]string, len(mappings))
+				for i, mapping := range mappings {
+					targets[i] = mapping.Target
+				}
+				err = client.RestoreVolumesWithContainers(mappings, finalSnapshotName, dryRun, force, stopContainers)
+				if !dryRun {
+					recordContainerHistory("restore", finalSnapshotName, strings.Join(targets, ","), storageType, client.ContainerResults(), err)
+				}
+				return err
+			}
 
 			// Direct volume restore
-			return client.RestoreDirectVolumeWithContainers(targetVolume, finalSnapshotName, dryRun, force, stopContainers)
+			targetVolume := targetVolumes[0]
+			err = client.RestoreDirectVolumeWithContainers(targetVolume, finalSnapshotName, dryRun, force, stopContainers)
+			if !dryRun {
+				recordContainerHistory("restore", finalSnapshotName, targetVolume, storageType, client.ContainerResults(), err)
+			}
+			return err
 		},
 	}
 
 	cmd.Flags().StringVarP(&snapshotName, "snapshot", "s", "", "Name of the volume backup to restore")
-	cmd.Flags().StringVar(&versionFlag, "version", "", "Specific version to restore (format: YYYYMMDD-HHMMSS)")
-	cmd.Flags().StringVar(&targetVolume, "target-volume", "", "Target volume name")
+	cmd.Flags().StringVar(&versionFlag, "version", "", "Version to restore: YYYYMMDD-HHMMSS, latest, previous or ~N (N versions before latest)")
+	cmd.Flags().StringSliceVar(&targetVolumes, "target-volume", []string{}, "Target volume name, or <volume>=<target> (repeatable) to restore volumes of a multi-volume snapshot")
 	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be restored without making changes")
+	cmd.Flags().IntVar(&dryRunLimit, "dry-run-limit", backup.DefaultDryRunLimit, "Number of added, changed and removed files a dry run lists of each (0 lists all)")
 	cmd.Flags().BoolVar(&force, "force", false, "Skip confirmation prompts")
-	cmd.Flags().StringSliceVar(&stopContainers, "stop-containers", []string{}, "Container names/IDs to stop during restore (comma-separated)")
+	cmd.Flags().StringSliceVar(&stopContainers, "stop-containers", []string{}, "Container names/IDs to stop during restore, in stop order; restarted in reverse (comma-separated)")
+	cmd.Flags().DurationVar(&waitHealthy, "wait-healthy", 0, "After restarting stopped containers, wait up to this long for them to become healthy (e.g. 60s)")
+	cmd.Flags().IntVar(&retryFailedRestart, "retry-failed-restart", 0, "Restart a container up to this many more times if it does not become healthy (requires --wait-healthy)")
+	cmd.Flags().BoolVar(&noRestart, "no-restart", false, "Leave the stopped containers stopped afterwards instead of restarting them")
+	cmd.Flags().DurationVar(&stopTimeout, "stop-timeout", 30*time.Second, "How long a stopped container is given to exit after SIGTERM before it is killed")
+	cmd.Flags().BoolVar(&forceStop, "force-stop", false, "Kill a container with SIGKILL if stopping it fails or it is still running after --stop-timeout")
 	cmd.Flags().StringVar(&password, "password", "", "Password for decryption (will prompt if encrypted and not provided)")
+	cmd.Flags().StringVar(&keyfile, "keyfile", "", "Keyfile to decrypt a backup encrypted with --keyfile")
+	cmd.Flags().StringVar(&fromFile, "from-file", "", "Restore from a local backup archive instead of the storage backend")
+	cmd.Flags().StringVar(&onlyVolume, "only-volume", "", "Restore only this volume from a multi-volume snapshot")
+	cmd.Flags().IntVar(&stripComponents, "strip-components", 0, "Remove N leading path components from backup entries on extraction")
+	cmd.Flags().BoolVar(&backupBeforeRestore, "backup-before-restore", false, "Back up the target volume's current contents to <snapshot>-pre-restore before overwriting them")
+	cmd.Flags().BoolVar(&createVolume, "create-volume", false, "Create the target volume if it does not exist")
+	cmd.Flags().BoolVar(&copyDriver, "copy-driver", false, "Create the target volume with the driver of the backed up volume instead of local (requires --create-volume)")
+	cmd.Flags().BoolVar(&verifyAfterRestore, "verify-after", false, "Compare the checksums of the restored files with the manifest captured at backup time")
 
 	return cmd
 }
 
-func createListCommand() *cobra.Command {
-	return &cobra.Command{
-		Use:   "list",
-		Short: "List available backups",
-		Long:  "List all backup files in the configured storage backend",
+// parseVolumeMappings parses --target-volume values of the form <volume>=<target>. It returns
+// nil when a single plain volume name is given.
+func parseVolumeMappings(values []string) ([]backup.VolumeMapping, error) {
+	if len(values) == 1 && !strings.Contains(values[0], "=") {
+		return nil, nil
+	}
+
+	mappings := make([]backup.VolumeMapping, 0, len(values))
+	for _, value := range values {
+		source, target, ok := strings.Cut(value, "=")
+		if !ok || source == "" || target == "" {
+			return nil, fmt.Errorf("invalid --target-volume %q: use <volume>=<target> when restoring several volumes", value)
+		}
+		mappings = append(mappings, backup.VolumeMapping{Source: source, Target: target})
+	}
+	return mappings, nil
+}
+
+func createRestoreFileCommand() *cobra.Command {
+	var entryPath string
+
+	cmd := &cobra.Command{
+		Use:   "restore-file <snapshot-name[@version]>",
+		Short: "Extract a single file or directory from a volume backup",
+		Long:  "Stream a volume backup and extract one file, or every file below a directory given with a trailing slash, to the local filesystem. No volume or container is touched.",
+		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := context.Background()
+			ctx := cmd.Context()
+
+			if entryPath == "" {
+				return fmt.Errorf("--path is required to specify which file to extract")
+			}
+			if outputPath == "" {
+				return fmt.Errorf("--output is required to specify where to write the extracted file")
+			}
 
 			storageConfig, err := buildStorageConfig()
 			if err != nil {
@@ -264,7 +1101,7 @@ func createListCommand() *cobra.Command {
 
 			storageBackend, err := storage.NewBackend(ctx, storageConfig)
 			if err != nil {
-				return err
+				return backup.StorageError(err)
 			}
 
 			client, err := backup.NewClientWithStorage(ctx, storageBackend, verbose && !quiet)
@@ -272,21 +1109,49 @@ func createListCommand() *cobra.Command {
 				return err
 			}
 			client.SetQuiet(quiet)
+			client.SetContextLines(contextLines)
+			client.SetHelperImage(helperImage)
+			client.SetNoPull(noPull)
+			if err := client.SetRateLimit(rateLimitBytes); err != nil {
+				return err
+			}
+			client.SetOnlyVolume(onlyVolume)
 
-			// List snapshots
-			return client.ListSnapshots()
+			if password != "" {
+				client.SetEncryption(true, password)
+			}
+			if err := applyKeyfile(client); err != nil {
+				return err
+			}
+
+			return client.ExtractPath(args[0], entryPath, outputPath, force)
 		},
 	}
+
+	cmd.Flags().StringVar(&entryPath, "path", "", "Path inside the volume to extract (e.g. app/config.yaml); end with / to extract a directory")
+	cmd.Flags().StringVarP(&outputPath, "output", "o", "", "Local file (or directory for a --path ending in /) to write to")
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite existing local files")
+	cmd.Flags().StringVar(&onlyVolume, "only-volume", "", "Volume to extract from in a multi-volume snapshot")
+	cmd.Flags().StringVar(&password, "password", "", "Password for decryption (will prompt if encrypted and not provided)")
+	cmd.Flags().StringVar(&keyfile, "keyfile", "", "Keyfile to decrypt a backup encrypted with --keyfile")
+
+	return cmd
 }
 
-func createInfoCommand() *cobra.Command {
-	return &cobra.Command{
-		Use:   "info <snapshot-name>",
-		Short: "Show detailed information about a volume backup",
-		Long:  "Display detailed information about a volume backup including metadata and versions",
+func createTestRestoreCommand() *cobra.Command {
+	var opts backup.TestRestoreOptions
+
+	cmd := &cobra.Command{
+		Use:   "test-restore <snapshot-name[@version]>",
+		Short: "Restore a snapshot into a throwaway volume to prove it is restorable",
+		Long:  "Restore a snapshot into a temporary volume, optionally run --validate-cmd against the restored data (mounted at /data), report the result and remove the volume again. No existing volume or container is touched.",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := context.Background()
+			ctx := cmd.Context()
+
+			if opts.ValidateTimeout < 0 {
+				return fmt.Errorf("--validate-timeout must not be negative")
+			}
 
 			storageConfig, err := buildStorageConfig()
 			if err != nil {
@@ -295,7 +1160,7 @@ func createInfoCommand() *cobra.Command {
 
 			storageBackend, err := storage.NewBackend(ctx, storageConfig)
 			if err != nil {
-				return err
+				return backup.StorageError(err)
 			}
 
 			client, err := backup.NewClientWithStorage(ctx, storageBackend, verbose && !quiet)
@@ -303,23 +1168,172 @@ func createInfoCommand() *cobra.Command {
 				return err
 			}
 			client.SetQuiet(quiet)
+			client.SetContextLines(contextLines)
+			client.SetHelperImage(helperImage)
+			client.SetNoPull(noPull)
+			if err := client.SetRateLimit(rateLimitBytes); err != nil {
+				return err
+			}
 
-			snapshotName := args[0]
+			if password != "" {
+				client.SetEncryption(true, password)
+			}
+			if err := applyKeyfile(client); err != nil {
+				return err
+			}
 
-			// Get snapshot info
-			return client.GetSnapshotInfo(snapshotName)
+			err = client.TestRestore(args[0], opts)
+			recordHistory("test-restore", args[0], "", storageType, err)
+			return err
 		},
 	}
-}
 
-func createRepositoryCommand() *cobra.Command {
+	cmd.Flags().StringVar(&opts.ValidateCmd, "validate-cmd", "", "Shell command run against the restored data mounted at /data; a non-zero exit fails the test")
+	cmd.Flags().StringVar(&opts.ValidateImage, "validate-image", "alpine:latest", "Image the validation command runs in")
+	cmd.Flags().DurationVar(&opts.ValidateTimeout, "validate-timeout", 10*time.Minute, "Fail the test if the validation command runs longer than this (0 for no limit)")
+	cmd.Flags().BoolVar(&opts.KeepVolume, "keep-volume", false, "Keep the restored volume for inspection instead of removing it")
+	cmd.Flags().StringVar(&password, "password", "", "Password for decryption (will prompt if encrypted and not provided)")
+	cmd.Flags().StringVar(&keyfile, "keyfile", "", "Keyfile to decrypt a backup encrypted with --keyfile")
+
+	return cmd
+}
+
+func createListCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List available backups",
+		Long:  "List all backup files in the configured storage backend",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			storageConfig, err := buildStorageConfig()
+			if err != nil {
+				return err
+			}
+
+			storageBackend, err := storage.NewBackend(ctx, storageConfig)
+			if err != nil {
+				return backup.StorageError(err)
+			}
+
+			client, err := backup.NewClientWithStorage(ctx, storageBackend, verbose && !quiet)
+			if err != nil {
+				return err
+			}
+			client.SetQuiet(quiet)
+			if password != "" {
+				client.SetEncryption(false, password)
+			}
+
+			var filters []backup.SnapshotFilter
+			for _, expr := range listFilters {
+				filter, err := backup.ParseSnapshotFilter(expr)
+				if err != nil {
+					return fmt.Errorf("invalid --filter: %w", err)
+				}
+				filters = append(filters, filter)
+			}
+			client.SetSnapshotFilters(filters)
+
+			var since, until time.Time
+			if listSince != "" {
+				if since, err = parseListTime(listSince); err != nil {
+					return fmt.Errorf("invalid --since value: %w", err)
+				}
+			}
+			if listUntil != "" {
+				if until, err = parseListTime(listUntil); err != nil {
+					return fmt.Errorf("invalid --until value: %w", err)
+				}
+			}
+			if !since.IsZero() && !until.IsZero() && !since.Before(until) {
+				return fmt.Errorf("--since must be before --until")
+			}
+			client.SetTimeWindow(since, until)
+
+			if outputFormat != "table" {
+				snapshots, err := client.Snapshots()
+				if err != nil {
+					return err
+				}
+				_, err = writeStructured(outputFormat, snapshots)
+				return err
+			}
+
+			// List snapshots
+			if listTree {
+				return client.ListSnapshotTree()
+			}
+			return client.ListSnapshots()
+		},
+	}
+
+	cmd.Flags().BoolVar(&listTree, "tree", false, "Show the versions of each backup as a tree")
+	cmd.Flags().StringVar(&password, "password", "", "Password to show backups with encrypted metadata")
+	cmd.Flags().StringArrayVar(&listFilters, "filter", nil, "Only list backups matching a filter, e.g. tag=env:prod or tag=env (repeatable, all must match)")
+	cmd.Flags().StringVar(&listSince, "since", "", "Only count versions created at or after this date, timestamp or time ago (e.g. 2024-01-01 or 7d)")
+	cmd.Flags().StringVar(&listUntil, "until", "", "Only count versions created before this date, timestamp or time ago (e.g. 2024-02-01 or 24h)")
+
+	return cmd
+}
+
+func createInfoCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "info <snapshot-name>",
+		Short: "Show detailed information about a volume backup",
+		Long:  "Display detailed information about a volume backup including metadata and versions",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			storageConfig, err := buildStorageConfig()
+			if err != nil {
+				return err
+			}
+
+			storageBackend, err := storage.NewBackend(ctx, storageConfig)
+			if err != nil {
+				return backup.StorageError(err)
+			}
+
+			client, err := backup.NewClientWithStorage(ctx, storageBackend, verbose && !quiet)
+			if err != nil {
+				return err
+			}
+			client.SetQuiet(quiet)
+			if password != "" {
+				client.SetEncryption(false, password)
+			}
+
+			snapshotName := args[0]
+
+			if outputFormat != "table" {
+				metadata, err := client.SnapshotMetadata(snapshotName)
+				if err != nil {
+					return err
+				}
+				_, err = writeStructured(outputFormat, metadata)
+				return err
+			}
+
+			// Get snapshot info
+			return client.GetSnapshotInfo(snapshotName)
+		},
+	}
+
+	cmd.Flags().StringVar(&password, "password", "", "Password to show backups with encrypted metadata")
+
+	return cmd
+}
+
+func createRepositoryCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "snapshots",
 		Short: "Manage volume snapshots",
 		Long:  "List and manage volume snapshots in the repository",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Default to listing snapshots
-			ctx := context.Background()
+			ctx := cmd.Context()
 
 			storageConfig, err := buildStorageConfig()
 			if err != nil {
@@ -328,7 +1342,7 @@ func createRepositoryCommand() *cobra.Command {
 
 			storageBackend, err := storage.NewBackend(ctx, storageConfig)
 			if err != nil {
-				return err
+				return backup.StorageError(err)
 			}
 
 			client, err := backup.NewClientWithStorage(ctx, storageBackend, verbose && !quiet)
@@ -341,9 +1355,146 @@ func createRepositoryCommand() *cobra.Command {
 		},
 	}
 
+	cmd.AddCommand(createHistoryCommand())
+
+	return cmd
+}
+
+func createHistoryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history <container-name>",
+		Short: "List repository backups added since a version or time",
+		Long:  "List the backup references of a container in the repository that were created after a given version or timestamp",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			var since time.Time
+			if sinceTime != "" {
+				parsed, err := parseTimeFlag(sinceTime)
+				if err != nil {
+					return fmt.Errorf("invalid --since value: %w", err)
+				}
+				since = parsed
+			}
+			if sinceVersion < 0 {
+				return fmt.Errorf("--since-version must not be negative")
+			}
+
+			storageConfig, err := buildStorageConfig()
+			if err != nil {
+				return err
+			}
+
+			repositoryBackend, err := storage.NewRepositoryBackend(ctx, storageConfig)
+			if err != nil {
+				return err
+			}
+
+			client, err := backup.NewClientWithStorage(ctx, repositoryBackend, verbose && !quiet)
+			if err != nil {
+				return err
+			}
+			client.SetQuiet(quiet)
+
+			return client.ListRepositoryHistory(args[0], sinceVersion, since)
+		},
+	}
+
+	cmd.Flags().IntVar(&sinceVersion, "since-version", 0, "Only list backups with a version greater than this")
+	cmd.Flags().StringVar(&sinceTime, "since", "", "Only list backups created after this time (RFC3339 or YYYY-MM-DD)")
+
 	return cmd
 }
 
+// envReference matches ${VAR} references in flag values
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// parseRateLimit parses a --rate-limit value such as 10MB/s or 512KB into bytes per second.
+// An empty value means unlimited.
+func parseRateLimit(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	bytesPerSecond, err := units.RAMInBytes(strings.TrimSuffix(strings.TrimSpace(value), "/s"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid --rate-limit value %q: %w", value, err)
+	}
+	if bytesPerSecond < backup.MinRateLimit {
+		return 0, fmt.Errorf("invalid --rate-limit value %q: must be at least 1KB/s", value)
+	}
+	return bytesPerSecond, nil
+}
+
+// parseTags parses key=value --tag values
+func parseTags(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	parsed := make(map[string]string, len(values))
+	for _, value := range values {
+		key, tagValue, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --tag value %q: expected key=value", value)
+		}
+		if strings.Contains(key, ":") {
+			return nil, fmt.Errorf("invalid --tag value %q: the key cannot contain ':'", value)
+		}
+		parsed[key] = tagValue
+	}
+	return parsed, nil
+}
+
+// expandFlagEnv expands ${VAR} references in the flags that support it. Referencing an
+// unset variable is an error rather than silently expanding to an empty string.
+func expandFlagEnv() error {
+	flags := []struct {
+		name  string
+		value *string
+	}{
+		{"--name", &snapshotName},
+		{"--output", &outputPath},
+		{"--backup-dir", &backupDir},
+	}
+
+	for _, flag := range flags {
+		var missing []string
+		*flag.value = envReference.ReplaceAllStringFunc(*flag.value, func(ref string) string {
+			name := envReference.FindStringSubmatch(ref)[1]
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				missing = append(missing, name)
+			}
+			return value
+		})
+		if len(missing) > 0 {
+			return fmt.Errorf("environment variable(s) %s referenced in %s are not set", strings.Join(missing, ", "), flag.name)
+		}
+	}
+
+	return nil
+}
+
+// parseTimeFlag parses an RFC3339 timestamp or a plain date
+func parseTimeFlag(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+// parseListTime parses an RFC3339 timestamp, a plain date or a duration before now such as 7d
+func parseListTime(value string) (time.Time, error) {
+	if duration, err := parseRetentionDuration(value); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+	t, err := parseTimeFlag(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected a date (2024-01-01), an RFC3339 timestamp or a duration such as 7d or 12h")
+	}
+	return t, nil
+}
+
 func createVersionsCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "versions <snapshot-name>",
@@ -351,7 +1502,7 @@ func createVersionsCommand() *cobra.Command {
 		Long:  "List all versions of a volume backup with timestamps and sizes",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := context.Background()
+			ctx := cmd.Context()
 
 			storageConfig, err := buildStorageConfig()
 			if err != nil {
@@ -360,7 +1511,7 @@ func createVersionsCommand() *cobra.Command {
 
 			storageBackend, err := storage.NewBackend(ctx, storageConfig)
 			if err != nil {
-				return err
+				return backup.StorageError(err)
 			}
 
 			client, err := backup.NewClientWithStorage(ctx, storageBackend, verbose && !quiet)
@@ -368,12 +1519,27 @@ func createVersionsCommand() *cobra.Command {
 				return err
 			}
 			client.SetQuiet(quiet)
+			if password != "" {
+				client.SetEncryption(false, password)
+			}
 
 			snapshotName := args[0]
+
+			if outputFormat != "table" {
+				versions, err := client.SnapshotVersions(snapshotName)
+				if err != nil {
+					return err
+				}
+				_, err = writeStructured(outputFormat, versions)
+				return err
+			}
+
 			return client.ListSnapshotVersions(snapshotName)
 		},
 	}
 
+	cmd.Flags().StringVar(&password, "password", "", "Password to show backups with encrypted metadata")
+
 	return cmd
 }
 
@@ -384,7 +1550,7 @@ func createDeleteCommand() *cobra.Command {
 		Long:  "Delete all versions of a volume backup or a specific version if --version is specified",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := context.Background()
+			ctx := cmd.Context()
 
 			storageConfig, err := buildStorageConfig()
 			if err != nil {
@@ -393,7 +1559,7 @@ func createDeleteCommand() *cobra.Command {
 
 			storageBackend, err := storage.NewBackend(ctx, storageConfig)
 			if err != nil {
-				return err
+				return backup.StorageError(err)
 			}
 
 			client, err := backup.NewClientWithStorage(ctx, storageBackend, verbose && !quiet)
@@ -404,37 +1570,1136 @@ func createDeleteCommand() *cobra.Command {
 
 			snapshotName := args[0]
 
-			// Build versioned snapshot name if version is specified
+			// Resolve the version selector to a versioned snapshot name
 			finalSnapshotName := snapshotName
 			if versionFlag != "" {
-				finalSnapshotName = fmt.Sprintf("%s@%s", snapshotName, versionFlag)
+				finalSnapshotName, err = client.ResolveVersion(snapshotName, versionFlag)
+				if err != nil {
+					return err
+				}
 			}
 
-			return client.DeleteSnapshot(finalSnapshotName, force)
+			err = client.DeleteSnapshot(finalSnapshotName, force)
+			recordHistory("delete", finalSnapshotName, "", storageType, err)
+			return err
 		},
 	}
 
-	cmd.Flags().StringVar(&versionFlag, "version", "", "Specific version to delete (format: YYYYMMDD-HHMMSS)")
+	cmd.Flags().StringVar(&versionFlag, "version", "", "Version to delete: YYYYMMDD-HHMMSS, latest, previous or ~N (N versions before latest)")
 	cmd.Flags().BoolVar(&force, "force", false, "Skip confirmation prompts")
 
 	return cmd
 }
 
-func createVolumesCommand() *cobra.Command {
+func createRenameCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "volumes",
-		Short: "List all Docker volumes",
-		Long:  "List all Docker volumes available on the system",
-		Args:  cobra.NoArgs,
+		Use:   "rename <old-name> <new-name>",
+		Short: "Rename a snapshot and all of its versions",
+		Long:  "Move every version of a snapshot to a new name, keeping its version timestamps. Versions are copied within the storage backend instead of being downloaded and uploaded again.",
+		Args:  cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// We don't need storage backend for listing Docker volumes
-			client, err := backup.NewClient("", verbose && !quiet)
+			ctx := cmd.Context()
+
+			storageConfig, err := buildStorageConfig()
+			if err != nil {
+				return err
+			}
+
+			storageBackend, err := storage.NewBackend(ctx, storageConfig)
+			if err != nil {
+				return backup.StorageError(err)
+			}
+
+			client, err := backup.NewClientWithStorage(ctx, storageBackend, verbose && !quiet)
 			if err != nil {
 				return err
 			}
 			client.SetQuiet(quiet)
+			if password != "" {
+				client.SetEncryption(false, password)
+			}
 
-			return client.ListDockerVolumes()
+			err = client.RenameSnapshot(args[0], args[1])
+			recordHistory("rename", args[0], args[1], storageType, err)
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&password, "password", "", "Password to rename backups with encrypted metadata")
+
+	return cmd
+}
+
+func createPruneCommand() *cobra.Command {
+	var (
+		pruneKeepLast   int
+		pruneKeepWithin string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "prune [snapshot-name]",
+		Short: "Delete old snapshot versions or run repository maintenance",
+		Long:  "Delete the versions of a snapshot not kept by --keep-last or --keep-within, or with --index compact the repository index by removing the references of deleted backups.",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			if pruneIndex {
+				if len(args) > 0 {
+					return fmt.Errorf("--index cannot be combined with a snapshot name")
+				}
+
+				storageConfig, err := buildStorageConfig()
+				if err != nil {
+					return err
+				}
+
+				repositoryBackend, err := storage.NewRepositoryBackend(ctx, storageConfig)
+				if err != nil {
+					return err
+				}
+
+				client, err := backup.NewClientWithStorage(ctx, repositoryBackend, verbose && !quiet)
+				if err != nil {
+					return err
+				}
+				client.SetQuiet(quiet)
+
+				return client.CompactRepositoryIndex()
+			}
+
+			if len(args) == 0 {
+				return fmt.Errorf("nothing to prune: give a snapshot name with --keep-last/--keep-within, or use --index to compact the repository index")
+			}
+			if pruneKeepLast < 0 {
+				return fmt.Errorf("--keep-last must not be negative")
+			}
+			policy := backup.RetentionPolicy{KeepLast: pruneKeepLast}
+			if pruneKeepWithin != "" {
+				within, err := parseRetentionDuration(pruneKeepWithin)
+				if err != nil {
+					return fmt.Errorf("invalid --keep-within value %q: %w", pruneKeepWithin, err)
+				}
+				policy.KeepWithin = within
+			}
+			if policy.IsZero() {
+				return fmt.Errorf("--keep-last or --keep-within is required to select the versions to keep")
+			}
+
+			storageConfig, err := buildStorageConfig()
+			if err != nil {
+				return err
+			}
+
+			storageBackend, err := storage.NewBackend(ctx, storageConfig)
+			if err != nil {
+				return backup.StorageError(err)
+			}
+
+			client, err := backup.NewClientWithStorage(ctx, storageBackend, verbose && !quiet)
+			if err != nil {
+				return err
+			}
+			client.SetQuiet(quiet)
+
+			return client.PruneSnapshot(args[0], policy, dryRun, force)
+		},
+	}
+
+	cmd.Flags().BoolVar(&pruneIndex, "index", false, "Compact the repository index by removing deleted backup references")
+	cmd.Flags().IntVar(&pruneKeepLast, "keep-last", 0, "Keep the newest N versions of the snapshot")
+	cmd.Flags().StringVar(&pruneKeepWithin, "keep-within", "", "Keep the versions created within this duration (e.g. 30d, 12h)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show which versions would be deleted without deleting them")
+	cmd.Flags().BoolVar(&force, "force", false, "Skip the confirmation prompt")
+
+	return cmd
+}
+
+// parseRetentionDuration parses a duration that may also be given in whole days (e.g. 30d)
+func parseRetentionDuration(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("expected a number of days such as 30d")
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("duration must not be negative")
+	}
+	return duration, nil
+}
+
+func createShareCommand() *cobra.Command {
+	var shareExpires string
+
+	cmd := &cobra.Command{
+		Use:   "share <snapshot-name[@version]>",
+		Short: "Print a signed URL to download a backup without credentials",
+		Long:  "Sign a URL granting time-limited read access to the data of a snapshot version stored in S3 or GCS, so it can be downloaded without storage credentials. Without a version, the latest version is shared.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			expiry, err := parseRetentionDuration(shareExpires)
+			if err != nil {
+				return fmt.Errorf("invalid --expires value: %w", err)
+			}
+
+			storageConfig, err := buildStorageConfig()
+			if err != nil {
+				return err
+			}
+
+			storageBackend, err := storage.NewBackend(ctx, storageConfig)
+			if err != nil {
+				return backup.StorageError(err)
+			}
+
+			client, err := backup.NewClientWithStorage(ctx, storageBackend, verbose && !quiet)
+			if err != nil {
+				return err
+			}
+			client.SetQuiet(quiet)
+			if password != "" {
+				client.SetEncryption(false, password)
+			}
+
+			snapshotName := args[0]
+			if versionFlag != "" {
+				snapshotName, err = client.ResolveVersion(snapshotName, versionFlag)
+				if err != nil {
+					return err
+				}
+			}
+
+			return client.ShareSnapshot(snapshotName, expiry)
+		},
+	}
+
+	cmd.Flags().StringVar(&shareExpires, "expires", "24h", "How long the URL stays valid (e.g. 24h or 7d, at most 7d)")
+	cmd.Flags().StringVar(&versionFlag, "version", "", "Version to share: YYYYMMDD-HHMMSS, latest, previous or ~N (N versions before latest)")
+	cmd.Flags().StringVar(&password, "password", "", "Password to share backups with encrypted metadata")
+
+	return cmd
+}
+
+func createMetadataCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "metadata <snapshot-name[@version]>",
+		Short: "Print the raw stored metadata of a snapshot",
+		Long:  "Print the metadata object stored for a snapshot version exactly as written, without downloading the backup data. Without a version, the latest version is used.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			storageConfig, err := buildStorageConfig()
+			if err != nil {
+				return err
+			}
+
+			storageBackend, err := storage.NewBackend(ctx, storageConfig)
+			if err != nil {
+				return backup.StorageError(err)
+			}
+
+			client, err := backup.NewClientWithStorage(ctx, storageBackend, verbose && !quiet)
+			if err != nil {
+				return err
+			}
+			client.SetQuiet(quiet)
+
+			return client.DumpMetadata(args[0])
+		},
+	}
+
+	return cmd
+}
+
+// Exit codes of the exists command
+const (
+	existsExitMissing = 1
+	existsExitError   = 2
+)
+
+func createExistsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "exists <snapshot-name[@version]>",
+		Short: "Check whether a snapshot exists",
+		Long:  "Check whether a snapshot (any version) or a specific snapshot version exists, without listing the whole storage. Exits 0 if it exists, 1 if it does not and 2 if the check failed. Nothing is printed unless --verbose is set.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			storageConfig, err := buildStorageConfig()
+			if err != nil {
+				return err
+			}
+
+			storageBackend, err := storage.NewBackend(ctx, storageConfig)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(existsExitError)
+			}
+
+			exists, err := storage.NewSnapshotStorage(storageBackend).SnapshotExists(ctx, args[0])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: failed to check snapshot: %v\n", err)
+				os.Exit(existsExitError)
+			}
+
+			if verbose && !quiet {
+				if exists {
+					fmt.Printf("%s exists\n", args[0])
+				} else {
+					fmt.Printf("%s does not exist\n", args[0])
+				}
+			}
+			if !exists {
+				os.Exit(existsExitMissing)
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func createNormalizeNameCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "normalize-name <snapshot-name>",
+		Short: "Show the name a snapshot name is stored under",
+		Long:  "Print the name a backup with the given --name would be stored under. Slashes and backslashes become '-' and .tar.gz/.zip extensions are dropped; the changes are explained on stderr.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			stored := storage.NormalizeSnapshotName(name)
+
+			fmt.Println(stored)
+			if stored != name && !quiet {
+				fmt.Fprintf(os.Stderr, "'%s' is stored as '%s'\n", name, stored)
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func createRepairCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "repair <snapshot-name@version>",
+		Short: "Regenerate corrupted snapshot metadata",
+		Long:  "Regenerate minimal metadata for a snapshot version from its data object (size, name, version and creation time), recovering backups whose metadata is corrupted",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			storageConfig, err := buildStorageConfig()
+			if err != nil {
+				return err
+			}
+
+			storageBackend, err := storage.NewBackend(ctx, storageConfig)
+			if err != nil {
+				return backup.StorageError(err)
+			}
+
+			client, err := backup.NewClientWithStorage(ctx, storageBackend, verbose && !quiet)
+			if err != nil {
+				return err
+			}
+			client.SetQuiet(quiet)
+
+			return client.RepairSnapshot(args[0], overwriteMetadata)
+		},
+	}
+
+	cmd.Flags().BoolVar(&overwriteMetadata, "overwrite-metadata", false, "Regenerate metadata even if the existing metadata is readable")
+
+	return cmd
+}
+
+func createVerifyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify --all-backends",
+		Short: "Verify snapshot copies across storage backends",
+		Long:  "Check that every snapshot exists in all configured storage backends (local, plus S3 and GCS when their buckets are set) and that the recorded sizes and checksums of the copies agree",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !allBackends {
+				return fmt.Errorf("nothing to verify: use --all-backends to compare snapshots across backends")
+			}
+
+			types := configuredStorageTypes()
+			if len(types) < 2 {
+				return fmt.Errorf("--all-backends requires at least two configured backends (set --s3-bucket and/or --gcs-bucket)")
+			}
+
+			ctx := cmd.Context()
+
+			var targets []backup.BackendTarget
+			for _, backendType := range types {
+				storageConfig, err := buildStorageConfigFor(backendType)
+				if err != nil {
+					return err
+				}
+
+				storageBackend, err := storage.NewBackend(ctx, storageConfig)
+				if err != nil {
+					return backup.StorageError(fmt.Errorf("failed to create %s backend: %w", backendType, err))
+				}
+
+				targets = append(targets, backup.BackendTarget{Name: backendType, Backend: storageBackend})
+			}
+
+			client, err := backup.NewClientWithStorage(ctx, targets[0].Backend, verbose && !quiet)
+			if err != nil {
+				return err
+			}
+			client.SetQuiet(quiet)
+
+			return client.VerifyBackends(targets)
+		},
+	}
+
+	cmd.Flags().BoolVar(&allBackends, "all-backends", false, "Verify that all configured backends hold matching copies of every snapshot")
+
+	return cmd
+}
+
+func createSyncCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sync --from <backend> --to <backend>",
+		Short: "Copy missing snapshots from one storage backend to another",
+		Long:  "Copy the snapshot versions of the --from backend that the --to backend does not have yet, keeping their versioned IDs and metadata. Versions already in the destination are skipped, so repeated runs mirror the source.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if syncFrom == "" || syncTo == "" {
+				return fmt.Errorf("--from and --to are required to specify the backends to sync")
+			}
+			if syncFrom == syncTo {
+				return fmt.Errorf("--from and --to must be different backends")
+			}
+
+			ctx := cmd.Context()
+
+			var targets []backup.BackendTarget
+			for _, backendType := range []string{syncFrom, syncTo} {
+				storageConfig, err := buildStorageConfigFor(backendType)
+				if err != nil {
+					return err
+				}
+
+				storageBackend, err := storage.NewBackend(ctx, storageConfig)
+				if err != nil {
+					return backup.StorageError(fmt.Errorf("failed to create %s backend: %w", backendType, err))
+				}
+
+				targets = append(targets, backup.BackendTarget{Name: backendType, Backend: storageBackend})
+			}
+
+			client, err := backup.NewClientWithStorage(ctx, targets[0].Backend, verbose && !quiet)
+			if err != nil {
+				return err
+			}
+			client.SetQuiet(quiet)
+			if err := client.SetRateLimit(rateLimitBytes); err != nil {
+				return err
+			}
+
+			err = client.SyncBackends(targets[0], targets[1], dryRun)
+			if !dryRun {
+				recordHistory("sync", syncFrom+" -> "+syncTo, "", syncTo, err)
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&syncFrom, "from", "", "Backend to copy snapshots from (local, gcs, s3)")
+	cmd.Flags().StringVar(&syncTo, "to", "", "Backend to copy missing snapshots to (local, gcs, s3)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "List the snapshot versions that would be copied without copying them")
+
+	return cmd
+}
+
+func createImportLegacyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import-legacy <backup.zip>",
+		Short: "Import a legacy dockup zip backup",
+		Long:  "Import a .zip backup created by dockup by storing each embedded volume archive as a dvom snapshot. Backups with several volumes produce one snapshot per volume, named <name>-<volume>.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			storageConfig, err := buildStorageConfig()
+			if err != nil {
+				return err
+			}
+
+			storageBackend, err := storage.NewBackend(ctx, storageConfig)
+			if err != nil {
+				return backup.StorageError(err)
+			}
+
+			client, err := backup.NewClientWithStorage(ctx, storageBackend, verbose && !quiet)
+			if err != nil {
+				return err
+			}
+			client.SetQuiet(quiet)
+
+			if encrypt || password != "" {
+				client.SetEncryption(true, password)
+			}
+
+			err = client.ImportLegacyBackup(args[0], snapshotName)
+			recordHistory("import", args[0], "", storageType, err)
+			return err
+		},
+	}
+
+	cmd.Flags().StringVarP(&snapshotName, "name", "n", "", "Snapshot name (defaults to the container name recorded in the backup)")
+	cmd.Flags().BoolVar(&encrypt, "encrypt", false, "Encrypt the imported snapshots with AES-256")
+	cmd.Flags().StringVar(&password, "password", "", "Password for encryption (will prompt if not provided)")
+
+	return cmd
+}
+
+// historyFilePath returns the configured local history log path
+func historyFilePath() string {
+	if historyFile != "" {
+		return historyFile
+	}
+	return history.DefaultPath()
+}
+
+// applyKeyfile makes the client use the --keyfile key material instead of a password
+func applyKeyfile(client *backup.Client) error {
+	if keyfile == "" {
+		return nil
+	}
+	if password != "" {
+		return fmt.Errorf("--password and --keyfile cannot be used together")
+	}
+	if err := client.SetKeyfile(keyfile); err != nil {
+		return fmt.Errorf("invalid --keyfile: %w", err)
+	}
+	return nil
+}
+
+// configureBackupClient applies the backup flags shared by backup and backup-all to the client
+func configureBackupClient(client *backup.Client) error {
+	// Set encryption options
+	if encrypt || password != "" {
+		client.SetEncryption(true, password)
+	}
+	if keyfile != "" {
+		if kdf != crypto.KDF {
+			return fmt.Errorf("--kdf cannot be combined with --keyfile, which does not use a password")
+		}
+		client.SetEncryption(true, password)
+	}
+	if err := applyKeyfile(client); err != nil {
+		return err
+	}
+	if cryptoChunkSize != "" {
+		chunkSize, err := units.RAMInBytes(cryptoChunkSize)
+		if err != nil {
+			return fmt.Errorf("invalid --crypto-chunk-size value %q: %w", cryptoChunkSize, err)
+		}
+		if err := client.SetCryptoChunkSize(int(chunkSize)); err != nil {
+			return fmt.Errorf("invalid --crypto-chunk-size: %w", err)
+		}
+	}
+	if err := client.SetKDF(kdf); err != nil {
+		return fmt.Errorf("invalid --kdf: %w", err)
+	}
+	if encryptMetadata {
+		if !encrypt && password == "" && keyfile == "" {
+			return fmt.Errorf("--encrypt-metadata requires --encrypt")
+		}
+		client.SetMetadataEncryption(true)
+	}
+
+	if err := client.SetSnapshotStrategy(snapshotStrategy); err != nil {
+		return err
+	}
+	if err := client.SetCompression(compression); err != nil {
+		return fmt.Errorf("invalid --compression: %w", err)
+	}
+	if err := client.SetCompressionLevel(compressionLevel); err != nil {
+		return fmt.Errorf("invalid --compression-level: %w", err)
+	}
+	if streamBackup && (failOnEmpty || minSize != "" || skipIfUnchanged) {
+		return fmt.Errorf("--stream cannot be combined with --fail-on-empty, --min-size or --skip-if-unchanged, which inspect the archive before it is uploaded")
+	}
+	client.SetStream(streamBackup)
+	if err := client.SetExcludes(excludes); err != nil {
+		return err
+	}
+
+	backupTags, err := parseTags(tags)
+	if err != nil {
+		return err
+	}
+	client.SetTags(backupTags)
+
+	var minSizeBytes int64
+	if minSize != "" {
+		var err error
+		minSizeBytes, err = units.RAMInBytes(minSize)
+		if err != nil {
+			return fmt.Errorf("invalid --min-size value %q: %w", minSize, err)
+		}
+	}
+	client.SetEmptyGuard(failOnEmpty, minSizeBytes)
+	client.SetSkipIfUnchanged(skipIfUnchanged)
+	client.SetSkipUnmodified(sinceLastModified)
+	client.SetIncremental(incremental)
+	client.SetVerifyAfterBackup(verifyAfterBackup)
+	if deleteUnverified && !verifyChecksum && !verifyAfterBackup {
+		return fmt.Errorf("--delete-on-verify-failure requires --verify or --verify-after-backup")
+	}
+	client.SetVerifyChecksum(verifyChecksum, deleteUnverified)
+	if keepLast < 0 || keepWithin < 0 || maxVersions < 0 {
+		return fmt.Errorf("--keep-last, --keep-within and --max-versions must not be negative")
+	}
+	client.SetRetention(backup.RetentionPolicy{KeepLast: keepLast, KeepWithin: keepWithin, MaxVersions: maxVersions})
+	return configureRestartHealthCheck(client)
+}
+
+// configureRestartHealthCheck applies the container stop and restart flags to the client
+func configureRestartHealthCheck(client *backup.Client) error {
+	if retryFailedRestart > 0 && waitHealthy <= 0 {
+		return fmt.Errorf("--retry-failed-restart requires --wait-healthy")
+	}
+	if noRestart && waitHealthy > 0 {
+		return fmt.Errorf("--no-restart cannot be combined with --wait-healthy")
+	}
+	if stopTimeout <= 0 {
+		return fmt.Errorf("--stop-timeout must be positive")
+	}
+	client.SetStopBehavior(stopTimeout, forceStop)
+	client.SetNoRestart(noRestart)
+	client.SetRestartHealthCheck(waitHealthy, retryFailedRestart)
+	return nil
+}
+
+// recordHistory appends an operation to the local history log. Failing to record
+// only produces a warning so it never fails the operation itself.
+func recordHistory(operation, target, volume, storageName string, opErr error) {
+	recordContainerHistory(operation, target, volume, storageName, nil, opErr)
+}
+
+// recordContainerHistory appends an operation to the local history log together with the
+// containers that were stopped and restarted around it
+func recordContainerHistory(operation, target, volume, storageName string, containers []models.ContainerResult, opErr error) {
+	recordBackupHistory(operation, target, volume, storageName, containers, false, opErr)
+}
+
+// recordBackupHistory appends an operation to the local history log, recording a successful
+// backup that stored nothing because the volume was unchanged as such
+func recordBackupHistory(operation, target, volume, storageName string, containers []models.ContainerResult, unchanged bool, opErr error) {
+	entry := history.Entry{
+		Timestamp:  time.Now(),
+		Operation:  operation,
+		Target:     target,
+		Volume:     volume,
+		Storage:    storageName,
+		Result:     history.ResultSuccess,
+		Containers: containers,
+	}
+	if opErr != nil {
+		entry.Result = history.ResultFailure
+		entry.Error = opErr.Error()
+	} else if unchanged {
+		entry.Result = history.ResultUnchanged
+	}
+
+	if err := history.Append(historyFilePath(), entry); err != nil {
+		appLogger.Warnf("failed to record history: %v", err)
+	}
+}
+
+func createOperationHistoryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Show the operations performed on this host",
+		Long:  "Show the backups, restores and deletes performed by dvom on this host, read from the local history log. The log is kept separately from the storage backend and never leaves the host.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := history.Read(historyFilePath())
+			if err != nil {
+				return err
+			}
+
+			if entries == nil {
+				entries = []history.Entry{}
+			}
+			if written, err := writeStructured(outputFormat, entries); written || err != nil {
+				return err
+			}
+
+			if len(entries) == 0 {
+				fmt.Println("No operations recorded")
+				return nil
+			}
+
+			fmt.Printf("%-20s %-10s %-40s %-20s %-8s %s\n", "TIME", "OPERATION", "TARGET", "VOLUME", "STORAGE", "RESULT")
+			fmt.Printf("%-20s %-10s %-40s %-20s %-8s %s\n", strings.Repeat("-", 20), strings.Repeat("-", 10), strings.Repeat("-", 40), strings.Repeat("-", 20), strings.Repeat("-", 8), strings.Repeat("-", 10))
+
+			for _, entry := range entries {
+				volume := entry.Volume
+				if volume == "" {
+					volume = "-"
+				}
+				result := entry.Result
+				if entry.Error != "" {
+					result = fmt.Sprintf("%s: %s", entry.Result, strings.SplitN(entry.Error, "\n", 2)[0])
+				}
+
+				fmt.Printf("%-20s %-10s %-40s %-20s %-8s %s\n", entry.Timestamp.Local().Format("2006-01-02 15:04:05"), entry.Operation, entry.Target, volume, entry.Storage, result)
+			}
+
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func createVolumesCommand() *cobra.Command {
+	var usedBy string
+
+	cmd := &cobra.Command{
+		Use:   "volumes",
+		Short: "List all Docker volumes",
+		Long:  "List all Docker volumes available on the system, or with --used-by the containers using a volume",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// We don't need storage backend for listing Docker volumes
+			client, err := backup.NewClient(cmd.Context(), "", verbose && !quiet)
+			if err != nil {
+				return err
+			}
+			client.SetQuiet(quiet)
+
+			if usedBy != "" {
+				if outputFormat != "table" {
+					users, err := client.VolumeUsers(usedBy)
+					if err != nil {
+						return err
+					}
+					_, err = writeStructured(outputFormat, users)
+					return err
+				}
+				return client.ListVolumeUsers(usedBy)
+			}
+
+			if outputFormat != "table" {
+				volumes, err := client.DockerVolumes()
+				if err != nil {
+					return err
+				}
+				_, err = writeStructured(outputFormat, volumes)
+				return err
+			}
+
+			return client.ListDockerVolumes()
+		},
+	}
+
+	cmd.Flags().StringVar(&usedBy, "used-by", "", "List the containers using this volume and whether they are running")
+
+	return cmd
+}
+
+func createDuCommand() *cobra.Command {
+	var top int
+
+	cmd := &cobra.Command{
+		Use:   "du <volume>",
+		Short: "Show the size of a Docker volume",
+		Long:  "Estimate how large a backup of a live volume will be by measuring its total size and file count in a read-only helper container. No backup is created.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if top < 0 {
+				return fmt.Errorf("--top must not be negative")
+			}
+
+			// We don't need storage backend for measuring Docker volumes
+			client, err := backup.NewClient(cmd.Context(), "", verbose && !quiet)
+			if err != nil {
+				return err
+			}
+			client.SetQuiet(quiet)
+			client.SetContextLines(contextLines)
+			client.SetHelperImage(helperImage)
+			client.SetNoPull(noPull)
+			if err := client.SetRateLimit(rateLimitBytes); err != nil {
+				return err
+			}
+
+			usage, err := client.GetVolumeUsage(args[0], top)
+			if err != nil {
+				return err
+			}
+
+			if written, err := writeStructured(outputFormat, usage); written || err != nil {
+				return err
+			}
+
+			fmt.Printf("Volume: %s\n", usage.Volume)
+			fmt.Printf("Size: %.1f MB (%d bytes)\n", float64(usage.Size)/(1024*1024), usage.Size)
+			fmt.Printf("Files: %d\n", usage.FileCount)
+			if len(usage.Largest) > 0 {
+				fmt.Printf("\nLargest files:\n")
+				for _, file := range usage.Largest {
+					fmt.Printf("  %10.1f MB  %s\n", float64(file.Size)/(1024*1024), file.Path)
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&top, "top", 0, "Also list the N largest files")
+
+	return cmd
+}
+
+func createCleanupCommand() *cobra.Command {
+	var olderThan time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "cleanup",
+		Short: "Remove helper containers left behind by dvom",
+		Long:  "Force-remove the temporary helper containers dvom creates for backups and restores that were left behind, e.g. because dvom crashed or was killed. Helpers are recognised by their dvom=true label; the ones created within --older-than are kept, as they may belong to a dvom run still in progress.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if olderThan < 0 {
+				return fmt.Errorf("--older-than cannot be negative")
+			}
+
+			// We don't need storage backend for removing helper containers
+			client, err := backup.NewClient(cmd.Context(), "", verbose && !quiet)
+			if err != nil {
+				return err
+			}
+			client.SetQuiet(quiet)
+
+			return client.CleanupHelpers(olderThan, dryRun)
+		},
+	}
+
+	cmd.Flags().DurationVar(&olderThan, "older-than", backup.DefaultCleanupAge, "Only remove helper containers created longer ago than this (0 removes all of them)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "List the helper containers that would be removed without removing them")
+
+	return cmd
+}
+
+func createDaemonCommand() *cobra.Command {
+	var (
+		schedule      string
+		volume        string
+		autoStopUsers bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Run scheduled backups of a volume in the foreground",
+		Long:  "Stay in the foreground and back up a volume whenever the cron --schedule is due, logging each run. A run due while the previous one is still going is skipped, and a failed run does not stop the daemon. SIGHUP reloads the schedule from $DVOM_SCHEDULE or the config file; SIGINT or SIGTERM stops the daemon, ending a running backup cleanly.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			if schedule == "" {
+				return fmt.Errorf("--schedule is required, e.g. --schedule=\"0 2 * * *\"")
+			}
+			if _, err := backup.ParseSchedule(schedule); err != nil {
+				return err
+			}
+			if volume == "" {
+				return fmt.Errorf("--volume is required to specify which volume to backup")
+			}
+			if snapshotName == "" {
+				return fmt.Errorf("--name is required to name the volume backup")
+			}
+
+			storageConfig, err := buildStorageConfig()
+			if err != nil {
+				return err
+			}
+
+			storageBackend, err := storage.NewBackend(ctx, storageConfig)
+			if err != nil {
+				return backup.StorageError(err)
+			}
+
+			client, err := backup.NewClientWithStorage(ctx, storageBackend, verbose && !quiet)
+			if err != nil {
+				return err
+			}
+			client.SetQuiet(quiet)
+			client.SetContextLines(contextLines)
+			client.SetHelperImage(helperImage)
+			client.SetNoPull(noPull)
+			if err := client.SetRateLimit(rateLimitBytes); err != nil {
+				return err
+			}
+			if err := configureBackupClient(client); err != nil {
+				return err
+			}
+			client.SetAutoStopUsers(autoStopUsers)
+
+			hangup := make(chan os.Signal, 1)
+			signal.Notify(hangup, syscall.SIGHUP)
+			defer signal.Stop(hangup)
+			reload := make(chan struct{}, 1)
+			go func() {
+				for {
+					select {
+					case <-hangup:
+						select {
+						case reload <- struct{}{}:
+						default:
+						}
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+
+			appLogger.SetTimestamps(true)
+			return client.RunDaemon(backup.DaemonOptions{
+				Schedule:       schedule,
+				Volume:         volume,
+				Snapshot:       snapshotName,
+				StopContainers: stopContainers,
+				RunTimeout:     commandTimeout,
+				Reload:         reload,
+				ReloadSchedule: func() (string, error) {
+					return reloadSchedule(cmd.Flags())
+				},
+				OnRun: func(unchanged bool, err error) {
+					recordBackupHistory("backup", snapshotName, volume, storageType, client.ContainerResults(), unchanged, err)
+				},
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&schedule, "schedule", "", "Cron expression of when to back up (minute hour day-of-month month day-of-week, or @daily, @every 6h)")
+	cmd.Flags().StringVar(&volume, "volume", "", "Volume to back up")
+	cmd.Flags().StringVarP(&snapshotName, "name", "n", "", "Name the backups are stored under")
+	cmd.Flags().BoolVar(&autoStopUsers, "auto-stop-users", false, "Stop the running containers using the volume during each backup and restart them afterwards")
+	addBackupOptionFlags(cmd)
+
+	return cmd
+}
+
+// reloadSchedule returns the schedule the daemon should follow now. A schedule given on the
+// command line is kept; otherwise $DVOM_SCHEDULE and the config file are read again.
+func reloadSchedule(flags *pflag.FlagSet) (string, error) {
+	flag := flags.Lookup("schedule")
+	if flag.Changed && !configApplied["schedule"] {
+		appLogger.Warnf("the schedule was given with --schedule, reloading keeps it; set it in the config file to change it with SIGHUP")
+		return flag.Value.String(), nil
+	}
+
+	if value, ok := os.LookupEnv("DVOM_SCHEDULE"); ok {
+		return value, nil
+	}
+	profile, err := loadConfigProfile()
+	if err != nil {
+		return "", err
+	}
+	value, ok := profile["schedule"]
+	if !ok {
+		return "", fmt.Errorf("no schedule set in the config file")
+	}
+	return value, nil
+}
+
+// writeStructured writes v to stdout in a structured output format. It returns false for the
+// table format, which each command renders itself. YAML is converted from the JSON encoding so
+// both formats use the same field names and order.
+func writeStructured(format string, v interface{}) (bool, error) {
+	switch format {
+	case "table":
+		return false, nil
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return true, encoder.Encode(v)
+	case "yaml":
+		data, err := json.Marshal(v)
+		if err != nil {
+			return true, fmt.Errorf("failed to encode output: %w", err)
+		}
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return true, fmt.Errorf("failed to convert output to YAML: %w", err)
+		}
+		clearYAMLStyle(&node)
+
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(&node); err != nil {
+			return true, fmt.Errorf("failed to write YAML output: %w", err)
+		}
+		return true, encoder.Close()
+	default:
+		return false, fmt.Errorf("unsupported output format: %s (use table, json or yaml)", format)
+	}
+}
+
+// clearYAMLStyle resets the flow and quoting styles a node inherits from its JSON source, so it
+// is written as block-style YAML
+func clearYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		clearYAMLStyle(child)
+	}
+}
+
+// capabilities lists the features compiled into this build of dvom
+type capabilities struct {
+	Version            string   `json:"version"`
+	StorageBackends    []string `json:"storage_backends"`
+	Compression        []string `json:"compression"`
+	KDFs               []string `json:"kdfs"`
+	EncryptionModes    []string `json:"encryption_modes"`
+	SnapshotStrategies []string `json:"snapshot_strategies"`
+	FUSEMount          bool     `json:"fuse_mount"`
+}
+
+func createCapabilitiesCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "capabilities",
+		Short: "Show the storage backends and features supported by this build",
+		Long:  "Show the storage backends, compression algorithms, key derivation functions, encryption modes and snapshot strategies compiled into this build, and whether FUSE mounting is available on this platform.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			caps := capabilities{
+				Version:            version.Version,
+				StorageBackends:    storage.BackendTypes(),
+				Compression:        backup.CompressionAlgorithms(),
+				KDFs:               []string{crypto.KDF, crypto.KDFArgon2id, crypto.KDFKeyfile},
+				EncryptionModes:    []string{crypto.Cipher},
+				SnapshotStrategies: backup.SnapshotStrategyNames(),
+				// Mounting snapshots is not implemented on any platform yet
+				FUSEMount: false,
+			}
+
+			if written, err := writeStructured(outputFormat, caps); written || err != nil {
+				return err
+			}
+
+			fuse := "not available"
+			if caps.FUSEMount {
+				fuse = "available"
+			}
+
+			fmt.Printf("dvom %s\n\n", caps.Version)
+			fmt.Printf("%-22s %s\n", "Storage backends:", strings.Join(caps.StorageBackends, ", "))
+			fmt.Printf("%-22s %s\n", "Compression:", strings.Join(caps.Compression, ", "))
+			fmt.Printf("%-22s %s\n", "Key derivation:", strings.Join(caps.KDFs, ", "))
+			fmt.Printf("%-22s %s\n", "Encryption:", strings.Join(caps.EncryptionModes, ", "))
+			fmt.Printf("%-22s %s\n", "Snapshot strategies:", strings.Join(caps.SnapshotStrategies, ", "))
+			fmt.Printf("%-22s %s\n", "FUSE mount:", fuse)
+
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// doctorCheck is the result of one environment check run by doctor
+type doctorCheck struct {
+	Name   string
+	Detail string
+	Err    error
+}
+
+func createDoctorCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check that Docker, the helper image and the storage backend are usable",
+		Long:  "Diagnose common setup problems: check that the Docker daemon is reachable, that the helper image (--helper-image) is available (pulling it if it is missing, unless --no-pull is set) and that the configured storage backend can be written to, read from and deleted from, using a small sentinel object. Exits non-zero if any check fails.",
+		Args:  cobra.NoArgs,
+		// Failed checks are not usage errors
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			var checks []doctorCheck
+
+			// Docker daemon; docker.NewClient pings it
+			dockerClient, err := docker.NewClient()
+			if err != nil {
+				checks = append(checks, doctorCheck{Name: "Docker daemon", Err: err})
+				checks = append(checks, doctorCheck{Name: "Helper image", Err: fmt.Errorf("skipped: Docker daemon is not reachable")})
+			} else {
+				detail := "reachable"
+				if serverVersion, err := dockerClient.ServerVersion(); err == nil {
+					detail = fmt.Sprintf("reachable (Docker %s)", serverVersion)
+				}
+				checks = append(checks, doctorCheck{Name: "Docker daemon", Detail: detail})
+
+				// Helper image used for every backup and restore
+				imageCheck := doctorCheck{Name: "Helper image", Detail: helperImage + " available"}
+				if noPull {
+					exists, err := dockerClient.ImageExists(helperImage)
+					if err == nil && !exists {
+						err = fmt.Errorf("%s not present and --no-pull is set", helperImage)
+					}
+					imageCheck.Err = err
+				} else {
+					pulled, err := dockerClient.EnsureImage(helperImage)
+					if pulled {
+						imageCheck.Detail = helperImage + " pulled"
+					}
+					imageCheck.Err = err
+				}
+				checks = append(checks, imageCheck)
+			}
+
+			// Storage backend round trip
+			storageCheck := doctorCheck{Name: fmt.Sprintf("Storage (%s)", storageType)}
+			storageConfig, err := buildStorageConfig()
+			if err == nil {
+				var storageBackend storage.Backend
+				storageBackend, err = storage.NewBackend(ctx, storageConfig)
+				if err == nil {
+					err = storage.CheckAccess(ctx, storageBackend)
+				}
+			}
+			if err == nil {
+				storageCheck.Detail = "write, read and delete succeeded"
+			}
+			storageCheck.Err = err
+			checks = append(checks, storageCheck)
+
+			failed := 0
+			for _, check := range checks {
+				if check.Err != nil {
+					failed++
+					fmt.Printf("❌ %-18s %v\n", check.Name+":", check.Err)
+					continue
+				}
+				fmt.Printf("✅ %-18s %s\n", check.Name+":", check.Detail)
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+			}
+			if !quiet {
+				fmt.Println("\n🎉 All checks passed")
+			}
+			return nil
 		},
 	}
 
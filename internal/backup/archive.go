@@ -0,0 +1,495 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ypeckstadt/dvom/internal/storage"
+)
+
+// archiveStats describes the contents of a volume archive
+type archiveStats struct {
+	FileCount        int64
+	UncompressedSize int64
+	// ContentChecksum is the SHA-256 of the uncompressed tar stream, which unlike the
+	// stored data does not change with compression or encryption
+	ContentChecksum string
+	// Manifest holds the size and checksum of every regular file
+	Manifest fileManifest
+}
+
+// inspectArchive counts the regular files and their total size in a volume archive and
+// computes the checksum of its contents and the manifest of its files
+func inspectArchive(path string, compression string) (*archiveStats, error) {
+	file, err := os.Open(path) // #nosec G304 - controlled backup temp file path
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Warnf("failed to close archive: %v", err)
+		}
+	}()
+
+	decompressed, err := newDecompressor(file, compression)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	defer func() {
+		if err := decompressed.Close(); err != nil {
+			logger.Warnf("failed to close decompressor: %v", err)
+		}
+	}()
+
+	hash := sha256.New()
+	content := io.TeeReader(decompressed, hash)
+
+	stats := &archiveStats{Manifest: fileManifest{}}
+	tarReader := tar.NewReader(content)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive entry: %w", err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeReg:
+			stats.FileCount++
+			stats.UncompressedSize += header.Size
+
+			fileHash := sha256.New()
+			if _, err := io.Copy(fileHash, tarReader); err != nil {
+				return nil, fmt.Errorf("failed to read archive entry %s: %w", header.Name, err)
+			}
+			stats.Manifest[manifestPath(header.Name)] = manifestEntry{Size: header.Size, SHA256: hex.EncodeToString(fileHash.Sum(nil))}
+		case tar.TypeLink:
+			// A hard link is extracted as another name of the file it links to
+			if entry, ok := stats.Manifest[manifestPath(header.Linkname)]; ok {
+				stats.Manifest[manifestPath(header.Name)] = entry
+			}
+		}
+	}
+
+	// Include the end-of-archive padding in the checksum
+	if _, err := io.Copy(io.Discard, content); err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	stats.ContentChecksum = hex.EncodeToString(hash.Sum(nil))
+
+	return stats, nil
+}
+
+// countEntriesAfterStrip counts the non-directory entries of a volume archive that keep a
+// path after removing n leading path components, as tar --strip-components does
+func countEntriesAfterStrip(path string, n int, compression string) (int, error) {
+	file, err := os.Open(path) // #nosec G304 - controlled backup temp file path
+	if err != nil {
+		return 0, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Warnf("failed to close archive: %v", err)
+		}
+	}()
+
+	decompressed, err := newDecompressor(file, compression)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read archive: %w", err)
+	}
+	defer func() {
+		if err := decompressed.Close(); err != nil {
+			logger.Warnf("failed to close decompressor: %v", err)
+		}
+	}()
+
+	remaining := 0
+	tarReader := tar.NewReader(decompressed)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read archive entry: %w", err)
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		// Leading "./" counts as a component for tar, empty segments do not
+		components := 0
+		for _, part := range strings.Split(header.Name, "/") {
+			if part != "" {
+				components++
+			}
+		}
+		if components > n {
+			remaining++
+		}
+	}
+
+	return remaining, nil
+}
+
+// SetStripComponents sets the number of leading path components removed when restoring
+func (c *Client) SetStripComponents(n int) error {
+	if n < 0 {
+		return fmt.Errorf("--strip-components must be non-negative, got %d", n)
+	}
+	c.stripComponents = n
+	return nil
+}
+
+// CompressionAlgorithms returns the compression algorithms used for volume archives
+func CompressionAlgorithms() []string {
+	return []string{storage.CompressionGzip, storage.CompressionZstd, storage.CompressionNone}
+}
+
+// SetCompression sets the compression algorithm of new volume archives
+func (c *Client) SetCompression(compression string) error {
+	for _, algorithm := range CompressionAlgorithms() {
+		if compression == algorithm {
+			c.compression = compression
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported compression %q (use %s)", compression, strings.Join(CompressionAlgorithms(), ", "))
+}
+
+// SetExcludes sets the patterns of files left out of new volume archives. A pattern containing
+// a '/' is matched against the path relative to the volume root, e.g. cache/* or /logs; one
+// without matches a file or directory name at any depth, e.g. *.tmp. A matching directory is
+// left out with all of its contents.
+func (c *Client) SetExcludes(patterns []string) error {
+	for _, pattern := range patterns {
+		if err := validateExcludePattern(pattern); err != nil {
+			return err
+		}
+	}
+	c.excludes = patterns
+	return nil
+}
+
+// validateExcludePattern checks that an exclude pattern is well-formed and excludes something
+// less than the whole volume
+func validateExcludePattern(pattern string) error {
+	if strings.ContainsAny(pattern, "\x00\n\r") {
+		return fmt.Errorf("invalid exclude pattern %q: must not contain control characters", pattern)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+	}
+	relative := strings.Trim(pattern, "/")
+	if relative == "" || relative == "." || relative == "*" || relative == "./*" {
+		return fmt.Errorf("invalid exclude pattern %q: it would exclude the whole volume", pattern)
+	}
+	for _, segment := range strings.Split(relative, "/") {
+		if segment == ".." {
+			return fmt.Errorf("invalid exclude pattern %q: must not contain '..'", pattern)
+		}
+	}
+	return nil
+}
+
+// helperExcludePattern returns the tar --exclude pattern of an exclude pattern. Archive entries
+// are named ./<path>, so patterns with a '/' are anchored at the volume root with a ./ prefix,
+// while tar matches patterns without one against every path component.
+func helperExcludePattern(pattern string) string {
+	pattern = strings.TrimSuffix(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		return pattern
+	}
+	return "./" + strings.TrimPrefix(strings.TrimPrefix(pattern, "./"), "/")
+}
+
+// compressionLevelRange returns the levels accepted by a compression algorithm, or ok false
+// if the algorithm has no levels
+func compressionLevelRange(compression string) (min, max int, ok bool) {
+	switch compression {
+	case storage.CompressionGzip:
+		return 1, 9, true
+	case storage.CompressionZstd:
+		return 1, 22, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// SetCompressionLevel sets the compression level of new volume archives, 0 for the algorithm's
+// default. It must be called after SetCompression, as the valid range depends on the algorithm.
+func (c *Client) SetCompressionLevel(level int) error {
+	if level == 0 {
+		c.compressionLevel = 0
+		return nil
+	}
+
+	compression := c.archiveOptions().Compression
+	min, max, ok := compressionLevelRange(compression)
+	if !ok {
+		return fmt.Errorf("compression %q has no compression levels", compression)
+	}
+	if level < min || level > max {
+		return fmt.Errorf("%s compression level must be between %d and %d, got %d", compression, min, max, level)
+	}
+	c.compressionLevel = level
+	return nil
+}
+
+// archiveOptions returns the options new volume archives are produced with
+func (c *Client) archiveOptions() storage.BackupOptions {
+	options := storage.DefaultBackupOptions()
+	if c.compression != "" {
+		options.Compression = c.compression
+	}
+	options.CompressionLevel = c.compressionLevel
+	options.ModifiedSince = c.modifiedSince
+	options.Excludes = c.excludes
+	return options
+}
+
+// helperCompressionArgs returns the tar flags selecting the compression applied inside the
+// helper container. The alpine helper has no zstd, so zstd archives leave the helper as a
+// plain tar and are compressed and decompressed by dvom itself.
+func helperCompressionArgs(options storage.BackupOptions) ([]string, error) {
+	if options.Format != storage.FormatTar {
+		return nil, fmt.Errorf("unsupported archive format %q", options.Format)
+	}
+	switch options.Compression {
+	case storage.CompressionGzip:
+		return []string{"-z"}, nil
+	case storage.CompressionZstd, storage.CompressionNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", options.Compression)
+	}
+}
+
+// tarCreateCommand returns the helper command archiving /data to /backup.tar.gz as described by
+// the options
+func tarCreateCommand(options storage.BackupOptions) ([]string, error) {
+	args, err := helperCompressionArgs(options)
+	if err != nil {
+		return nil, err
+	}
+
+	// The patterns are separate arguments, never parsed by the helper's shell
+	var tarArgs []string
+	for _, pattern := range options.Excludes {
+		tarArgs = append(tarArgs, "--exclude="+helperExcludePattern(pattern))
+	}
+
+	// tar -z always uses gzip's default level, so other levels pipe through gzip
+	gzipLevel := options.Compression == storage.CompressionGzip && options.CompressionLevel != 0
+	if options.ModifiedSince != nil {
+		return incrementalCreateCommand(*options.ModifiedSince, args, gzipLevel, options.CompressionLevel, tarArgs), nil
+	}
+	tarArgs = append([]string{"-C", "/data"}, tarArgs...)
+	tarArgs = append(tarArgs, ".")
+
+	if gzipLevel {
+		script := fmt.Sprintf(`set -o pipefail; tar -c -f - "$@" | gzip -%d > /backup.tar.gz`, options.CompressionLevel)
+		return append([]string{"sh", "-c", script, "sh"}, tarArgs...), nil
+	}
+
+	cmd := append([]string{"tar", "-c"}, args...)
+	cmd = append(cmd, "-f", "/backup.tar.gz")
+	return append(cmd, tarArgs...), nil
+}
+
+// incrementalCreateCommand returns the helper command archiving only the files of /data
+// modified after since. The helper tar has no --newer-mtime, so find lists the files and tar
+// reads the list. Directories are left out, as tar would add all of their contents; an empty
+// directory is archived when no file changed, since tar refuses to create an empty archive.
+func incrementalCreateCommand(since time.Time, compressionArgs []string, gzipLevel bool, level int, tarArgs []string) []string {
+	tarCommand := `exec tar -c ` + strings.Join(compressionArgs, " ") + ` -f /backup.tar.gz "$@"`
+	if gzipLevel {
+		tarCommand = fmt.Sprintf(`set -o pipefail; tar -c -f - "$@" | gzip -%d > /backup.tar.gz`, level)
+	}
+
+	script := `set -e
+touch -d "@$1" /tmp/dvom-since
+shift
+cd /data
+find . -newer /tmp/dvom-since ! -type d > /tmp/dvom-files
+if [ -s /tmp/dvom-files ]; then
+	set -- "$@" -T /tmp/dvom-files
+else
+	mkdir -p /tmp/dvom-empty
+	set -- "$@" -C /tmp/dvom-empty .
+fi
+` + tarCommand
+	cmd := []string{"sh", "-c", script, "sh", strconv.FormatInt(since.Unix(), 10)}
+	return append(cmd, tarArgs...)
+}
+
+// tarExtractArgs returns the tar arguments reversing the options a backup was produced with
+func tarExtractArgs(options storage.BackupOptions) ([]string, error) {
+	args, err := helperCompressionArgs(options)
+	if err != nil {
+		return nil, fmt.Errorf("cannot restore this backup: %w; it was made by a newer version of dvom", err)
+	}
+
+	if !options.PreserveOwnership {
+		args = append(args, "--no-same-owner")
+	}
+	return args, nil
+}
+
+// newCompressor wraps w with the compression dvom applies itself for the options, if any. The
+// returned writer must be closed to flush the compressed stream.
+func newCompressor(w io.Writer, options storage.BackupOptions) (io.WriteCloser, error) {
+	if options.Compression != storage.CompressionZstd {
+		return nopWriteCloser{w}, nil
+	}
+	var encoderOptions []zstd.EOption
+	if options.CompressionLevel != 0 {
+		encoderOptions = append(encoderOptions, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(options.CompressionLevel)))
+	}
+	encoder, err := zstd.NewWriter(w, encoderOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+	}
+	return encoder, nil
+}
+
+// nopWriteCloser adds a no-op Close to a writer
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// newDecompressor returns a reader of the tar stream inside an archive with the given compression
+func newDecompressor(r io.Reader, compression string) (io.ReadCloser, error) {
+	switch compression {
+	case storage.CompressionGzip:
+		return gzip.NewReader(r)
+	case storage.CompressionZstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	case storage.CompressionNone:
+		return io.NopCloser(r), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", compression)
+	}
+}
+
+// decompressOnHost returns the path of the archive the restore helper extracts: zstd archives
+// are decompressed by dvom into a temp file, which the returned cleanup removes; any other
+// archive is passed through unchanged
+func decompressOnHost(path string, options storage.BackupOptions) (string, func(), error) {
+	if options.Compression != storage.CompressionZstd {
+		return path, func() {}, nil
+	}
+
+	file, err := os.Open(path) // #nosec G304 - controlled backup file path
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Warnf("failed to close backup file: %v", err)
+		}
+	}()
+
+	decoder, err := zstd.NewReader(file)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+	}
+	defer decoder.Close()
+
+	plain, err := os.CreateTemp("", "dvom-restore-*.tar")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	cleanup := func() {
+		if err := os.Remove(plain.Name()); err != nil {
+			logger.Warnf("failed to remove temp file: %v", err)
+		}
+	}
+	if _, err := io.Copy(plain, decoder); err != nil {
+		if closeErr := plain.Close(); closeErr != nil {
+			logger.Warnf("failed to close temp file: %v", closeErr)
+		}
+		cleanup()
+		return "", nil, fmt.Errorf("failed to decompress backup: %w", err)
+	}
+	if err := plain.Close(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to close temp file: %w", err)
+	}
+	return plain.Name(), cleanup, nil
+}
+
+// detectFileCompression identifies the compression of an archive file from its leading bytes
+func detectFileCompression(path string) (string, error) {
+	file, err := os.Open(path) // #nosec G304 - controlled backup file path
+	if err != nil {
+		return "", fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Warnf("failed to close archive: %v", err)
+		}
+	}()
+
+	header := make([]byte, 4)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", fmt.Errorf("failed to read archive header: %w", err)
+	}
+	return detectCompression(header[:n]), nil
+}
+
+// detectCompression identifies the compression of an archive from its leading magic bytes
+func detectCompression(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return storage.CompressionGzip
+	case bytes.HasPrefix(header, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return storage.CompressionZstd
+	default:
+		return storage.CompressionNone
+	}
+}
+
+// SetSkipIfUnchanged makes backups skip the upload when a version of the snapshot with
+// identical content already exists
+func (c *Client) SetSkipIfUnchanged(skip bool) {
+	c.skipIfUnchanged = skip
+}
+
+// SetEmptyGuard makes backups fail when the volume archive contains no files or
+// less than minSize bytes of file data (0 disables the size check)
+func (c *Client) SetEmptyGuard(failOnEmpty bool, minSize int64) {
+	c.failOnEmpty = failOnEmpty
+	c.minSize = minSize
+}
+
+// checkArchiveNotEmpty enforces the configured empty-volume guard
+func (c *Client) checkArchiveNotEmpty(volumeName string, stats *archiveStats) error {
+	if c.failOnEmpty && stats.FileCount == 0 {
+		return fmt.Errorf("volume '%s' is empty: the backup contains no files (is the volume mounted and populated?)", volumeName)
+	}
+	if c.minSize > 0 && stats.UncompressedSize < c.minSize {
+		return fmt.Errorf("volume '%s' contains only %d bytes in %d file(s), below the minimum size of %d bytes", volumeName, stats.UncompressedSize, stats.FileCount, c.minSize)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package backup
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/ypeckstadt/dvom/internal/models"
+)
+
+// SetIncludeBinds allows host paths, such as the bind mounts of a container, to be backed up
+// like volumes. They are opt-in because the helper container reads them as root.
+func (c *Client) SetIncludeBinds(include bool) {
+	c.includeBinds = include
+}
+
+// isBindSource reports whether a backup source is a host path rather than a volume name
+func isBindSource(source string) bool {
+	return filepath.IsAbs(source)
+}
+
+// lookupSource returns the volume a backup reads from or, if host paths are included, the host
+// path given as an absolute path
+func (c *Client) lookupSource(name string) (*models.VolumeInfo, error) {
+	if !isBindSource(name) {
+		if err := validateVolumeName(name); err != nil {
+			return nil, err
+		}
+		exists, err := c.docker.VolumeExists(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check volume: %w", err)
+		}
+		if !exists {
+			return nil, fmt.Errorf("volume '%s' not found", name)
+		}
+		return c.docker.GetVolume(name)
+	}
+
+	if !c.includeBinds {
+		return nil, fmt.Errorf("'%s' is a host path, not a volume: pass --include-binds to back up host paths", name)
+	}
+	// Sources are recorded comma-separated and mapped on restore with <source>=<target>
+	if strings.ContainsAny(name, ",=") {
+		return nil, fmt.Errorf("host path '%s' cannot be backed up: it contains ',' or '='", name)
+	}
+	if c.snapshotStrategy != "" && c.snapshotStrategy != (&tarStrategy{}).Name() {
+		return nil, fmt.Errorf("host path '%s' can only be backed up with the tar strategy, not %s", name, c.snapshotStrategy)
+	}
+
+	if !c.quiet {
+		fmt.Printf("⚠️  Backing up host path %s: the helper container reads it as root, so the backup holds every file below it, including files your user cannot read, with their owners and permissions. Restores write them into a volume, never back to the host path.\n", name)
+	}
+	return &models.VolumeInfo{
+		Name:   name,
+		Type:   models.MountTypeBind,
+		Source: name,
+	}, nil
+}
+
+// mountTypes returns the MountTypes metadata of a backup of volumes, nil if none is a host path
+func mountTypes(volumes []models.VolumeInfo) map[string]string {
+	types := make(map[string]string, len(volumes))
+	binds := false
+	for _, volume := range volumes {
+		if volume.Type == models.MountTypeBind {
+			types[volume.Name] = models.MountTypeBind
+			binds = true
+		} else {
+			types[volume.Name] = models.MountTypeVolume
+		}
+	}
+	if !binds {
+		return nil
+	}
+	return types
+}
+
+// noteBindRestore points out that a source backed up from a host path is restored into a volume
+func (c *Client) noteBindRestore(types map[string]string, source, target string) {
+	if types[source] == models.MountTypeBind && !c.quiet {
+		fmt.Printf("ℹ️  '%s' was backed up from a host path, its files are restored into volume '%s'\n", source, target)
+	}
+}
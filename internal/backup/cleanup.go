@@ -0,0 +1,119 @@
+package backup
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ypeckstadt/dvom/internal/docker"
+)
+
+// DefaultCleanupAge is how old a helper container must be before cleanup removes it, so the
+// helpers of a dvom run still in progress are left alone
+const DefaultCleanupAge = time.Hour
+
+// HelperContainer describes a helper container created by dvom
+type HelperContainer struct {
+	ID      string
+	Name    string
+	RunID   string
+	Purpose string
+	State   string
+	Created time.Time
+}
+
+// HelperContainers returns the dvom helper containers on the host, oldest first
+func (c *Client) HelperContainers() ([]HelperContainer, error) {
+	containers, err := c.docker.ListHelperContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	helpers := make([]HelperContainer, 0, len(containers))
+	for _, container := range containers {
+		helper := HelperContainer{
+			ID:      container.ID,
+			RunID:   container.Labels[docker.HelperRunLabel],
+			Purpose: container.Labels[docker.HelperPurposeLabel],
+			State:   container.State,
+			Created: time.Unix(container.Created, 0),
+		}
+		if len(container.Names) > 0 {
+			helper.Name = strings.TrimPrefix(container.Names[0], "/")
+		}
+		helpers = append(helpers, helper)
+	}
+	sort.Slice(helpers, func(i, j int) bool {
+		return helpers[i].Created.Before(helpers[j].Created)
+	})
+	return helpers, nil
+}
+
+// CleanupHelpers force-removes the dvom helper containers created more than olderThan ago,
+// e.g. the ones left behind by a dvom process that crashed or was killed. Younger helpers are
+// kept, as they may belong to a run still in progress. With dryRun, the helpers that would be
+// removed are only listed.
+func (c *Client) CleanupHelpers(olderThan time.Duration, dryRun bool) error {
+	helpers, err := c.HelperContainers()
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	var stale []HelperContainer
+	for _, helper := range helpers {
+		if helper.Created.Before(cutoff) {
+			stale = append(stale, helper)
+		}
+	}
+
+	if kept := len(helpers) - len(stale); kept > 0 && !c.quiet {
+		fmt.Printf("ℹ️  Keeping %d helper container(s) created within the last %s, they may belong to a running dvom\n", kept, olderThan)
+	}
+	if len(stale) == 0 {
+		if !c.quiet {
+			fmt.Println("✅ No dvom helper containers to remove")
+		}
+		return nil
+	}
+
+	if dryRun {
+		fmt.Printf("🎯 Would remove %d helper container(s):\n", len(stale))
+		for _, helper := range stale {
+			printHelperContainer(helper)
+		}
+		fmt.Println("\n✋ Dry run - no changes made")
+		return nil
+	}
+
+	failed := 0
+	for _, helper := range stale {
+		if err := c.docker.RemoveContainer(helper.ID); err != nil {
+			failed++
+			logger.Errorf("failed to remove helper container %s: %v", shortID(helper.ID), err)
+			continue
+		}
+		if !c.quiet {
+			fmt.Printf("🧹 Removed %s (%s helper of run %s)\n", shortID(helper.ID), helperPurpose(helper), helper.RunID)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d helper container(s) could not be removed", failed, len(stale))
+	}
+	return nil
+}
+
+// printHelperContainer prints one line describing a helper container
+func printHelperContainer(helper HelperContainer) {
+	fmt.Printf("   %s  %-10s %-10s run %s, created %s ago\n", shortID(helper.ID), helperPurpose(helper), helper.State, helper.RunID, time.Since(helper.Created).Round(time.Second))
+}
+
+// helperPurpose returns what a helper container was created for, or "-" if it is not recorded
+func helperPurpose(helper HelperContainer) string {
+	if helper.Purpose == "" {
+		return "-"
+	}
+	return helper.Purpose
+}
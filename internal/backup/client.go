@@ -4,11 +4,20 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sync"
+	"time"
 
+	"github.com/ypeckstadt/dvom/internal/crypto"
 	"github.com/ypeckstadt/dvom/internal/docker"
+	"github.com/ypeckstadt/dvom/internal/models"
 	"github.com/ypeckstadt/dvom/internal/storage"
+	"golang.org/x/time/rate"
 )
 
+// PasswordEnvVar is the environment variable read for the encryption password when none is
+// given, so scripted use never needs the password on the command line
+const PasswordEnvVar = "DVOM_ENCRYPTION_PASSWORD"
+
 // Client wraps Docker client with backup functionality
 type Client struct {
 	docker       *docker.Client
@@ -19,13 +28,70 @@ type Client struct {
 	ctx          context.Context
 	encryptEnabled bool
 	password     string
+	passwordMu   sync.Mutex
+	snapshotStrategy string
+	contextLines int
+	helperImage  string
+	noPull       bool
+	pullMu       sync.Mutex
+	pulledImage  string
+	failOnEmpty  bool
+	minSize      int64
+	stripComponents int
+	encryptMetadata bool
+	onlyVolume   string
+	volumeParallel int
+	skipIfUnchanged bool
+	containerResults []models.ContainerResult
+	healthTimeout time.Duration
+	restartRetries int
+	retention    RetentionPolicy
+	verifyAfterBackup bool
+	verifyAfterRestore bool
+	dryRunLimit  int
+	cryptoChunkSize int
+	kdf             string
+	keyfile         bool
+	noRestart    bool
+	stopTimeout  time.Duration
+	forceStop    bool
+	skipUnmodified bool
+	incremental    bool
+	modifiedSince  *time.Time
+	verifyChecksum bool
+	deleteUnverified bool
+	lastUnchanged  bool
+	backupBeforeRestore bool
+	createVolume bool
+	copyDriver   bool
+	// rateLimiter caps storage transfer rates; nil means unlimited
+	rateLimiter *rate.Limiter
+	tags         map[string]string
+	// includeBinds allows host paths to be backed up like volumes
+	includeBinds bool
+	// autoStopUsers stops the running containers using the volumes of a backup
+	autoStopUsers bool
+	// sourceContainer is recorded with new backups of volumes discovered from a container
+	sourceContainer *storage.ContainerInfo
+	snapshotFilters []SnapshotFilter
+	// since and until limit snapshot listings to a creation time window
+	since        time.Time
+	until        time.Time
+	compression  string
+	// excludes are the patterns of files left out of new volume archives
+	excludes     []string
+	compressionLevel int
+	stream       bool
+	snapshots    *storage.SnapshotStorage
+	// runID labels the helper containers of this client, see docker.HelperLabels
+	runID        string
 }
 
 // NewClient creates a new backup client
-func NewClient(backupDir string, verbose bool) (*Client, error) {
+func NewClient(ctx context.Context, backupDir string, verbose bool) (*Client, error) {
 	dockerClient, err := docker.NewClient()
 	if err != nil {
-		return nil, err
+		return nil, dockerError(err)
 	}
 
 	// Ensure backup directory exists
@@ -37,7 +103,10 @@ func NewClient(backupDir string, verbose bool) (*Client, error) {
 		docker:    dockerClient,
 		backupDir: backupDir,
 		verbose:   verbose,
-		ctx:       context.Background(),
+		ctx:       ctx,
+		runID:     newRunID(),
+		contextLines: defaultContextLines,
+		stopTimeout: defaultStopTimeout,
 	}, nil
 }
 
@@ -45,7 +114,7 @@ func NewClient(backupDir string, verbose bool) (*Client, error) {
 func NewClientWithStorage(ctx context.Context, storageBackend storage.Backend, verbose bool) (*Client, error) {
 	dockerClient, err := docker.NewClient()
 	if err != nil {
-		return nil, err
+		return nil, dockerError(err)
 	}
 
 	return &Client{
@@ -54,6 +123,9 @@ func NewClientWithStorage(ctx context.Context, storageBackend storage.Backend, v
 		quiet:   false,
 		storage: storageBackend,
 		ctx:     ctx,
+		runID:   newRunID(),
+		contextLines: defaultContextLines,
+		stopTimeout: defaultStopTimeout,
 	}, nil
 }
 
@@ -62,8 +134,58 @@ func (c *Client) SetQuiet(quiet bool) {
 	c.quiet = quiet
 }
 
+// SetMetadataEncryption enables encrypting the metadata of new backups with the encryption password
+func (c *Client) SetMetadataEncryption(enabled bool) {
+	c.encryptMetadata = enabled
+}
+
+// SetCryptoChunkSize sets the plaintext size of each encrypted chunk of new backups
+func (c *Client) SetCryptoChunkSize(size int) error {
+	if err := crypto.ValidateChunkSize(size); err != nil {
+		return err
+	}
+	c.cryptoChunkSize = size
+	return nil
+}
+
+// SetKDF sets the key derivation function used for the encryption key of new backups. It is
+// recorded in the encryption header, so restores need no setting.
+func (c *Client) SetKDF(kdf string) error {
+	if err := crypto.ValidateKDF(kdf); err != nil {
+		return err
+	}
+	c.kdf = kdf
+	return nil
+}
+
+// SetKeyfile makes the client use the contents of a keyfile as key material instead of a
+// password. New backups record the keyfile key derivation in their encryption header.
+func (c *Client) SetKeyfile(path string) error {
+	material, err := crypto.ReadKeyfile(path)
+	if err != nil {
+		return err
+	}
+	c.password = string(material)
+	c.keyfile = true
+	return nil
+}
+
 // SetEncryption sets encryption settings for the client
 func (c *Client) SetEncryption(enabled bool, password string) {
 	c.encryptEnabled = enabled
 	c.password = password
 }
+
+// snapshotStorage returns the snapshot layer over the storage backend. It is shared for the
+// lifetime of the client so listings are reused within one invocation.
+func (c *Client) snapshotStorage() *storage.SnapshotStorage {
+	if c.snapshots == nil {
+		c.snapshots = storage.NewSnapshotStorage(c.storage)
+	}
+	password := c.password
+	if password == "" {
+		password = os.Getenv(PasswordEnvVar)
+	}
+	c.snapshots.SetMetadataEncryption(c.encryptMetadata, password)
+	return c.snapshots
+}
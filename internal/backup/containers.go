@@ -0,0 +1,269 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ypeckstadt/dvom/internal/models"
+	"github.com/ypeckstadt/dvom/internal/storage"
+)
+
+// defaultStopTimeout is how long a container is given to exit after SIGTERM before it is killed
+const defaultStopTimeout = 30 * time.Second
+
+// restartSettleTime is how long a container without a health check must stay running after a restart
+const restartSettleTime = 5 * time.Second
+
+// SetRestartHealthCheck makes restarted containers count as restarted only once they are healthy
+// (or, without a health check, still running) within timeout. An unhealthy container is restarted
+// up to retries more times. A zero timeout disables the check.
+func (c *Client) SetRestartHealthCheck(timeout time.Duration, retries int) {
+	if timeout < 0 {
+		timeout = 0
+	}
+	if retries < 0 {
+		retries = 0
+	}
+	c.healthTimeout = timeout
+	c.restartRetries = retries
+}
+
+// SetStopBehavior sets how long a stopped container is given to exit before it is killed, and
+// whether a container that still fails to stop is killed explicitly
+func (c *Client) SetStopBehavior(timeout time.Duration, force bool) {
+	if timeout <= 0 {
+		timeout = defaultStopTimeout
+	}
+	c.stopTimeout = timeout
+	c.forceStop = force
+}
+
+// ContainerResults returns what happened to the containers stopped around the last operation
+func (c *Client) ContainerResults() []models.ContainerResult {
+	return c.containerResults
+}
+
+// SetNoRestart leaves the containers stopped for an operation down afterwards, so the
+// operator can check the result before bringing the application back
+func (c *Client) SetNoRestart(noRestart bool) {
+	c.noRestart = noRestart
+}
+
+// withStoppedContainers stops the given containers, runs op and restarts them in reverse order.
+// A container that fails to restart fails the operation even if op itself succeeded, so a
+// production container is never left down behind a successful exit code.
+func (c *Client) withStoppedContainers(containerNames []string, op func() error) error {
+	c.containerResults = nil
+
+	stoppedContainers, err := c.stopContainers(containerNames)
+	if err != nil {
+		// Bring back whatever was stopped before the failure
+		if restartErr := c.restartContainers(stoppedContainers); restartErr != nil {
+			c.warnRestartFailures()
+		}
+		return fmt.Errorf("failed to stop containers: %w", err)
+	}
+
+	opErr := op()
+
+	if c.noRestart {
+		c.printContainerSummary()
+		c.reportLeftStopped(stoppedContainers)
+		return opErr
+	}
+
+	restartErr := c.restartContainers(stoppedContainers)
+	c.printContainerSummary()
+	if restartErr == nil {
+		return opErr
+	}
+
+	c.warnRestartFailures()
+	if opErr != nil {
+		return fmt.Errorf("%w (additionally, %v)", opErr, restartErr)
+	}
+	return restartErr
+}
+
+// waitForRestart waits for a restarted container to come up, restarting it again on failure
+func (c *Client) waitForRestart(stopped stoppedContainer) error {
+	if c.healthTimeout == 0 {
+		return nil
+	}
+
+	settle := restartSettleTime
+	if c.healthTimeout < settle {
+		settle = c.healthTimeout
+	}
+
+	var err error
+	for attempt := 0; attempt <= c.restartRetries; attempt++ {
+		if attempt > 0 {
+			if c.verbose {
+				fmt.Printf("   🔁 Retrying restart of %s (retry %d of %d)\n", stopped.Name, attempt, c.restartRetries)
+			}
+			if restartErr := c.docker.RestartContainer(stopped.ID); restartErr != nil {
+				return restartErr
+			}
+		}
+
+		if c.verbose {
+			fmt.Printf("   ⏳ Waiting up to %s for %s to come up...\n", c.healthTimeout, stopped.Name)
+		}
+		err = c.docker.WaitHealthy(stopped.ID, c.healthTimeout, settle)
+		if err == nil {
+			return nil
+		}
+		if c.verbose {
+			fmt.Printf("   ⚠️  %s did not come up: %v\n", stopped.Name, err)
+		}
+	}
+
+	return fmt.Errorf("not healthy after %d attempt(s): %w", c.restartRetries+1, err)
+}
+
+// printContainerSummary prints which containers were stopped and restarted
+func (c *Client) printContainerSummary() {
+	if c.quiet || len(c.containerResults) == 0 {
+		return
+	}
+
+	actions := make(map[string][]string)
+	for _, result := range c.containerResults {
+		actions[result.Action] = append(actions[result.Action], result.Name)
+	}
+
+	fmt.Println("📦 Containers:")
+	for _, action := range []string{models.ContainerStopped, models.ContainerKilled, models.ContainerAlreadyStopped, models.ContainerRestarted, models.ContainerRestartFailed} {
+		if names := actions[action]; len(names) > 0 {
+			fmt.Printf("   %-16s %s\n", action+":", strings.Join(names, ", "))
+		}
+	}
+}
+
+// reportLeftStopped logs the containers left stopped because of --no-restart
+func (c *Client) reportLeftStopped(stoppedContainers []stoppedContainer) {
+	var names []string
+	for _, stopped := range stoppedContainers {
+		if stopped.WasRunning {
+			names = append(names, stopped.Name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	logger.Warnf("%d container(s) left stopped (--no-restart): %s; start them when ready with: docker start %s", len(names), strings.Join(names, ", "), strings.Join(names, " "))
+}
+
+// warnRestartFailures logs the containers that failed to restart, regardless of verbosity
+func (c *Client) warnRestartFailures() {
+	var failed []models.ContainerResult
+	for _, result := range c.containerResults {
+		if result.Action == models.ContainerRestartFailed {
+			failed = append(failed, result)
+		}
+	}
+	if len(failed) == 0 {
+		return
+	}
+
+	for _, result := range failed {
+		logger.Errorf("container %s (%s) failed to restart: %s", result.Name, shortID(result.ID), result.Error)
+	}
+	logger.Warnf("%d container(s) failed to restart and are still stopped; start them manually with: docker start %s", len(failed), strings.Join(containerNames(failed), " "))
+}
+
+// containerNames returns the names of the given container results
+func containerNames(results []models.ContainerResult) []string {
+	names := make([]string, len(results))
+	for i, result := range results {
+		names[i] = result.Name
+	}
+	return names
+}
+
+// shortID returns the abbreviated form of a container ID
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// dockerSockets are bind mounts that give a container access to the Docker daemon rather than
+// holding data, so they are never backed up
+var dockerSockets = map[string]bool{
+	"/var/run/docker.sock": true,
+	"/run/docker.sock":     true,
+}
+
+// ContainerVolumes returns the named volumes mounted by a container, in mount order, and
+// records the container with the next backups so it could be recreated. Bind mounts are
+// included, named by their host path, only if SetIncludeBinds is set; tmpfs mounts are left out.
+func (c *Client) ContainerVolumes(containerName string) ([]string, error) {
+	container, err := c.docker.GetContainer(containerName)
+	if err != nil {
+		return nil, err
+	}
+	mounts, err := c.docker.GetContainerVolumes(container.ID, c.includeBinds)
+	if err != nil {
+		return nil, err
+	}
+	kept := mounts[:0]
+	for _, mount := range mounts {
+		if mount.Type == models.MountTypeBind && dockerSockets[mount.Source] {
+			if c.verbose {
+				fmt.Printf("⏭️  Skipping bind mount of the Docker socket %s\n", mount.Source)
+			}
+			continue
+		}
+		kept = append(kept, mount)
+	}
+	mounts = kept
+	if len(mounts) == 0 {
+		if c.includeBinds {
+			return nil, fmt.Errorf("container '%s' has no named volumes or bind mounts", containerName)
+		}
+		return nil, fmt.Errorf("container '%s' has no named volumes mounted", containerName)
+	}
+	config, err := c.docker.GetContainerConfig(container.ID)
+	if err != nil {
+		return nil, err
+	}
+	rawConfig, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode container config: %w", err)
+	}
+
+	info := &storage.ContainerInfo{
+		Name:   containerName,
+		ID:     container.ID,
+		Image:  container.Image,
+		Mounts: make(map[string]string, len(mounts)),
+		Config: rawConfig,
+	}
+	if len(container.Names) > 0 {
+		info.Name = strings.TrimPrefix(container.Names[0], "/")
+	}
+	volumeNames := make([]string, 0, len(mounts))
+	for _, mount := range mounts {
+		// The same volume or host path can be mounted at several paths
+		if _, ok := info.Mounts[mount.Name]; ok {
+			continue
+		}
+		info.Mounts[mount.Name] = mount.Destination
+		volumeNames = append(volumeNames, mount.Name)
+	}
+	c.sourceContainer = info
+
+	if c.verbose {
+		fmt.Printf("🔍 Container '%s' mounts %d volume(s):\n", info.Name, len(volumeNames))
+		for _, volumeName := range volumeNames {
+			fmt.Printf("   %s at %s\n", volumeName, info.Mounts[volumeName])
+		}
+	}
+	return volumeNames, nil
+}
@@ -0,0 +1,143 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// DaemonOptions configures scheduled backups run by RunDaemon
+type DaemonOptions struct {
+	// Schedule is a five-field cron expression or a descriptor such as @daily or @every 6h
+	Schedule       string
+	Volume         string
+	Snapshot       string
+	StopContainers []string
+	// RunTimeout limits each run; 0 for no limit
+	RunTimeout time.Duration
+	// Reload receives a value when the schedule should be reloaded from ReloadSchedule
+	Reload         <-chan struct{}
+	ReloadSchedule func() (string, error)
+	// OnRun is called after each run with its outcome
+	OnRun func(unchanged bool, err error)
+}
+
+// ParseSchedule parses a standard five-field cron expression (minute, hour, day of month,
+// month, day of week), or a descriptor such as @daily or @every 6h
+func ParseSchedule(spec string) (cron.Schedule, error) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+	}
+	return schedule, nil
+}
+
+// RunDaemon backs up a volume on a cron schedule until the client's context is cancelled. A
+// run that is due while the previous one is still going is skipped. A failed run is logged
+// and the daemon waits for the next one. On cancellation, a running backup is stopped and
+// its containers are restarted before RunDaemon returns.
+func (c *Client) RunDaemon(opts DaemonOptions) error {
+	schedule, err := ParseSchedule(opts.Schedule)
+	if err != nil {
+		return err
+	}
+	spec := opts.Schedule
+
+	// Ask for the password up front, nobody is there to answer a prompt when a run is due
+	if c.encryptEnabled {
+		if _, err := c.encryptionPassword("Enter encryption password: ", true); err != nil {
+			return err
+		}
+	}
+
+	// Each run gets its own context, so a run timeout does not end the daemon
+	base := c.ctx
+	defer func() { c.ctx = base }()
+
+	next := schedule.Next(time.Now())
+	logger.Infof("🕒 Backing up volume %s as %s on schedule %q, next run at %s", opts.Volume, opts.Snapshot, spec, next.Format(time.DateTime))
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+
+	var done chan error
+	var started time.Time
+	for {
+		select {
+		case <-base.Done():
+			if done != nil {
+				logger.Infof("⏹️  Stopping, waiting for the running backup to end...")
+				<-done
+			}
+			logger.Infof("👋 Daemon stopped")
+			return nil
+
+		case <-opts.Reload:
+			reloaded, err := opts.ReloadSchedule()
+			if err == nil {
+				schedule, err = ParseSchedule(reloaded)
+			}
+			if err != nil {
+				logger.Errorf("failed to reload the schedule, keeping %q: %v", spec, err)
+				continue
+			}
+			spec = reloaded
+			next = schedule.Next(time.Now())
+			timer.Reset(time.Until(next))
+			logger.Infof("🔄 Reloaded schedule %q, next run at %s", spec, next.Format(time.DateTime))
+
+		case <-timer.C:
+			due := next
+			next = schedule.Next(time.Now())
+			timer.Reset(time.Until(next))
+
+			if done != nil {
+				logger.Warnf("skipping the run due at %s, the backup started at %s is still running", due.Format(time.DateTime), started.Format(time.DateTime))
+				continue
+			}
+			started = time.Now()
+			logger.Infof("▶️  Starting backup of volume %s as %s", opts.Volume, opts.Snapshot)
+			done = make(chan error, 1)
+			go func(done chan<- error) {
+				done <- c.runScheduledBackup(base, opts)
+			}(done)
+
+		case err := <-done:
+			done = nil
+			took := time.Since(started).Round(time.Second)
+			switch {
+			case err != nil:
+				logger.Errorf("scheduled backup of volume %s failed after %s: %v", opts.Volume, took, err)
+			case c.lastUnchanged:
+				logger.Infof("⏭️  Volume %s unchanged, nothing stored (%s)", opts.Volume, took)
+			default:
+				logger.Infof("✅ Backup of volume %s stored in %s", opts.Volume, took)
+			}
+			if opts.OnRun != nil {
+				opts.OnRun(c.lastUnchanged, err)
+			}
+			logger.Infof("🕒 Next run at %s", next.Format(time.DateTime))
+		}
+	}
+}
+
+// runScheduledBackup runs one scheduled backup with its own context derived from base
+func (c *Client) runScheduledBackup(base context.Context, opts DaemonOptions) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if opts.RunTimeout > 0 {
+		ctx, cancel = context.WithTimeout(base, opts.RunTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(base)
+	}
+	defer cancel()
+
+	c.ctx = ctx
+	err := c.BackupDirectVolumeWithContainers(opts.Volume, opts.Snapshot, opts.StopContainers)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s: %w", opts.RunTimeout, err)
+	}
+	return err
+}
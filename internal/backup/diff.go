@@ -0,0 +1,160 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ypeckstadt/dvom/internal/storage"
+)
+
+// DefaultDryRunLimit is the number of files a restore dry run lists per kind of change
+const DefaultDryRunLimit = 20
+
+// volumeFilesScript lists the regular files under /data as "<bytes> <path>" lines
+const volumeFilesScript = `cd /data && find . -type f -exec stat -c '%s %n' {} +`
+
+// SetDryRunLimit sets how many files a restore dry run lists per kind of change; 0 lists them all
+func (c *Client) SetDryRunLimit(limit int) {
+	c.dryRunLimit = limit
+}
+
+// listVolumeFiles returns the sizes of the regular files in a volume, keyed by manifest path
+func (c *Client) listVolumeFiles(volumeName string) (map[string]int64, error) {
+	output, err := c.runVolumeHelper(volumeName, "listing", []string{"sh", "-c", volumeFilesScript})
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]int64)
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+		sizeField, name, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("unexpected listing output: %q", line)
+		}
+		size, err := strconv.ParseInt(sizeField, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected listing output: %q", line)
+		}
+		files[manifestPath(name)] = size
+	}
+	return files, nil
+}
+
+// dryRunManifest returns the files restoring a backup writes to the volume. The manifests
+// stored with the backup are used when every version of the chain has one; otherwise a full
+// backup is downloaded and its archive listed. It returns nil when the files cannot be listed
+// without restoring, i.e. for an incremental backup without manifests.
+func (c *Client) dryRunManifest(backup *storage.Backup, chain []storage.VersionInfo, selectedVolume string, multiVolume bool) (fileManifest, error) {
+	if !multiVolume {
+		manifest, err := c.restoreManifest(backup.Metadata, chain)
+		if err == nil {
+			return manifest, nil
+		}
+		if !errors.Is(err, storage.ErrNotFound) {
+			return nil, err
+		}
+		if len(chain) > 0 {
+			return nil, nil
+		}
+	}
+
+	if c.verbose {
+		fmt.Println("📋 No file manifest stored, downloading the backup to list its files")
+	}
+	tempFile, err := os.CreateTemp("", "dvom-dry-run-*.tar.gz")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer func() {
+		if err := os.Remove(tempFile.Name()); err != nil {
+			logger.Warnf("failed to remove temp file: %v", err)
+		}
+	}()
+	if err := c.downloadBackup(backup, tempFile); err != nil {
+		return nil, err
+	}
+
+	archivePath := tempFile.Name()
+	if multiVolume {
+		archivePath, err = c.extractVolumeArchive(tempFile.Name(), selectedVolume)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := os.Remove(archivePath); err != nil {
+				logger.Warnf("failed to remove temp file: %v", err)
+			}
+		}()
+	}
+
+	stats, err := inspectArchive(archivePath, backup.Metadata.ArchiveOptions().Compression)
+	if err != nil {
+		return nil, err
+	}
+	return stats.Manifest, nil
+}
+
+// printRestoreDiff prints the files a restore replacing the volume's contents with expected
+// would add, remove and change, comparing paths and sizes
+func (c *Client) printRestoreDiff(volumeName string, exists bool, expected fileManifest) error {
+	current := map[string]int64{}
+	if exists {
+		var err error
+		if current, err = c.listVolumeFiles(volumeName); err != nil {
+			return err
+		}
+	}
+
+	var added, removed, changed []string
+	for name, entry := range expected {
+		size, ok := current[name]
+		switch {
+		case !ok:
+			added = append(added, name)
+		case size != entry.Size:
+			changed = append(changed, name)
+		}
+	}
+	for name := range current {
+		if _, ok := expected[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	unchanged := len(expected) - len(added) - len(changed)
+
+	fmt.Printf("\n📋 File changes (by path and size): %d added, %d changed, %d removed, %d unchanged\n",
+		len(added), len(changed), len(removed), unchanged)
+	printFileList("➕ Added", added, c.dryRunLimit)
+	printFileList("✏️  Changed", changed, c.dryRunLimit)
+	printFileList("➖ Removed", removed, c.dryRunLimit)
+	return nil
+}
+
+// showRestoreDiff prints the file changes of a restore dry run. The dry run stays useful
+// without them, so failing to determine them is reported as a warning.
+func (c *Client) showRestoreDiff(backup *storage.Backup, chain []storage.VersionInfo, manifest fileManifest, selectedVolume string, multiVolume bool, volumeName string, exists bool) {
+	if c.stripComponents > 0 {
+		fmt.Println("\nℹ️  File changes not shown: --strip-components changes the restored paths")
+		return
+	}
+	if manifest == nil {
+		var err error
+		if manifest, err = c.dryRunManifest(backup, chain, selectedVolume, multiVolume); err != nil {
+			logger.Warnf("cannot show the file changes: %v", err)
+			return
+		}
+		if manifest == nil {
+			fmt.Println("\nℹ️  File changes not shown: the incremental chain has no file manifests")
+			return
+		}
+	}
+	if err := c.printRestoreDiff(volumeName, exists, manifest); err != nil {
+		logger.Warnf("cannot show the file changes: %v", err)
+	}
+}
@@ -2,8 +2,10 @@ package backup
 
 import (
 	"archive/tar"
+	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -13,6 +15,7 @@ import (
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/ypeckstadt/dvom/internal/crypto"
 	"github.com/ypeckstadt/dvom/internal/models"
 	"github.com/ypeckstadt/dvom/internal/storage"
@@ -21,178 +24,366 @@ import (
 
 // BackupDirectVolume backs up a volume directly by volume name (no container required)
 func (c *Client) BackupDirectVolume(volumeName, snapshotName string) error {
+	_, unchanged, err := c.backupDirectVolume(volumeName, snapshotName)
+	c.lastUnchanged = unchanged
+	return err
+}
+
+// backupDirectVolume backs up a volume and returns the stored backup, or the existing version
+// and true when nothing was stored because the volume is unchanged
+func (c *Client) backupDirectVolume(volumeName, snapshotName string) (*storage.Backup, bool, error) {
 	if c.storage == nil {
-		return fmt.Errorf("storage backend is required for volume operations")
+		return nil, false, fmt.Errorf("storage backend is required for volume operations")
 	}
 
 	if c.verbose {
 		fmt.Printf("📸 Creating volume backup '%s' from volume '%s'...\n",
 			snapshotName, volumeName)
 	}
-
-	// Check if volume exists
-	exists, err := c.docker.VolumeExists(volumeName)
-	if err != nil {
-		return fmt.Errorf("failed to check volume: %w", err)
-	}
-	if !exists {
-		return fmt.Errorf("volume '%s' not found", volumeName)
+	if stored := storage.NormalizeSnapshotName(snapshotName); stored != snapshotName && !c.quiet {
+		fmt.Printf("ℹ️  Snapshot name '%s' will be stored as '%s'\n", snapshotName, stored)
 	}
 
 	// Get volume info
-	volumeInfo, err := c.docker.GetVolume(volumeName)
+	volumeInfo, err := c.lookupSource(volumeName)
 	if err != nil {
-		return err
+		return nil, false, err
 	}
 
 	if c.verbose {
 		fmt.Printf("📦 Found volume: %s (driver: %s)\n", volumeInfo.Name, volumeInfo.Driver)
 	}
 
+	if err := c.checkDriverSupported(*volumeInfo); err != nil {
+		return nil, false, err
+	}
+
+	if c.skipUnmodified {
+		previous, err := c.unmodifiedSinceLastBackup(*volumeInfo, snapshotName)
+		if err != nil {
+			return nil, false, err
+		}
+		if previous != nil {
+			if !c.quiet {
+				fmt.Printf("⏭️  Volume '%s' has no files modified since %s, skipping backup\n", volumeName, previous.ID)
+			}
+			return &storage.Backup{ID: previous.ID, Metadata: *previous}, true, c.applyRetention(snapshotName, previous.ID)
+		}
+	}
+
+	// An incremental backup archives only the files modified since its parent was taken
+	var parent *storage.BackupMetadata
+	if c.incremental {
+		parent, err = c.incrementalParent(*volumeInfo, snapshotName)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	parentID := ""
+	if parent != nil {
+		since := parent.SourceTime.Add(-clockSkewMargin)
+		c.modifiedSince = &since
+		defer func() { c.modifiedSince = nil }()
+		parentID = parent.ID
+	}
+
+	c.measureVolumeSize(volumeInfo)
+
+	// Files modified after this point are picked up by the next --since-last-modified check
+	sourceTime := time.Now()
+
+	if c.stream {
+		stored, err := c.streamDirectVolume(*volumeInfo, snapshotName, sourceTime, parentID)
+		if err != nil {
+			return nil, false, err
+		}
+		if err := c.verifyNewBackup(stored); err != nil {
+			return nil, false, err
+		}
+		return stored, false, c.applyRetention(snapshotName, stored.ID)
+	}
+
 	// Create temporary file for backup
 	tempFile, err := os.CreateTemp("", "dvom-volume-*.tar.gz")
 	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
+		return nil, false, fmt.Errorf("failed to create temp file: %w", err)
 	}
 	defer func() {
-		if err := os.Remove(tempFile.Name()); err != nil && c.verbose {
-			fmt.Printf("Warning: failed to remove temp file: %v\n", err)
+		if err := os.Remove(tempFile.Name()); err != nil {
+			logger.Warnf("failed to remove temp file: %v", err)
 		}
 	}()
 	defer func() {
-		if err := tempFile.Close(); err != nil && c.verbose {
-			fmt.Printf("Warning: failed to close temp file: %v\n", err)
+		if err := tempFile.Close(); err != nil {
+			logger.Warnf("failed to close temp file: %v", err)
 		}
 	}()
 
 	// Backup the volume using a temporary container
-	var spinner *IndeterminateProgress
+	var archiveWriter io.Writer = tempFile
+	var progress *archiveProgress
 	if !c.quiet {
-		spinner = NewIndeterminateProgress("💾 Creating volume backup")
-		defer spinner.Stop()
+		progress = newArchiveProgress(tempFile, "💾 Creating volume backup")
+		defer progress.Stop()
+		archiveWriter = progress
 	} else if c.verbose {
 		fmt.Println("💾 Creating volume backup...")
 	}
 
-	if err := c.backupDirectVolume(*volumeInfo, tempFile.Name()); err != nil {
-		return err
+	archiveOptions := c.archiveOptions()
+	archiveOptions.Strategy, err = c.archiveVolume(*volumeInfo, archiveWriter)
+	if err != nil {
+		return nil, false, err
 	}
 
-	if spinner != nil {
-		spinner.Stop()
+	if progress != nil {
+		progress.Stop()
 	}
 
-	// Prepare for storage
-	if _, err := tempFile.Seek(0, 0); err != nil {
-		return fmt.Errorf("failed to seek temp file: %w", err)
-	}
-	stat, err := tempFile.Stat()
+	// Capture the archive contents and guard against silently empty volumes
+	archiveStats, err := inspectArchive(tempFile.Name(), archiveOptions.Compression)
 	if err != nil {
-		return fmt.Errorf("failed to stat backup file: %w", err)
+		return nil, false, err
 	}
-
-	// Handle encryption if enabled
-	var finalReader io.Reader = tempFile
-	encryptedSize := stat.Size()
-	isEncrypted := false
-
-	if c.encryptEnabled {
-		// Get password if not provided
-		password := c.password
-		if password == "" {
-			password = c.promptPassword("Enter encryption password: ", true)
-			if password == "" {
-				return fmt.Errorf("encryption password is required")
-			}
+	if c.verbose {
+		fmt.Printf("📊 Archive contains %d file(s), %.1f MB uncompressed\n", archiveStats.FileCount, float64(archiveStats.UncompressedSize)/(1024*1024))
+	}
+	// An increment is legitimately empty when no file changed
+	if parent == nil {
+		if err := c.checkArchiveNotEmpty(volumeName, archiveStats); err != nil {
+			return nil, false, err
 		}
+	}
 
-		// Create encrypted reader wrapper
-		encryptReader, header, err := crypto.NewEncryptReader(tempFile, password)
+	if c.skipIfUnchanged {
+		existing, err := c.snapshotStorage().FindVersionByContentChecksum(c.ctx, snapshotName, archiveStats.ContentChecksum)
 		if err != nil {
-			return fmt.Errorf("failed to create encryption: %w", err)
+			return nil, false, fmt.Errorf("failed to look up existing versions: %w", err)
 		}
-
-		// Write encryption header to a buffer first
-		var headerBuf bytes.Buffer
-		if err := crypto.WriteEncryptionHeader(&headerBuf, header); err != nil {
-			return fmt.Errorf("failed to write encryption header: %w", err)
+		if existing != nil {
+			if !c.quiet {
+				fmt.Printf("⏭️  Volume '%s' is unchanged since %s, skipping upload\n", volumeName, existing.ID)
+			}
+			return &storage.Backup{ID: existing.ID, Metadata: *existing}, true, c.applyRetention(snapshotName, existing.ID)
 		}
+	}
 
-		// Combine header and encrypted data
-		finalReader = io.MultiReader(&headerBuf, encryptReader)
-		// Estimate encrypted size (header + data + overhead)
-		encryptedSize = int64(headerBuf.Len()) + stat.Size() + (stat.Size()/64/1024)*16 // GCM overhead
-		isEncrypted = true
+	stored, err := c.storeArchive(tempFile, snapshotName, storage.BackupMetadata{
+		Type:             "direct-volume-backup",
+		CreatedAt:        time.Now(),
+		VolumeName:       volumeInfo.Name,
+		VolumeDriver:     volumeInfo.Driver,
+		VolumeLabels:     volumeInfo.Labels,
+		VolumeOptions:    volumeInfo.Options,
+		VolumeSize:       volumeInfo.Size,
+		MountTypes:       mountTypes([]models.VolumeInfo{*volumeInfo}),
+		Description:      backupDescription(volumeName, parentID),
+		FileCount:        archiveStats.FileCount,
+		UncompressedSize: archiveStats.UncompressedSize,
+		ContentChecksum:  archiveStats.ContentChecksum,
+		SourceTime:       &sourceTime,
+		Options:          &archiveOptions,
+		Parent:           parentID,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	c.storeManifest(stored, archiveStats.Manifest)
 
-		if c.verbose {
-			fmt.Println("🔐 Encryption enabled")
+	if err := c.verifyNewBackup(stored); err != nil {
+		return nil, false, err
+	}
+	return stored, false, c.applyRetention(snapshotName, stored.ID)
+}
+
+// verifyNewBackup reports a newly stored backup and verifies it if requested
+func (c *Client) verifyNewBackup(stored *storage.Backup) error {
+	if c.verbose {
+		fmt.Printf("✅ Volume backup created: %s (%.1f MB)\n", stored.ID, float64(stored.Metadata.Size)/(1024*1024))
+	}
+
+	if c.verifyChecksum {
+		if err := c.verifyStoredChecksum(stored); err != nil {
+			return c.failVerification(stored, "does not match the upload", err)
+		}
+	}
+	if c.verifyAfterBackup {
+		if err := c.verifyStoredBackup(stored); err != nil {
+			return c.failVerification(stored, "cannot be read back", err)
 		}
 	}
+	return nil
+}
+
+// storeArchive encrypts a volume archive if enabled and stores it as a new version of the
+// snapshot. The size and encrypted flag of the metadata are set from the stored data. On
+// backends supporting it the upload is resumable, see ResumeBackup.
+func (c *Client) storeArchive(archive *os.File, snapshotName string, metadata storage.BackupMetadata) (*storage.Backup, error) {
+	// Prepare for storage
+	if _, err := archive.Seek(0, 0); err != nil {
+		return nil, fmt.Errorf("failed to seek temp file: %w", err)
+	}
+	stat, err := archive.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat backup file: %w", err)
+	}
+
+	if _, ok := c.storage.(storage.ResumableBackend); !ok {
+		return c.storeStream(archive, stat.Size(), snapshotName, metadata)
+	}
+
+	data, size, header, err := c.encryptArchive(archive, stat.Size())
+	if err != nil {
+		return nil, err
+	}
+	metadata = c.backupMetadata(snapshotName, metadata, size)
+	return c.upload(data, snapshotName, metadata, &resumeState{
+		Snapshot:         snapshotName,
+		Archive:          archive.Name(),
+		ArchiveSize:      stat.Size(),
+		EncryptionHeader: header,
+		SealMetadata:     c.encryptMetadata,
+		Metadata:         metadata,
+		StartedAt:        time.Now(),
+	})
+}
+
+// storeStream encrypts an archive stream of size bytes if enabled and stores it as a new
+// version of the snapshot. A size of 0 means the size is not known in advance, and upload
+// progress is shown without a percentage.
+func (c *Client) storeStream(archive io.Reader, size int64, snapshotName string, metadata storage.BackupMetadata) (*storage.Backup, error) {
+	data, size, _, err := c.encryptArchive(archive, size)
+	if err != nil {
+		return nil, err
+	}
+	return c.upload(data, snapshotName, c.backupMetadata(snapshotName, metadata, size), nil)
+}
+
+// encryptArchive encrypts an archive of size bytes if encryption is enabled. It returns the
+// data to store, its size (0 if unknown) and the encryption header the data starts with, nil
+// if it is not encrypted.
+func (c *Client) encryptArchive(archive io.Reader, size int64) (io.Reader, int64, []byte, error) {
+	if !c.encryptEnabled {
+		return archive, size, nil, nil
+	}
+
+	password, err := c.encryptionPassword("Enter encryption password: ", true)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	// Create encrypted reader wrapper
+	chunkSize := c.cryptoChunkSize
+	if chunkSize == 0 {
+		chunkSize = crypto.DefaultChunkSize
+	}
+	kdf := c.kdf
+	if kdf == "" {
+		kdf = crypto.KDF
+	}
+	if c.keyfile {
+		kdf = crypto.KDFKeyfile
+	}
+	encryptReader, header, err := crypto.NewEncryptReaderWithKDF(archive, password, chunkSize, kdf)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to create encryption: %w", err)
+	}
+
+	// Write encryption header to a buffer first
+	var headerBuf bytes.Buffer
+	if err := crypto.WriteEncryptionHeader(&headerBuf, header); err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to write encryption header: %w", err)
+	}
+	headerBytes := headerBuf.Bytes()
+
+	encryptedSize := int64(0)
+	if size > 0 {
+		encryptedSize = int64(len(headerBytes)) + crypto.EncryptedSize(size, chunkSize)
+	}
+
+	if c.verbose {
+		fmt.Println("🔐 Encryption enabled")
+	}
+
+	// Combine header and encrypted data
+	return io.MultiReader(bytes.NewReader(headerBytes), encryptReader), encryptedSize, headerBytes, nil
+}
+
+// backupMetadata completes the metadata of a new backup of size bytes with the settings of
+// the client
+func (c *Client) backupMetadata(snapshotName string, metadata storage.BackupMetadata, size int64) storage.BackupMetadata {
+	metadata.Name = snapshotName
+	metadata.Size = size
+	metadata.Encrypted = c.encryptEnabled
+	if len(c.tags) > 0 {
+		metadata.Tags = c.tags
+	}
+	if c.sourceContainer != nil {
+		metadata.ContainerID = c.sourceContainer.ID
+		metadata.Container = c.sourceContainer
+	}
+	return metadata
+}
 
+// upload stores data as a new version of the snapshot, showing its progress. With a resume
+// state, the upload is resumable.
+func (c *Client) upload(data io.Reader, snapshotName string, metadata storage.BackupMetadata, resume *resumeState) (*storage.Backup, error) {
 	// Create progress reader for upload
-	dataReader := finalReader
+	data = c.throttle(data)
+	dataReader := data
 	var progressReader *ProgressReader
-	if !c.quiet && encryptedSize > 0 {
-		progressReader = NewProgressReader(finalReader, encryptedSize, "📤 Uploading backup")
+	if !c.quiet && metadata.Size > 0 {
+		progressReader = NewProgressReader(data, metadata.Size, "📤 Uploading backup")
 		dataReader = progressReader
 		defer func() {
-			if err := progressReader.Close(); err != nil && c.verbose {
-				fmt.Printf("Warning: failed to close progress reader: %v\n", err)
+			if err := progressReader.Close(); err != nil {
+				logger.Warnf("failed to close progress reader: %v", err)
 			}
 		}()
+	} else if !c.quiet {
+		spinner := NewIndeterminateProgress("📤 Uploading backup")
+		defer spinner.Stop()
 	}
 
 	// Create storage backup object
 	backup := &storage.Backup{
-		ID: snapshotName,
-		Metadata: storage.BackupMetadata{
-			Name:        snapshotName,
-			Type:        "direct-volume-backup",
-			Size:        encryptedSize,
-			CreatedAt:   time.Now(),
-			VolumeName:  volumeInfo.Name,
-			Description: fmt.Sprintf("Direct volume backup of %s", volumeName),
-			Encrypted:   isEncrypted,
-		},
+		ID:         snapshotName,
+		Metadata:   metadata,
 		DataReader: dataReader,
 	}
 
 	// Store the volume backup
-	snapshotStorage := storage.NewSnapshotStorage(c.storage)
-	if err := snapshotStorage.StoreSnapshot(c.ctx, snapshotName, backup); err != nil {
-		return fmt.Errorf("failed to store volume backup: %w", err)
+	var err error
+	if resume != nil {
+		err = c.storeResumable(backup, resume)
+	} else {
+		err = c.snapshotStorage().StoreSnapshot(c.ctx, snapshotName, backup)
 	}
 
 	if progressReader != nil {
-		if err := progressReader.Close(); err != nil && c.verbose {
-			fmt.Printf("Warning: failed to close progress reader: %v\n", err)
+		if err := progressReader.Close(); err != nil {
+			logger.Warnf("failed to close progress reader: %v", err)
 		}
 	}
 
-	if c.verbose {
-		fmt.Printf("✅ Volume backup created: %s (%.1f MB)\n", snapshotName, float64(stat.Size())/(1024*1024))
+	if err != nil {
+		if resume != nil && resume.kept && !c.quiet {
+			fmt.Printf("💡 Resume the upload with: dvom backup --resume --name %s\n", resume.Snapshot)
+		}
+		return nil, StorageError(fmt.Errorf("failed to store volume backup: %w", err))
 	}
-
-	return nil
+	return backup, nil
 }
 
 // BackupDirectVolumeWithContainers backs up a volume directly with optional container stop/start
 func (c *Client) BackupDirectVolumeWithContainers(volumeName, snapshotName string, stopContainers []string) error {
-	// Stop specified containers before backup
-	stoppedContainers, err := c.stopContainers(stopContainers)
+	stopContainers, err := c.backupStopSet([]string{volumeName}, stopContainers)
 	if err != nil {
-		return fmt.Errorf("failed to stop containers: %w", err)
+		return err
 	}
-
-	// Ensure we restart containers even if backup fails
-	defer func() {
-		if err := c.restartContainers(stoppedContainers); err != nil && c.verbose {
-			fmt.Printf("Warning: failed to restart some containers: %v\n", err)
-		}
-	}()
-
-	// Perform the backup
-	return c.BackupDirectVolume(volumeName, snapshotName)
+	return c.withStoppedContainers(stopContainers, func() error {
+		return c.BackupDirectVolume(volumeName, snapshotName)
+	})
 }
 
 // RestoreDirectVolume restores a volume backup directly to a volume (no container required)
@@ -206,31 +397,22 @@ func (c *Client) RestoreDirectVolume(volumeName, snapshotName string, dryRun, fo
 			snapshotName, volumeName)
 	}
 
-	// Check if target volume exists
-	exists, err := c.docker.VolumeExists(volumeName)
-	if err != nil {
-		return fmt.Errorf("failed to check target volume: %w", err)
-	}
-	if !exists {
-		return fmt.Errorf("target volume '%s' not found", volumeName)
-	}
-
-	// Get target volume info
-	volumeInfo, err := c.docker.GetVolume(volumeName)
+	// Check the target volume, which is created later if missing and --create-volume is set
+	volumeInfo, exists, err := c.lookupTargetVolume(volumeName)
 	if err != nil {
 		return err
 	}
 
 	// Retrieve volume backup
-	snapshotStorage := storage.NewSnapshotStorage(c.storage)
+	snapshotStorage := c.snapshotStorage()
 	backup, err := snapshotStorage.GetSnapshot(c.ctx, snapshotName)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve volume backup: %w", err)
+		return StorageError(fmt.Errorf("failed to retrieve volume backup: %w", err))
 	}
 	defer func() {
 		if closer, ok := backup.DataReader.(interface{ Close() error }); ok {
-			if err := closer.Close(); err != nil && c.verbose {
-				fmt.Printf("Warning: failed to close backup data reader: %v\n", err)
+			if err := closer.Close(); err != nil {
+				logger.Warnf("failed to close backup data reader: %v", err)
 			}
 		}
 	}()
@@ -244,27 +426,110 @@ func (c *Client) RestoreDirectVolume(volumeName, snapshotName string, dryRun, fo
 		fmt.Printf("   Encrypted: %v\n", backup.Metadata.Encrypted)
 	}
 
+	// Refuse backups produced in a way this version cannot reverse before downloading them
+	if _, err := tarExtractArgs(backup.Metadata.ArchiveOptions()); err != nil {
+		return err
+	}
+
+	selectedVolume, multiVolume, err := c.selectRestoreVolume(backup.Metadata)
+	if err != nil {
+		return err
+	}
+	c.noteBindRestore(backup.Metadata.MountTypes, selectedVolume, volumeName)
+
+	// An incremental backup is restored by replaying the versions it is based on first
+	chain, err := c.backupChain(backup.Metadata)
+	if err != nil {
+		return err
+	}
+
+	// Load the manifest up front, so a backup that cannot be verified is not restored
+	var manifest fileManifest
+	if c.verifyAfterRestore {
+		if multiVolume {
+			return fmt.Errorf("cannot verify the restore: multi-volume snapshots have no file manifest")
+		}
+		if manifest, err = c.restoreManifest(backup.Metadata, chain); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				return fmt.Errorf("cannot verify the restore, only direct volume backups made without --stream record a file manifest: %w", err)
+			}
+			return err
+		}
+	}
+
 	if dryRun {
 		fmt.Printf("\n🎯 Would restore to:\n")
-		fmt.Printf("   Volume: %s (driver: %s)\n", volumeInfo.Name, volumeInfo.Driver)
+		if selectedVolume != "" {
+			fmt.Printf("   From backup volume: %s\n", selectedVolume)
+		}
+		if len(chain) > 0 {
+			fmt.Printf("   Incremental backup: replays %s and %d later version(s) first\n", chain[0].ID, len(chain)-1)
+		}
+		if !exists {
+			spec := c.targetVolumeSpec(backup.Metadata)
+			fmt.Printf("   Volume: %s (will be created, driver: %s)\n", volumeName, spec.Driver)
+			if len(spec.Labels) > 0 {
+				fmt.Printf("   Labels: %s\n", formatKeyValues(spec.Labels))
+			}
+			if len(spec.Options) > 0 {
+				fmt.Printf("   Driver options: %s\n", formatKeyValues(spec.Options))
+			}
+		} else {
+			fmt.Printf("   Volume: %s (driver: %s)\n", volumeInfo.Name, volumeInfo.Driver)
+		}
+		if exists && c.backupBeforeRestore {
+			fmt.Printf("   Current contents backed up to: %s\n", preRestoreSnapshotName(snapshotName))
+		}
+		if manifest != nil {
+			fmt.Printf("   Verified afterwards against a manifest of %d file(s)\n", len(manifest))
+		}
+		c.showRestoreDiff(backup, chain, manifest, selectedVolume, multiVolume, volumeName, exists)
 		fmt.Println("\n✋ Dry run - no changes made")
 		return nil
 	}
 
-	if !force {
-		fmt.Printf("\n⚠️  This will completely overwrite the contents of volume '%s'\n", volumeName)
-		fmt.Printf("⚠️  For best results, stop any containers using this volume first\n")
-		fmt.Printf("⚠️  All existing data in the volume will be deleted and replaced\n")
-		fmt.Print("Continue? (y/N): ")
+	// A volume created for the restore has nothing to overwrite or back up
+	if exists && !force && !confirmVolumeOverwrite(volumeName) {
+		fmt.Println("Restore cancelled")
+		return nil
+	}
+
+	if !exists {
+		volumeInfo, err = c.createTargetVolume(volumeName, c.targetVolumeSpec(backup.Metadata))
+		if err != nil {
+			return err
+		}
+	} else if c.backupBeforeRestore {
+		if err := c.backupPreRestoreState(volumeName, snapshotName, backup.Metadata); err != nil {
+			return err
+		}
+
+		// The safety backup can take long enough for the open download to time out
+		if closer, ok := backup.DataReader.(interface{ Close() error }); ok {
+			if err := closer.Close(); err != nil {
+				logger.Warnf("failed to close backup data reader: %v", err)
+			}
+		}
+		backup, err = snapshotStorage.GetSnapshot(c.ctx, snapshotName)
+		if err != nil {
+			return StorageError(fmt.Errorf("failed to retrieve volume backup: %w", err))
+		}
+	}
+
+	if len(chain) > 0 {
+		if err := c.restoreChain(*volumeInfo, chain); err != nil {
+			return err
+		}
 
-		var response string
-		if _, err := fmt.Scanln(&response); err != nil {
-			// Treat as "N" if there's an error reading response
-			response = "N"
+		// Restoring the chain can take long enough for the open download to time out
+		if closer, ok := backup.DataReader.(interface{ Close() error }); ok {
+			if err := closer.Close(); err != nil {
+				logger.Warnf("failed to close backup data reader: %v", err)
+			}
 		}
-		if response != "y" && response != "Y" {
-			fmt.Println("Restore cancelled")
-			return nil
+		backup, err = snapshotStorage.GetSnapshot(c.ctx, backup.ID)
+		if err != nil {
+			return StorageError(fmt.Errorf("failed to retrieve volume backup: %w", err))
 		}
 	}
 
@@ -274,67 +539,99 @@ func (c *Client) RestoreDirectVolume(volumeName, snapshotName string, dryRun, fo
 		return fmt.Errorf("failed to create temp file: %w", err)
 	}
 	defer func() {
-		if err := os.Remove(tempFile.Name()); err != nil && c.verbose {
-			fmt.Printf("Warning: failed to remove temp file: %v\n", err)
+		if err := os.Remove(tempFile.Name()); err != nil {
+			logger.Warnf("failed to remove temp file: %v", err)
 		}
 	}()
 	defer func() {
-		if err := tempFile.Close(); err != nil && c.verbose {
-			fmt.Printf("Warning: failed to close temp file: %v\n", err)
+		if err := tempFile.Close(); err != nil {
+			logger.Warnf("failed to close temp file: %v", err)
 		}
 	}()
 
-	// Handle decryption if the backup is encrypted
-	finalReader := backup.DataReader
-	
-	if backup.Metadata.Encrypted {
-		// Check if backup starts with encryption header
-		headerBytes := make([]byte, 512) // Read first 512 bytes to check
-		n, err := backup.DataReader.Read(headerBytes)
+	if err := c.downloadBackup(backup, tempFile); err != nil {
+		return err
+	}
+
+	// Pick the selected volume out of a multi-volume snapshot
+	restorePath := tempFile.Name()
+	if multiVolume {
+		restorePath, err = c.extractVolumeArchive(tempFile.Name(), selectedVolume)
 		if err != nil {
-			return fmt.Errorf("failed to read backup header: %w", err)
-		}
-		
-		if !crypto.IsEncrypted(headerBytes) {
-			return fmt.Errorf("backup marked as encrypted but no encryption header found")
+			return err
 		}
-		
-		// Get password if not provided
-		password := c.password
-		if password == "" {
-			password = c.promptPassword("Enter decryption password: ", false)
-			if password == "" {
-				return fmt.Errorf("decryption password is required")
+		defer func() {
+			if err := os.Remove(restorePath); err != nil {
+				logger.Warnf("failed to remove temp file: %v", err)
 			}
-		}
-		
-		// Create reader from the header bytes and remaining data
-		remainingReader := io.MultiReader(bytes.NewReader(headerBytes[:n]), backup.DataReader)
-		
-		// Read encryption header
-		header, err := crypto.ReadEncryptionHeader(remainingReader)
-		if err != nil {
-			return fmt.Errorf("failed to read encryption header: %w", err)
-		}
-		
-		// Create decryption reader
-		decryptReader, err := crypto.NewDecryptReader(remainingReader, password, header)
-		if err != nil {
-			return fmt.Errorf("failed to create decryption: %w", err)
-		}
-		
-		finalReader = decryptReader
-		
+		}()
 		if c.verbose {
-			fmt.Println("🔓 Decrypting backup...")
+			fmt.Printf("📦 Restoring only volume '%s' from the snapshot\n", selectedVolume)
 		}
 	}
 
+	// Restore the volume
+	var spinner *IndeterminateProgress
+	if !c.quiet {
+		spinner = NewIndeterminateProgress("📥 Restoring volume data")
+		defer spinner.Stop()
+	} else if c.verbose {
+		fmt.Println("📥 Restoring volume data...")
+	}
+
+	if err := c.restoreDirectVolume(*volumeInfo, restorePath, backup.Metadata.ArchiveOptions(), len(chain) == 0); err != nil {
+		return fmt.Errorf("failed to restore volume: %w", err)
+	}
+
+	if spinner != nil {
+		spinner.Stop()
+	}
+
+	if c.verbose {
+		fmt.Printf("✅ Volume restored successfully to %s\n", volumeInfo.Name)
+	}
+
+	if manifest != nil {
+		return c.verifyRestoredVolume(volumeInfo.Name, manifest)
+	}
+	return nil
+}
+
+// plainDataReader returns a reader yielding the unencrypted archive data of a retrieved backup,
+// downloaded no faster than the rate limit
+func (c *Client) plainDataReader(backup *storage.Backup) (io.Reader, error) {
+	data := c.throttle(backup.DataReader)
+	if !backup.Metadata.Encrypted {
+		return data, nil
+	}
+
+	// Check if backup starts with encryption header
+	bufferedReader := bufio.NewReader(data)
+	headerBytes, err := bufferedReader.Peek(8)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup header: %w", err)
+	}
+
+	if !crypto.IsEncrypted(headerBytes) {
+		return nil, fmt.Errorf("backup marked as encrypted but no encryption header found")
+	}
+
+	return c.decryptingReader(bufferedReader)
+}
+
+// downloadBackup writes the data of a retrieved backup to file, decrypting it if needed, and
+// closes the file
+func (c *Client) downloadBackup(backup *storage.Backup, file *os.File) error {
+	finalReader, err := c.plainDataReader(backup)
+	if err != nil {
+		return err
+	}
+
 	// Copy backup data to temp file with progress
 	var progressWriter *ProgressWriter
-	var writer io.Writer = tempFile
+	var writer io.Writer = file
 	if !c.quiet && backup.Metadata.Size > 0 {
-		progressWriter = NewProgressWriter(tempFile, backup.Metadata.Size, "📥 Downloading backup")
+		progressWriter = NewProgressWriter(file, backup.Metadata.Size, "📥 Downloading backup")
 		writer = progressWriter
 	}
 
@@ -343,14 +640,121 @@ func (c *Client) RestoreDirectVolume(volumeName, snapshotName string, dryRun, fo
 	}
 
 	if progressWriter != nil {
-		if err := progressWriter.Close(); err != nil && c.verbose {
-			fmt.Printf("Warning: failed to close progress writer: %v\n", err)
+		progressWriter.Complete()
+		if err := progressWriter.Close(); err != nil {
+			logger.Warnf("failed to close progress writer: %v", err)
 		}
 	}
 
-	if err := tempFile.Close(); err != nil {
+	if err := file.Close(); err != nil {
 		return fmt.Errorf("failed to close temp file: %w", err)
 	}
+	return nil
+}
+
+// RestoreDirectVolumeWithContainers restores a volume backup with optional container stop/start
+func (c *Client) RestoreDirectVolumeWithContainers(volumeName, snapshotName string, dryRun, force bool, stopContainers []string) error {
+	return c.withStoppedContainers(stopContainers, func() error {
+		return c.RestoreDirectVolume(volumeName, snapshotName, dryRun, force)
+	})
+}
+
+// RestoreFromFile restores a local backup archive directly to a volume without using a storage backend
+func (c *Client) RestoreFromFile(volumeName, backupFile string, dryRun, force bool) error {
+	if c.verbose {
+		fmt.Printf("🔄 Restoring backup file '%s' to volume '%s'...\n", backupFile, volumeName)
+	}
+
+	// Check the target volume, which is created later if missing and --create-volume is set
+	volumeInfo, exists, err := c.lookupTargetVolume(volumeName)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(backupFile) // #nosec G304 - user provided backup file path
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Warnf("failed to close backup file: %v", err)
+		}
+	}()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat backup file: %w", err)
+	}
+
+	// Detect encrypted archives by their header
+	bufferedReader := bufio.NewReader(file)
+	headerBytes, err := bufferedReader.Peek(8)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read backup header: %w", err)
+	}
+	isEncrypted := crypto.IsEncrypted(headerBytes)
+
+	if c.verbose {
+		fmt.Printf("📦 Backup file info:\n")
+		fmt.Printf("   Path: %s\n", backupFile)
+		fmt.Printf("   Size: %.1f MB\n", float64(stat.Size())/(1024*1024))
+		fmt.Printf("   Encrypted: %v\n", isEncrypted)
+	}
+
+	// A backup file records no volume driver
+	if dryRun {
+		fmt.Printf("\n🎯 Would restore to:\n")
+		if !exists {
+			fmt.Printf("   Volume: %s (will be created, driver: %s)\n", volumeName, c.targetVolumeSpec(storage.BackupMetadata{}).Driver)
+		} else {
+			fmt.Printf("   Volume: %s (driver: %s)\n", volumeInfo.Name, volumeInfo.Driver)
+		}
+		fmt.Println("\n✋ Dry run - no changes made")
+		return nil
+	}
+
+	if exists && !force && !confirmVolumeOverwrite(volumeName) {
+		fmt.Println("Restore cancelled")
+		return nil
+	}
+
+	if !exists {
+		volumeInfo, err = c.createTargetVolume(volumeName, c.targetVolumeSpec(storage.BackupMetadata{}))
+		if err != nil {
+			return err
+		}
+	}
+
+	archivePath := backupFile
+	if isEncrypted {
+		decryptReader, err := c.decryptingReader(bufferedReader)
+		if err != nil {
+			return err
+		}
+
+		// Decrypt into a temp file the restore container can be fed from
+		tempFile, err := os.CreateTemp("", "dvom-restore-*.tar.gz")
+		if err != nil {
+			return fmt.Errorf("failed to create temp file: %w", err)
+		}
+		defer func() {
+			if err := os.Remove(tempFile.Name()); err != nil {
+				logger.Warnf("failed to remove temp file: %v", err)
+			}
+		}()
+
+		if _, err := io.Copy(tempFile, decryptReader); err != nil {
+			if closeErr := tempFile.Close(); closeErr != nil {
+				logger.Warnf("failed to close temp file: %v", closeErr)
+			}
+			return fmt.Errorf("failed to decrypt backup file: %w", err)
+		}
+		if err := tempFile.Close(); err != nil {
+			return fmt.Errorf("failed to close temp file: %w", err)
+		}
+
+		archivePath = tempFile.Name()
+	}
 
 	// Restore the volume
 	var spinner *IndeterminateProgress
@@ -361,7 +765,14 @@ func (c *Client) RestoreDirectVolume(volumeName, snapshotName string, dryRun, fo
 		fmt.Println("📥 Restoring volume data...")
 	}
 
-	if err := c.restoreDirectVolume(*volumeInfo, tempFile.Name()); err != nil {
+	// A backup file carries no metadata, so it is assumed to use the default options with the
+	// compression detected from the archive
+	options := storage.DefaultBackupOptions()
+	options.Compression, err = detectFileCompression(archivePath)
+	if err != nil {
+		return err
+	}
+	if err := c.restoreDirectVolume(*volumeInfo, archivePath, options, true); err != nil {
 		return fmt.Errorf("failed to restore volume: %w", err)
 	}
 
@@ -376,32 +787,77 @@ func (c *Client) RestoreDirectVolume(volumeName, snapshotName string, dryRun, fo
 	return nil
 }
 
-// RestoreDirectVolumeWithContainers restores a volume backup with optional container stop/start
-func (c *Client) RestoreDirectVolumeWithContainers(volumeName, snapshotName string, dryRun, force bool, stopContainers []string) error {
-	// Stop specified containers before restore
-	stoppedContainers, err := c.stopContainers(stopContainers)
+// RestoreFromFileWithContainers restores a local backup archive with optional container stop/start
+func (c *Client) RestoreFromFileWithContainers(volumeName, backupFile string, dryRun, force bool, stopContainers []string) error {
+	return c.withStoppedContainers(stopContainers, func() error {
+		return c.RestoreFromFile(volumeName, backupFile, dryRun, force)
+	})
+}
+
+// confirmVolumeOverwrite asks the user to confirm overwriting a volume
+func confirmVolumeOverwrite(volumeName string) bool {
+	fmt.Printf("\n⚠️  This will completely overwrite the contents of volume '%s'\n", volumeName)
+	fmt.Printf("⚠️  For best results, stop any containers using this volume first\n")
+	fmt.Printf("⚠️  All existing data in the volume will be deleted and replaced\n")
+	fmt.Print("Continue? (y/N): ")
+
+	var response string
+	if _, err := fmt.Scanln(&response); err != nil {
+		// Treat as "N" if there's an error reading response
+		response = "N"
+	}
+	return response == "y" || response == "Y"
+}
+
+// decryptingReader reads the encryption header from r and returns a reader yielding the decrypted data
+func (c *Client) decryptingReader(r io.Reader) (io.Reader, error) {
+	// Read encryption header
+	header, err := crypto.ReadEncryptionHeader(r)
 	if err != nil {
-		return fmt.Errorf("failed to stop containers: %w", err)
+		return nil, fmt.Errorf("failed to read encryption header: %w", err)
 	}
 
-	// Ensure we restart containers even if restore fails
-	defer func() {
-		if err := c.restartContainers(stoppedContainers); err != nil && c.verbose {
-			fmt.Printf("Warning: failed to restart some containers: %v\n", err)
-		}
-	}()
+	// The header records whether the backup was encrypted with a keyfile or a password
+	if header.KDF == crypto.KDFKeyfile && !c.keyfile {
+		return nil, fmt.Errorf("backup was encrypted with a keyfile: use --keyfile to restore it")
+	}
+	if header.KDF != crypto.KDFKeyfile && c.keyfile {
+		return nil, fmt.Errorf("backup was encrypted with a password: use --password instead of --keyfile")
+	}
+
+	password, err := c.encryptionPassword("Enter decryption password: ", false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create decryption reader
+	decryptReader, err := crypto.NewDecryptReader(r, password, header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create decryption: %w", err)
+	}
+
+	if c.verbose {
+		fmt.Println("🔓 Decrypting backup...")
+	}
+
+	return decryptReader, nil
+}
 
-	// Perform the restore
-	return c.RestoreDirectVolume(volumeName, snapshotName, dryRun, force)
+// stoppedContainer records a container stopped before an operation
+type stoppedContainer struct {
+	ID         string
+	Name       string
+	WasRunning bool
 }
 
-// stopContainers stops the specified containers and returns their IDs and running states
-func (c *Client) stopContainers(containerNames []string) (map[string]bool, error) {
+// stopContainers stops the specified containers in the given order and returns them in stop order
+func (c *Client) stopContainers(containerNames []string) ([]stoppedContainer, error) {
 	if len(containerNames) == 0 {
-		return make(map[string]bool), nil
+		return nil, nil
 	}
 
-	stoppedContainers := make(map[string]bool)
+	var stoppedContainers []stoppedContainer
+	seen := make(map[string]bool)
 
 	if c.verbose {
 		fmt.Printf("🛑 Stopping %d container(s)...\n", len(containerNames))
@@ -414,15 +870,41 @@ func (c *Client) stopContainers(containerNames []string) (map[string]bool, error
 			return stoppedContainers, fmt.Errorf("container '%s' not found: %w", name, err)
 		}
 
+		// Skip containers listed more than once
+		if seen[container.ID] {
+			continue
+		}
+		seen[container.ID] = true
+
 		// Check if container is running and stop it
-		wasRunning, err := c.docker.StopContainer(container.ID)
+		wasRunning, killed, err := c.docker.StopContainer(container.ID, c.stopTimeout, c.forceStop)
 		if err != nil {
 			return stoppedContainers, fmt.Errorf("failed to stop container '%s': %w", name, err)
 		}
 
-		stoppedContainers[container.ID] = wasRunning
+		stoppedContainers = append(stoppedContainers, stoppedContainer{
+			ID:         container.ID,
+			Name:       name,
+			WasRunning: wasRunning,
+		})
 
-		if c.verbose {
+		action := models.ContainerAlreadyStopped
+		switch {
+		case killed:
+			action = models.ContainerKilled
+		case wasRunning:
+			action = models.ContainerStopped
+		}
+		c.containerResults = append(c.containerResults, models.ContainerResult{
+			Name:   name,
+			ID:     container.ID,
+			Action: action,
+		})
+
+		if killed && !c.quiet {
+			fmt.Printf("   ⚠️  Killed: %s (%s) did not stop within %s\n", name, container.ID[:12], c.stopTimeout)
+		}
+		if c.verbose && !killed {
 			if wasRunning {
 				fmt.Printf("   ✅ Stopped: %s (%s)\n", name, container.ID[:12])
 			} else {
@@ -434,16 +916,16 @@ func (c *Client) stopContainers(containerNames []string) (map[string]bool, error
 	return stoppedContainers, nil
 }
 
-// restartContainers restarts containers that were previously running
-func (c *Client) restartContainers(stoppedContainers map[string]bool) error {
+// restartContainers restarts containers that were previously running, in reverse stop order
+func (c *Client) restartContainers(stoppedContainers []stoppedContainer) error {
 	if len(stoppedContainers) == 0 {
 		return nil
 	}
 
 	var errors []string
 	runningCount := 0
-	for _, wasRunning := range stoppedContainers {
-		if wasRunning {
+	for _, stopped := range stoppedContainers {
+		if stopped.WasRunning {
 			runningCount++
 		}
 	}
@@ -452,17 +934,32 @@ func (c *Client) restartContainers(stoppedContainers map[string]bool) error {
 		fmt.Printf("🔄 Restarting %d container(s)...\n", runningCount)
 	}
 
-	for containerID, wasRunning := range stoppedContainers {
-		if wasRunning {
-			if err := c.docker.StartContainer(containerID); err != nil {
-				errors = append(errors, fmt.Sprintf("failed to restart container %s: %v", containerID[:12], err))
-				if c.verbose {
-					fmt.Printf("   ❌ Failed to restart: %s\n", containerID[:12])
-				}
-			} else if c.verbose {
-				fmt.Printf("   ✅ Restarted: %s\n", containerID[:12])
+	for i := len(stoppedContainers) - 1; i >= 0; i-- {
+		stopped := stoppedContainers[i]
+		if !stopped.WasRunning {
+			continue
+		}
+
+		result := models.ContainerResult{
+			Name:   stopped.Name,
+			ID:     stopped.ID,
+			Action: models.ContainerRestarted,
+		}
+		err := c.docker.StartContainer(stopped.ID)
+		if err == nil {
+			err = c.waitForRestart(stopped)
+		}
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("failed to restart container %s: %v", stopped.Name, err))
+			result.Action = models.ContainerRestartFailed
+			result.Error = err.Error()
+			if c.verbose {
+				fmt.Printf("   ❌ Failed to restart: %s (%s)\n", stopped.Name, stopped.ID[:12])
 			}
+		} else if c.verbose {
+			fmt.Printf("   ✅ Restarted: %s (%s)\n", stopped.Name, stopped.ID[:12])
 		}
+		c.containerResults = append(c.containerResults, result)
 	}
 
 	if len(errors) > 0 {
@@ -472,43 +969,40 @@ func (c *Client) restartContainers(stoppedContainers map[string]bool) error {
 	return nil
 }
 
-// backupDirectVolume backs up a volume using a temporary container
-func (c *Client) backupDirectVolume(volume models.VolumeInfo, outputFile string) error {
+// archiveSource archives a volume name or host path to w using a temporary container
+func (c *Client) archiveSource(source string, w io.Writer) error {
 	dockerClient := c.docker.GetDockerClient()
 
 	// Create a temporary container to access the volume
-	resp, err := dockerClient.ContainerCreate(
-		context.Background(),
-		&container.Config{
-			Image: "alpine:latest",
-			Cmd:   []string{"tar", "czf", "/backup.tar.gz", "-C", "/data", "."},
-		},
+	options := c.archiveOptions()
+	cmd, err := tarCreateCommand(options)
+	if err != nil {
+		return err
+	}
+	resp, err := c.createHelperContainer(
+		"backup",
+		&container.Config{Cmd: cmd},
 		&container.HostConfig{
-			Binds: []string{
-				fmt.Sprintf("%s:/data:ro", volume.Name),
-			},
+			Mounts: []mount.Mount{helperMount(source, "/data", true)},
 		},
-		nil,
-		nil,
-		"",
 	)
 	if err != nil {
-		return fmt.Errorf("failed to create backup container: %w", err)
+		return err
 	}
 
 	defer func() {
-		if err := dockerClient.ContainerRemove(context.Background(), resp.ID, container.RemoveOptions{Force: true}); err != nil && c.verbose {
-			fmt.Printf("Warning: failed to remove container %s: %v\n", resp.ID, err)
+		if err := dockerClient.ContainerRemove(context.WithoutCancel(c.ctx), resp.ID, container.RemoveOptions{Force: true}); err != nil {
+			logger.Warnf("failed to remove container %s: %v", resp.ID, err)
 		}
 	}()
 
 	// Start the container
-	if err := dockerClient.ContainerStart(context.Background(), resp.ID, container.StartOptions{}); err != nil {
+	if err := dockerClient.ContainerStart(c.ctx, resp.ID, container.StartOptions{}); err != nil {
 		return fmt.Errorf("failed to start backup container: %w", err)
 	}
 
 	// Wait for completion
-	statusCh, errCh := dockerClient.ContainerWait(context.Background(), resp.ID, container.WaitConditionNotRunning)
+	statusCh, errCh := dockerClient.ContainerWait(c.ctx, resp.ID, container.WaitConditionNotRunning)
 	select {
 	case err := <-errCh:
 		if err != nil {
@@ -516,45 +1010,18 @@ func (c *Client) backupDirectVolume(volume models.VolumeInfo, outputFile string)
 		}
 	case status := <-statusCh:
 		if status.StatusCode != 0 {
-			// Get container logs for debugging
-			logs, logErr := dockerClient.ContainerLogs(context.Background(), resp.ID, container.LogsOptions{
-				ShowStdout: true,
-				ShowStderr: true,
-			})
-			if logErr == nil {
-				defer func() {
-					if err := logs.Close(); err != nil && c.verbose {
-						fmt.Printf("Warning: failed to close logs: %v\n", err)
-					}
-				}()
-				logData, _ := io.ReadAll(logs)
-				if len(logData) > 0 {
-					return fmt.Errorf("backup container failed with exit code %d. Logs: %s", status.StatusCode, string(logData))
-				}
-			}
-			return fmt.Errorf("backup container exited with code %d", status.StatusCode)
+			return c.helperFailure(resp.ID, "backup", cmd, status.StatusCode)
 		}
 	}
 
 	// Copy the backup file from container
-	reader, _, err := dockerClient.CopyFromContainer(context.Background(), resp.ID, "/backup.tar.gz")
+	reader, _, err := dockerClient.CopyFromContainer(c.ctx, resp.ID, "/backup.tar.gz")
 	if err != nil {
 		return fmt.Errorf("failed to copy backup from container: %w", err)
 	}
 	defer func() {
-		if err := reader.Close(); err != nil && c.verbose {
-			fmt.Printf("Warning: failed to close reader: %v\n", err)
-		}
-	}()
-
-	// Write to output file
-	outFile, err := os.Create(outputFile) // #nosec G304 - controlled backup output path
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
-	}
-	defer func() {
-		if err := outFile.Close(); err != nil && c.verbose {
-			fmt.Printf("Warning: failed to close output file: %v\n", err)
+		if err := reader.Close(); err != nil {
+			logger.Warnf("failed to close reader: %v", err)
 		}
 	}()
 
@@ -574,9 +1041,20 @@ func (c *Client) backupDirectVolume(volume models.VolumeInfo, outputFile string)
 		if header.Name == "backup.tar.gz" || strings.HasSuffix(header.Name, "/backup.tar.gz") {
 			// Limit copy size to prevent decompression bombs (100GB max)
 			const maxBackupSize = 100 * 1024 * 1024 * 1024
-			if _, err := io.CopyN(outFile, tarReader, maxBackupSize); err != nil && err != io.EOF {
+			compressor, err := newCompressor(w, options)
+			if err != nil {
+				return err
+			}
+			var archive io.Reader = tarReader
+			if tracker, ok := w.(archiveCopyTracker); ok {
+				archive = tracker.trackCopy(tarReader, header.Size)
+			}
+			if _, err := io.CopyN(compressor, archive, maxBackupSize); err != nil && err != io.EOF {
 				return fmt.Errorf("failed to copy backup data: %w", err)
 			}
+			if err := compressor.Close(); err != nil {
+				return fmt.Errorf("failed to compress backup data: %w", err)
+			}
 			found = true
 			break
 		}
@@ -589,60 +1067,94 @@ func (c *Client) backupDirectVolume(volume models.VolumeInfo, outputFile string)
 	return nil
 }
 
-// restoreDirectVolume restores a volume using a temporary container
-func (c *Client) restoreDirectVolume(volume models.VolumeInfo, backupFile string) error {
+// restoreDirectVolume restores a volume using a temporary container. The volume is emptied
+// first if clean is set; otherwise the archive is extracted over its contents.
+func (c *Client) restoreDirectVolume(volume models.VolumeInfo, backupFile string, options storage.BackupOptions, clean bool) error {
 	dockerClient := c.docker.GetDockerClient()
 
-	// Read backup file
-	backupData, err := os.ReadFile(backupFile) // #nosec G304 - controlled backup file path
+	tarArgs, err := tarExtractArgs(options)
+	if err != nil {
+		return err
+	}
+
+	// Open the archive the helper extracts; it is streamed into the container, not read into
+	// memory
+	archivePath, cleanup, err := decompressOnHost(backupFile, options)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	archive, err := os.Open(archivePath) // #nosec G304 - controlled backup file path
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer func() {
+		if err := archive.Close(); err != nil {
+			logger.Warnf("failed to close backup file: %v", err)
+		}
+	}()
+	stat, err := archive.Stat()
 	if err != nil {
-		return fmt.Errorf("failed to read backup file: %w", err)
+		return fmt.Errorf("failed to stat backup file: %w", err)
+	}
+
+	if c.stripComponents > 0 {
+		remaining, err := countEntriesAfterStrip(backupFile, c.stripComponents, options.Compression)
+		if err != nil {
+			return err
+		}
+		if remaining == 0 {
+			logger.Warnf("--strip-components=%d removes every entry of the backup; the volume will be left empty", c.stripComponents)
+		}
+		tarArgs = append(tarArgs, fmt.Sprintf("--strip-components=%d", c.stripComponents))
 	}
 
 	// Create a temporary container with the backup file
-	resp, err := dockerClient.ContainerCreate(
-		context.Background(),
-		&container.Config{
-			Image: "alpine:latest",
-			Cmd:   []string{"sh", "-c", "rm -rf /data/* /data/.[^.]* && cd /data && tar xzf /backup.tar.gz"},
-		},
+	cmd := restoreCommand(tarArgs...)
+	if !clean {
+		cmd = applyLayerCommand(tarArgs...)
+	}
+	resp, err := c.createHelperContainer(
+		"restore",
+		&container.Config{Cmd: cmd},
 		&container.HostConfig{
-			Binds: []string{
-				fmt.Sprintf("%s:/data", volume.Name),
-			},
+			Mounts: []mount.Mount{helperMount(volume.Name, "/data", false)},
 		},
-		nil,
-		nil,
-		"",
 	)
 	if err != nil {
-		return fmt.Errorf("failed to create restore container: %w", err)
+		return err
 	}
 
 	defer func() {
-		if err := dockerClient.ContainerRemove(context.Background(), resp.ID, container.RemoveOptions{Force: true}); err != nil && c.verbose {
-			fmt.Printf("Warning: failed to remove container %s: %v\n", resp.ID, err)
+		if err := dockerClient.ContainerRemove(context.WithoutCancel(c.ctx), resp.ID, container.RemoveOptions{Force: true}); err != nil {
+			logger.Warnf("failed to remove container %s: %v", resp.ID, err)
 		}
 	}()
 
 	// Copy backup file to container
+	content := createTarWithFile("backup.tar.gz", archive, stat.Size())
+	defer func() {
+		if err := content.Close(); err != nil {
+			logger.Warnf("failed to close backup stream: %v", err)
+		}
+	}()
 	if err := dockerClient.CopyToContainer(
-		context.Background(),
+		c.ctx,
 		resp.ID,
 		"/",
-		createTarWithFile("backup.tar.gz", backupData),
+		content,
 		types.CopyToContainerOptions{},
 	); err != nil {
 		return fmt.Errorf("failed to copy backup to container: %w", err)
 	}
 
 	// Start the container
-	if err := dockerClient.ContainerStart(context.Background(), resp.ID, container.StartOptions{}); err != nil {
+	if err := dockerClient.ContainerStart(c.ctx, resp.ID, container.StartOptions{}); err != nil {
 		return fmt.Errorf("failed to start restore container: %w", err)
 	}
 
 	// Wait for completion
-	statusCh, errCh := dockerClient.ContainerWait(context.Background(), resp.ID, container.WaitConditionNotRunning)
+	statusCh, errCh := dockerClient.ContainerWait(c.ctx, resp.ID, container.WaitConditionNotRunning)
 	select {
 	case err := <-errCh:
 		if err != nil {
@@ -650,37 +1162,21 @@ func (c *Client) restoreDirectVolume(volume models.VolumeInfo, backupFile string
 		}
 	case status := <-statusCh:
 		if status.StatusCode != 0 {
-			// Get container logs for debugging
-			logs, logErr := dockerClient.ContainerLogs(context.Background(), resp.ID, container.LogsOptions{
-				ShowStdout: true,
-				ShowStderr: true,
-			})
-			if logErr == nil {
-				defer func() {
-					if err := logs.Close(); err != nil && c.verbose {
-						fmt.Printf("Warning: failed to close logs: %v\n", err)
-					}
-				}()
-				logData, _ := io.ReadAll(logs)
-				if c.verbose && len(logData) > 0 {
-					fmt.Printf("Container logs: %s\n", string(logData))
-				}
-			}
-			return fmt.Errorf("restore container exited with code %d", status.StatusCode)
+			return c.helperFailure(resp.ID, "restore", cmd, status.StatusCode)
 		}
 	}
 
 	if c.verbose {
 		fmt.Println("🔍 Verifying restore completion...")
 		// Get container logs for verification
-		logs, logErr := dockerClient.ContainerLogs(context.Background(), resp.ID, container.LogsOptions{
+		logs, logErr := dockerClient.ContainerLogs(c.ctx, resp.ID, container.LogsOptions{
 			ShowStdout: true,
 			ShowStderr: true,
 		})
 		if logErr == nil {
 			defer func() {
-				if err := logs.Close(); err != nil && c.verbose {
-					fmt.Printf("Warning: failed to close logs: %v\n", err)
+				if err := logs.Close(); err != nil {
+					logger.Warnf("failed to close logs: %v", err)
 				}
 			}()
 			logData, _ := io.ReadAll(logs)
@@ -693,11 +1189,20 @@ func (c *Client) restoreDirectVolume(volume models.VolumeInfo, backupFile string
 	return nil
 }
 
+// DockerVolumes returns all Docker volumes on the host
+func (c *Client) DockerVolumes() ([]models.VolumeInfo, error) {
+	volumes, err := c.docker.ListVolumes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+	return volumes, nil
+}
+
 // ListDockerVolumes lists all Docker volumes
 func (c *Client) ListDockerVolumes() error {
-	volumes, err := c.docker.ListVolumes()
+	volumes, err := c.DockerVolumes()
 	if err != nil {
-		return fmt.Errorf("failed to list volumes: %w", err)
+		return err
 	}
 
 	if len(volumes) == 0 {
@@ -725,35 +1230,57 @@ func (c *Client) ListDockerVolumes() error {
 	return nil
 }
 
-// createTarWithFile creates a tar archive containing a single file
-func createTarWithFile(filename string, data []byte) io.Reader {
-	buf := new(strings.Builder)
-	tw := tar.NewWriter(buf)
+// createTarWithFile streams a tar archive containing a single file with the size bytes read
+// from r. Closing the returned reader stops the stream if it is not read to the end.
+func createTarWithFile(filename string, r io.Reader, size int64) io.ReadCloser {
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pipeWriter)
+		err := tw.WriteHeader(&tar.Header{
+			Name: filename,
+			Mode: 0600,
+			Size: size,
+		})
+		if err == nil {
+			// A file shorter than size must not end the stream as if it were complete
+			if _, err = io.CopyN(tw, r, size); err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+		}
+		if err == nil {
+			err = tw.Close()
+		}
+		pipeWriter.CloseWithError(err)
+	}()
+	return pipeReader
+}
 
-	header := &tar.Header{
-		Name: filename,
-		Mode: 0600,
-		Size: int64(len(data)),
-	}
+// encryptionPassword returns the password given with SetEncryption or, failing that, the
+// DVOM_ENCRYPTION_PASSWORD environment variable, and otherwise prompts for it (with
+// confirmation if confirm is set) the first time it is needed. The prompted password is kept
+// on the client, so batch operations ask for it at most once per invocation.
+func (c *Client) encryptionPassword(prompt string, confirm bool) (string, error) {
+	c.passwordMu.Lock()
+	defer c.passwordMu.Unlock()
 
-	if err := tw.WriteHeader(header); err != nil {
-		return strings.NewReader("")
-	}
-	if _, err := tw.Write(data); err != nil {
-		return strings.NewReader("")
+	if c.password == "" {
+		c.password = os.Getenv(PasswordEnvVar)
 	}
-	if err := tw.Close(); err != nil {
-		return strings.NewReader("")
+	if c.password == "" {
+		password := c.promptPassword(prompt, confirm)
+		if password == "" {
+			return "", fmt.Errorf("encryption password is required")
+		}
+		c.password = password
 	}
-
-	return strings.NewReader(buf.String())
+	return c.password, nil
 }
 
-// promptPassword prompts the user for a password
+// promptPassword prompts the user for a password on stderr, keeping stdout free for output
 func (c *Client) promptPassword(prompt string, confirm bool) string {
-	fmt.Print(prompt)
+	fmt.Fprint(os.Stderr, prompt)
 	bytePassword, err := term.ReadPassword(int(syscall.Stdin))
-	fmt.Println() // Print newline after password input
+	fmt.Fprintln(os.Stderr) // Print newline after password input
 	if err != nil {
 		if c.verbose {
 			fmt.Printf("Error reading password: %v\n", err)
@@ -764,9 +1291,9 @@ func (c *Client) promptPassword(prompt string, confirm bool) string {
 	password := string(bytePassword)
 	
 	if confirm {
-		fmt.Print("Confirm password: ")
+		fmt.Fprint(os.Stderr, "Confirm password: ")
 		byteConfirm, err := term.ReadPassword(int(syscall.Stdin))
-		fmt.Println()
+		fmt.Fprintln(os.Stderr)
 		if err != nil {
 			if c.verbose {
 				fmt.Printf("Error reading password confirmation: %v\n", err)
@@ -775,7 +1302,7 @@ func (c *Client) promptPassword(prompt string, confirm bool) string {
 		}
 		
 		if password != string(byteConfirm) {
-			fmt.Println("❌ Passwords do not match")
+			fmt.Fprintln(os.Stderr, "❌ Passwords do not match")
 			return ""
 		}
 	}
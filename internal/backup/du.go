@@ -0,0 +1,98 @@
+package backup
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ypeckstadt/dvom/internal/models"
+)
+
+// FileUsage is the size of a single file in a volume
+type FileUsage struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// VolumeUsage is the size of the data in a volume
+type VolumeUsage struct {
+	Volume    string      `json:"volume"`
+	Size      int64       `json:"size"`
+	FileCount int64       `json:"file_count"`
+	Largest   []FileUsage `json:"largest,omitempty"`
+}
+
+// usageScript sums the apparent size of the regular files under /data and lists the $1 largest.
+// The first line of output is "<total bytes> <file count>", followed by "<bytes> <path>" lines.
+const usageScript = `find /data -type f -exec stat -c '%s %n' {} + > /tmp/dvom-sizes || exit 1
+awk '{ total += $1 } END { printf "%.0f %d\n", total, NR }' /tmp/dvom-sizes
+if [ "$1" -gt 0 ]; then sort -rn /tmp/dvom-sizes | head -n "$1"; fi`
+
+// GetVolumeUsage measures a volume's total size and file count in a read-only helper container,
+// without creating a backup. With top > 0 the top largest files are returned as well.
+func (c *Client) GetVolumeUsage(volumeName string, top int) (*VolumeUsage, error) {
+	if !isBindSource(volumeName) {
+		if _, err := c.docker.GetVolume(volumeName); err != nil {
+			return nil, err
+		}
+	}
+	if top < 0 {
+		top = 0
+	}
+
+	if c.verbose {
+		fmt.Printf("📏 Measuring volume %s...\n", volumeName)
+	}
+	output, err := c.runVolumeHelper(volumeName, "usage", []string{"sh", "-c", usageScript, "sh", strconv.Itoa(top)})
+	if err != nil {
+		return nil, err
+	}
+
+	usage, err := parseVolumeUsage(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse usage of volume '%s': %w", volumeName, err)
+	}
+	usage.Volume = volumeName
+	return usage, nil
+}
+
+// measureVolumeSize sets the size of a volume's files, measured in a read-only helper container.
+// A failed measurement only loses the compression ratio, so it is reported as a warning.
+// Volumes archived from a driver snapshot are not measured, as they may not be mountable.
+func (c *Client) measureVolumeSize(volume *models.VolumeInfo) {
+	if !c.needsTarHelper(*volume) {
+		return
+	}
+	usage, err := c.GetVolumeUsage(volume.Name, 0)
+	if err != nil {
+		logger.Warnf("failed to measure volume '%s': %v", volume.Name, err)
+		return
+	}
+	volume.Size = usage.Size
+}
+
+// parseVolumeUsage parses the output of usageScript
+func parseVolumeUsage(output string) (*VolumeUsage, error) {
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+
+	var usage VolumeUsage
+	if _, err := fmt.Sscanf(lines[0], "%d %d", &usage.Size, &usage.FileCount); err != nil {
+		return nil, fmt.Errorf("unexpected summary %q: %w", lines[0], err)
+	}
+
+	for _, line := range lines[1:] {
+		sizeField, path, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		size, err := strconv.ParseInt(sizeField, 10, 64)
+		if err != nil {
+			continue
+		}
+		usage.Largest = append(usage.Largest, FileUsage{
+			Path: strings.TrimPrefix(path, "/data/"),
+			Size: size,
+		})
+	}
+	return &usage, nil
+}
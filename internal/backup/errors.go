@@ -0,0 +1,76 @@
+package backup
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ypeckstadt/dvom/internal/crypto"
+	"github.com/ypeckstadt/dvom/internal/storage"
+)
+
+// Exit codes of the failure classes dvom distinguishes, so scripts and monitoring can tell
+// them apart. Failures of no particular class exit with ExitFailure.
+const (
+	ExitFailure           = 1
+	ExitDockerUnavailable = 2
+	ExitStorage           = 3
+	ExitNotFound          = 4
+	ExitDecryption        = 5
+	ExitIntegrity         = 6
+	// ExitTimeout and ExitInterrupted follow the conventions of timeout(1) and of a shell
+	// reporting SIGINT
+	ExitTimeout     = 124
+	ExitInterrupted = 130
+)
+
+// DvomError is an error classified by the exit code it maps to
+type DvomError struct {
+	Code int
+	Err  error
+}
+
+func (e *DvomError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DvomError) Unwrap() error {
+	return e.Err
+}
+
+// StorageError classifies err as a failure to reach or use the storage backend
+func StorageError(err error) error {
+	return &DvomError{Code: ExitStorage, Err: err}
+}
+
+// dockerError classifies err as a failure to reach the Docker daemon
+func dockerError(err error) error {
+	return &DvomError{Code: ExitDockerUnavailable, Err: err}
+}
+
+// integrityError classifies err as a backup that failed an integrity check
+func integrityError(err error) error {
+	return &DvomError{Code: ExitIntegrity, Err: err}
+}
+
+// ExitCode returns the exit code for err. A missing backup or data that does not decrypt is
+// reported as such wherever it surfaces; otherwise the outermost DvomError decides.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var dvomErr *DvomError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ExitTimeout
+	case errors.Is(err, context.Canceled):
+		return ExitInterrupted
+	case errors.Is(err, storage.ErrNotFound):
+		return ExitNotFound
+	case errors.Is(err, crypto.ErrDecryption):
+		return ExitDecryption
+	case errors.As(err, &dvomErr):
+		return dvomErr.Code
+	}
+	return ExitFailure
+}
@@ -0,0 +1,42 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ypeckstadt/dvom/internal/crypto"
+	"github.com/ypeckstadt/dvom/internal/storage"
+)
+
+func TestExitCode(t *testing.T) {
+	failure := errors.New("failure")
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, 0},
+		{"unclassified", failure, ExitFailure},
+		{"docker", dockerError(failure), ExitDockerUnavailable},
+		{"storage", StorageError(failure), ExitStorage},
+		{"integrity", integrityError(failure), ExitIntegrity},
+		{"wrapped classified error", fmt.Errorf("backup failed: %w", StorageError(failure)), ExitStorage},
+		{"outermost classification wins", StorageError(integrityError(failure)), ExitStorage},
+		{"not found", fmt.Errorf("snapshot %w: db", storage.ErrNotFound), ExitNotFound},
+		{"decryption", fmt.Errorf("open: %w", crypto.ErrDecryption), ExitDecryption},
+		{"deadline inside storage error", StorageError(fmt.Errorf("upload: %w", context.DeadlineExceeded)), ExitTimeout},
+		{"cancel inside storage error", StorageError(fmt.Errorf("upload: %w", context.Canceled)), ExitInterrupted},
+		{"not found inside storage error", StorageError(fmt.Errorf("backup %w: db@1", storage.ErrNotFound)), ExitNotFound},
+		{"decryption inside integrity error", integrityError(fmt.Errorf("verify: %w", crypto.ErrDecryption)), ExitDecryption},
+		{"decryption inside storage error", StorageError(fmt.Errorf("read: %w", crypto.ErrDecryption)), ExitDecryption},
+		{"deadline over not found", StorageError(errors.Join(context.DeadlineExceeded, storage.ErrNotFound)), ExitTimeout},
+	}
+
+	for _, tt := range tests {
+		if got := ExitCode(tt.err); got != tt.want {
+			t.Errorf("%s: ExitCode(%v) = %d, want %d", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
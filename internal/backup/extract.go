@@ -0,0 +1,215 @@
+package backup
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxExtractedFileSize limits the size of a single extracted file to prevent decompression bombs
+const maxExtractedFileSize = 100 * 1024 * 1024 * 1024
+
+// ExtractPath streams a snapshot and writes a single entry of its archive to output on the
+// local filesystem, without touching any Docker volume. A path ending in "/" extracts every
+// entry below that directory into the output directory. Existing files are only replaced
+// when overwrite is set.
+func (c *Client) ExtractPath(snapshotName, entryPath, output string, overwrite bool) error {
+	if c.storage == nil {
+		return fmt.Errorf("storage backend is required for snapshot operations")
+	}
+
+	prefixMatch := strings.HasSuffix(entryPath, "/")
+	wanted := normalizeEntryName(entryPath)
+	if wanted == "" {
+		return fmt.Errorf("--path must name a file or directory inside the backup")
+	}
+
+	if c.verbose {
+		fmt.Printf("📄 Extracting '%s' from snapshot '%s' to %s\n", entryPath, snapshotName, output)
+	}
+
+	backup, err := c.snapshotStorage().GetSnapshot(c.ctx, snapshotName)
+	if err != nil {
+		return StorageError(fmt.Errorf("failed to retrieve volume backup: %w", err))
+	}
+	defer func() {
+		if closer, ok := backup.DataReader.(interface{ Close() error }); ok {
+			if err := closer.Close(); err != nil {
+				logger.Warnf("failed to close backup data reader: %v", err)
+			}
+		}
+	}()
+
+	selectedVolume, multiVolume, err := c.selectRestoreVolume(backup.Metadata)
+	if err != nil {
+		return err
+	}
+	if backup.Metadata.Parent != "" {
+		return fmt.Errorf("%s is an incremental backup holding only the files changed since %s: restore the volume, or extract from a full version", backup.ID, backup.Metadata.Parent)
+	}
+
+	reader, err := c.plainDataReader(backup)
+	if err != nil {
+		return err
+	}
+
+	// Find the selected volume's archive inside a multi-volume snapshot
+	if multiVolume {
+		entry := volumeEntryPath(selectedVolume)
+		outer := tar.NewReader(reader)
+		for {
+			header, err := outer.Next()
+			if err == io.EOF {
+				return fmt.Errorf("%s not found in snapshot", entry)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read backup archive: %w", err)
+			}
+			if header.Name == entry {
+				break
+			}
+		}
+		reader = outer
+	}
+
+	compression := backup.Metadata.ArchiveOptions().Compression
+	decompressed, err := newDecompressor(reader, compression)
+	if err != nil {
+		return fmt.Errorf("failed to open %s archive: %w", compression, err)
+	}
+	defer func() {
+		if err := decompressed.Close(); err != nil {
+			logger.Warnf("failed to close decompressor: %v", err)
+		}
+	}()
+
+	var spinner *IndeterminateProgress
+	if !c.quiet {
+		spinner = NewIndeterminateProgress("📥 Searching backup")
+		defer spinner.Stop()
+	}
+
+	extracted := 0
+	tarReader := tar.NewReader(decompressed)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read backup archive: %w", err)
+		}
+
+		name := normalizeEntryName(header.Name)
+		var destination string
+		switch {
+		case prefixMatch && strings.HasPrefix(name+"/", wanted+"/"):
+			destination = filepath.Join(output, filepath.FromSlash(strings.TrimPrefix(strings.TrimPrefix(name, wanted), "/")))
+		case !prefixMatch && name == wanted:
+			if header.Typeflag == tar.TypeDir {
+				return fmt.Errorf("'%s' is a directory in the backup: use --path %s/ to extract its contents", entryPath, wanted)
+			}
+			destination = output
+		default:
+			continue
+		}
+
+		if err := c.writeExtractedEntry(tarReader, header, destination, overwrite); err != nil {
+			return err
+		}
+		extracted++
+		if !prefixMatch {
+			break
+		}
+	}
+
+	if spinner != nil {
+		spinner.Stop()
+	}
+
+	if extracted == 0 {
+		return fmt.Errorf("path '%s' not found in snapshot '%s'", entryPath, snapshotName)
+	}
+
+	if !c.quiet {
+		fmt.Printf("✅ Extracted %d item(s) to %s\n", extracted, output)
+	}
+	return nil
+}
+
+// writeExtractedEntry writes a tar entry to destination. Only directories, regular files and
+// symlinks are extracted; other entry types are skipped.
+func (c *Client) writeExtractedEntry(tarReader *tar.Reader, header *tar.Header, destination string, overwrite bool) error {
+	mode := os.FileMode(header.Mode).Perm() // #nosec G115 - tar permission bits fit in FileMode
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if err := os.MkdirAll(destination, mode|0700); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", destination, err)
+		}
+		return nil
+	case tar.TypeSymlink:
+		if err := c.prepareExtractDestination(destination, overwrite); err != nil {
+			return err
+		}
+		if err := os.Symlink(header.Linkname, destination); err != nil {
+			return fmt.Errorf("failed to create symlink %s: %w", destination, err)
+		}
+		return nil
+	case tar.TypeReg:
+		// Written below
+	default:
+		logger.Warnf("skipping %s: unsupported entry type", header.Name)
+		return nil
+	}
+
+	if err := c.prepareExtractDestination(destination, overwrite); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode) // #nosec G304 - user provided output path
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", destination, err)
+	}
+	_, copyErr := io.CopyN(file, tarReader, maxExtractedFileSize)
+	if err := file.Close(); err != nil && (copyErr == nil || copyErr == io.EOF) {
+		copyErr = err
+	}
+	if copyErr != nil && copyErr != io.EOF {
+		return fmt.Errorf("failed to extract %s: %w", header.Name, copyErr)
+	}
+
+	if c.verbose {
+		fmt.Printf("   %s -> %s\n", header.Name, destination)
+	}
+	return nil
+}
+
+// prepareExtractDestination creates the parent directory of destination and refuses to
+// replace an existing file unless overwrite is set
+func (c *Client) prepareExtractDestination(destination string, overwrite bool) error {
+	if _, err := os.Lstat(destination); err == nil {
+		if !overwrite {
+			return fmt.Errorf("%s already exists: use --force to overwrite it", destination)
+		}
+		if err := os.Remove(destination); err != nil {
+			return fmt.Errorf("failed to replace %s: %w", destination, err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destination), 0750); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", filepath.Dir(destination), err)
+	}
+	return nil
+}
+
+// normalizeEntryName cleans an archive entry name for matching, dropping leading "./" and "/".
+// Cleaning it as a rooted path also keeps ".." elements from escaping the output directory.
+func normalizeEntryName(name string) string {
+	cleaned := path.Clean("/" + name)
+	return strings.TrimPrefix(cleaned, "/")
+}
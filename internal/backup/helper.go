@@ -0,0 +1,263 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/ypeckstadt/dvom/internal/docker"
+)
+
+// defaultContextLines is the number of log lines shown when a helper container fails
+const defaultContextLines = 20
+
+// DefaultHelperImage is the image helper containers run in unless SetHelperImage overrides it
+const DefaultHelperImage = "alpine:latest"
+
+// SetHelperImage sets the image the temporary backup and restore containers run in. The image
+// must provide sh and a tar with gzip support, like alpine or busybox.
+func (c *Client) SetHelperImage(image string) {
+	c.helperImage = image
+}
+
+// helperImageName returns the image helper containers run in
+func (c *Client) helperImageName() string {
+	if c.helperImage == "" {
+		return DefaultHelperImage
+	}
+	return c.helperImage
+}
+
+// SetNoPull stops a missing helper image from being pulled, for offline Docker hosts
+func (c *Client) SetNoPull(noPull bool) {
+	c.noPull = noPull
+}
+
+// newRunID returns an ID identifying the helper containers of one dvom run
+func newRunID() string {
+	random := make([]byte, 4)
+	if _, err := rand.Read(random); err != nil {
+		return time.Now().Format("20060102-150405")
+	}
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(random)
+}
+
+// createHelperContainer creates a helper container running the helper image, labelled as a
+// dvom helper. If the image is not present on the Docker host, it is pulled and the create is
+// retried, unless pulling is disabled with SetNoPull.
+func (c *Client) createHelperContainer(purpose string, config *container.Config, hostConfig *container.HostConfig) (container.CreateResponse, error) {
+	dockerClient := c.docker.GetDockerClient()
+	config.Image = c.helperImageName()
+	config.Labels = docker.HelperLabels(c.runID, purpose)
+
+	resp, err := dockerClient.ContainerCreate(c.ctx, config, hostConfig, nil, nil, "")
+	if err != nil && errdefs.IsNotFound(err) {
+		if c.noPull {
+			return resp, fmt.Errorf("failed to create %s container: image %s not present, pass --helper-image or pre-pull it (docker pull %s)", purpose, config.Image, config.Image)
+		}
+		if err := c.pullHelperImage(); err != nil {
+			return resp, fmt.Errorf("failed to create %s container: %w", purpose, err)
+		}
+		resp, err = dockerClient.ContainerCreate(c.ctx, config, hostConfig, nil, nil, "")
+	}
+	if err != nil {
+		return resp, fmt.Errorf("failed to create %s container: %w", purpose, err)
+	}
+	return resp, nil
+}
+
+// pullHelperImage pulls the helper image, showing the pull status on a spinner. Concurrent
+// helpers of a parallel backup pull it only once.
+func (c *Client) pullHelperImage() error {
+	c.pullMu.Lock()
+	defer c.pullMu.Unlock()
+
+	image := c.helperImageName()
+	if c.pulledImage == image {
+		return nil
+	}
+
+	if c.verbose {
+		fmt.Printf("📥 Helper image %s not present, pulling it\n", image)
+	}
+	var spinner *IndeterminateProgress
+	if !c.quiet {
+		spinner = NewIndeterminateProgress(fmt.Sprintf("📥 Pulling %s", image))
+		defer spinner.Stop()
+	}
+
+	err := c.docker.PullImage(image, func(status string) {
+		if spinner != nil {
+			spinner.Update(fmt.Sprintf("📥 Pulling %s: %s", image, strings.ReplaceAll(status, `"`, "")))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	c.pulledImage = image
+	return nil
+}
+
+// SetContextLines sets how many trailing stderr lines of a failed helper container are reported
+func (c *Client) SetContextLines(lines int) {
+	if lines < 0 {
+		lines = 0
+	}
+	c.contextLines = lines
+}
+
+// helperMount mounts a volume name, or an absolute host path, into a helper container. Mounts
+// are passed as structured fields rather than "source:target" bind strings so names and paths
+// containing colons, commas or spaces are not misparsed.
+func helperMount(source, target string, readOnly bool) mount.Mount {
+	mountType := mount.TypeVolume
+	if filepath.IsAbs(source) {
+		mountType = mount.TypeBind
+	}
+	return mount.Mount{
+		Type:     mountType,
+		Source:   source,
+		Target:   target,
+		ReadOnly: readOnly,
+	}
+}
+
+// runVolumeHelper runs cmd in a helper container with the volume mounted read-only at /data
+// and returns its stdout. A non-zero exit is reported with the helper's stderr.
+func (c *Client) runVolumeHelper(volumeName, purpose string, cmd []string) (string, error) {
+	dockerClient := c.docker.GetDockerClient()
+
+	resp, err := c.createHelperContainer(
+		purpose,
+		&container.Config{Cmd: cmd},
+		&container.HostConfig{
+			Mounts: []mount.Mount{helperMount(volumeName, "/data", true)},
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+	// Removed even when the operation is cancelled, so no helper is left running
+	defer func() {
+		if err := dockerClient.ContainerRemove(context.WithoutCancel(c.ctx), resp.ID, container.RemoveOptions{Force: true}); err != nil {
+			logger.Warnf("failed to remove container %s: %v", resp.ID, err)
+		}
+	}()
+
+	if err := dockerClient.ContainerStart(c.ctx, resp.ID, container.StartOptions{}); err != nil {
+		return "", fmt.Errorf("failed to start %s container: %w", purpose, err)
+	}
+
+	statusCh, errCh := dockerClient.ContainerWait(c.ctx, resp.ID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return "", fmt.Errorf("%s container error: %w", purpose, err)
+		}
+	case status := <-statusCh:
+		if status.StatusCode != 0 {
+			return "", c.helperFailure(resp.ID, purpose, cmd, status.StatusCode)
+		}
+	}
+
+	logs, err := dockerClient.ContainerLogs(c.ctx, resp.ID, container.LogsOptions{ShowStdout: true})
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s output: %w", purpose, err)
+	}
+	defer func() {
+		if err := logs.Close(); err != nil {
+			logger.Warnf("failed to close logs: %v", err)
+		}
+	}()
+
+	var stdout bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, io.Discard, logs); err != nil {
+		return "", fmt.Errorf("failed to read %s output: %w", purpose, err)
+	}
+	return stdout.String(), nil
+}
+
+// probeVolumeMount checks that a volume can be mounted read-only into a helper container
+func (c *Client) probeVolumeMount(volumeName string) error {
+	_, err := c.runVolumeHelper(volumeName, "probe", []string{"ls", "/data"})
+	return err
+}
+
+// restoreCommand returns the helper command that empties /data and extracts /backup.tar.gz into
+// it. The tar arguments, which select the decompression, are passed as positional parameters,
+// never spliced into the script.
+func restoreCommand(tarArgs ...string) []string {
+	script := `find /data -mindepth 1 -delete && exec tar -x -f /backup.tar.gz -C /data "$@"`
+	return append([]string{"sh", "-c", script, "sh"}, tarArgs...)
+}
+
+// applyLayerCommand returns the helper command that extracts /backup.tar.gz into /data on top
+// of its current contents, for the increments of an incremental backup chain
+func applyLayerCommand(tarArgs ...string) []string {
+	return append([]string{"tar", "-x", "-f", "/backup.tar.gz", "-C", "/data"}, tarArgs...)
+}
+
+// helperFailure builds the error for a helper container that exited non-zero, including the
+// command that ran, its exit code and the last lines of its stderr
+func (c *Client) helperFailure(containerID, purpose string, cmd []string, exitCode int64) error {
+	message := fmt.Sprintf("%s container exited with code %d\ncommand: %s", purpose, exitCode, strings.Join(cmd, " "))
+
+	if c.contextLines == 0 {
+		return fmt.Errorf("%s", message)
+	}
+
+	lines, err := c.tailHelperLogs(containerID, c.contextLines)
+	if err != nil {
+		logger.Warnf("failed to read %s container logs: %v", purpose, err)
+		return fmt.Errorf("%s", message)
+	}
+	if len(lines) == 0 {
+		return fmt.Errorf("%s", message)
+	}
+
+	return fmt.Errorf("%s\nlast %d line(s) of stderr:\n  %s", message, len(lines), strings.Join(lines, "\n  "))
+}
+
+// tailHelperLogs returns up to n trailing lines of a helper container's stderr
+func (c *Client) tailHelperLogs(containerID string, n int) ([]string, error) {
+	logs, err := c.docker.GetDockerClient().ContainerLogs(c.ctx, containerID, container.LogsOptions{
+		ShowStderr: true,
+		Tail:       strconv.Itoa(n),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := logs.Close(); err != nil {
+			logger.Warnf("failed to close logs: %v", err)
+		}
+	}()
+
+	// Container logs are multiplexed unless the container has a TTY
+	var stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(io.Discard, &stderr, logs); err != nil {
+		return nil, err
+	}
+
+	text := strings.TrimRight(stderr.String(), "\n")
+	if text == "" {
+		return nil, nil
+	}
+
+	lines := strings.Split(text, "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
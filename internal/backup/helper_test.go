@@ -0,0 +1,114 @@
+package backup
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/ypeckstadt/dvom/internal/storage"
+)
+
+// adversarialValues are values that would run commands if spliced into a shell script
+var adversarialValues = []string{
+	"my file.log",
+	"cache; rm -rf /",
+	"$(reboot)",
+	"`id`",
+	"a && b",
+	"'quoted' \"double\"",
+}
+
+func TestRestoreCommandPassesArgumentsPositionally(t *testing.T) {
+	const script = `find /data -mindepth 1 -delete && exec tar -x -f /backup.tar.gz -C /data "$@"`
+
+	for _, value := range adversarialValues {
+		cmd := restoreCommand("-z", value)
+		want := []string{"sh", "-c", script, "sh", "-z", value}
+		if !slices.Equal(cmd, want) {
+			t.Errorf("restoreCommand(%q) = %q, want %q", value, cmd, want)
+		}
+	}
+}
+
+func TestRestoreCommandKeepsTheScriptFixed(t *testing.T) {
+	const script = `find /data -mindepth 1 -delete && exec tar -x -f /backup.tar.gz -C /data "$@"`
+
+	cmd := restoreCommand()
+	if want := []string{"sh", "-c", script, "sh"}; !slices.Equal(cmd, want) {
+		t.Errorf("restoreCommand() = %q, want %q", cmd, want)
+	}
+
+	args := append([]string{"--strip-components=1"}, adversarialValues...)
+	cmd = restoreCommand(args...)
+	if cmd[2] != script || !slices.Equal(cmd[4:], args) {
+		t.Errorf("restoreCommand(%q) = %q, want the fixed script followed by the arguments", args, cmd)
+	}
+}
+
+func TestHelperMountPassesPathsVerbatim(t *testing.T) {
+	for _, value := range adversarialValues {
+		for _, target := range []string{"/data", "/restore/" + value} {
+			// A volume name is mounted as a volume
+			got := helperMount(value, target, true)
+			want := mount.Mount{Type: mount.TypeVolume, Source: value, Target: target, ReadOnly: true}
+			if got != want {
+				t.Errorf("helperMount(%q, %q, true) = %+v, want %+v", value, target, got, want)
+			}
+
+			// An absolute host path is bind-mounted
+			source := "/srv/" + value
+			got = helperMount(source, target, false)
+			want = mount.Mount{Type: mount.TypeBind, Source: source, Target: target}
+			if got != want {
+				t.Errorf("helperMount(%q, %q, false) = %+v, want %+v", source, target, got, want)
+			}
+		}
+	}
+}
+
+func TestTarCreateCommandPassesExcludesPositionally(t *testing.T) {
+	since := time.Unix(1700000000, 0)
+	tests := []struct {
+		name    string
+		options storage.BackupOptions
+		shell   bool
+	}{
+		{"gzip", storage.BackupOptions{Format: storage.FormatTar, Compression: storage.CompressionGzip}, false},
+		{"gzip level", storage.BackupOptions{Format: storage.FormatTar, Compression: storage.CompressionGzip, CompressionLevel: 9}, true},
+		{"incremental", storage.BackupOptions{Format: storage.FormatTar, Compression: storage.CompressionNone, ModifiedSince: &since}, true},
+	}
+
+	for _, tt := range tests {
+		for _, value := range adversarialValues {
+			if err := validateExcludePattern(value); err != nil {
+				t.Fatalf("validateExcludePattern(%q) = %v", value, err)
+			}
+			options := tt.options
+			options.Excludes = []string{value}
+
+			cmd, err := tarCreateCommand(options)
+			if err != nil {
+				t.Fatalf("%s: tarCreateCommand() error = %v", tt.name, err)
+			}
+			exclude := "--exclude=" + helperExcludePattern(value)
+
+			if !tt.shell {
+				if cmd[0] != "tar" || !slices.Contains(cmd, exclude) {
+					t.Errorf("%s: tarCreateCommand() = %q, want tar run directly with %q", tt.name, cmd, exclude)
+				}
+				continue
+			}
+			if len(cmd) < 4 || cmd[0] != "sh" || cmd[1] != "-c" || cmd[3] != "sh" {
+				t.Fatalf("%s: tarCreateCommand() = %q, want an sh -c script with positional parameters", tt.name, cmd)
+			}
+			if strings.Contains(cmd[2], value) {
+				t.Errorf("%s: script %q contains the exclude pattern %q", tt.name, cmd[2], value)
+			}
+			if !slices.Contains(cmd[4:], exclude) {
+				t.Errorf("%s: positional parameters %q do not contain %q", tt.name, cmd[4:], exclude)
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ypeckstadt/dvom/internal/models"
+	"github.com/ypeckstadt/dvom/internal/storage"
+)
+
+// SetIncremental makes backups archive only the files modified since the previous version of
+// the snapshot was taken, recording that version as the parent. Without a usable previous
+// version a full backup is made instead.
+func (c *Client) SetIncremental(incremental bool) {
+	c.incremental = incremental
+}
+
+// backupDescription returns the description recorded for a direct volume backup
+func backupDescription(volumeName, parentID string) string {
+	if parentID != "" {
+		return fmt.Sprintf("Incremental volume backup of %s since %s", volumeName, parentID)
+	}
+	return fmt.Sprintf("Direct volume backup of %s", volumeName)
+}
+
+// incrementalParent returns the previous version of the snapshot an incremental backup of the
+// volume is based on, or nil when a full backup has to be made because there is no previous
+// version of the same volume that records when it was taken
+func (c *Client) incrementalParent(volume models.VolumeInfo, snapshotName string) (*storage.BackupMetadata, error) {
+	previous, err := c.snapshotStorage().LatestVersionMetadata(c.ctx, snapshotName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up the previous version: %w", err)
+	}
+
+	reason := ""
+	switch {
+	case previous == nil:
+		reason = "no previous version exists"
+	case previous.VolumeName != volume.Name:
+		reason = fmt.Sprintf("previous version %s is not a backup of volume '%s'", previous.ID, volume.Name)
+	case previous.SourceTime == nil:
+		reason = fmt.Sprintf("previous version %s does not record when it was taken", previous.ID)
+	case previous.SourceTime.After(time.Now()):
+		reason = fmt.Sprintf("previous version %s was taken in the future (clock skew?)", previous.ID)
+	}
+	if reason != "" {
+		if !c.quiet {
+			fmt.Printf("ℹ️  Making a full backup instead of an incremental one: %s\n", reason)
+		}
+		return nil, nil
+	}
+
+	if c.verbose {
+		fmt.Printf("🧩 Incremental backup of the files modified since %s\n", previous.ID)
+	}
+	return previous, nil
+}
+
+// backupChain returns the versions an incremental backup is based on, oldest (the full
+// backup) first. It is empty for a full backup.
+func (c *Client) backupChain(metadata storage.BackupMetadata) ([]storage.VersionInfo, error) {
+	if metadata.Parent == "" {
+		return nil, nil
+	}
+
+	name, _, ok := storage.ParseVersionedID(metadata.ID)
+	if !ok {
+		return nil, fmt.Errorf("incremental backup %s has no versioned ID", metadata.ID)
+	}
+	versions, err := c.snapshotStorage().ListVersions(c.ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list versions of %s: %w", name, err)
+	}
+	byID := make(map[string]storage.VersionInfo, len(versions))
+	for _, version := range versions {
+		byID[version.ID] = version
+	}
+
+	var chain []storage.VersionInfo
+	seen := map[string]bool{metadata.ID: true}
+	for parentID := metadata.Parent; parentID != ""; {
+		parent, ok := byID[parentID]
+		if !ok {
+			return nil, fmt.Errorf("version %s, which incremental backup %s depends on, is missing", parentID, metadata.ID)
+		}
+		if seen[parentID] {
+			return nil, fmt.Errorf("incremental backup %s has a parent cycle at %s", metadata.ID, parentID)
+		}
+		seen[parentID] = true
+		chain = append([]storage.VersionInfo{parent}, chain...)
+		parentID = parent.Parent
+	}
+	return chain, nil
+}
+
+// restoreChain restores the versions of an incremental backup chain into the volume in order.
+// The first (full) version replaces the volume's contents, later ones are applied on top.
+func (c *Client) restoreChain(volume models.VolumeInfo, chain []storage.VersionInfo) error {
+	for i, version := range chain {
+		if c.verbose {
+			fmt.Printf("🧩 Restoring version %d of %d of the chain: %s\n", i+1, len(chain)+1, version.ID)
+		}
+		if err := c.restoreVersion(volume, version.ID, i == 0); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", version.ID, err)
+		}
+	}
+	return nil
+}
+
+// restoreVersion downloads a single-volume snapshot version and extracts it into the volume,
+// replacing its contents if clean is set
+func (c *Client) restoreVersion(volume models.VolumeInfo, versionedID string, clean bool) error {
+	backup, err := c.snapshotStorage().GetSnapshot(c.ctx, versionedID)
+	if err != nil {
+		return StorageError(fmt.Errorf("failed to retrieve volume backup: %w", err))
+	}
+	defer func() {
+		if closer, ok := backup.DataReader.(interface{ Close() error }); ok {
+			if err := closer.Close(); err != nil {
+				logger.Warnf("failed to close backup data reader: %v", err)
+			}
+		}
+	}()
+
+	options := backup.Metadata.ArchiveOptions()
+	if _, err := tarExtractArgs(options); err != nil {
+		return err
+	}
+
+	tempFile, err := os.CreateTemp("", "dvom-restore-*.tar.gz")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer func() {
+		if err := os.Remove(tempFile.Name()); err != nil {
+			logger.Warnf("failed to remove temp file: %v", err)
+		}
+	}()
+	defer func() {
+		if err := tempFile.Close(); err != nil {
+			logger.Warnf("failed to close temp file: %v", err)
+		}
+	}()
+
+	if err := c.downloadBackup(backup, tempFile); err != nil {
+		return err
+	}
+
+	if !c.quiet {
+		spinner := NewIndeterminateProgress(fmt.Sprintf("📥 Restoring %s", versionedID))
+		defer spinner.Stop()
+	}
+	return c.restoreDirectVolume(volume, tempFile.Name(), options, clean)
+}
@@ -0,0 +1,158 @@
+package backup
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ypeckstadt/dvom/internal/models"
+	"github.com/ypeckstadt/dvom/internal/storage"
+)
+
+// maxLegacyVolumeSize limits extraction of a volume archive from a legacy backup (100GB)
+const maxLegacyVolumeSize = 100 * 1024 * 1024 * 1024
+
+// ImportLegacyBackup imports a dockup zip backup by storing each embedded volume archive
+// as a dvom snapshot. With several volumes each snapshot is named <name>-<volume>.
+// An empty snapshotName defaults to the container name recorded in the backup.
+func (c *Client) ImportLegacyBackup(zipFile, snapshotName string) error {
+	if c.storage == nil {
+		return fmt.Errorf("storage backend is required for import operations")
+	}
+
+	reader, err := zip.OpenReader(zipFile)
+	if err != nil {
+		return fmt.Errorf("failed to open legacy backup: %w", err)
+	}
+	defer func() {
+		if err := reader.Close(); err != nil {
+			logger.Warnf("failed to close legacy backup: %v", err)
+		}
+	}()
+
+	metadata, err := readLegacyMetadata(reader)
+	if err != nil {
+		return err
+	}
+
+	if len(metadata.Volumes) == 0 {
+		return fmt.Errorf("legacy backup %s contains no volumes", zipFile)
+	}
+	if snapshotName == "" {
+		snapshotName = metadata.ContainerName
+	}
+	if snapshotName == "" {
+		return fmt.Errorf("snapshot name is required: the legacy backup does not record a container name")
+	}
+
+	if c.verbose {
+		fmt.Printf("📦 Importing dockup backup of container '%s' (%d volume(s), created %s)\n",
+			metadata.ContainerName, len(metadata.Volumes), metadata.CreatedAt.Format("2006-01-02 15:04:05"))
+	}
+
+	for _, volume := range metadata.Volumes {
+		name := snapshotName
+		if len(metadata.Volumes) > 1 {
+			name = fmt.Sprintf("%s-%s", snapshotName, volume.Name)
+		}
+
+		stored, err := c.importLegacyVolume(reader, metadata, volume, name)
+		if err != nil {
+			return fmt.Errorf("failed to import volume '%s': %w", volume.Name, err)
+		}
+
+		if !c.quiet {
+			fmt.Printf("✅ Imported volume '%s' as %s\n", volume.Name, stored.ID)
+		}
+	}
+
+	return nil
+}
+
+// readLegacyMetadata reads metadata.json from a legacy backup
+func readLegacyMetadata(reader *zip.ReadCloser) (*models.BackupMetadata, error) {
+	for _, file := range reader.File {
+		if file.Name != "metadata.json" {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open metadata: %w", err)
+		}
+		defer func() {
+			if err := rc.Close(); err != nil {
+				logger.Warnf("failed to close metadata: %v", err)
+			}
+		}()
+
+		var metadata models.BackupMetadata
+		if err := json.NewDecoder(rc).Decode(&metadata); err != nil {
+			return nil, fmt.Errorf("failed to decode metadata: %w", err)
+		}
+		return &metadata, nil
+	}
+
+	return nil, fmt.Errorf("metadata.json not found: not a dockup backup")
+}
+
+// importLegacyVolume extracts one embedded volume archive and stores it as a snapshot
+func (c *Client) importLegacyVolume(reader *zip.ReadCloser, metadata *models.BackupMetadata, volume models.VolumeInfo, snapshotName string) (*storage.Backup, error) {
+	volumePath := fmt.Sprintf("volumes/%s.tar.gz", volume.Name)
+
+	var volumeFile *zip.File
+	for _, file := range reader.File {
+		if file.Name == volumePath {
+			volumeFile = file
+			break
+		}
+	}
+	if volumeFile == nil {
+		return nil, fmt.Errorf("%s not found in legacy backup", volumePath)
+	}
+
+	tempFile, err := os.CreateTemp("", "dvom-legacy-*.tar.gz")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer func() {
+		if err := os.Remove(tempFile.Name()); err != nil {
+			logger.Warnf("failed to remove temp file: %v", err)
+		}
+	}()
+	defer func() {
+		if err := tempFile.Close(); err != nil {
+			logger.Warnf("failed to close temp file: %v", err)
+		}
+	}()
+
+	rc, err := volumeFile.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", volumePath, err)
+	}
+	_, err = io.CopyN(tempFile, rc, maxLegacyVolumeSize)
+	if closeErr := rc.Close(); closeErr != nil {
+		logger.Warnf("failed to close %s: %v", volumePath, closeErr)
+	}
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to extract %s: %w", volumePath, err)
+	}
+
+	archiveStats, err := inspectArchive(tempFile.Name(), storage.CompressionGzip)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.storeArchive(tempFile, snapshotName, storage.BackupMetadata{
+		Type:             "direct-volume-backup",
+		CreatedAt:        metadata.CreatedAt,
+		ContainerID:      metadata.ContainerID,
+		VolumeName:       volume.Name,
+		Description:      fmt.Sprintf("Imported from dockup backup of %s created %s", metadata.ContainerName, metadata.CreatedAt.Format("2006-01-02 15:04:05")),
+		FileCount:        archiveStats.FileCount,
+		UncompressedSize: archiveStats.UncompressedSize,
+		ContentChecksum:  archiveStats.ContentChecksum,
+	})
+}
@@ -0,0 +1,137 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ypeckstadt/dvom/internal/docker"
+	"github.com/ypeckstadt/dvom/internal/history"
+	"github.com/ypeckstadt/dvom/internal/storage"
+)
+
+// LogLevel is the severity of a log message; a logger writes the messages at or below its level
+type LogLevel int
+
+// Log levels, from most to least severe
+const (
+	LevelError LogLevel = iota
+	LevelWarn
+	LevelInfo
+	LevelDebug
+)
+
+// Log formats. Text keeps the human-readable output, info and debug messages on stdout and
+// errors and warnings on stderr. Logfmt and JSON write every message to stderr as one record per
+// line, leaving stdout to command output.
+const (
+	LogFormatText   = "text"
+	LogFormatLogfmt = "logfmt"
+	LogFormatJSON   = "json"
+)
+
+// Logger writes leveled messages in one of the log formats
+type Logger struct {
+	mu     sync.Mutex
+	level  LogLevel
+	stdout io.Writer
+	stderr io.Writer
+	// structured is nil for the text format
+	structured *slog.Logger
+	// timestamps prefixes text messages with the time
+	timestamps bool
+}
+
+// NewLogger creates a logger writing the messages up to level in format to stdout and stderr
+func NewLogger(level LogLevel, format string, stdout, stderr io.Writer) (*Logger, error) {
+	l := &Logger{level: level, stdout: stdout, stderr: stderr}
+	options := &slog.HandlerOptions{Level: slog.LevelDebug}
+	switch format {
+	case "", LogFormatText:
+	case LogFormatLogfmt:
+		l.structured = slog.New(slog.NewTextHandler(stderr, options))
+	case LogFormatJSON:
+		l.structured = slog.New(slog.NewJSONHandler(stderr, options))
+	default:
+		return nil, fmt.Errorf("unsupported log format: %s (use text, logfmt or json)", format)
+	}
+	return l, nil
+}
+
+// logger is the logger of the backup package, replaced with SetLogger
+var logger, _ = NewLogger(LevelInfo, LogFormatText, os.Stdout, os.Stderr)
+
+// SetLogger replaces the logger the backup package writes its messages to, and routes the
+// warnings of the storage, docker and history packages to it as well
+func SetLogger(l *Logger) {
+	logger = l
+	storage.Warnf = l.Warnf
+	docker.Warnf = l.Warnf
+	history.Warnf = l.Warnf
+}
+
+// SetTimestamps prefixes the messages of the text format with the time they are logged, e.g.
+// for the log of a long-running daemon. Structured records always carry the time.
+func (l *Logger) SetTimestamps(timestamps bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.timestamps = timestamps
+}
+
+// Errorf logs an error
+func (l *Logger) Errorf(format string, args ...any) {
+	l.log(LevelError, format, args...)
+}
+
+// Warnf logs a warning
+func (l *Logger) Warnf(format string, args ...any) {
+	l.log(LevelWarn, format, args...)
+}
+
+// Infof logs an informational message
+func (l *Logger) Infof(format string, args ...any) {
+	l.log(LevelInfo, format, args...)
+}
+
+// Debugf logs a message only shown with --verbose
+func (l *Logger) Debugf(format string, args ...any) {
+	l.log(LevelDebug, format, args...)
+}
+
+func (l *Logger) log(level LogLevel, format string, args ...any) {
+	if level > l.level {
+		return
+	}
+	message := fmt.Sprintf(format, args...)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.structured != nil {
+		l.structured.Log(context.Background(), slogLevels[level], message)
+		return
+	}
+	if l.timestamps {
+		message = time.Now().Format(time.DateTime) + " " + message
+	}
+	switch level {
+	case LevelError:
+		_, _ = fmt.Fprintf(l.stderr, "Error: %s\n", message)
+	case LevelWarn:
+		_, _ = fmt.Fprintf(l.stderr, "Warning: %s\n", message)
+	default:
+		_, _ = fmt.Fprintln(l.stdout, message)
+	}
+}
+
+// slogLevels maps the log levels to their slog equivalents
+var slogLevels = map[LogLevel]slog.Level{
+	LevelError: slog.LevelError,
+	LevelWarn:  slog.LevelWarn,
+	LevelInfo:  slog.LevelInfo,
+	LevelDebug: slog.LevelDebug,
+}
@@ -0,0 +1,203 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ypeckstadt/dvom/internal/crypto"
+	"github.com/ypeckstadt/dvom/internal/storage"
+)
+
+// maxReportedFiles is the number of files listed per kind of difference when a restored volume
+// does not match its manifest
+const maxReportedFiles = 10
+
+// manifestEntry describes a regular file of a backed up volume
+type manifestEntry struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// fileManifest maps the paths of the regular files of a volume, relative to its root, to their
+// size and checksum
+type fileManifest map[string]manifestEntry
+
+// manifestPath normalizes a path of an archive entry or of find output to a manifest key
+func manifestPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// SetVerifyAfterRestore makes restores compare the checksums of the files in the restored
+// volume with the file manifest captured when the backup was made
+func (c *Client) SetVerifyAfterRestore(verify bool) {
+	c.verifyAfterRestore = verify
+}
+
+// storeManifest stores the file manifest of a newly stored backup, encrypted like the backup
+// itself. Only restores with --verify-after need it, so a failure is reported as a warning.
+func (c *Client) storeManifest(stored *storage.Backup, manifest fileManifest) {
+	data, err := json.Marshal(manifest)
+	if err == nil && stored.Metadata.Encrypted {
+		var password string
+		if password, err = c.encryptionPassword("Enter encryption password: ", true); err == nil {
+			data, err = crypto.EncryptBytes(data, password)
+		}
+	}
+	if err == nil {
+		err = c.snapshotStorage().PutManifest(c.ctx, stored.ID, data, stored.Metadata.Encrypted)
+	}
+	if err != nil {
+		logger.Warnf("failed to store the file manifest of %s, it cannot be verified after a restore: %v", stored.ID, err)
+	}
+}
+
+// loadManifest retrieves and decodes the file manifest of a snapshot version
+func (c *Client) loadManifest(versionedID string) (fileManifest, error) {
+	data, encrypted, err := c.snapshotStorage().GetManifest(c.ctx, versionedID)
+	if err != nil {
+		return nil, err
+	}
+	if encrypted {
+		password, err := c.encryptionPassword("Enter decryption password: ", false)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = crypto.DecryptBytes(data, password); err != nil {
+			return nil, fmt.Errorf("failed to decrypt the file manifest of %s: %w", versionedID, err)
+		}
+	}
+
+	manifest := fileManifest{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse the file manifest of %s: %w", versionedID, err)
+	}
+	return manifest, nil
+}
+
+// restoreManifest returns the files a volume is expected to hold after restoring a backup and
+// the incremental chain it is based on. Later versions of the chain override earlier ones, as
+// their files are extracted on top. A version without a manifest fails with an error wrapping
+// storage.ErrNotFound.
+func (c *Client) restoreManifest(metadata storage.BackupMetadata, chain []storage.VersionInfo) (fileManifest, error) {
+	ids := make([]string, 0, len(chain)+1)
+	for _, version := range chain {
+		ids = append(ids, version.ID)
+	}
+	ids = append(ids, metadata.ID)
+
+	merged := fileManifest{}
+	for _, id := range ids {
+		manifest, err := c.loadManifest(id)
+		if err != nil {
+			return nil, StorageError(err)
+		}
+		for name, entry := range manifest {
+			merged[name] = entry
+		}
+	}
+	return merged, nil
+}
+
+// verifyRestoredVolume computes the checksums of the files in a restored volume in a helper
+// container and compares them with the manifest, reporting missing, extra and mismatched files
+func (c *Client) verifyRestoredVolume(volumeName string, manifest fileManifest) error {
+	var spinner *IndeterminateProgress
+	if !c.quiet {
+		spinner = NewIndeterminateProgress("🔍 Verifying restored files")
+		defer spinner.Stop()
+	} else if c.verbose {
+		fmt.Println("🔍 Verifying restored files...")
+	}
+
+	output, err := c.runVolumeHelper(volumeName, "verification", []string{
+		"sh", "-c", "cd /data && find . -type f -exec sha256sum {} +",
+	})
+	if err != nil {
+		return err
+	}
+	actual, err := parseChecksumOutput(output)
+	if err != nil {
+		return err
+	}
+
+	if spinner != nil {
+		spinner.Stop()
+	}
+
+	var missing, extra, mismatched []string
+	for name, entry := range manifest {
+		checksum, ok := actual[name]
+		switch {
+		case !ok:
+			missing = append(missing, name)
+		case checksum != entry.SHA256:
+			mismatched = append(mismatched, name)
+		}
+	}
+	for name := range actual {
+		if _, ok := manifest[name]; !ok {
+			extra = append(extra, name)
+		}
+	}
+
+	if len(missing)+len(extra)+len(mismatched) == 0 {
+		if !c.quiet {
+			fmt.Printf("✅ All %d restored file(s) match the backup manifest\n", len(manifest))
+		}
+		return nil
+	}
+
+	printFileList("❌ Missing file(s)", missing, maxReportedFiles)
+	printFileList("❌ Extra file(s)", extra, maxReportedFiles)
+	printFileList("❌ Mismatched file(s)", mismatched, maxReportedFiles)
+	return integrityError(fmt.Errorf("restored volume %s does not match the backup: %d missing, %d extra, %d mismatched file(s)",
+		volumeName, len(missing), len(extra), len(mismatched)))
+}
+
+// printFileList prints the files of one kind of difference, up to limit of them unless limit
+// is 0
+func printFileList(heading string, names []string, limit int) {
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+	fmt.Printf("%s: %d\n", heading, len(names))
+	for i, name := range names {
+		if limit > 0 && i == limit {
+			fmt.Printf("   ... and %d more\n", len(names)-limit)
+			break
+		}
+		fmt.Printf("   %s\n", name)
+	}
+}
+
+// parseChecksumOutput parses sha256sum output into a map of manifest paths to checksums. Lines
+// of names containing a newline or backslash start with a backslash and escape those characters.
+func parseChecksumOutput(output string) (map[string]string, error) {
+	checksums := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+		escaped := strings.HasPrefix(line, "\\")
+		line = strings.TrimPrefix(line, "\\")
+
+		checksum, name, ok := strings.Cut(line, "  ")
+		if !ok || len(checksum) != 64 {
+			return nil, fmt.Errorf("unexpected checksum output: %q", line)
+		}
+		if escaped {
+			unquoted, err := strconv.Unquote(`"` + strings.ReplaceAll(name, `"`, `\"`) + `"`)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected checksum output: %q", line)
+			}
+			name = unquoted
+		}
+		checksums[manifestPath(name)] = checksum
+	}
+	return checksums, nil
+}
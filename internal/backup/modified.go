@@ -0,0 +1,80 @@
+package backup
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ypeckstadt/dvom/internal/models"
+	"github.com/ypeckstadt/dvom/internal/storage"
+)
+
+// clockSkewMargin is subtracted from the previous backup's source time before comparing file
+// modification times, so a Docker host clock running slightly behind ours cannot hide changes
+const clockSkewMargin = 5 * time.Minute
+
+// SetSkipUnmodified skips a backup without archiving the volume when no file in it was modified
+// since the previous version of the snapshot was taken
+func (c *Client) SetSkipUnmodified(skip bool) {
+	c.skipUnmodified = skip
+}
+
+// LastBackupUnchanged reports whether the last BackupDirectVolume call stored nothing because
+// the volume was unchanged
+func (c *Client) LastBackupUnchanged() bool {
+	return c.lastUnchanged
+}
+
+// unmodifiedSinceLastBackup returns the previous version of the snapshot if no file of the
+// volume was modified since it was taken. It returns nil, so the volume is backed up, when
+// there is no previous version, the previous version does not record when it was taken, or
+// that time is ahead of our clock.
+func (c *Client) unmodifiedSinceLastBackup(volume models.VolumeInfo, snapshotName string) (*storage.BackupMetadata, error) {
+	previous, err := c.snapshotStorage().LatestVersionMetadata(c.ctx, snapshotName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up the previous version: %w", err)
+	}
+	if previous == nil {
+		if c.verbose {
+			fmt.Println("🕒 No previous version, backing up")
+		}
+		return nil, nil
+	}
+	if previous.SourceTime == nil {
+		if c.verbose {
+			fmt.Printf("🕒 Previous version %s does not record when it was taken, backing up\n", previous.ID)
+		}
+		return nil, nil
+	}
+	if previous.SourceTime.After(time.Now()) {
+		if c.verbose {
+			fmt.Printf("🕒 Previous version %s was taken in the future (clock skew?), backing up\n", previous.ID)
+		}
+		return nil, nil
+	}
+
+	since := previous.SourceTime.Add(-clockSkewMargin)
+	modified, err := c.findModifiedSince(volume.Name, since)
+	if err != nil {
+		return nil, err
+	}
+	if modified != "" {
+		if c.verbose {
+			fmt.Printf("🕒 %s was modified since %s, backing up\n", modified, previous.ID)
+		}
+		return nil, nil
+	}
+	return previous, nil
+}
+
+// findModifiedSince returns the path of a file or directory in the volume modified after since,
+// or "" if there is none. Directories are included so deleted and renamed files are noticed.
+func (c *Client) findModifiedSince(volumeName string, since time.Time) (string, error) {
+	script := `touch -d "@$1" /tmp/dvom-since && find /data -newer /tmp/dvom-since | head -n 1`
+	output, err := c.runVolumeHelper(volumeName, "modification check", []string{"sh", "-c", script, "sh", strconv.FormatInt(since.Unix(), 10)})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
@@ -0,0 +1,557 @@
+package backup
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ypeckstadt/dvom/internal/models"
+	"github.com/ypeckstadt/dvom/internal/storage"
+	"golang.org/x/sync/errgroup"
+)
+
+// volumeEntryPath returns the path of a volume's archive inside a multi-volume snapshot.
+// Multi-volume snapshots are tar archives holding one volumes/<name>.tar.gz entry per volume
+// and one binds/<host path>.tar.gz entry per host path.
+func volumeEntryPath(volumeName string) string {
+	if isBindSource(volumeName) {
+		return fmt.Sprintf("binds%s.tar.gz", path.Clean(volumeName))
+	}
+	return fmt.Sprintf("volumes/%s.tar.gz", volumeName)
+}
+
+// snapshotVolumes returns the names of the volumes contained in a snapshot
+func snapshotVolumes(metadata storage.BackupMetadata) []string {
+	var volumes []string
+	for _, name := range strings.Split(metadata.VolumeName, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			volumes = append(volumes, name)
+		}
+	}
+	return volumes
+}
+
+// SetVolumeParallelism sets how many volumes of a multi-volume backup are archived at the
+// same time, each in its own helper container and temporary file
+func (c *Client) SetVolumeParallelism(parallel int) error {
+	if parallel < 1 {
+		return fmt.Errorf("parallelism must be at least 1")
+	}
+	c.volumeParallel = parallel
+	return nil
+}
+
+// SetOnlyVolume selects the volume to restore from a multi-volume snapshot
+func (c *Client) SetOnlyVolume(volumeName string) {
+	c.onlyVolume = volumeName
+}
+
+// selectRestoreVolume determines which volume of a snapshot is restored and whether it has
+// to be extracted from a multi-volume archive
+func (c *Client) selectRestoreVolume(metadata storage.BackupMetadata) (string, bool, error) {
+	if metadata.IsSealed() {
+		if c.onlyVolume != "" {
+			return "", false, fmt.Errorf("the snapshot metadata is encrypted: provide --password to select a volume")
+		}
+		return "", false, nil
+	}
+
+	volumes := snapshotVolumes(metadata)
+	if len(volumes) > 1 {
+		if c.onlyVolume == "" {
+			return "", false, fmt.Errorf("snapshot contains multiple volumes (%s): use --target-volume <volume>=<target> or --only-volume to choose", strings.Join(volumes, ", "))
+		}
+		for _, name := range volumes {
+			if name == c.onlyVolume {
+				return name, true, nil
+			}
+		}
+		return "", false, fmt.Errorf("volume '%s' is not part of the snapshot (contains: %s)", c.onlyVolume, strings.Join(volumes, ", "))
+	}
+
+	if c.onlyVolume != "" && len(volumes) == 1 && volumes[0] != c.onlyVolume {
+		return "", false, fmt.Errorf("volume '%s' is not part of the snapshot (contains: %s)", c.onlyVolume, volumes[0])
+	}
+	if len(volumes) == 1 {
+		return volumes[0], false, nil
+	}
+	return c.onlyVolume, false, nil
+}
+
+// extractVolumeArchive extracts one volume's archive from a multi-volume snapshot into a
+// temporary file and returns its path
+func (c *Client) extractVolumeArchive(archivePath, volumeName string) (string, error) {
+	archive, err := os.Open(archivePath) // #nosec G304 - controlled backup temp file path
+	if err != nil {
+		return "", fmt.Errorf("failed to open backup archive: %w", err)
+	}
+	defer func() {
+		if err := archive.Close(); err != nil {
+			logger.Warnf("failed to close backup archive: %v", err)
+		}
+	}()
+
+	entryPath := volumeEntryPath(volumeName)
+	tarReader := tar.NewReader(archive)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return "", fmt.Errorf("%s not found in snapshot", entryPath)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read backup archive: %w", err)
+		}
+		if header.Name != entryPath {
+			continue
+		}
+
+		volumeFile, err := os.CreateTemp("", "dvom-volume-*.tar.gz")
+		if err != nil {
+			return "", fmt.Errorf("failed to create temp file: %w", err)
+		}
+
+		// Limit copy size to prevent decompression bombs (100GB max)
+		const maxVolumeSize = 100 * 1024 * 1024 * 1024
+		_, copyErr := io.CopyN(volumeFile, tarReader, maxVolumeSize)
+		if err := volumeFile.Close(); err != nil && copyErr == nil {
+			copyErr = err
+		}
+		if copyErr != nil && copyErr != io.EOF {
+			if err := os.Remove(volumeFile.Name()); err != nil {
+				logger.Warnf("failed to remove temp file: %v", err)
+			}
+			return "", fmt.Errorf("failed to extract %s: %w", entryPath, copyErr)
+		}
+
+		return volumeFile.Name(), nil
+	}
+}
+
+// VolumeMapping maps a volume in a multi-volume snapshot to the volume it is restored to
+type VolumeMapping struct {
+	Source string
+	Target string
+}
+
+// BackupVolumesWithContainers backs up several volumes into one snapshot with optional
+// container stop/start, so they are captured as a consistent set
+func (c *Client) BackupVolumesWithContainers(volumeNames []string, snapshotName string, stopContainers []string) error {
+	stopContainers, err := c.backupStopSet(volumeNames, stopContainers)
+	if err != nil {
+		return err
+	}
+	return c.withStoppedContainers(stopContainers, func() error {
+		return c.BackupVolumes(volumeNames, snapshotName)
+	})
+}
+
+// BackupVolumes backs up several volumes into one snapshot. Each volume is archived on its own
+// and stored as a volumes/<name>.tar.gz entry of a tar archive.
+func (c *Client) BackupVolumes(volumeNames []string, snapshotName string) error {
+	if c.storage == nil {
+		return fmt.Errorf("storage backend is required for volume operations")
+	}
+	if c.stream || c.skipIfUnchanged || c.skipUnmodified || c.incremental {
+		return fmt.Errorf("--stream, --skip-if-unchanged, --since-last-modified and --incremental are not supported when backing up multiple volumes")
+	}
+	if compression := c.archiveOptions().Compression; compression != storage.CompressionGzip {
+		return fmt.Errorf("multi-volume snapshots store volumes as .tar.gz entries and do not support %s compression", compression)
+	}
+
+	if c.verbose {
+		fmt.Printf("📸 Creating volume backup '%s' from volumes: %s\n", snapshotName, strings.Join(volumeNames, ", "))
+	}
+	if stored := storage.NormalizeSnapshotName(snapshotName); stored != snapshotName && !c.quiet {
+		fmt.Printf("ℹ️  Snapshot name '%s' will be stored as '%s'\n", snapshotName, stored)
+	}
+
+	// Check all volumes before archiving any of them
+	seen := make(map[string]bool, len(volumeNames))
+	volumes := make([]models.VolumeInfo, 0, len(volumeNames))
+	for _, volumeName := range volumeNames {
+		if seen[volumeName] {
+			return fmt.Errorf("volume '%s' is listed more than once", volumeName)
+		}
+		seen[volumeName] = true
+
+		volumeInfo, err := c.lookupSource(volumeName)
+		if err != nil {
+			return err
+		}
+		if err := c.checkDriverSupported(*volumeInfo); err != nil {
+			return err
+		}
+		volumes = append(volumes, *volumeInfo)
+	}
+
+	tempFile, err := os.CreateTemp("", "dvom-volumes-*.tar")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer func() {
+		if err := os.Remove(tempFile.Name()); err != nil {
+			logger.Warnf("failed to remove temp file: %v", err)
+		}
+	}()
+	defer func() {
+		if err := tempFile.Close(); err != nil {
+			logger.Warnf("failed to close temp file: %v", err)
+		}
+	}()
+
+	sourceTime := time.Now()
+	archiveOptions := c.archiveOptions()
+	metadata := storage.BackupMetadata{
+		Type:        "direct-volume-backup",
+		VolumeName:  strings.Join(volumeNames, ","),
+		VolumeSizes: make(map[string]int64, len(volumes)),
+		MountTypes:  mountTypes(volumes),
+		Description: fmt.Sprintf("Direct volume backup of %s", strings.Join(volumeNames, ", ")),
+		SourceTime:  &sourceTime,
+		Options:     &archiveOptions,
+	}
+
+	entries, err := c.archiveVolumeEntries(volumes)
+	defer func() {
+		for _, entry := range entries {
+			if entry == nil {
+				continue
+			}
+			if err := os.Remove(entry.path); err != nil {
+				logger.Warnf("failed to remove temp file: %v", err)
+			}
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	// Merge the volume archives in the order the volumes were given
+	tarWriter := tar.NewWriter(tempFile)
+	for i, volume := range volumes {
+		entry := entries[i]
+		if err := c.writeVolumeEntry(tarWriter, volume.Name, entry.path); err != nil {
+			return err
+		}
+
+		metadata.VolumeSizes[volume.Name] = entry.size
+		metadata.FileCount += entry.stats.FileCount
+		metadata.UncompressedSize += entry.stats.UncompressedSize
+		if archiveOptions.Strategy == "" {
+			archiveOptions.Strategy = entry.strategy
+		} else if archiveOptions.Strategy != entry.strategy {
+			archiveOptions.Strategy = "mixed"
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return fmt.Errorf("failed to finish backup archive: %w", err)
+	}
+
+	metadata.CreatedAt = time.Now()
+	stored, err := c.storeArchive(tempFile, snapshotName, metadata)
+	if err != nil {
+		return err
+	}
+
+	c.lastUnchanged = false
+	if err := c.verifyNewBackup(stored); err != nil {
+		return err
+	}
+	return c.applyRetention(snapshotName, stored.ID)
+}
+
+// volumeEntry is a volume archived into a temporary file for a multi-volume snapshot
+type volumeEntry struct {
+	path     string
+	stats    *archiveStats
+	strategy string
+	size     int64
+}
+
+// archiveVolumeEntries archives each volume into its own temporary file, running up to the
+// configured number of helper containers at a time. The entries are returned in the order of
+// volumes; entries of volumes that were archived are returned even on error so they can be
+// removed.
+func (c *Client) archiveVolumeEntries(volumes []models.VolumeInfo) ([]*volumeEntry, error) {
+	entries := make([]*volumeEntry, len(volumes))
+
+	parallel := c.volumeParallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	// Progress of concurrent volumes would overwrite each other, so show one spinner for all
+	var spinner *IndeterminateProgress
+	if parallel > 1 && len(volumes) > 1 {
+		if !c.quiet {
+			spinner = NewIndeterminateProgress(fmt.Sprintf("💾 Backing up %d volumes (%d at a time)", len(volumes), parallel))
+			defer spinner.Stop()
+		} else if c.verbose {
+			fmt.Printf("💾 Backing up %d volumes (%d at a time)...\n", len(volumes), parallel)
+		}
+	}
+
+	var group errgroup.Group
+	group.SetLimit(parallel)
+	for i, volume := range volumes {
+		group.Go(func() error {
+			entry, err := c.archiveVolumeEntry(volume, spinner == nil)
+			if err != nil {
+				return fmt.Errorf("volume %s: %w", volume.Name, err)
+			}
+			entries[i] = entry
+			return nil
+		})
+	}
+	err := group.Wait()
+
+	if spinner != nil {
+		spinner.Stop()
+	}
+	return entries, err
+}
+
+// archiveVolumeEntry archives a volume into a temporary file and inspects its contents.
+// showProgress shows a spinner while the volume is archived.
+func (c *Client) archiveVolumeEntry(volume models.VolumeInfo, showProgress bool) (*volumeEntry, error) {
+	volumeFile, err := os.CreateTemp("", "dvom-volume-*.tar.gz")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	entry := &volumeEntry{path: volumeFile.Name()}
+	removeFile := true
+	defer func() {
+		if err := volumeFile.Close(); err != nil {
+			logger.Warnf("failed to close temp file: %v", err)
+		}
+		if !removeFile {
+			return
+		}
+		if err := os.Remove(volumeFile.Name()); err != nil {
+			logger.Warnf("failed to remove temp file: %v", err)
+		}
+	}()
+
+	var archiveWriter io.Writer = volumeFile
+	var progress *archiveProgress
+	if showProgress && !c.quiet {
+		progress = newArchiveProgress(volumeFile, fmt.Sprintf("💾 Backing up volume %s", volume.Name))
+		defer progress.Stop()
+		archiveWriter = progress
+	} else if showProgress && c.verbose {
+		fmt.Printf("💾 Backing up volume %s...\n", volume.Name)
+	}
+
+	entry.strategy, err = c.archiveVolume(volume, archiveWriter)
+	if err != nil {
+		return nil, err
+	}
+
+	if progress != nil {
+		progress.Stop()
+	}
+
+	entry.stats, err = inspectArchive(volumeFile.Name(), storage.CompressionGzip)
+	if err != nil {
+		return nil, err
+	}
+	if c.verbose {
+		fmt.Printf("📊 Volume %s contains %d file(s), %.1f MB uncompressed\n", volume.Name, entry.stats.FileCount, float64(entry.stats.UncompressedSize)/(1024*1024))
+	}
+	if err := c.checkArchiveNotEmpty(volume.Name, entry.stats); err != nil {
+		return nil, err
+	}
+
+	stat, err := volumeFile.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat volume archive: %w", err)
+	}
+	entry.size = stat.Size()
+
+	removeFile = false
+	return entry, nil
+}
+
+// writeVolumeEntry appends a volume's archive to a multi-volume snapshot
+func (c *Client) writeVolumeEntry(tarWriter *tar.Writer, volumeName, path string) error {
+	volumeFile, err := os.Open(path) // #nosec G304 - controlled backup temp file path
+	if err != nil {
+		return fmt.Errorf("failed to open volume archive: %w", err)
+	}
+	defer func() {
+		if err := volumeFile.Close(); err != nil {
+			logger.Warnf("failed to close volume archive: %v", err)
+		}
+	}()
+
+	stat, err := volumeFile.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat volume archive: %w", err)
+	}
+
+	header := &tar.Header{
+		Name:    volumeEntryPath(volumeName),
+		Mode:    0644,
+		Size:    stat.Size(),
+		ModTime: time.Now(),
+	}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to add volume %s to backup archive: %w", volumeName, err)
+	}
+	if _, err := io.Copy(tarWriter, volumeFile); err != nil {
+		return fmt.Errorf("failed to add volume %s to backup archive: %w", volumeName, err)
+	}
+	return nil
+}
+
+// RestoreVolumesWithContainers restores volumes of a multi-volume snapshot with optional
+// container stop/start
+func (c *Client) RestoreVolumesWithContainers(mappings []VolumeMapping, snapshotName string, dryRun, force bool, stopContainers []string) error {
+	return c.withStoppedContainers(stopContainers, func() error {
+		return c.RestoreVolumes(mappings, snapshotName, dryRun, force)
+	})
+}
+
+// RestoreVolumes restores the mapped volumes of a multi-volume snapshot, each to its target
+// volume. The snapshot is downloaded once; volumes without a mapping are not restored.
+func (c *Client) RestoreVolumes(mappings []VolumeMapping, snapshotName string, dryRun, force bool) error {
+	if c.storage == nil {
+		return fmt.Errorf("storage backend is required for volume operations")
+	}
+	if c.backupBeforeRestore {
+		return fmt.Errorf("--backup-before-restore is not supported when restoring multiple volumes")
+	}
+
+	// Check every target volume before downloading anything
+	targets := make(map[string]models.VolumeInfo, len(mappings))
+	for _, mapping := range mappings {
+		if _, ok := targets[mapping.Target]; ok {
+			return fmt.Errorf("target volume '%s' is mapped more than once", mapping.Target)
+		}
+		exists, err := c.docker.VolumeExists(mapping.Target)
+		if err != nil {
+			return fmt.Errorf("failed to check target volume: %w", err)
+		}
+		if !exists {
+			return fmt.Errorf("target volume '%s' not found", mapping.Target)
+		}
+		volumeInfo, err := c.docker.GetVolume(mapping.Target)
+		if err != nil {
+			return err
+		}
+		targets[mapping.Target] = *volumeInfo
+	}
+
+	snapshotStorage := c.snapshotStorage()
+	backup, err := snapshotStorage.GetSnapshot(c.ctx, snapshotName)
+	if err != nil {
+		return StorageError(fmt.Errorf("failed to retrieve volume backup: %w", err))
+	}
+	defer func() {
+		if closer, ok := backup.DataReader.(interface{ Close() error }); ok {
+			if err := closer.Close(); err != nil {
+				logger.Warnf("failed to close backup data reader: %v", err)
+			}
+		}
+	}()
+
+	if backup.Metadata.IsSealed() {
+		return fmt.Errorf("the snapshot metadata is encrypted: provide --password to map its volumes")
+	}
+	if _, err := tarExtractArgs(backup.Metadata.ArchiveOptions()); err != nil {
+		return err
+	}
+
+	volumes := snapshotVolumes(backup.Metadata)
+	if len(volumes) < 2 {
+		return fmt.Errorf("snapshot '%s' does not contain multiple volumes: use --target-volume <name>", snapshotName)
+	}
+	contained := make(map[string]bool, len(volumes))
+	for _, name := range volumes {
+		contained[name] = true
+	}
+	for _, mapping := range mappings {
+		if !contained[mapping.Source] {
+			return fmt.Errorf("volume '%s' is not part of the snapshot (contains: %s)", mapping.Source, strings.Join(volumes, ", "))
+		}
+	}
+
+	if dryRun {
+		fmt.Printf("\n🎯 Would restore to:\n")
+		for _, mapping := range mappings {
+			target := targets[mapping.Target]
+			fmt.Printf("   %s -> %s (driver: %s)\n", mapping.Source, target.Name, target.Driver)
+		}
+		fmt.Println("\n✋ Dry run - no changes made")
+		return nil
+	}
+
+	if !force {
+		for _, mapping := range mappings {
+			if !confirmVolumeOverwrite(mapping.Target) {
+				fmt.Println("Restore cancelled")
+				return nil
+			}
+		}
+	}
+
+	tempFile, err := os.CreateTemp("", "dvom-restore-*.tar")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer func() {
+		if err := os.Remove(tempFile.Name()); err != nil {
+			logger.Warnf("failed to remove temp file: %v", err)
+		}
+	}()
+	if err := c.downloadBackup(backup, tempFile); err != nil {
+		return err
+	}
+
+	for _, mapping := range mappings {
+		c.noteBindRestore(backup.Metadata.MountTypes, mapping.Source, mapping.Target)
+		if err := c.restoreVolumeEntry(tempFile.Name(), mapping, targets[mapping.Target], backup.Metadata.ArchiveOptions()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreVolumeEntry restores one volume of a downloaded multi-volume snapshot
+func (c *Client) restoreVolumeEntry(archivePath string, mapping VolumeMapping, target models.VolumeInfo, options storage.BackupOptions) error {
+	volumePath, err := c.extractVolumeArchive(archivePath, mapping.Source)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := os.Remove(volumePath); err != nil {
+			logger.Warnf("failed to remove temp file: %v", err)
+		}
+	}()
+
+	var spinner *IndeterminateProgress
+	if !c.quiet {
+		spinner = NewIndeterminateProgress(fmt.Sprintf("📥 Restoring volume %s to %s", mapping.Source, target.Name))
+		defer spinner.Stop()
+	} else if c.verbose {
+		fmt.Printf("📥 Restoring volume %s to %s...\n", mapping.Source, target.Name)
+	}
+
+	if err := c.restoreDirectVolume(target, volumePath, options, true); err != nil {
+		return fmt.Errorf("failed to restore volume %s to %s: %w", mapping.Source, target.Name, err)
+	}
+
+	if spinner != nil {
+		spinner.Stop()
+	}
+
+	if c.verbose {
+		fmt.Printf("✅ Volume %s restored successfully to %s\n", mapping.Source, target.Name)
+	}
+	return nil
+}
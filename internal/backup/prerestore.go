@@ -0,0 +1,53 @@
+package backup
+
+import (
+	"fmt"
+
+	"github.com/ypeckstadt/dvom/internal/storage"
+)
+
+// preRestoreSuffix is appended to the name of the restored snapshot to name the safety
+// snapshot taken by --backup-before-restore
+const preRestoreSuffix = "-pre-restore"
+
+// SetBackupBeforeRestore backs up the current contents of the target volume before a restore
+// overwrites them, so the restore can be rolled back
+func (c *Client) SetBackupBeforeRestore(enabled bool) {
+	c.backupBeforeRestore = enabled
+}
+
+// preRestoreSnapshotName returns the name the safety snapshot of a restore is stored under.
+// The version added when it is stored records when it was taken.
+func preRestoreSnapshotName(snapshotName string) string {
+	if name, _, ok := storage.ParseVersionedID(snapshotName); ok {
+		snapshotName = name
+	}
+	return snapshotName + preRestoreSuffix
+}
+
+// backupPreRestoreState stores the current contents of the volume before it is overwritten by
+// a restore of metadata. The safety snapshot is encrypted when the client encrypts backups or
+// the restored backup is encrypted, with the same password.
+func (c *Client) backupPreRestoreState(volumeName, snapshotName string, metadata storage.BackupMetadata) error {
+	if metadata.Encrypted && !c.encryptEnabled {
+		// Ask for the restore's password now, so it also encrypts the safety snapshot
+		if _, err := c.encryptionPassword("Enter decryption password: ", false); err != nil {
+			return err
+		}
+		c.encryptEnabled = true
+		defer func() { c.encryptEnabled = false }()
+	}
+
+	name := preRestoreSnapshotName(snapshotName)
+	if !c.quiet {
+		fmt.Printf("🛟 Backing up the current contents of %s before restoring...\n", volumeName)
+	}
+
+	stored, _, err := c.backupDirectVolume(volumeName, name)
+	if err != nil {
+		return fmt.Errorf("failed to back up volume '%s' before restore, nothing was changed: %w", volumeName, err)
+	}
+
+	fmt.Printf("🛟 Pre-restore snapshot: %s (roll back with: dvom restore --snapshot %s --target-volume %s)\n", stored.ID, stored.ID, volumeName)
+	return nil
+}
@@ -8,69 +8,133 @@ import (
 	"github.com/cheggaaa/pb/v3"
 )
 
-// ProgressReader wraps an io.Reader with a progress bar
-type ProgressReader struct {
-	reader io.Reader
-	bar    *pb.ProgressBar
+// overshootMargin is how far past its expected size a transfer may run before its progress bar
+// switches to an indeterminate display
+const overshootMargin = 0.05
+
+// progressTracker drives a progress bar from a byte count whose expected total is an estimate.
+// The bar is capped at 100%, switches to an indeterminate display once the transfer exceeds
+// the estimate by more than overshootMargin, and completes at 100% when the transfer finishes
+// short of the estimate.
+type progressTracker struct {
+	bar           *pb.ProgressBar
+	description   string
+	expected      int64
+	transferred   int64
+	indeterminate bool
+	done          bool
 }
 
-// NewProgressReader creates a new progress reader
-func NewProgressReader(r io.Reader, size int64, description string) *ProgressReader {
+// newProgressTracker starts a progress bar for a transfer of the given expected size
+func newProgressTracker(size int64, description string) *progressTracker {
 	tmpl := fmt.Sprintf(`{{ "%s" }} {{ bar . "[" "=" ">" " " "]"}} {{speed . }} {{percent . }} {{rtime . " ETA"}}`, description)
-	
+
 	bar := pb.New64(size)
 	bar.Set(pb.SIBytesPrefix, true)
 	bar.SetTemplateString(tmpl)
 	bar.SetRefreshRate(100 * time.Millisecond)
 	bar.Start()
 
+	return &progressTracker{
+		bar:         bar,
+		description: description,
+		expected:    size,
+	}
+}
+
+// add records n transferred bytes
+func (t *progressTracker) add(n int) {
+	if n <= 0 {
+		return
+	}
+	t.transferred += int64(n)
+
+	if !t.indeterminate && float64(t.transferred) > float64(t.expected)*(1+overshootMargin) {
+		// The estimate was wrong; show the bytes transferred instead of a percentage and ETA
+		t.indeterminate = true
+		t.bar.SetTemplateString(fmt.Sprintf(`{{ "%s" }} {{ cycle . "⠋" "⠙" "⠹" "⠸" "⠼" "⠴" "⠦" "⠧" "⠇" "⠏" }} {{ counters . "%%[1]s" }} {{speed . }}`, t.description))
+	}
+
+	if t.indeterminate || t.transferred <= t.expected {
+		t.bar.SetCurrent(t.transferred)
+	} else {
+		t.bar.SetCurrent(t.expected)
+	}
+}
+
+// complete marks the transfer as finished, filling the bar if it ended short of the estimate
+func (t *progressTracker) complete() {
+	t.done = true
+}
+
+// finish stops the progress bar
+func (t *progressTracker) finish() {
+	if t.done && !t.indeterminate {
+		t.bar.SetCurrent(t.expected)
+	}
+	t.bar.Finish()
+}
+
+// ProgressReader wraps an io.Reader with a progress bar
+type ProgressReader struct {
+	reader  io.Reader
+	tracker *progressTracker
+}
+
+// NewProgressReader creates a new progress reader. The size may be an estimate.
+func NewProgressReader(r io.Reader, size int64, description string) *ProgressReader {
 	return &ProgressReader{
-		reader: bar.NewProxyReader(r),
-		bar:    bar,
+		reader:  r,
+		tracker: newProgressTracker(size, description),
 	}
 }
 
 // Read implements io.Reader
 func (pr *ProgressReader) Read(p []byte) (n int, err error) {
-	return pr.reader.Read(p)
+	n, err = pr.reader.Read(p)
+	pr.tracker.add(n)
+	if err == io.EOF {
+		pr.tracker.complete()
+	}
+	return n, err
 }
 
 // Close finishes the progress bar
 func (pr *ProgressReader) Close() error {
-	pr.bar.Finish()
+	pr.tracker.finish()
 	return nil
 }
 
 // ProgressWriter wraps an io.Writer with a progress bar
 type ProgressWriter struct {
-	writer io.Writer
-	bar    *pb.ProgressBar
+	writer  io.Writer
+	tracker *progressTracker
 }
 
-// NewProgressWriter creates a new progress writer
+// NewProgressWriter creates a new progress writer. The size may be an estimate.
 func NewProgressWriter(w io.Writer, size int64, description string) *ProgressWriter {
-	tmpl := fmt.Sprintf(`{{ "%s" }} {{ bar . "[" "=" ">" " " "]"}} {{speed . }} {{percent . }} {{rtime . " ETA"}}`, description)
-	
-	bar := pb.New64(size)
-	bar.Set(pb.SIBytesPrefix, true)
-	bar.SetTemplateString(tmpl)
-	bar.SetRefreshRate(100 * time.Millisecond)
-	bar.Start()
-
 	return &ProgressWriter{
-		writer: bar.NewProxyWriter(w),
-		bar:    bar,
+		writer:  w,
+		tracker: newProgressTracker(size, description),
 	}
 }
 
 // Write implements io.Writer
 func (pw *ProgressWriter) Write(p []byte) (n int, err error) {
-	return pw.writer.Write(p)
+	n, err = pw.writer.Write(p)
+	pw.tracker.add(n)
+	return n, err
+}
+
+// Complete marks the written data as complete, so the bar finishes at 100% even if fewer
+// bytes than expected were written
+func (pw *ProgressWriter) Complete() {
+	pw.tracker.complete()
 }
 
 // Close finishes the progress bar
 func (pw *ProgressWriter) Close() error {
-	pw.bar.Finish()
+	pw.tracker.finish()
 	return nil
 }
 
@@ -105,4 +169,52 @@ func (ip *IndeterminateProgress) Update(description string) {
 	ip.description = description
 	tmpl := fmt.Sprintf(`{{ "%s" }} {{ cycle . "⠋" "⠙" "⠹" "⠸" "⠼" "⠴" "⠦" "⠧" "⠇" "⠏" }}`, description)
 	ip.spinner.SetTemplateString(tmpl)
-}
\ No newline at end of file
+}
+// archiveCopyTracker is implemented by archive writers that show the progress of copying an
+// archive of known size out of the helper container
+type archiveCopyTracker interface {
+	trackCopy(r io.Reader, size int64) io.Reader
+}
+
+// archiveProgress writes an archive to w, showing a spinner while the helper container creates
+// it and a progress bar once it is copied out and its size is known
+type archiveProgress struct {
+	writer      io.Writer
+	description string
+	spinner     *IndeterminateProgress
+	bar         *ProgressReader
+}
+
+// newArchiveProgress starts the spinner of an archive written to w
+func newArchiveProgress(w io.Writer, description string) *archiveProgress {
+	return &archiveProgress{
+		writer:      w,
+		description: description,
+		spinner:     NewIndeterminateProgress(description),
+	}
+}
+
+func (p *archiveProgress) Write(b []byte) (int, error) {
+	return p.writer.Write(b)
+}
+
+// trackCopy replaces the spinner with a progress bar over the size bytes read from r. The
+// spinner is kept if the size is unknown.
+func (p *archiveProgress) trackCopy(r io.Reader, size int64) io.Reader {
+	if size <= 0 || p.bar != nil {
+		return r
+	}
+	p.spinner.Stop()
+	p.bar = NewProgressReader(r, size, p.description)
+	return p.bar
+}
+
+// Stop stops the spinner or progress bar
+func (p *archiveProgress) Stop() {
+	p.spinner.Stop()
+	if p.bar != nil {
+		if err := p.bar.Close(); err != nil {
+			logger.Warnf("failed to close progress reader: %v", err)
+		}
+	}
+}
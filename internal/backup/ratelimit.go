@@ -0,0 +1,66 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// MinRateLimit is the lowest accepted transfer rate limit in bytes per second
+const MinRateLimit = 1024
+
+// SetRateLimit caps the rate at which backups are uploaded to and downloaded from the storage
+// backend, in bytes per second; 0 means unlimited. The limit is shared by all transfers of the
+// client, so volumes backed up in parallel do not multiply it.
+func (c *Client) SetRateLimit(bytesPerSecond int64) error {
+	if bytesPerSecond == 0 {
+		c.rateLimiter = nil
+		return nil
+	}
+	if bytesPerSecond < MinRateLimit {
+		return fmt.Errorf("rate limit must be at least %d bytes per second, got %d", MinRateLimit, bytesPerSecond)
+	}
+	c.rateLimiter = rate.NewLimiter(rate.Limit(bytesPerSecond), int(bytesPerSecond))
+	return nil
+}
+
+// throttle returns r limited to the client's transfer rate, or r itself without a limit
+func (c *Client) throttle(r io.Reader) io.Reader {
+	if c.rateLimiter == nil {
+		return r
+	}
+	return NewRateLimitedReader(c.ctx, r, c.rateLimiter)
+}
+
+// RateLimitedReader wraps an io.Reader, waiting on a token bucket for every byte read
+type RateLimitedReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *rate.Limiter
+}
+
+// NewRateLimitedReader creates a reader that reads from r no faster than the limiter allows
+func NewRateLimitedReader(ctx context.Context, r io.Reader, limiter *rate.Limiter) *RateLimitedReader {
+	return &RateLimitedReader{
+		ctx:     ctx,
+		reader:  r,
+		limiter: limiter,
+	}
+}
+
+// Read implements io.Reader. Reads are capped at the limiter's burst, so that a single read
+// never asks for more tokens than the bucket holds.
+func (rr *RateLimitedReader) Read(p []byte) (int, error) {
+	if burst := rr.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := rr.reader.Read(p)
+	if n > 0 {
+		if waitErr := rr.limiter.WaitN(rr.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
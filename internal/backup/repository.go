@@ -0,0 +1,71 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ypeckstadt/dvom/internal/storage"
+)
+
+// ListRepositoryHistory displays the backups of a container added after the given version or time
+func (c *Client) ListRepositoryHistory(containerName string, sinceVersion int, since time.Time) error {
+	repo, ok := c.storage.(storage.RepositoryBackend)
+	if !ok {
+		return fmt.Errorf("repository storage backend is required for history operations")
+	}
+
+	backups, err := repo.ListBackupsSince(c.ctx, containerName, sinceVersion, since)
+	if err != nil {
+		return fmt.Errorf("failed to list repository history: %w", err)
+	}
+
+	if len(backups) == 0 {
+		fmt.Printf("No new backups found for '%s'\n", containerName)
+		return nil
+	}
+
+	fmt.Printf("Backups for '%s':\n\n", containerName)
+	fmt.Printf("%-10s %-30s %-20s %-10s %s\n", "VERSION", "ID", "CREATED", "SIZE", "DESCRIPTION")
+	fmt.Printf("%-10s %-30s %-20s %-10s %s\n", strings.Repeat("-", 10), strings.Repeat("-", 30), strings.Repeat("-", 20), strings.Repeat("-", 10), strings.Repeat("-", 20))
+
+	for _, backup := range backups {
+		size := fmt.Sprintf("%.1f MB", float64(backup.Size)/(1024*1024))
+		created := backup.CreatedAt.Format("2006-01-02 15:04:05")
+		description := backup.Description
+		if description == "" {
+			description = "-"
+		}
+
+		fmt.Printf("%-10d %-30s %-20s %-10s %s\n", backup.Version, backup.ID, created, size, description)
+	}
+
+	return nil
+}
+
+// CompactRepositoryIndex removes tombstones of deleted backups from the repository index
+func (c *Client) CompactRepositoryIndex() error {
+	repo, ok := c.storage.(storage.RepositoryBackend)
+	if !ok {
+		return fmt.Errorf("repository storage backend is required for index operations")
+	}
+
+	if c.verbose {
+		fmt.Println("🧹 Compacting repository index...")
+	}
+
+	removed, err := repo.CompactIndex(c.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to compact repository index: %w", err)
+	}
+
+	if !c.quiet {
+		if removed == 0 {
+			fmt.Println("Repository index is already compact")
+		} else {
+			fmt.Printf("✅ Removed %d deleted backup reference(s) from the repository index\n", removed)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,268 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ypeckstadt/dvom/internal/crypto"
+	"github.com/ypeckstadt/dvom/internal/storage"
+)
+
+// resumeState records an upload to a resumable backend, so an upload that failed or was
+// interrupted can be retried with `dvom backup --resume` without archiving the volume again.
+// It is written when the upload starts and removed once it completes.
+type resumeState struct {
+	// Snapshot is the name the backup is stored under
+	Snapshot string                  `json:"snapshot"`
+	Upload   storage.ResumableUpload `json:"upload"`
+	// Archive is the path of the unencrypted archive being uploaded, moved into the resume
+	// directory when the upload fails
+	Archive     string `json:"archive"`
+	ArchiveSize int64  `json:"archive_size"`
+	// EncryptionHeader is the header the archive was encrypted with, so a resumed upload
+	// encrypts it to the same bytes; empty for unencrypted backups
+	EncryptionHeader []byte `json:"encryption_header,omitempty"`
+	// SealMetadata records that the metadata is stored encrypted
+	SealMetadata bool                   `json:"seal_metadata,omitempty"`
+	Metadata     storage.BackupMetadata `json:"metadata"`
+	StartedAt    time.Time              `json:"started_at"`
+	// Error is why the last attempt failed
+	Error string `json:"error,omitempty"`
+	// kept is set once a failed upload was recorded for resuming
+	kept bool
+}
+
+// resumeDir returns the directory the states of resumable uploads are kept in
+func resumeDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".dvom", "uploads")
+	}
+	return filepath.Join(home, ".dvom", "uploads")
+}
+
+// resumeStatePath returns the path of the resume state of a snapshot
+func resumeStatePath(snapshotName string) string {
+	return filepath.Join(resumeDir(), url.PathEscape(storage.NormalizeSnapshotName(snapshotName))+".json")
+}
+
+// keptArchivePath returns the path an archive is kept at after its upload failed
+func keptArchivePath(snapshotName string) string {
+	return filepath.Join(resumeDir(), url.PathEscape(storage.NormalizeSnapshotName(snapshotName))+".archive")
+}
+
+// loadResumeState reads the resume state of a snapshot
+func loadResumeState(snapshotName string) (*resumeState, error) {
+	data, err := os.ReadFile(resumeStatePath(snapshotName)) // #nosec G304 - path built from the resume directory
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no interrupted upload of '%s' to resume: %w", snapshotName, storage.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read resume state: %w", err)
+	}
+
+	var state resumeState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse resume state %s: %w", resumeStatePath(snapshotName), err)
+	}
+	return &state, nil
+}
+
+// save writes the resume state, replacing the previous one atomically
+func (s *resumeState) save() error {
+	if err := os.MkdirAll(resumeDir(), 0700); err != nil {
+		return fmt.Errorf("failed to create resume directory: %w", err)
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode resume state: %w", err)
+	}
+
+	path := resumeStatePath(s.Snapshot)
+	temp := path + ".tmp"
+	if err := os.WriteFile(temp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write resume state: %w", err)
+	}
+	if err := os.Rename(temp, path); err != nil {
+		return fmt.Errorf("failed to write resume state: %w", err)
+	}
+	return nil
+}
+
+// storeResumable stores a backup with a resumable upload, keeping the state and archive needed
+// to resume it when it fails and removing them once it succeeded
+func (c *Client) storeResumable(backup *storage.Backup, state *resumeState) error {
+	if previous, err := loadResumeState(state.Snapshot); err == nil && previous.Upload.ID != state.Upload.ID {
+		logger.Warnf("discarding the interrupted upload of %s started %s", previous.Upload.ID, previous.StartedAt.Format("2006-01-02 15:04:05"))
+		previous.remove()
+	}
+
+	state.Upload.Started = func(*storage.ResumableUpload) error {
+		return state.save()
+	}
+	err := c.snapshotStorage().StoreSnapshotResumable(c.ctx, state.Snapshot, backup, &state.Upload)
+	if err == nil {
+		state.remove()
+		return nil
+	}
+
+	state.Error = err.Error()
+	if keepErr := state.keepArchive(); keepErr != nil {
+		logger.Warnf("the upload cannot be resumed: %v", keepErr)
+		state.remove()
+		return err
+	}
+	if saveErr := state.save(); saveErr != nil {
+		logger.Warnf("the upload cannot be resumed: %v", saveErr)
+		return err
+	}
+	state.kept = true
+	return err
+}
+
+// keepArchive moves the archive of a failed upload into the resume directory, as the archive
+// of a new backup is a temporary file removed when the backup returns
+func (s *resumeState) keepArchive() error {
+	kept := keptArchivePath(s.Snapshot)
+	if s.Archive == kept {
+		return nil
+	}
+	if err := os.MkdirAll(resumeDir(), 0700); err != nil {
+		return fmt.Errorf("failed to create resume directory: %w", err)
+	}
+
+	// The temporary file may be on another filesystem, fall back to copying it
+	if err := os.Link(s.Archive, kept); err != nil {
+		if err := copyFile(s.Archive, kept); err != nil {
+			return fmt.Errorf("failed to keep the backup archive: %w", err)
+		}
+	}
+	s.Archive = kept
+	return nil
+}
+
+// remove deletes the resume state and the archive kept for it
+func (s *resumeState) remove() {
+	if err := os.Remove(resumeStatePath(s.Snapshot)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Warnf("failed to remove resume state: %v", err)
+	}
+	if s.Archive == keptArchivePath(s.Snapshot) {
+		if err := os.Remove(s.Archive); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Warnf("failed to remove kept archive: %v", err)
+		}
+	}
+}
+
+// copyFile copies the file at src to a new file at dst
+func copyFile(src, dst string) (err error) {
+	in, err := os.Open(src) // #nosec G304 - archive written by dvom
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := in.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600) // #nosec G304 - path in the resume directory
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// ResumeBackup retries the upload of a backup of snapshotName that failed or was interrupted.
+// The archive kept from the failed attempt is uploaded again as the same version; parts the
+// backend already stored are skipped where it supports it. The file manifest, verification and
+// retention run as for a new backup.
+func (c *Client) ResumeBackup(snapshotName string) error {
+	if c.storage == nil {
+		return fmt.Errorf("storage backend is required for volume operations")
+	}
+	if _, ok := c.storage.(storage.ResumableBackend); !ok {
+		return fmt.Errorf("storage backend does not support resumable uploads")
+	}
+
+	state, err := loadResumeState(snapshotName)
+	if err != nil {
+		return err
+	}
+
+	archive, err := os.Open(state.Archive)
+	if err != nil {
+		return fmt.Errorf("archive of the interrupted upload is gone, run the backup again: %w", err)
+	}
+	defer func() {
+		if err := archive.Close(); err != nil {
+			logger.Warnf("failed to close archive: %v", err)
+		}
+	}()
+	stat, err := archive.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat archive: %w", err)
+	}
+	if stat.Size() != state.ArchiveSize {
+		return fmt.Errorf("archive of the interrupted upload changed size (%d bytes, expected %d), run the backup again", stat.Size(), state.ArchiveSize)
+	}
+
+	// The archive is removed with the state once the upload completes, read the manifest first
+	var manifest fileManifest
+	if state.Metadata.Type == "direct-volume-backup" {
+		stats, err := inspectArchive(state.Archive, state.Metadata.ArchiveOptions().Compression)
+		if err != nil {
+			return err
+		}
+		manifest = stats.Manifest
+	}
+
+	var data io.Reader = archive
+	size := stat.Size()
+	if len(state.EncryptionHeader) > 0 {
+		header, err := crypto.ReadEncryptionHeader(bytes.NewReader(state.EncryptionHeader))
+		if err != nil {
+			return fmt.Errorf("failed to read encryption header: %w", err)
+		}
+		password, err := c.encryptionPassword("Enter encryption password: ", false)
+		if err != nil {
+			return err
+		}
+		encryptReader, err := crypto.ResumeEncryptReader(archive, password, header)
+		if err != nil {
+			return fmt.Errorf("failed to resume encryption: %w", err)
+		}
+		data = io.MultiReader(bytes.NewReader(state.EncryptionHeader), encryptReader)
+		size = int64(len(state.EncryptionHeader)) + crypto.EncryptedSize(size, header.ChunkSize)
+	}
+	state.Metadata.Size = size
+	c.encryptMetadata = state.SealMetadata
+
+	if !c.quiet {
+		fmt.Printf("🔁 Resuming upload of %s (started %s)\n", state.Upload.ID, state.StartedAt.Format("2006-01-02 15:04:05"))
+	}
+	stored, err := c.upload(data, state.Snapshot, state.Metadata, state)
+	if err != nil {
+		return err
+	}
+	if manifest != nil {
+		c.storeManifest(stored, manifest)
+	}
+
+	c.lastUnchanged = false
+	if err := c.verifyNewBackup(stored); err != nil {
+		return err
+	}
+	return c.applyRetention(state.Snapshot, stored.ID)
+}
@@ -0,0 +1,147 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ypeckstadt/dvom/internal/storage"
+)
+
+// RetentionPolicy selects the versions of a snapshot kept after a backup. A version is kept if
+// any keep rule keeps it (all versions when there are none), and MaxVersions then caps the
+// number kept; a zero policy keeps everything.
+type RetentionPolicy struct {
+	// KeepLast keeps the newest N versions
+	KeepLast int
+	// KeepWithin keeps the versions created within this duration of now
+	KeepWithin time.Duration
+	// MaxVersions deletes the oldest versions beyond this count, whatever the keep rules say
+	MaxVersions int
+}
+
+// IsZero reports whether the policy has no rules
+func (p RetentionPolicy) IsZero() bool {
+	return p.KeepLast <= 0 && p.KeepWithin <= 0 && p.MaxVersions <= 0
+}
+
+// hasKeepRules reports whether the policy has rules selecting versions to keep
+func (p RetentionPolicy) hasKeepRules() bool {
+	return p.KeepLast > 0 || p.KeepWithin > 0
+}
+
+// prunePolicy converts the policy for SnapshotStorage.PruneVersions, protecting one version
+func (p RetentionPolicy) prunePolicy(protect string) storage.PrunePolicy {
+	return storage.PrunePolicy{
+		KeepLast:    p.KeepLast,
+		KeepWithin:  p.KeepWithin,
+		MaxVersions: p.MaxVersions,
+		Protect:     protect,
+	}
+}
+
+// SetRetention sets the retention policy applied to a snapshot after each successful backup
+func (c *Client) SetRetention(policy RetentionPolicy) {
+	c.retention = policy
+}
+
+// applyRetention deletes the versions of a snapshot not kept by the retention policy. The
+// version just stored is always kept and must be readable before anything is deleted, so a
+// failed backup can never leave the snapshot without versions.
+func (c *Client) applyRetention(snapshotName, currentID string) error {
+	if c.retention.IsZero() {
+		return nil
+	}
+
+	snapshotStorage := c.snapshotStorage()
+	exists, err := snapshotStorage.SnapshotExists(c.ctx, currentID)
+	if err != nil {
+		return fmt.Errorf("failed to confirm backup %s before pruning: %w", currentID, err)
+	}
+	if !exists {
+		return fmt.Errorf("backup %s not found after storing; nothing was pruned", currentID)
+	}
+
+	pruned, total, err := snapshotStorage.PruneVersions(c.ctx, snapshotName, c.retention.prunePolicy(currentID), false)
+	if c.verbose {
+		for _, version := range pruned {
+			fmt.Printf("🗑️  Pruned: %s\n", version.ID)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if !c.quiet {
+		if len(pruned) == 0 {
+			fmt.Printf("🧹 Retention: kept all %d version(s) of %s\n", total, snapshotName)
+		} else {
+			fmt.Printf("🧹 Retention: pruned %d of %d version(s) of %s\n", len(pruned), total, snapshotName)
+			if !c.verbose {
+				for _, version := range pruned {
+					fmt.Printf("   - %s\n", version.ID)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// PruneSnapshot deletes the versions of a snapshot not kept by the policy, listing them and
+// asking for confirmation first unless force is set. With dryRun nothing is deleted.
+func (c *Client) PruneSnapshot(snapshotName string, policy RetentionPolicy, dryRun, force bool) error {
+	if c.storage == nil {
+		return fmt.Errorf("storage backend is required for snapshot operations")
+	}
+	if !policy.hasKeepRules() && policy.MaxVersions <= 0 {
+		return fmt.Errorf("no retention rule given: nothing would be pruned")
+	}
+
+	snapshotStorage := c.snapshotStorage()
+	candidates, total, err := snapshotStorage.PruneVersions(c.ctx, snapshotName, policy.prunePolicy(""), true)
+	if err != nil {
+		return err
+	}
+	if total == 0 {
+		return fmt.Errorf("no snapshots found with name '%s'", snapshotName)
+	}
+	if len(candidates) == 0 {
+		if !c.quiet {
+			fmt.Printf("🧹 Nothing to prune: all %d version(s) of %s are kept\n", total, snapshotName)
+		}
+		return nil
+	}
+
+	fmt.Printf("Versions of %s to delete (%d of %d):\n", snapshotName, len(candidates), total)
+	for _, version := range candidates {
+		fmt.Printf("   - %s  %s  %.1f MB\n", version.ID, version.CreatedAt.Format("2006-01-02 15:04:05"), float64(version.Size)/(1024*1024))
+	}
+
+	if dryRun {
+		fmt.Println("\n✋ Dry run - no changes made")
+		return nil
+	}
+
+	if !force {
+		fmt.Print("Continue? (y/N): ")
+		var response string
+		if _, err := fmt.Scanln(&response); err != nil {
+			// Treat as "N" if there's an error reading response
+			response = "N"
+		}
+		if strings.ToLower(response) != "y" {
+			fmt.Println("Prune cancelled")
+			return nil
+		}
+	}
+
+	pruned, _, err := snapshotStorage.PruneVersions(c.ctx, snapshotName, policy.prunePolicy(""), false)
+	if err != nil {
+		return err
+	}
+	if !c.quiet {
+		fmt.Printf("🧹 Pruned %d of %d version(s) of %s\n", len(pruned), total, snapshotName)
+	}
+	return nil
+}
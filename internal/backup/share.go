@@ -0,0 +1,47 @@
+package backup
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ypeckstadt/dvom/internal/storage"
+)
+
+// ShareSnapshot prints a signed URL granting read access to the data of a snapshot version for
+// expiry, so it can be downloaded without storage credentials. Only backends implementing
+// storage.SharableBackend can sign URLs.
+func (c *Client) ShareSnapshot(versionedID string, expiry time.Duration) error {
+	if c.storage == nil {
+		return fmt.Errorf("storage backend is required for snapshot operations")
+	}
+	sharable, ok := c.storage.(storage.SharableBackend)
+	if !ok {
+		return fmt.Errorf("storage backend cannot sign URLs: sharing needs the S3 or GCS backend")
+	}
+	if expiry <= 0 || expiry > storage.MaxSignedURLExpiry {
+		return fmt.Errorf("expiry must be between 1s and %s, got %s", storage.MaxSignedURLExpiry, expiry)
+	}
+
+	metadata, err := c.SnapshotMetadata(versionedID)
+	if err != nil {
+		return err
+	}
+
+	url, err := sharable.SignedURL(c.ctx, metadata.ID, expiry)
+	if err != nil {
+		return StorageError(err)
+	}
+
+	if c.quiet {
+		fmt.Println(url)
+		return nil
+	}
+	fmt.Printf("🔗 Signed URL of %s (%.1f MB), valid until %s:\n\n", metadata.ID, float64(metadata.Size)/(1024*1024), time.Now().Add(expiry).Format("2006-01-02 15:04:05"))
+	fmt.Println(url)
+	if metadata.Encrypted {
+		fmt.Println("\nℹ️  The backup is encrypted: the recipient needs its password to restore it with dvom restore --from-file")
+	} else {
+		fmt.Println("\nℹ️  Anyone with the URL can download the backup until it expires")
+	}
+	return nil
+}
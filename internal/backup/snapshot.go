@@ -2,31 +2,47 @@ package backup
 
 import (
 	"fmt"
+	"os"
+	"sort"
 	"strings"
 
+	"github.com/ypeckstadt/dvom/internal/models"
 	"github.com/ypeckstadt/dvom/internal/storage"
 )
 
-// ListSnapshots lists all volume snapshots in the repository
-func (c *Client) ListSnapshots() error {
+// Snapshots returns all volume snapshots in the repository with their latest version, limited
+// to the snapshots matching the snapshot filters and to the versions in the time window
+func (c *Client) Snapshots() ([]storage.SnapshotInfo, error) {
 	if c.storage == nil {
-		return fmt.Errorf("storage backend is required for snapshot operations")
+		return nil, fmt.Errorf("storage backend is required for snapshot operations")
+	}
+
+	snapshots, err := c.snapshotStorage().ListSnapshotsBetween(c.ctx, c.since, c.until)
+	if err != nil {
+		return nil, StorageError(fmt.Errorf("failed to list snapshots: %w", err))
 	}
+	return c.filterSnapshots(snapshots), nil
+}
 
-	snapshotStorage := storage.NewSnapshotStorage(c.storage)
-	snapshots, err := snapshotStorage.ListSnapshots(c.ctx)
+// ListSnapshots lists all volume snapshots in the repository
+func (c *Client) ListSnapshots() error {
+	snapshots, err := c.Snapshots()
 	if err != nil {
-		return fmt.Errorf("failed to list snapshots: %w", err)
+		return err
 	}
 
 	if len(snapshots) == 0 {
+		if c.hasListFilters() {
+			fmt.Println("No snapshots match the filter")
+			return nil
+		}
 		fmt.Println("No snapshots found in repository")
 		return nil
 	}
 
 	fmt.Printf("Volume Backups:\n\n")
-	fmt.Printf("%-30s %-20s %-10s %-10s %-10s %s\n", "BACKUP NAME", "LATEST VERSION", "SIZE", "VERSIONS", "ENCRYPTED", "VOLUME")
-	fmt.Printf("%-30s %-20s %-10s %-10s %-10s %s\n", strings.Repeat("-", 30), strings.Repeat("-", 20), strings.Repeat("-", 10), strings.Repeat("-", 10), strings.Repeat("-", 10), strings.Repeat("-", 20))
+	fmt.Printf("%-30s %-20s %-10s %-7s %-10s %-10s %-20s %s\n", "BACKUP NAME", "LATEST VERSION", "SIZE", "RATIO", "VERSIONS", "ENCRYPTED", "VOLUME", "TAGS")
+	fmt.Printf("%-30s %-20s %-10s %-7s %-10s %-10s %-20s %s\n", strings.Repeat("-", 30), strings.Repeat("-", 20), strings.Repeat("-", 10), strings.Repeat("-", 7), strings.Repeat("-", 10), strings.Repeat("-", 10), strings.Repeat("-", 20), strings.Repeat("-", 20))
 
 	for _, snapshot := range snapshots {
 		size := fmt.Sprintf("%.1f MB", float64(snapshot.Size)/(1024*1024))
@@ -42,7 +58,12 @@ func (c *Client) ListSnapshots() error {
 			encrypted = "Yes"
 		}
 
-		fmt.Printf("%-30s %-20s %-10s %-10s %-10s %s\n", snapshot.Name, created, size, versionCount, encrypted, volumeName)
+		ratio := "-"
+		if snapshot.Parent == "" {
+			ratio = compressionRatio(snapshot.VolumeSize, snapshot.Size)
+		}
+
+		fmt.Printf("%-30s %-20s %-10s %-7s %-10s %-10s %-20s %s\n", snapshot.Name, created, size, ratio, versionCount, encrypted, volumeName, formatKeyValues(snapshot.Tags))
 
 		if c.verbose {
 			if snapshot.Description != "" {
@@ -57,56 +78,237 @@ func (c *Client) ListSnapshots() error {
 	return nil
 }
 
-// GetSnapshotInfo displays detailed information about a snapshot
-func (c *Client) GetSnapshotInfo(snapshotName string) error {
+// ListSnapshotTree lists all volume snapshots with their versions nested below them
+func (c *Client) ListSnapshotTree() error {
 	if c.storage == nil {
 		return fmt.Errorf("storage backend is required for snapshot operations")
 	}
 
-	snapshotStorage := storage.NewSnapshotStorage(c.storage)
-	backup, err := snapshotStorage.GetSnapshot(c.ctx, snapshotName)
+	allVersions, err := c.snapshotStorage().ListAllVersions(c.ctx)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve snapshot: %w", err)
+		return StorageError(fmt.Errorf("failed to list snapshots: %w", err))
 	}
-	defer func() {
-		if closer, ok := backup.DataReader.(interface{ Close() error }); ok {
-			if err := closer.Close(); err != nil && c.verbose {
-				fmt.Printf("Warning: failed to close backup data reader: %v\n", err)
+
+	latestIDs := make(map[string]string, len(allVersions))
+	for name, versions := range allVersions {
+		latestIDs[name] = versions[0].ID
+	}
+
+	// Filters select the versions whose own tags match and that were created in the window
+	if c.hasListFilters() {
+		for name, versions := range allVersions {
+			var matching []storage.VersionInfo
+			for _, version := range versions {
+				if c.matchesSnapshotFilters(version.Tags) && storage.InTimeWindow(version.CreatedAt, c.since, c.until) {
+					matching = append(matching, version)
+				}
+			}
+			if len(matching) == 0 {
+				delete(allVersions, name)
+				continue
+			}
+			allVersions[name] = matching
+		}
+		if len(allVersions) == 0 {
+			fmt.Println("No snapshots match the filter")
+			return nil
+		}
+	}
+
+	if len(allVersions) == 0 {
+		fmt.Println("No snapshots found in repository")
+		return nil
+	}
+
+	names := make([]string, 0, len(allVersions))
+	for name := range allVersions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Printf("Volume Backups:\n\n")
+	for _, name := range names {
+		versions := allVersions[name]
+
+		var totalSize int64
+		for _, version := range versions {
+			totalSize += version.Size
+		}
+		fmt.Printf("📦 %s (%d version(s), %.1f MB total)\n", name, len(versions), float64(totalSize)/(1024*1024))
+
+		for i, version := range versions {
+			branch := "├─"
+			if i == len(versions)-1 {
+				branch = "└─"
+			}
+			latest := ""
+			if version.ID == latestIDs[name] {
+				latest = " (latest)"
+			}
+			tags := ""
+			if len(version.Tags) > 0 {
+				tags = "  [" + formatKeyValues(version.Tags) + "]"
 			}
+			fmt.Printf("   %s %s  %s  %.1f MB%s%s\n", branch, version.Version, version.CreatedAt.Format("2006-01-02 15:04:05"), float64(version.Size)/(1024*1024), latest, tags)
 		}
-	}()
+	}
+
+	return nil
+}
+
+// compressionRatio formats how many times larger the volume is than its backup, or "-" if either
+// size is unknown, e.g. for an empty volume
+func compressionRatio(volumeSize, backupSize int64) string {
+	if volumeSize <= 0 || backupSize <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1fx", float64(volumeSize)/float64(backupSize))
+}
 
-	fmt.Printf("Snapshot: %s\n", backup.Metadata.Name)
-	fmt.Printf("Created: %s\n", backup.Metadata.CreatedAt.Format("2006-01-02 15:04:05"))
-	fmt.Printf("Size: %.1f MB\n", float64(backup.Metadata.Size)/(1024*1024))
-	fmt.Printf("Type: %s\n", backup.Metadata.Type)
-	fmt.Printf("Encrypted: %v\n", backup.Metadata.Encrypted)
+// SnapshotMetadata returns the metadata of a snapshot (latest version) or name@version
+func (c *Client) SnapshotMetadata(snapshotName string) (*storage.BackupMetadata, error) {
+	if c.storage == nil {
+		return nil, fmt.Errorf("storage backend is required for snapshot operations")
+	}
 
-	if backup.Metadata.VolumeName != "" {
-		volumes := strings.Split(backup.Metadata.VolumeName, ",")
+	backup, err := c.snapshotStorage().GetSnapshot(c.ctx, snapshotName)
+	if err != nil {
+		return nil, StorageError(fmt.Errorf("failed to retrieve snapshot: %w", err))
+	}
+	if closer, ok := backup.DataReader.(interface{ Close() error }); ok {
+		if err := closer.Close(); err != nil {
+			logger.Warnf("failed to close backup data reader: %v", err)
+		}
+	}
+	return &backup.Metadata, nil
+}
+
+// GetSnapshotInfo displays detailed information about a snapshot
+func (c *Client) GetSnapshotInfo(snapshotName string) error {
+	metadata, err := c.SnapshotMetadata(snapshotName)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Snapshot: %s\n", metadata.Name)
+	fmt.Printf("Created: %s\n", metadata.CreatedAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("Size: %.1f MB\n", float64(metadata.Size)/(1024*1024))
+	fmt.Printf("Type: %s\n", metadata.Type)
+	fmt.Printf("Encrypted: %v\n", metadata.Encrypted)
+	if metadata.FileCount > 0 {
+		fmt.Printf("Files: %d (%.1f MB uncompressed)\n", metadata.FileCount, float64(metadata.UncompressedSize)/(1024*1024))
+	}
+	if metadata.VolumeSize > 0 {
+		// An increment holds only the changed files, so its size says nothing about compression
+		if metadata.Parent == "" {
+			fmt.Printf("Volume size: %.1f MB (compression ratio %s)\n", float64(metadata.VolumeSize)/(1024*1024), compressionRatio(metadata.VolumeSize, metadata.Size))
+		} else {
+			fmt.Printf("Volume size: %.1f MB\n", float64(metadata.VolumeSize)/(1024*1024))
+		}
+	}
+	if metadata.Checksum != "" {
+		fmt.Printf("Checksum: sha256:%s\n", metadata.Checksum)
+	}
+	if options := metadata.Options; options != nil {
+		level := ""
+		if options.CompressionLevel != 0 {
+			level = fmt.Sprintf(" level %d", options.CompressionLevel)
+		}
+		fmt.Printf("Archive: %s+%s%s (strategy: %s)\n", options.Format, options.Compression, level, options.Strategy)
+		if len(options.Excludes) > 0 {
+			fmt.Printf("Excluded: %s\n", strings.Join(options.Excludes, ", "))
+		}
+	} else {
+		options := metadata.ArchiveOptions()
+		fmt.Printf("Archive: %s+%s (not recorded, assumed)\n", options.Format, options.Compression)
+	}
+
+	if metadata.VolumeName != "" {
+		volumes := strings.Split(metadata.VolumeName, ",")
 		fmt.Printf("Volumes: %d\n", len(volumes))
 		for _, vol := range volumes {
-			fmt.Printf("  - %s\n", vol)
+			kind := ""
+			if metadata.MountTypes[vol] == models.MountTypeBind {
+				kind = " [host path]"
+			}
+			if size, ok := metadata.VolumeSizes[vol]; ok {
+				fmt.Printf("  - %s%s (%.1f MB)\n", vol, kind, float64(size)/(1024*1024))
+			} else {
+				fmt.Printf("  - %s%s\n", vol, kind)
+			}
+		}
+	}
+	if container := metadata.Container; container != nil {
+		fmt.Printf("Container: %s (%s)\n", container.Name, shortID(container.ID))
+		for _, volumeName := range sortedKeys(container.Mounts) {
+			fmt.Printf("  - %s mounted at %s\n", volumeName, container.Mounts[volumeName])
 		}
 	}
+	if len(metadata.Tags) > 0 {
+		fmt.Printf("Tags:\n")
+		for _, key := range sortedKeys(metadata.Tags) {
+			fmt.Printf("  - %s=%s\n", key, metadata.Tags[key])
+		}
+	}
+	if metadata.VolumeDriver != "" {
+		fmt.Printf("Volume driver: %s\n", metadata.VolumeDriver)
+	}
+	if len(metadata.VolumeLabels) > 0 {
+		fmt.Printf("Volume labels:\n")
+		for _, key := range sortedKeys(metadata.VolumeLabels) {
+			fmt.Printf("  - %s=%s\n", key, metadata.VolumeLabels[key])
+		}
+	}
+	if len(metadata.VolumeOptions) > 0 {
+		fmt.Printf("Driver options: %s\n", formatKeyValues(metadata.VolumeOptions))
+	}
 
-	if backup.Metadata.Description != "" {
-		fmt.Printf("Description: %s\n", backup.Metadata.Description)
+	if metadata.Parent != "" {
+		fmt.Printf("Incremental: files changed since %s\n", metadata.Parent)
+	}
+
+	if metadata.Description != "" {
+		fmt.Printf("Description: %s\n", metadata.Description)
 	}
 
 	return nil
 }
 
-// ListSnapshotVersions displays all versions of a specific snapshot
-func (c *Client) ListSnapshotVersions(snapshotName string) error {
+// SnapshotVersions returns all versions of a specific snapshot, newest first
+func (c *Client) SnapshotVersions(snapshotName string) ([]storage.VersionInfo, error) {
 	if c.storage == nil {
-		return fmt.Errorf("storage backend is required for snapshot operations")
+		return nil, fmt.Errorf("storage backend is required for snapshot operations")
 	}
 
-	snapshotStorage := storage.NewSnapshotStorage(c.storage)
-	versions, err := snapshotStorage.ListVersions(c.ctx, snapshotName)
+	versions, err := c.snapshotStorage().ListVersions(c.ctx, snapshotName)
 	if err != nil {
-		return fmt.Errorf("failed to list versions: %w", err)
+		return nil, StorageError(fmt.Errorf("failed to list versions: %w", err))
+	}
+	return versions, nil
+}
+
+// ResolveVersion returns the versioned ID of the snapshot version a --version selector refers
+// to, such as "latest", "previous", "~2" or an exact version
+func (c *Client) ResolveVersion(snapshotName, selector string) (string, error) {
+	if c.storage == nil {
+		return "", fmt.Errorf("storage backend is required for snapshot operations")
+	}
+
+	versionedID, err := c.snapshotStorage().ResolveVersion(c.ctx, snapshotName, selector)
+	if err != nil {
+		return "", StorageError(fmt.Errorf("failed to resolve version: %w", err))
+	}
+	if c.verbose && versionedID != storage.VersionedID(snapshotName, selector) {
+		fmt.Printf("🔎 Version %s of %s is %s\n", selector, snapshotName, versionedID)
+	}
+	return versionedID, nil
+}
+
+// ListSnapshotVersions displays all versions of a specific snapshot
+func (c *Client) ListSnapshotVersions(snapshotName string) error {
+	versions, err := c.SnapshotVersions(snapshotName)
+	if err != nil {
+		return err
 	}
 
 	if len(versions) == 0 {
@@ -138,14 +340,25 @@ func (c *Client) DeleteSnapshot(nameOrVersioned string, force bool) error {
 		return fmt.Errorf("storage backend is required for snapshot operations")
 	}
 
-	snapshotStorage := storage.NewSnapshotStorage(c.storage)
+	snapshotStorage := c.snapshotStorage()
 
 	// Check if it's a versioned delete or full name delete
-	isVersioned := strings.Contains(nameOrVersioned, "@")
+	isVersioned := storage.IsVersionedID(nameOrVersioned)
 
 	if !force {
 		if isVersioned {
 			fmt.Printf("⚠️  This will permanently delete the specific version: %s\n", nameOrVersioned)
+			if name, _, ok := storage.ParseVersionedID(nameOrVersioned); ok {
+				versions, err := snapshotStorage.ListVersions(c.ctx, name)
+				if err != nil {
+					return fmt.Errorf("failed to check versions: %w", err)
+				}
+				for _, version := range versions {
+					if version.Parent == nameOrVersioned {
+						fmt.Printf("⚠️  Incremental version %s is based on it and can no longer be restored\n", version.ID)
+					}
+				}
+			}
 		} else {
 			// Show how many versions will be deleted
 			versions, err := snapshotStorage.ListVersions(c.ctx, nameOrVersioned)
@@ -188,3 +401,92 @@ func (c *Client) DeleteSnapshot(nameOrVersioned string, force bool) error {
 
 	return nil
 }
+
+// RenameSnapshot moves all versions of a snapshot to a new name without re-uploading them
+func (c *Client) RenameSnapshot(oldName, newName string) error {
+	if c.storage == nil {
+		return fmt.Errorf("storage backend is required for snapshot operations")
+	}
+
+	if c.verbose {
+		fmt.Printf("✏️  Renaming snapshot '%s' to '%s'...\n", oldName, newName)
+	}
+
+	renamed, err := c.snapshotStorage().RenameSnapshot(c.ctx, oldName, newName)
+	if err != nil {
+		return StorageError(fmt.Errorf("failed to rename snapshot: %w", err))
+	}
+
+	if c.verbose {
+		for _, id := range renamed {
+			fmt.Printf("   %s\n", id)
+		}
+	}
+	if !c.quiet {
+		fmt.Printf("✅ Renamed snapshot '%s' to '%s' (%d version(s))\n", oldName, storage.NormalizeSnapshotName(newName), len(renamed))
+	}
+	return nil
+}
+
+// DumpMetadata writes the stored metadata object of a snapshot to stdout verbatim, without
+// downloading its data
+func (c *Client) DumpMetadata(snapshotName string) error {
+	if c.storage == nil {
+		return fmt.Errorf("storage backend is required for snapshot operations")
+	}
+
+	versionedID, data, err := c.snapshotStorage().RawMetadata(c.ctx, snapshotName)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot metadata: %w", err)
+	}
+
+	if c.verbose {
+		fmt.Fprintf(os.Stderr, "📄 Metadata object of %s (%d bytes)\n", versionedID, len(data))
+	}
+
+	if _, err := os.Stdout.Write(data); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+	return nil
+}
+
+// RepairSnapshot regenerates the metadata of a snapshot version from its data object.
+// Metadata that can still be read is only replaced when overwrite is set.
+func (c *Client) RepairSnapshot(versionedID string, overwrite bool) error {
+	if c.storage == nil {
+		return fmt.Errorf("storage backend is required for snapshot operations")
+	}
+
+	snapshotStorage := c.snapshotStorage()
+
+	if !overwrite {
+		if backup, err := snapshotStorage.GetSnapshot(c.ctx, versionedID); err == nil {
+			if closer, ok := backup.DataReader.(interface{ Close() error }); ok {
+				if err := closer.Close(); err != nil {
+					logger.Warnf("failed to close backup data reader: %v", err)
+				}
+			}
+			return fmt.Errorf("metadata for '%s' is readable; use --overwrite-metadata to regenerate it anyway", versionedID)
+		}
+	}
+
+	if c.verbose {
+		fmt.Printf("🔧 Regenerating metadata for: %s\n", versionedID)
+	}
+
+	metadata, err := snapshotStorage.RepairSnapshot(c.ctx, versionedID)
+	if err != nil {
+		return fmt.Errorf("failed to repair snapshot: %w", err)
+	}
+
+	if !c.quiet {
+		fmt.Printf("✅ Metadata regenerated for %s\n", metadata.ID)
+		fmt.Printf("Snapshot: %s\n", metadata.Name)
+		fmt.Printf("Version: %s\n", metadata.Version)
+		fmt.Printf("Created: %s\n", metadata.CreatedAt.Format("2006-01-02 15:04:05"))
+		fmt.Printf("Size: %.1f MB\n", float64(metadata.Size)/(1024*1024))
+		fmt.Printf("Encrypted: %v\n", metadata.Encrypted)
+	}
+
+	return nil
+}
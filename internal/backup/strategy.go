@@ -0,0 +1,246 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ypeckstadt/dvom/internal/models"
+)
+
+// SnapshotStrategy creates a compressed tar archive of a volume's contents
+type SnapshotStrategy interface {
+	// Name returns the name used to select the strategy
+	Name() string
+	// Supports reports whether the strategy can handle the volume's driver
+	Supports(volume models.VolumeInfo) bool
+	// Backup writes the compressed archive of the volume to w
+	Backup(c *Client, volume models.VolumeInfo, w io.Writer) error
+}
+
+// snapshotStrategies lists the available strategies in order of preference
+var snapshotStrategies = []SnapshotStrategy{
+	&btrfsStrategy{},
+	&zfsStrategy{},
+	&tarStrategy{},
+}
+
+// SnapshotStrategyNames returns the names accepted by SetSnapshotStrategy
+func SnapshotStrategyNames() []string {
+	names := []string{"auto"}
+	for _, strategy := range snapshotStrategies {
+		names = append(names, strategy.Name())
+	}
+	return names
+}
+
+// SetSnapshotStrategy selects the snapshot strategy used for backups ("auto" picks one by volume driver)
+func (c *Client) SetSnapshotStrategy(name string) error {
+	if name == "" || name == "auto" {
+		c.snapshotStrategy = ""
+		return nil
+	}
+
+	for _, strategy := range snapshotStrategies {
+		if strategy.Name() == name {
+			c.snapshotStrategy = name
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown snapshot strategy '%s' (available: %s)", name, strings.Join(SnapshotStrategyNames(), ", "))
+}
+
+// archiveVolume archives a volume to w with the selected strategy and returns the name of the
+// strategy that produced the archive. In auto mode the first strategy supporting the volume's
+// driver is used, falling back to the tar helper if it fails before writing anything.
+func (c *Client) archiveVolume(volume models.VolumeInfo, w io.Writer) (string, error) {
+	fallback := &tarStrategy{}
+
+	if c.snapshotStrategy != "" {
+		for _, strategy := range snapshotStrategies {
+			if strategy.Name() == c.snapshotStrategy {
+				if c.verbose {
+					fmt.Printf("📷 Using %s snapshot strategy\n", strategy.Name())
+				}
+				return strategy.Name(), strategy.Backup(c, volume, w)
+			}
+		}
+		return "", fmt.Errorf("unknown snapshot strategy '%s'", c.snapshotStrategy)
+	}
+
+	for _, strategy := range snapshotStrategies {
+		if strategy.Name() == fallback.Name() || !strategy.Supports(volume) {
+			continue
+		}
+
+		if c.verbose {
+			fmt.Printf("📷 Using %s snapshot strategy for driver '%s'\n", strategy.Name(), volume.Driver)
+		}
+		counter := &countingWriter{writer: w}
+		err := strategy.Backup(c, volume, counter)
+		if err == nil {
+			return strategy.Name(), nil
+		}
+		if counter.written > 0 {
+			// Part of the archive is already written, so tar cannot start over
+			return strategy.Name(), fmt.Errorf("%s snapshot failed: %w", strategy.Name(), err)
+		}
+		logger.Warnf("%s snapshot failed, falling back to tar: %v", strategy.Name(), err)
+		break
+	}
+
+	return fallback.Name(), fallback.Backup(c, volume, w)
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	writer  io.Writer
+	written int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// trackCopy passes the archive size on to a wrapped writer that shows progress
+func (w *countingWriter) trackCopy(r io.Reader, size int64) io.Reader {
+	if tracker, ok := w.writer.(archiveCopyTracker); ok {
+		return tracker.trackCopy(r, size)
+	}
+	return r
+}
+
+// localDriver is Docker's built-in volume driver, which helper containers can always mount
+const localDriver = "local"
+
+// needsTarHelper reports whether a backup of the volume copies its files through the tar
+// helper container rather than from a driver snapshot on the host
+func (c *Client) needsTarHelper(volume models.VolumeInfo) bool {
+	fallback := &tarStrategy{}
+	if c.snapshotStrategy != "" {
+		return c.snapshotStrategy == fallback.Name()
+	}
+	for _, strategy := range snapshotStrategies {
+		if strategy.Name() != fallback.Name() && strategy.Supports(volume) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkDriverSupported fails early for a volume of a plugin driver (rexray, local-persist, CSI
+// and the like) that cannot be mounted into the tar helper container, instead of failing deep
+// inside the backup with the driver's mount error
+func (c *Client) checkDriverSupported(volume models.VolumeInfo) error {
+	if volume.Driver == "" || volume.Driver == localDriver || !c.needsTarHelper(volume) {
+		return nil
+	}
+
+	if c.verbose {
+		fmt.Printf("🔌 Volume '%s' uses plugin driver '%s', checking it can be mounted...\n", volume.Name, volume.Driver)
+	}
+	if err := c.probeVolumeMount(volume.Name); err != nil {
+		return fmt.Errorf("volume '%s' uses driver '%s', which dvom cannot mount into its helper container for a tar backup (only the local driver and btrfs/zfs driver snapshots via --strategy are supported): %w", volume.Name, volume.Driver, err)
+	}
+	return nil
+}
+
+// tarStrategy copies every file of the volume through tar in a helper container
+type tarStrategy struct{}
+
+func (s *tarStrategy) Name() string { return "tar" }
+
+func (s *tarStrategy) Supports(volume models.VolumeInfo) bool { return true }
+
+func (s *tarStrategy) Backup(c *Client, volume models.VolumeInfo, w io.Writer) error {
+	return c.archiveSource(volume.Name, w)
+}
+
+// btrfsStrategy takes a read-only btrfs subvolume snapshot of the volume and archives the snapshot
+type btrfsStrategy struct{}
+
+func (s *btrfsStrategy) Name() string { return "btrfs" }
+
+func (s *btrfsStrategy) Supports(volume models.VolumeInfo) bool {
+	return strings.Contains(strings.ToLower(volume.Driver), "btrfs")
+}
+
+func (s *btrfsStrategy) Backup(c *Client, volume models.VolumeInfo, w io.Writer) error {
+	if volume.Source == "" {
+		return fmt.Errorf("volume '%s' has no mountpoint", volume.Name)
+	}
+
+	snapshotPath := filepath.Join(filepath.Dir(volume.Source), fmt.Sprintf(".dvom-snapshot-%s-%d", volume.Name, time.Now().Unix()))
+	if err := runSnapshotCommand("btrfs", "subvolume", "snapshot", "-r", volume.Source, snapshotPath); err != nil {
+		return err
+	}
+	defer func() {
+		if err := runSnapshotCommand("btrfs", "subvolume", "delete", snapshotPath); err != nil {
+			logger.Warnf("failed to delete btrfs snapshot %s: %v", snapshotPath, err)
+		}
+	}()
+
+	if c.verbose {
+		fmt.Printf("📷 Created btrfs snapshot: %s\n", snapshotPath)
+	}
+
+	return c.archiveSource(snapshotPath, w)
+}
+
+// zfsStrategy takes a ZFS snapshot of the dataset backing the volume and archives the snapshot
+type zfsStrategy struct{}
+
+func (s *zfsStrategy) Name() string { return "zfs" }
+
+func (s *zfsStrategy) Supports(volume models.VolumeInfo) bool {
+	return strings.Contains(strings.ToLower(volume.Driver), "zfs")
+}
+
+func (s *zfsStrategy) Backup(c *Client, volume models.VolumeInfo, w io.Writer) error {
+	if volume.Source == "" {
+		return fmt.Errorf("volume '%s' has no mountpoint", volume.Name)
+	}
+
+	// Resolve the dataset mounted at the volume's mountpoint
+	output, err := exec.Command("zfs", "list", "-H", "-o", "name", volume.Source).Output() // #nosec G204 - fixed command with volume mountpoint argument
+	if err != nil {
+		return fmt.Errorf("failed to resolve zfs dataset for %s: %w", volume.Source, err)
+	}
+	dataset := strings.TrimSpace(string(output))
+	if dataset == "" {
+		return fmt.Errorf("no zfs dataset found for %s", volume.Source)
+	}
+
+	snapshotName := fmt.Sprintf("dvom-%d", time.Now().Unix())
+	fullName := dataset + "@" + snapshotName
+	if err := runSnapshotCommand("zfs", "snapshot", fullName); err != nil {
+		return err
+	}
+	defer func() {
+		if err := runSnapshotCommand("zfs", "destroy", fullName); err != nil {
+			logger.Warnf("failed to destroy zfs snapshot %s: %v", fullName, err)
+		}
+	}()
+
+	if c.verbose {
+		fmt.Printf("📷 Created zfs snapshot: %s\n", fullName)
+	}
+
+	// ZFS exposes snapshots read-only under the hidden .zfs directory of the dataset
+	return c.archiveSource(filepath.Join(volume.Source, ".zfs", "snapshot", snapshotName), w)
+}
+
+// runSnapshotCommand runs a storage driver command on the host
+func runSnapshotCommand(name string, args ...string) error {
+	output, err := exec.Command(name, args...).CombinedOutput() // #nosec G204 - fixed snapshot tool commands
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ypeckstadt/dvom/internal/models"
+	"github.com/ypeckstadt/dvom/internal/storage"
+)
+
+// SetStream makes backups stream the archive straight from the helper container to the storage
+// backend instead of writing it to a local temp file first. The archive cannot be inspected
+// before it is uploaded, so streamed backups record no file count, uncompressed size or content
+// checksum.
+func (c *Client) SetStream(stream bool) {
+	c.stream = stream
+}
+
+// streamDirectVolume archives a volume into a pipe that is uploaded as it is produced
+func (c *Client) streamDirectVolume(volume models.VolumeInfo, snapshotName string, sourceTime time.Time, parentID string) (*storage.Backup, error) {
+	if c.failOnEmpty || c.minSize > 0 || c.skipIfUnchanged {
+		return nil, fmt.Errorf("streamed backups cannot be checked for empty or unchanged volumes before upload")
+	}
+
+	if c.verbose {
+		fmt.Println("💾 Streaming volume backup to storage...")
+	}
+
+	// The metadata shares archiveOptions, so the strategy set by the archiver before it closes
+	// the pipe is included when the metadata is written after the data
+	archiveOptions := c.archiveOptions()
+	reader, writer := io.Pipe()
+	archiveDone := make(chan error, 1)
+	go func() {
+		var err error
+		archiveOptions.Strategy, err = c.archiveVolume(volume, writer)
+		archiveDone <- err
+		if err != nil {
+			writer.CloseWithError(err)
+			return
+		}
+		if err := writer.Close(); err != nil {
+			logger.Warnf("failed to close archive stream: %v", err)
+		}
+	}()
+
+	stored, storeErr := c.storeStream(reader, 0, snapshotName, storage.BackupMetadata{
+		Type:          "direct-volume-backup",
+		CreatedAt:     time.Now(),
+		VolumeName:    volume.Name,
+		VolumeDriver:  volume.Driver,
+		VolumeLabels:  volume.Labels,
+		VolumeOptions: volume.Options,
+		VolumeSize:    volume.Size,
+		MountTypes:    mountTypes([]models.VolumeInfo{volume}),
+		Description:   backupDescription(volume.Name, parentID),
+		SourceTime:    &sourceTime,
+		Options:       &archiveOptions,
+		Parent:        parentID,
+	})
+
+	// Unblock the archiver if the upload stopped reading early
+	if err := reader.CloseWithError(fmt.Errorf("upload stopped")); err != nil {
+		logger.Warnf("failed to close archive stream: %v", err)
+	}
+	if err := <-archiveDone; err != nil {
+		return nil, err
+	}
+	if storeErr != nil {
+		return nil, storeErr
+	}
+	return stored, nil
+}
@@ -0,0 +1,269 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// volumePlaceholder is replaced by the volume name in a sweep name template
+const volumePlaceholder = "{volume}"
+
+// SweepOptions configures a backup of every Docker volume on the host
+type SweepOptions struct {
+	// NameTemplate derives each snapshot name; {volume} is replaced by the volume name and
+	// {date} by the current date (YYYYMMDD)
+	NameTemplate string
+	// Deny skips volumes whose name matches any of these glob patterns
+	Deny []string
+	// Parallel is the number of volumes backed up at the same time
+	Parallel int
+	// KeepGoing backs up the remaining volumes after a volume fails
+	KeepGoing bool
+	// StopContainers are stopped around the whole sweep
+	StopContainers []string
+	// StopUsingContainers also stops every container using one of the volumes, each once
+	// around the whole sweep however many of its volumes are backed up
+	StopUsingContainers bool
+	// OnResult, if set, is called with each volume's result as soon as it is known, and the
+	// sweep's own progress lines and summary are written to stderr instead of stdout
+	OnResult func(SweepResult)
+}
+
+// SweepResult is the outcome of backing up one volume in a sweep
+type SweepResult struct {
+	Volume   string
+	Snapshot string
+	// ID is the stored version, or the existing version when the content was unchanged
+	ID string
+	// Size is the stored size of the backup in bytes
+	Size     int64
+	Duration time.Duration
+	// Unchanged is set when nothing was stored because the volume is unchanged
+	Unchanged bool
+	// Skipped is set for volumes not attempted because an earlier volume failed
+	Skipped bool
+	Err     error
+}
+
+// ValidateSweepOptions checks the name template and deny patterns of a sweep
+func ValidateSweepOptions(opts SweepOptions) error {
+	if !strings.Contains(opts.NameTemplate, volumePlaceholder) {
+		return fmt.Errorf("name template %q must contain %s so every volume gets its own snapshot", opts.NameTemplate, volumePlaceholder)
+	}
+	for _, pattern := range opts.Deny {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid deny pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// sweepSnapshotName derives the snapshot name of a volume from the name template
+func sweepSnapshotName(template, volumeName string, now time.Time) string {
+	name := strings.ReplaceAll(template, volumePlaceholder, volumeName)
+	return strings.ReplaceAll(name, "{date}", now.Format("20060102"))
+}
+
+// deniedVolume reports whether a volume name matches any of the deny patterns
+func deniedVolume(volumeName string, deny []string) bool {
+	for _, pattern := range deny {
+		if matched, _ := path.Match(pattern, volumeName); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// BackupAllVolumes backs up every Docker volume not matching a deny pattern as its own
+// snapshot and prints a coverage summary. The results are returned in volume name order;
+// the error reports how many volumes failed.
+func (c *Client) BackupAllVolumes(opts SweepOptions) ([]SweepResult, error) {
+	if c.storage == nil {
+		return nil, fmt.Errorf("storage backend is required for volume operations")
+	}
+	if err := ValidateSweepOptions(opts); err != nil {
+		return nil, err
+	}
+	if opts.Parallel < 1 {
+		opts.Parallel = 1
+	}
+
+	volumes, err := c.docker.ListVolumes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+
+	now := time.Now()
+	var results []SweepResult
+	denied := 0
+	for _, volume := range volumes {
+		if deniedVolume(volume.Name, opts.Deny) {
+			denied++
+			if c.verbose {
+				fmt.Printf("🚫 Skipping denied volume: %s\n", volume.Name)
+			}
+			continue
+		}
+		results = append(results, SweepResult{
+			Volume:   volume.Name,
+			Snapshot: sweepSnapshotName(opts.NameTemplate, volume.Name, now),
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Volume < results[j].Volume
+	})
+
+	var out io.Writer = os.Stdout
+	if opts.OnResult != nil {
+		out = os.Stderr
+	}
+
+	if len(results) == 0 {
+		fmt.Fprintf(out, "No volumes to back up (%d found, %d denied)\n", len(volumes), denied)
+		return nil, nil
+	}
+
+	// Ask for the password and set up the snapshot layer once, before the backups share them
+	if c.encryptEnabled {
+		if _, err := c.encryptionPassword("Enter encryption password: ", true); err != nil {
+			return nil, err
+		}
+	}
+	c.snapshotStorage()
+
+	// Progress bars of parallel backups would overwrite each other
+	if opts.Parallel > 1 && !c.quiet {
+		c.quiet = true
+		defer func() { c.quiet = false }()
+	}
+
+	stopSet := opts.StopContainers
+	if opts.StopUsingContainers {
+		stopSet, err = c.resolveStopSet(results, opts.StopContainers)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = c.withStoppedContainers(stopSet, func() error {
+		c.backupSweep(results, opts, out)
+		return nil
+	})
+	if err != nil {
+		return results, err
+	}
+
+	failed := printSweepSummary(out, results, len(volumes), denied)
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d volume backup(s) failed", failed, len(results))
+	}
+	return results, nil
+}
+
+// resolveStopSet returns the containers to stop around a sweep: the explicitly named ones
+// followed by every other container using one of the volumes, each listed once however many
+// of the volumes it uses
+func (c *Client) resolveStopSet(results []SweepResult, explicit []string) ([]string, error) {
+	volumes := make([]string, 0, len(results))
+	for _, result := range results {
+		volumes = append(volumes, result.Volume)
+	}
+	found, err := c.containersUsing(volumes, false, explicit)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(found) > 0 && !c.quiet {
+		fmt.Printf("🛑 %d container(s) use the selected volumes and will be stopped once for the whole sweep: %s\n", len(found), strings.Join(found, ", "))
+	}
+	return append(append([]string{}, explicit...), found...), nil
+}
+
+// backupSweep backs up the volumes of a sweep, running up to opts.Parallel backups at a time.
+// Without opts.KeepGoing no further backups are started once one has failed.
+func (c *Client) backupSweep(results []SweepResult, opts SweepOptions, out io.Writer) {
+	semaphore := make(chan struct{}, opts.Parallel)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	stop := false
+
+	for i := range results {
+		semaphore <- struct{}{}
+
+		mu.Lock()
+		if stop {
+			mu.Unlock()
+			<-semaphore
+			results[i].Skipped = true
+			if opts.OnResult != nil {
+				opts.OnResult(results[i])
+			}
+			continue
+		}
+		mu.Unlock()
+
+		wg.Add(1)
+		go func(result *SweepResult) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			if c.verbose {
+				fmt.Printf("💾 Backing up volume %s as %s\n", result.Volume, result.Snapshot)
+			}
+			started := time.Now()
+			stored, unchanged, err := c.backupDirectVolume(result.Volume, result.Snapshot)
+			result.Duration = time.Since(started)
+			result.Err = err
+			result.Unchanged = unchanged
+			if stored != nil {
+				result.ID = stored.ID
+				result.Size = stored.Metadata.Size
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if result.Err != nil {
+				fmt.Fprintf(out, "❌ %s: %v\n", result.Volume, result.Err)
+				if !opts.KeepGoing {
+					stop = true
+				}
+			} else if result.Unchanged {
+				fmt.Fprintf(out, "✅ %s → %s (unchanged)\n", result.Volume, result.Snapshot)
+			} else {
+				fmt.Fprintf(out, "✅ %s → %s\n", result.Volume, result.Snapshot)
+			}
+			if opts.OnResult != nil {
+				opts.OnResult(*result)
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+}
+
+// printSweepSummary prints the coverage of a sweep and returns the number of failed volumes
+func printSweepSummary(out io.Writer, results []SweepResult, found, denied int) int {
+	succeeded, failed, skipped := 0, 0, 0
+	for _, result := range results {
+		switch {
+		case result.Skipped:
+			skipped++
+		case result.Err != nil:
+			failed++
+		default:
+			succeeded++
+		}
+	}
+
+	fmt.Fprintf(out, "\n📊 Backup sweep: %d volume(s) found, %d denied, %d backed up, %d succeeded, %d failed", found, denied, succeeded+failed, succeeded, failed)
+	if skipped > 0 {
+		fmt.Fprintf(out, ", %d not attempted", skipped)
+	}
+	fmt.Fprintln(out)
+	return failed
+}
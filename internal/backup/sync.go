@@ -0,0 +1,114 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ypeckstadt/dvom/internal/storage"
+)
+
+// SyncBackends copies the snapshot versions of the source backend that the destination does
+// not have yet, keeping their versioned IDs and stored metadata. Data is streamed from one
+// backend to the other as stored, so encrypted backups stay encrypted and sealed metadata stays
+// sealed. With dryRun, the versions that would be copied are only listed.
+func (c *Client) SyncBackends(source, destination BackendTarget, dryRun bool) error {
+	sourceBackups, err := source.Backend.List(c.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list %s backend: %w", source.Name, err)
+	}
+	destinationBackups, err := destination.Backend.List(c.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list %s backend: %w", destination.Name, err)
+	}
+
+	present := make(map[string]bool, len(destinationBackups))
+	for _, backup := range destinationBackups {
+		present[backup.ID] = true
+	}
+
+	var missing []storage.BackupMetadata
+	total := 0
+	for _, backup := range sourceBackups {
+		// Only snapshot versions are synced; repository backups depend on their index
+		if _, _, ok := storage.ParseVersionedID(backup.ID); !ok {
+			continue
+		}
+		total++
+		if !present[backup.ID] {
+			missing = append(missing, backup)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		return missing[i].ID < missing[j].ID
+	})
+
+	if !c.quiet {
+		fmt.Printf("🔄 %d of %d snapshot version(s) in %s are missing from %s\n", len(missing), total, source.Name, destination.Name)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	if dryRun {
+		fmt.Printf("\n🎯 Would copy:\n")
+		for _, backup := range missing {
+			fmt.Printf("   %s (%.1f MB)\n", backup.ID, float64(backup.Size)/(1024*1024))
+		}
+		fmt.Println("\n✋ Dry run - no changes made")
+		return nil
+	}
+
+	failed := 0
+	for _, backup := range missing {
+		if err := c.copySnapshotVersion(source, destination, backup); err != nil {
+			failed++
+			logger.Errorf("failed to copy %s: %v", backup.ID, err)
+			continue
+		}
+		if !c.quiet {
+			fmt.Printf("✅ Copied %s (%.1f MB)\n", backup.ID, float64(backup.Size)/(1024*1024))
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d snapshot version(s) failed to copy", failed, len(missing))
+	}
+	return nil
+}
+
+// copySnapshotVersion streams a stored backup from the source backend into the destination
+// under the same ID and with the same metadata
+func (c *Client) copySnapshotVersion(source, destination BackendTarget, listed storage.BackupMetadata) error {
+	backup, err := source.Backend.Retrieve(c.ctx, listed.ID)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve from %s: %w", source.Name, err)
+	}
+	defer func() {
+		if closer, ok := backup.DataReader.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				logger.Warnf("failed to close backup data reader: %v", err)
+			}
+		}
+	}()
+
+	data := c.throttle(backup.DataReader)
+	if !c.quiet && backup.Metadata.Size > 0 {
+		progressReader := NewProgressReader(data, backup.Metadata.Size, fmt.Sprintf("📤 Copying %s", listed.ID))
+		defer func() {
+			if err := progressReader.Close(); err != nil {
+				logger.Warnf("failed to close progress reader: %v", err)
+			}
+		}()
+		data = progressReader
+	}
+
+	if err := destination.Backend.Store(c.ctx, &storage.Backup{
+		ID:         listed.ID,
+		Metadata:   backup.Metadata,
+		DataReader: data,
+	}); err != nil {
+		return fmt.Errorf("failed to store in %s: %w", destination.Name, err)
+	}
+	return nil
+}
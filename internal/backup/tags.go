@@ -0,0 +1,83 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ypeckstadt/dvom/internal/storage"
+)
+
+// SnapshotFilter selects snapshots by a tag. An empty Value matches any value of the tag.
+type SnapshotFilter struct {
+	TagKey   string
+	TagValue string
+}
+
+// ParseSnapshotFilter parses a filter expression of the form tag=<key>[:<value>]
+func ParseSnapshotFilter(expr string) (SnapshotFilter, error) {
+	kind, tag, ok := strings.Cut(expr, "=")
+	if !ok || kind != "tag" {
+		return SnapshotFilter{}, fmt.Errorf("unsupported filter %q (use tag=<key>[:<value>])", expr)
+	}
+	key, value, _ := strings.Cut(tag, ":")
+	if key == "" {
+		return SnapshotFilter{}, fmt.Errorf("filter %q has no tag key", expr)
+	}
+	return SnapshotFilter{TagKey: key, TagValue: value}, nil
+}
+
+// Matches reports whether tags satisfy the filter
+func (f SnapshotFilter) Matches(tags map[string]string) bool {
+	value, ok := tags[f.TagKey]
+	if !ok {
+		return false
+	}
+	return f.TagValue == "" || value == f.TagValue
+}
+
+// SetTags sets the key/value tags recorded with new backups
+func (c *Client) SetTags(tags map[string]string) {
+	c.tags = tags
+}
+
+// SetSnapshotFilters limits snapshot listings to snapshots matching all filters
+func (c *Client) SetSnapshotFilters(filters []SnapshotFilter) {
+	c.snapshotFilters = filters
+}
+
+// SetTimeWindow limits snapshot listings to the versions created at or after since and before
+// until; a zero time leaves that end of the window open
+func (c *Client) SetTimeWindow(since, until time.Time) {
+	c.since = since
+	c.until = until
+}
+
+// hasListFilters reports whether snapshot listings are limited by filters or a time window
+func (c *Client) hasListFilters() bool {
+	return len(c.snapshotFilters) > 0 || !c.since.IsZero() || !c.until.IsZero()
+}
+
+// matchesSnapshotFilters reports whether tags satisfy all snapshot filters
+func (c *Client) matchesSnapshotFilters(tags map[string]string) bool {
+	for _, filter := range c.snapshotFilters {
+		if !filter.Matches(tags) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterSnapshots returns the snapshots whose latest version matches the snapshot filters
+func (c *Client) filterSnapshots(snapshots []storage.SnapshotInfo) []storage.SnapshotInfo {
+	if len(c.snapshotFilters) == 0 {
+		return snapshots
+	}
+	var filtered []storage.SnapshotInfo
+	for _, snapshot := range snapshots {
+		if c.matchesSnapshotFilters(snapshot.Tags) {
+			filtered = append(filtered, snapshot)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,112 @@
+package backup
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ypeckstadt/dvom/internal/models"
+	"github.com/ypeckstadt/dvom/internal/storage"
+)
+
+// defaultVolumeDriver is the driver of volumes created for a restore
+const defaultVolumeDriver = "local"
+
+// SetCreateVolume makes restores create a missing target volume instead of failing. With
+// copyDriver, the volume is created with the driver recorded in the backup rather than local.
+func (c *Client) SetCreateVolume(create, copyDriver bool) {
+	c.createVolume = create
+	c.copyDriver = copyDriver
+}
+
+// lookupTargetVolume returns the info of a restore's target volume and whether it exists. A
+// missing volume is an error unless SetCreateVolume is set, in which case only its name is
+// returned and it is created by createTargetVolume once the restore proceeds.
+func (c *Client) lookupTargetVolume(volumeName string) (*models.VolumeInfo, bool, error) {
+	if err := validateVolumeName(volumeName); err != nil {
+		return nil, false, err
+	}
+	exists, err := c.docker.VolumeExists(volumeName)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to check target volume: %w", err)
+	}
+	if !exists {
+		if !c.createVolume {
+			return nil, false, fmt.Errorf("target volume '%s' not found", volumeName)
+		}
+		return &models.VolumeInfo{Name: volumeName}, false, nil
+	}
+
+	volumeInfo, err := c.docker.GetVolume(volumeName)
+	if err != nil {
+		return nil, false, err
+	}
+	return volumeInfo, true, nil
+}
+
+// targetVolumeSpec returns the driver, labels and driver options a missing target volume is
+// created with, from those recorded in the backup. The recorded labels are always copied;
+// driver options only when the volume gets the driver they were recorded for.
+func (c *Client) targetVolumeSpec(metadata storage.BackupMetadata) models.VolumeInfo {
+	spec := models.VolumeInfo{
+		Driver: defaultVolumeDriver,
+		Labels: metadata.VolumeLabels,
+	}
+
+	recordedDriver := metadata.VolumeDriver
+	if c.copyDriver {
+		if recordedDriver != "" {
+			spec.Driver = recordedDriver
+		} else if !c.quiet {
+			logger.Warnf("the backup does not record its volume driver, creating the volume with the %s driver", defaultVolumeDriver)
+		}
+	}
+
+	if len(metadata.VolumeOptions) > 0 {
+		if recordedDriver == spec.Driver {
+			spec.Options = metadata.VolumeOptions
+		} else if !c.quiet {
+			logger.Warnf("not copying the %s driver options to a %s volume, pass --copy-driver to keep them", recordedDriver, spec.Driver)
+		}
+	}
+	return spec
+}
+
+// createTargetVolume creates a missing restore target volume as described by spec
+func (c *Client) createTargetVolume(volumeName string, spec models.VolumeInfo) (*models.VolumeInfo, error) {
+	if err := c.docker.CreateVolume(volumeName, spec.Driver, spec.Labels, spec.Options); err != nil {
+		return nil, err
+	}
+	if !c.quiet {
+		fmt.Printf("🆕 Created volume '%s' (driver: %s)\n", volumeName, spec.Driver)
+	}
+	if c.verbose {
+		if len(spec.Labels) > 0 {
+			fmt.Printf("   Labels: %s\n", formatKeyValues(spec.Labels))
+		}
+		if len(spec.Options) > 0 {
+			fmt.Printf("   Driver options: %s\n", formatKeyValues(spec.Options))
+		}
+	}
+	return c.docker.GetVolume(volumeName)
+}
+
+// formatKeyValues formats labels or options as a sorted, comma-separated key=value list
+func formatKeyValues(values map[string]string) string {
+	keys := sortedKeys(values)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + values[key]
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// sortedKeys returns the keys of labels or options in sorted order
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,168 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/ypeckstadt/dvom/internal/docker"
+)
+
+// testRestoreLabel marks the throwaway volumes created by TestRestore
+const testRestoreLabel = "dvom.test-restore"
+
+// TestRestoreOptions configures a test restore
+type TestRestoreOptions struct {
+	// ValidateCmd is a shell command run with the restored volume mounted at /data; a non-zero
+	// exit fails the test. Empty skips validation.
+	ValidateCmd string
+	// ValidateImage is the image the validation command runs in
+	ValidateImage string
+	// ValidateTimeout stops the validation command after this long (0 waits indefinitely)
+	ValidateTimeout time.Duration
+	// KeepVolume leaves the restored volume in place for inspection
+	KeepVolume bool
+}
+
+// TestRestore restores a snapshot into a temporary volume, optionally validates the restored
+// data with a command, and removes the volume again. Nothing but the temporary volume is
+// touched, so it is safe to run against production snapshots.
+func (c *Client) TestRestore(snapshotName string, opts TestRestoreOptions) error {
+	if c.storage == nil {
+		return fmt.Errorf("storage backend is required for volume operations")
+	}
+
+	volumeName := fmt.Sprintf("dvom-test-restore-%d", time.Now().UnixNano())
+	if err := c.docker.CreateVolume(volumeName, "", map[string]string{testRestoreLabel: snapshotName}, nil); err != nil {
+		return err
+	}
+	if c.verbose {
+		fmt.Printf("🧪 Created temporary volume %s\n", volumeName)
+	}
+
+	if opts.KeepVolume {
+		defer fmt.Printf("📦 Restored data kept in volume %s (remove it with: docker volume rm %s)\n", volumeName, volumeName)
+	} else {
+		defer func() {
+			if err := c.docker.RemoveVolume(volumeName); err != nil {
+				logger.Warnf("failed to remove temporary volume: %v", err)
+			} else if c.verbose {
+				fmt.Printf("🗑️  Removed temporary volume %s\n", volumeName)
+			}
+		}()
+	}
+
+	if err := c.RestoreDirectVolume(volumeName, snapshotName, false, true); err != nil {
+		return fmt.Errorf("test restore of %s failed: %w", snapshotName, err)
+	}
+	if !c.quiet {
+		fmt.Printf("✅ Restored %s into %s\n", snapshotName, volumeName)
+	}
+
+	if opts.ValidateCmd == "" {
+		return nil
+	}
+	if err := c.runValidation(volumeName, opts); err != nil {
+		return integrityError(fmt.Errorf("validation of %s failed: %w", snapshotName, err))
+	}
+	if !c.quiet {
+		fmt.Println("✅ Validation passed")
+	}
+	return nil
+}
+
+// runValidation runs the validation command of a test restore with the volume mounted at /data
+func (c *Client) runValidation(volumeName string, opts TestRestoreOptions) error {
+	dockerClient := c.docker.GetDockerClient()
+
+	image := opts.ValidateImage
+	if image == "" {
+		image = "alpine:latest"
+	}
+	cmd := []string{"sh", "-c", opts.ValidateCmd}
+
+	if c.verbose {
+		fmt.Printf("🔍 Running validation in %s: %s\n", image, opts.ValidateCmd)
+	}
+
+	resp, err := dockerClient.ContainerCreate(
+		c.ctx,
+		&container.Config{
+			Image:      image,
+			Cmd:        cmd,
+			WorkingDir: "/data",
+			Labels:     docker.HelperLabels(c.runID, "validation"),
+		},
+		&container.HostConfig{
+			Mounts: []mount.Mount{helperMount(volumeName, "/data", false)},
+		},
+		nil,
+		nil,
+		"",
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create validation container: %w", err)
+	}
+	defer func() {
+		if err := dockerClient.ContainerRemove(context.WithoutCancel(c.ctx), resp.ID, container.RemoveOptions{Force: true}); err != nil {
+			logger.Warnf("failed to remove container %s: %v", resp.ID, err)
+		}
+	}()
+
+	if err := dockerClient.ContainerStart(c.ctx, resp.ID, container.StartOptions{}); err != nil {
+		return fmt.Errorf("failed to start validation container: %w", err)
+	}
+
+	ctx := c.ctx
+	if opts.ValidateTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.ValidateTimeout)
+		defer cancel()
+	}
+
+	statusCh, errCh := dockerClient.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		if ctx.Err() != nil {
+			return fmt.Errorf("validation command did not finish within %s", opts.ValidateTimeout)
+		}
+		if err != nil {
+			return fmt.Errorf("validation container error: %w", err)
+		}
+	case status := <-statusCh:
+		if c.verbose {
+			c.printValidationOutput(resp.ID)
+		}
+		if status.StatusCode != 0 {
+			return c.helperFailure(resp.ID, "validation", cmd, status.StatusCode)
+		}
+	}
+	return nil
+}
+
+// printValidationOutput prints the stdout of the validation container
+func (c *Client) printValidationOutput(containerID string) {
+	logs, err := c.docker.GetDockerClient().ContainerLogs(c.ctx, containerID, container.LogsOptions{ShowStdout: true})
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err := logs.Close(); err != nil {
+			logger.Warnf("failed to close logs: %v", err)
+		}
+	}()
+
+	var stdout bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, io.Discard, logs); err != nil {
+		return
+	}
+	if output := strings.TrimSpace(stdout.String()); output != "" {
+		fmt.Printf("Validation output:\n%s\n", output)
+	}
+}
@@ -0,0 +1,148 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// VolumeUser is a container using a volume
+type VolumeUser struct {
+	Name   string `json:"name"`
+	ID     string `json:"id"`
+	Image  string `json:"image"`
+	State  string `json:"state"`
+	Status string `json:"status"`
+}
+
+// SetAutoStopUsers stops the running containers using the volumes of a backup during the
+// backup, in addition to any containers named to stop
+func (c *Client) SetAutoStopUsers(autoStop bool) {
+	c.autoStopUsers = autoStop
+}
+
+// VolumeUsers returns the containers, running or not, that use a volume. dvom's own helper
+// containers are not included.
+func (c *Client) VolumeUsers(volumeName string) ([]VolumeUser, error) {
+	exists, err := c.docker.VolumeExists(volumeName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check volume: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("volume '%s' not found", volumeName)
+	}
+
+	containers, err := c.docker.GetContainersUsingVolume(volumeName)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]VolumeUser, 0, len(containers))
+	for _, container := range containers {
+		users = append(users, VolumeUser{
+			Name:   containerName(container),
+			ID:     container.ID,
+			Image:  container.Image,
+			State:  container.State,
+			Status: container.Status,
+		})
+	}
+	return users, nil
+}
+
+// ListVolumeUsers prints the containers using a volume
+func (c *Client) ListVolumeUsers(volumeName string) error {
+	users, err := c.VolumeUsers(volumeName)
+	if err != nil {
+		return err
+	}
+
+	if len(users) == 0 {
+		fmt.Printf("No containers use volume '%s'\n", volumeName)
+		return nil
+	}
+
+	fmt.Printf("Containers using volume '%s':\n\n", volumeName)
+	fmt.Printf("%-30s %-14s %-10s %s\n", "CONTAINER", "ID", "STATE", "IMAGE")
+	fmt.Printf("%-30s %-14s %-10s %s\n",
+		"------------------------------",
+		"--------------",
+		"----------",
+		"--------------------")
+	running := 0
+	for _, user := range users {
+		fmt.Printf("%-30s %-14s %-10s %s\n", user.Name, shortID(user.ID), user.State, user.Image)
+		if user.State == "running" {
+			running++
+		}
+	}
+
+	if running > 0 {
+		fmt.Printf("\n💡 %d running container(s) write to the volume; stop them during a backup with --stop-containers or --auto-stop-users for a consistent copy\n", running)
+	}
+	return nil
+}
+
+// containersUsing returns the names of the containers using any of the volumes, each listed
+// once, leaving out the ones in skip (by name or ID). Host paths are not looked up.
+func (c *Client) containersUsing(volumes []string, runningOnly bool, skip []string) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, name := range skip {
+		seen[name] = true
+	}
+
+	var found []string
+	for _, volume := range volumes {
+		if isBindSource(volume) {
+			continue
+		}
+		containers, err := c.docker.GetContainersUsingVolume(volume)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find containers using volume %s: %w", volume, err)
+		}
+		for _, container := range containers {
+			name := containerName(container)
+			if seen[name] || seen[container.ID] || (runningOnly && container.State != "running") {
+				continue
+			}
+			seen[name] = true
+			seen[container.ID] = true
+			found = append(found, name)
+		}
+	}
+	return found, nil
+}
+
+// backupStopSet returns the containers to stop around a backup of volumes: the explicitly
+// named ones, followed with --auto-stop-users by the running containers using the volumes.
+// Without either, running containers using the volumes are only warned about.
+func (c *Client) backupStopSet(volumes []string, explicit []string) ([]string, error) {
+	if !c.autoStopUsers && len(explicit) > 0 {
+		return explicit, nil
+	}
+
+	running, err := c.containersUsing(volumes, true, explicit)
+	if err != nil {
+		return nil, err
+	}
+	if len(running) == 0 {
+		return explicit, nil
+	}
+
+	if !c.autoStopUsers {
+		logger.Warnf("running container(s) %s use the volume(s) being backed up and may change files while they are read; stop them with --stop-containers or --auto-stop-users for a consistent backup", strings.Join(running, ", "))
+		return explicit, nil
+	}
+	if !c.quiet {
+		fmt.Printf("🛑 %d running container(s) use the volume(s) and will be stopped during the backup: %s\n", len(running), strings.Join(running, ", "))
+	}
+	return append(append([]string{}, explicit...), running...), nil
+}
+
+// containerName returns the name of a listed container, or its short ID if it has none
+func containerName(container types.Container) string {
+	if len(container.Names) > 0 {
+		return strings.TrimPrefix(container.Names[0], "/")
+	}
+	return shortID(container.ID)
+}
@@ -1 +1,17 @@
 package backup
+
+import (
+	"fmt"
+
+	"github.com/ypeckstadt/dvom/internal/docker"
+)
+
+// validateVolumeName rejects a volume name Docker would not accept. Names are passed to helper
+// containers as mount sources, never through a shell, but are also used in host snapshot paths
+// and backup names, so anything else, such as spaces, ';' or '$(', is refused up front.
+func validateVolumeName(name string) error {
+	if !docker.ValidVolumeName(name) {
+		return fmt.Errorf("invalid volume name '%s': only letters, digits, '_', '.' and '-' are allowed, starting with a letter or digit", name)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package backup
+
+import "testing"
+
+func TestValidateVolumeName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"pgdata", true},
+		{"app_db-1.v2", true},
+		{"0123abcdef", true},
+		{"my volume", false},
+		{"data;rm -rf /", false},
+		{"$(reboot)", false},
+		{"`id`", false},
+		{"a&&b", false},
+		{"a|b", false},
+		{"vol\nname", false},
+		{"../etc", false},
+		{"a/b", false},
+		{"a:b", false},
+		{"-rf", false},
+		{".hidden", false},
+		{"a", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		err := validateVolumeName(tt.name)
+		if tt.valid && err != nil {
+			t.Errorf("validateVolumeName(%q) = %v, want nil", tt.name, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("validateVolumeName(%q) = nil, want an error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package backup
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ypeckstadt/dvom/internal/crypto"
+	"github.com/ypeckstadt/dvom/internal/storage"
+)
+
+// SetVerifyAfterBackup makes backups read back the start of the stored data and check that it
+// can be decrypted (or, if not encrypted, decompressed) before the backup is reported successful
+func (c *Client) SetVerifyAfterBackup(verify bool) {
+	c.verifyAfterBackup = verify
+}
+
+// SetVerifyChecksum makes backups read back all of the stored data and compare its size and
+// SHA-256 checksum with what was uploaded before the backup is reported successful. With
+// deleteOnFailure, a stored version failing the check is deleted.
+func (c *Client) SetVerifyChecksum(verify, deleteOnFailure bool) {
+	c.verifyChecksum = verify
+	c.deleteUnverified = deleteOnFailure
+}
+
+// verifyStoredChecksum reads back all of a stored backup's data and checks its size and
+// checksum match the values recorded while uploading it
+func (c *Client) verifyStoredChecksum(stored *storage.Backup) error {
+	metadataBackend, ok := c.storage.(storage.MetadataBackend)
+	if !ok {
+		return fmt.Errorf("storage backend does not support reading back stored data")
+	}
+	if stored.Metadata.Checksum == "" {
+		return fmt.Errorf("no checksum was recorded for the upload")
+	}
+
+	data, err := metadataBackend.OpenData(c.ctx, stored.ID)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := data.Close(); err != nil {
+			logger.Warnf("failed to close backup data: %v", err)
+		}
+	}()
+
+	reader := c.throttle(data)
+	if !c.quiet && stored.Metadata.Size > 0 {
+		progressReader := NewProgressReader(reader, stored.Metadata.Size, "🔍 Verifying backup")
+		defer func() {
+			if err := progressReader.Close(); err != nil {
+				logger.Warnf("failed to close progress reader: %v", err)
+			}
+		}()
+		reader = progressReader
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, reader)
+	if err != nil {
+		return fmt.Errorf("failed to read back stored data: %w", err)
+	}
+	if size != stored.Metadata.Size {
+		return fmt.Errorf("stored data is %d bytes, %d were uploaded", size, stored.Metadata.Size)
+	}
+	if checksum := hex.EncodeToString(hash.Sum(nil)); checksum != stored.Metadata.Checksum {
+		return fmt.Errorf("stored data checksum sha256:%s does not match uploaded sha256:%s", checksum, stored.Metadata.Checksum)
+	}
+
+	if c.verbose {
+		fmt.Printf("✅ Stored backup matches the upload (%d bytes, sha256:%s)\n", size, stored.Metadata.Checksum)
+	}
+	return nil
+}
+
+// failVerification reports a stored backup that failed verification, deleting it if requested,
+// and returns the error failing the backup
+func (c *Client) failVerification(stored *storage.Backup, problem string, err error) error {
+	logger.Errorf("VERIFICATION FAILED: backup %s %s: %v", stored.ID, problem, err)
+	if c.deleteUnverified {
+		if deleteErr := c.snapshotStorage().DeleteSnapshot(c.ctx, stored.ID); deleteErr != nil {
+			logger.Errorf("failed to delete the bad backup %s: %v", stored.ID, deleteErr)
+		} else {
+			logger.Warnf("the bad backup %s was deleted", stored.ID)
+		}
+	}
+	logger.Warnf("do not rely on backup %s; run the backup again", stored.ID)
+	return integrityError(fmt.Errorf("backup %s failed verification: %w", stored.ID, err))
+}
+
+// verifyStoredBackup reads the start of a stored backup's data and checks it decrypts with the
+// backup password, or decompresses for unencrypted backups. Only the first chunk is read.
+func (c *Client) verifyStoredBackup(stored *storage.Backup) error {
+	metadataBackend, ok := c.storage.(storage.MetadataBackend)
+	if !ok {
+		return fmt.Errorf("storage backend does not support reading back stored data")
+	}
+
+	if c.verbose {
+		fmt.Printf("🔍 Verifying stored backup: %s\n", stored.ID)
+	}
+
+	data, err := metadataBackend.OpenData(c.ctx, stored.ID)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := data.Close(); err != nil {
+			logger.Warnf("failed to close backup data: %v", err)
+		}
+	}()
+
+	if stored.Metadata.Encrypted {
+		if err := crypto.VerifyFirstChunk(data, c.password); err != nil {
+			return err
+		}
+	} else if len(snapshotVolumes(stored.Metadata)) > 1 {
+		// Multi-volume snapshots are an uncompressed tar of compressed volume archives
+		if _, err := tar.NewReader(data).Next(); err != nil {
+			return fmt.Errorf("stored data is not a valid multi-volume archive: %w", err)
+		}
+	} else {
+		compression := stored.Metadata.ArchiveOptions().Compression
+		decompressed, err := newDecompressor(data, compression)
+		if err != nil {
+			return fmt.Errorf("stored data is not a valid %s archive: %w", compression, err)
+		}
+		defer func() {
+			if err := decompressed.Close(); err != nil {
+				logger.Warnf("failed to close decompressor: %v", err)
+			}
+		}()
+		if _, err := decompressed.Read(make([]byte, 1)); err != nil && err != io.EOF {
+			return fmt.Errorf("stored data cannot be decompressed: %w", err)
+		}
+	}
+
+	if c.verbose {
+		fmt.Println("✅ Stored backup verified")
+	}
+	return nil
+}
+
+// BackendTarget is a named storage backend used by multi-backend operations
+type BackendTarget struct {
+	Name    string
+	Backend storage.Backend
+}
+
+// VerifyBackends checks that every snapshot exists in all the given backends and
+// that the recorded sizes and checksums of the copies agree
+func (c *Client) VerifyBackends(targets []BackendTarget) error {
+	if len(targets) < 2 {
+		return fmt.Errorf("at least two storage backends are required for verification")
+	}
+
+	if c.verbose {
+		names := make([]string, len(targets))
+		for i, target := range targets {
+			names[i] = target.Name
+		}
+		fmt.Printf("🔍 Verifying snapshots across backends: %s\n", strings.Join(names, ", "))
+	}
+
+	// List all backends in parallel
+	listings := make([]map[string]storage.BackupMetadata, len(targets))
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target BackendTarget) {
+			defer wg.Done()
+
+			backups, err := target.Backend.List(c.ctx)
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to list %s backend: %w", target.Name, err)
+				return
+			}
+
+			listing := make(map[string]storage.BackupMetadata, len(backups))
+			for _, backup := range backups {
+				listing[backup.ID] = backup
+			}
+			listings[i] = listing
+		}(i, target)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	// Collect every snapshot known to any backend
+	idSet := make(map[string]bool)
+	for _, listing := range listings {
+		for id := range listing {
+			idSet[id] = true
+		}
+	}
+	ids := make([]string, 0, len(idSet))
+	for id := range idSet {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	if len(ids) == 0 {
+		fmt.Println("No snapshots found")
+		return nil
+	}
+
+	problems := 0
+	if !c.quiet {
+		fmt.Printf("%-40s %-10s %s\n", "SNAPSHOT", "STATUS", "DETAILS")
+		fmt.Printf("%-40s %-10s %s\n", strings.Repeat("-", 40), strings.Repeat("-", 10), strings.Repeat("-", 30))
+	}
+
+	for _, id := range ids {
+		status, details := compareCopies(id, targets, listings)
+		if status != "ok" {
+			problems++
+		}
+
+		if !c.quiet || status != "ok" {
+			fmt.Printf("%-40s %-10s %s\n", id, status, details)
+		}
+	}
+
+	if problems > 0 {
+		return integrityError(fmt.Errorf("verification failed: %d of %d snapshot(s) missing or divergent", problems, len(ids)))
+	}
+
+	if !c.quiet {
+		fmt.Printf("\n✅ All %d snapshot(s) are present and consistent in %d backends\n", len(ids), len(targets))
+	}
+
+	return nil
+}
+
+// compareCopies compares the copies of a snapshot across backends and returns its status and details
+func compareCopies(id string, targets []BackendTarget, listings []map[string]storage.BackupMetadata) (string, string) {
+	var missing []string
+	var reference *storage.BackupMetadata
+	var referenceName string
+	var divergent []string
+
+	for i, target := range targets {
+		metadata, ok := listings[i][id]
+		if !ok {
+			missing = append(missing, target.Name)
+			continue
+		}
+
+		if reference == nil {
+			reference = &metadata
+			referenceName = target.Name
+			continue
+		}
+
+		if metadata.Size != reference.Size {
+			divergent = append(divergent, fmt.Sprintf("size %s=%d %s=%d", referenceName, reference.Size, target.Name, metadata.Size))
+		}
+		if metadata.Checksum != "" && reference.Checksum != "" && metadata.Checksum != reference.Checksum {
+			divergent = append(divergent, fmt.Sprintf("checksum %s differs from %s", target.Name, referenceName))
+		}
+	}
+
+	if len(missing) > 0 {
+		return "missing", "not in " + strings.Join(missing, ", ")
+	}
+	if len(divergent) > 0 {
+		return "divergent", strings.Join(divergent, "; ")
+	}
+	if reference.Checksum == "" {
+		return "ok", "sizes match (no checksum recorded)"
+	}
+	return "ok", "sizes and checksums match"
+}
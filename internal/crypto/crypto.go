@@ -1,13 +1,19 @@
 package crypto
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
 	"golang.org/x/crypto/pbkdf2"
 )
 
@@ -20,12 +26,108 @@ const (
 	NonceSize = 12
 	// Iterations for PBKDF2
 	Iterations = 100000
+	// DefaultChunkSize is the size of the plaintext chunks sealed separately (version 1 headers)
+	DefaultChunkSize = 64 * 1024
+	// MinChunkSize and MaxChunkSize bound configurable chunk sizes
+	MinChunkSize = 4 * 1024
+	MaxChunkSize = 64 * 1024 * 1024
 )
 
+// ErrDecryption is wrapped by the errors of data that does not decrypt, which means a wrong
+// password or keyfile, or data that was modified
+var ErrDecryption = errors.New("decryption failed")
+
+// ErrIncorrectPassword is returned when the verifier block of a header does not open with the
+// password or keyfile, before any data is read
+var ErrIncorrectPassword = fmt.Errorf("%w: incorrect password or keyfile", ErrDecryption)
+
+// verifierMagic is the plaintext sealed in the verifier block of version 5 headers
+var verifierMagic = []byte("DVOM-KEY")
+
+// verifierOverhead is the size of the GCM tag sealed with the verifier
+const verifierOverhead = 16
+
+// verifierAAD is the associated data of the verifier block, distinguishing it from data chunks
+var verifierAAD = []byte("dvom verifier")
+
+// Cipher and KDF identify the encryption scheme used for backups. KDF is the default key
+// derivation; KDFArgon2id can be selected instead.
+const (
+	Cipher      = "aes-256-gcm"
+	KDF         = "pbkdf2-sha256"
+	KDFArgon2id = "argon2id"
+	// KDFKeyfile derives the key from keyfile contents instead of a password
+	KDFKeyfile = "keyfile-hkdf-sha256"
+)
+
+// KDF identifiers written into version 3 and 4 encryption headers
+const (
+	kdfIDPBKDF2   byte = 1
+	kdfIDArgon2id byte = 2
+	kdfIDKeyfile  byte = 3
+)
+
+// MinKeyfileSize is the minimum amount of key material a keyfile must hold
+const MinKeyfileSize = KeySize
+
+// Argon2Params are the Argon2id cost parameters recorded in the encryption header
+type Argon2Params struct {
+	// Memory is the memory cost in KiB
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+}
+
+// DefaultArgon2Params are the parameters used for new Argon2id headers (RFC 9106, 64 MiB)
+var DefaultArgon2Params = Argon2Params{Memory: 64 * 1024, Time: 3, Threads: 4}
+
+// maxArgon2Memory bounds the memory cost accepted from a header (4 GiB), so a corrupt or
+// hostile header cannot make decryption allocate without limit
+const maxArgon2Memory = 4 * 1024 * 1024
+
 // EncryptionHeader contains encryption metadata
 type EncryptionHeader struct {
 	Salt  []byte
 	Nonce []byte
+	// ChunkSize is the plaintext size of each sealed chunk
+	ChunkSize int
+	// KDF is the key derivation function; empty means KDF (PBKDF2)
+	KDF string
+	// Argon2 holds the cost parameters when KDF is KDFArgon2id
+	Argon2 Argon2Params
+	// Framed is set for version 4 headers, whose chunks are authenticated together with their
+	// index and end with a final chunk, so reordered or truncated data fails to decrypt
+	Framed bool
+	// Verifier is the sealed known value of version 5 headers, which tells a wrong password
+	// apart before any data is read
+	Verifier []byte
+}
+
+// ValidateKDF checks that a password key derivation function name is supported
+func ValidateKDF(kdf string) error {
+	if kdf != KDF && kdf != KDFArgon2id {
+		return fmt.Errorf("unsupported key derivation %q (use %s or %s)", kdf, KDF, KDFArgon2id)
+	}
+	return nil
+}
+
+// validateArgon2Params checks Argon2id parameters read from a header
+func validateArgon2Params(params Argon2Params) error {
+	if params.Time == 0 || params.Threads == 0 || params.Memory < 8*uint32(params.Threads) {
+		return fmt.Errorf("invalid argon2id parameters (memory %d KiB, time %d, threads %d)", params.Memory, params.Time, params.Threads)
+	}
+	if params.Memory > maxArgon2Memory {
+		return fmt.Errorf("argon2id memory cost of %d KiB exceeds the maximum of %d KiB", params.Memory, maxArgon2Memory)
+	}
+	return nil
+}
+
+// ValidateChunkSize checks that a chunk size is within the supported range
+func ValidateChunkSize(size int) error {
+	if size < MinChunkSize || size > MaxChunkSize {
+		return fmt.Errorf("chunk size must be between %d and %d bytes, got %d", MinChunkSize, MaxChunkSize, size)
+	}
+	return nil
 }
 
 // DeriveKey derives an encryption key from a password using PBKDF2
@@ -33,6 +135,42 @@ func DeriveKey(password string, salt []byte) []byte {
 	return pbkdf2.Key([]byte(password), salt, Iterations, KeySize, sha256.New)
 }
 
+// ReadKeyfile reads the key material of a keyfile. Keyfiles are used as they are, so they must
+// hold at least MinKeyfileSize bytes of random data (e.g. from openssl rand 64 > dvom.key).
+func ReadKeyfile(path string) ([]byte, error) {
+	material, err := os.ReadFile(path) // #nosec G304 - user provided keyfile path
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyfile: %w", err)
+	}
+	if len(material) < MinKeyfileSize {
+		return nil, fmt.Errorf("keyfile %s holds %d bytes, at least %d are required", path, len(material), MinKeyfileSize)
+	}
+	return material, nil
+}
+
+// deriveHeaderKey derives the encryption key with the key derivation recorded in the header
+func deriveHeaderKey(password string, header *EncryptionHeader) ([]byte, error) {
+	switch header.KDF {
+	case "", KDF:
+		return DeriveKey(password, header.Salt), nil
+	case KDFArgon2id:
+		params := header.Argon2
+		if err := validateArgon2Params(params); err != nil {
+			return nil, err
+		}
+		return argon2.IDKey([]byte(password), header.Salt, params.Time, params.Memory, params.Threads, KeySize), nil
+	case KDFKeyfile:
+		// Keyfile material is already high-entropy, so HKDF only binds it to the salt
+		key := make([]byte, KeySize)
+		if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(password), header.Salt, []byte("dvom backup key")), key); err != nil {
+			return nil, fmt.Errorf("failed to derive key from keyfile: %w", err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported key derivation %q", header.KDF)
+	}
+}
+
 // GenerateSalt generates a random salt
 func GenerateSalt() ([]byte, error) {
 	salt := make([]byte, SaltSize)
@@ -51,6 +189,37 @@ func GenerateNonce() ([]byte, error) {
 	return nonce, nil
 }
 
+// chunkNonce derives the nonce of a chunk by XORing its index into the last 8 bytes of the
+// random per-backup base nonce, so no nonce repeats within a backup
+func chunkNonce(baseNonce []byte, index uint64) []byte {
+	nonce := make([]byte, len(baseNonce))
+	copy(nonce, baseNonce)
+	for i := 0; i < 8 && i < len(nonce); i++ {
+		nonce[len(nonce)-1-i] ^= byte(index >> (8 * i))
+	}
+	return nonce
+}
+
+// verifierNonce derives the nonce of the verifier block by flipping the top bit of the base
+// nonce's first byte, which chunk nonces never change
+func verifierNonce(baseNonce []byte) []byte {
+	nonce := make([]byte, len(baseNonce))
+	copy(nonce, baseNonce)
+	nonce[0] ^= 0x80
+	return nonce
+}
+
+// chunkAAD returns the associated data authenticated with a chunk of a framed stream: its
+// big-endian index followed by 1 for the final chunk and 0 otherwise
+func chunkAAD(index uint64, final bool) []byte {
+	aad := make([]byte, 9)
+	binary.BigEndian.PutUint64(aad, index)
+	if final {
+		aad[8] = 1
+	}
+	return aad
+}
+
 // EncryptReader wraps a reader with AES-256-GCM encryption
 type EncryptReader struct {
 	reader    io.Reader
@@ -62,15 +231,50 @@ type EncryptReader struct {
 	eof       bool
 }
 
-// NewEncryptReader creates a new encrypting reader
+// NewEncryptReader creates a new encrypting reader using the default chunk size
 func NewEncryptReader(r io.Reader, password string) (*EncryptReader, *EncryptionHeader, error) {
+	return NewEncryptReaderWithChunkSize(r, password, DefaultChunkSize)
+}
+
+// NewEncryptReaderWithChunkSize creates a new encrypting reader sealing chunkSize bytes of
+// plaintext per chunk. The chunk size is recorded in the returned header.
+func NewEncryptReaderWithChunkSize(r io.Reader, password string, chunkSize int) (*EncryptReader, *EncryptionHeader, error) {
+	return NewEncryptReaderWithKDF(r, password, chunkSize, KDF)
+}
+
+// NewEncryptReaderWithKDF creates a new encrypting reader deriving its key with the given key
+// derivation function. With KDFKeyfile, password holds the keyfile contents. The chunk size
+// and key derivation are recorded in the returned header.
+func NewEncryptReaderWithKDF(r io.Reader, password string, chunkSize int, kdf string) (*EncryptReader, *EncryptionHeader, error) {
+	if err := ValidateChunkSize(chunkSize); err != nil {
+		return nil, nil, err
+	}
+	if kdf != KDFKeyfile {
+		if err := ValidateKDF(kdf); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	// Generate salt and derive key
 	salt, err := GenerateSalt()
 	if err != nil {
 		return nil, nil, err
 	}
-	
-	key := DeriveKey(password, salt)
+
+	header := &EncryptionHeader{
+		Salt:      salt,
+		ChunkSize: chunkSize,
+		KDF:       kdf,
+		Framed:    true,
+	}
+	if kdf == KDFArgon2id {
+		header.Argon2 = DefaultArgon2Params
+	}
+
+	key, err := deriveHeaderKey(password, header)
+	if err != nil {
+		return nil, nil, err
+	}
 	
 	// Create AES cipher
 	block, err := aes.NewCipher(key)
@@ -90,70 +294,89 @@ func NewEncryptReader(r io.Reader, password string) (*EncryptReader, *Encryption
 		return nil, nil, err
 	}
 	
-	header := &EncryptionHeader{
-		Salt:  salt,
-		Nonce: nonce,
-	}
+	header.Nonce = nonce
+	header.Verifier = gcm.Seal(nil, verifierNonce(nonce), verifierMagic, verifierAAD)
 	
 	return &EncryptReader{
 		reader:    r,
 		cipher:    gcm,
 		baseNonce: nonce,
 		counter:   0,
-		buffer:    make([]byte, 64*1024), // 64KB chunks
+		buffer:    make([]byte, chunkSize),
 	}, header, nil
 }
 
-// Read implements io.Reader with encryption
-func (er *EncryptReader) Read(p []byte) (int, error) {
-	if er.eof && len(er.encrypted) == 0 {
-		return 0, io.EOF
+// ResumeEncryptReader creates an encrypting reader with the key, nonce and chunk size of an
+// existing header, so the same plaintext encrypts to exactly the same stream again, e.g. to
+// resume an interrupted upload. The password must open the header's verifier.
+func ResumeEncryptReader(r io.Reader, password string, header *EncryptionHeader) (*EncryptReader, error) {
+	if !header.Framed || len(header.Verifier) == 0 {
+		return nil, fmt.Errorf("encryption header predates resumable encryption")
 	}
-	
-	// If we have encrypted data, return it
-	if len(er.encrypted) > 0 {
-		n := copy(p, er.encrypted)
-		er.encrypted = er.encrypted[n:]
-		return n, nil
+	if err := ValidateChunkSize(header.ChunkSize); err != nil {
+		return nil, err
 	}
-	
-	// Read more data
-	n, err := er.reader.Read(er.buffer)
-	if err != nil && err != io.EOF {
-		return 0, err
+
+	key, err := deriveHeaderKey(password, header)
+	if err != nil {
+		return nil, err
 	}
-	
-	if n > 0 {
-		// Create unique nonce for this chunk
-		chunkNonce := make([]byte, len(er.baseNonce))
-		copy(chunkNonce, er.baseNonce)
-		
-		// Combine base nonce with counter to ensure uniqueness
-		for i := 0; i < 8 && i < len(chunkNonce); i++ {
-			chunkNonce[len(chunkNonce)-1-i] ^= byte(er.counter >> (8 * i))
-		}
-		
-		// Encrypt the chunk
-		er.encrypted = er.cipher.Seal(nil, chunkNonce, er.buffer[:n], nil)
-		er.counter++
-		
-		// Copy to output
-		copied := copy(p, er.encrypted)
-		er.encrypted = er.encrypted[copied:]
-		return copied, nil
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
 	}
-	
-	if err == io.EOF {
-		er.eof = true
-		if len(er.encrypted) > 0 {
-			n := copy(p, er.encrypted)
-			er.encrypted = er.encrypted[n:]
-			return n, nil
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	if _, err := gcm.Open(nil, verifierNonce(header.Nonce), header.Verifier, verifierAAD); err != nil {
+		return nil, ErrIncorrectPassword
+	}
+
+	baseNonce := make([]byte, len(header.Nonce))
+	copy(baseNonce, header.Nonce)
+	return &EncryptReader{
+		reader:    r,
+		cipher:    gcm,
+		baseNonce: baseNonce,
+		buffer:    make([]byte, header.ChunkSize),
+	}, nil
+}
+
+// chunkOverhead is the size of the GCM tag sealed with every chunk
+const chunkOverhead = 16
+
+// EncryptedSize returns the exact number of bytes an EncryptReader produces for size bytes of
+// plaintext sealed in chunks of chunkSize, not counting the header. Every full chunk and the
+// final, possibly empty, partial chunk carry a GCM tag.
+func EncryptedSize(size int64, chunkSize int) int64 {
+	chunks := size/int64(chunkSize) + 1
+	return size + chunks*chunkOverhead
+}
+
+// Read implements io.Reader with encryption. Every chunk but the last is full, and the last
+// chunk is sealed as final; it is empty when the data fills the previous chunk exactly.
+func (er *EncryptReader) Read(p []byte) (int, error) {
+	if len(er.encrypted) == 0 {
+		if er.eof {
+			return 0, io.EOF
+		}
+
+		// Read a full chunk; the decryptor relies on every chunk but the last being full
+		n, err := io.ReadFull(er.reader, er.buffer)
+		final := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !final {
+			return 0, err
 		}
-		return 0, io.EOF
+
+		er.encrypted = er.cipher.Seal(nil, chunkNonce(er.baseNonce, er.counter), er.buffer[:n], chunkAAD(er.counter, final))
+		er.counter++
+		er.eof = final
 	}
-	
-	return 0, nil
+
+	n := copy(p, er.encrypted)
+	er.encrypted = er.encrypted[n:]
+	return n, nil
 }
 
 // DecryptReader wraps a reader with AES-256-GCM decryption
@@ -165,12 +388,16 @@ type DecryptReader struct {
 	buffer    []byte
 	decrypted []byte
 	eof       bool
+	framed    bool
 }
 
 // NewDecryptReader creates a new decrypting reader
 func NewDecryptReader(r io.Reader, password string, header *EncryptionHeader) (*DecryptReader, error) {
-	// Derive key from password and salt
-	key := DeriveKey(password, header.Salt)
+	// Derive key from password and salt with the recorded key derivation
+	key, err := deriveHeaderKey(password, header)
+	if err != nil {
+		return nil, err
+	}
 	
 	// Create AES cipher
 	block, err := aes.NewCipher(key)
@@ -183,76 +410,80 @@ func NewDecryptReader(r io.Reader, password string, header *EncryptionHeader) (*
 	if err != nil {
 		return nil, fmt.Errorf("failed to create GCM: %w", err)
 	}
+
+	// Headers with a verifier reject a wrong password before any data is read
+	if header.Verifier != nil {
+		plaintext, err := gcm.Open(nil, verifierNonce(header.Nonce), header.Verifier, verifierAAD)
+		if err != nil || !bytes.Equal(plaintext, verifierMagic) {
+			return nil, ErrIncorrectPassword
+		}
+	}
 	
 	// Copy nonce to avoid modifying the header
 	baseNonce := make([]byte, len(header.Nonce))
 	copy(baseNonce, header.Nonce)
+
+	chunkSize := header.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = DefaultChunkSize
+	}
 	
 	return &DecryptReader{
 		reader:    r,
 		cipher:    gcm,
 		baseNonce: baseNonce,
 		counter:   0,
-		buffer:    make([]byte, 64*1024+gcm.Overhead()), // 64KB + overhead
+		buffer:    make([]byte, chunkSize+gcm.Overhead()),
+		framed:    header.Framed,
 	}, nil
 }
 
-// Read implements io.Reader with decryption
+// Read implements io.Reader with decryption. Framed streams must end with a chunk sealed as
+// final; data that stops before it was truncated.
 func (dr *DecryptReader) Read(p []byte) (int, error) {
-	if dr.eof && len(dr.decrypted) == 0 {
-		return 0, io.EOF
-	}
-	
-	// If we have decrypted data, return it
-	if len(dr.decrypted) > 0 {
-		n := copy(p, dr.decrypted)
-		dr.decrypted = dr.decrypted[n:]
-		return n, nil
-	}
-	
-	// Read more data (encrypted chunk size)
-	n, err := dr.reader.Read(dr.buffer)
-	if err != nil && err != io.EOF {
-		return 0, err
-	}
-	
-	if n > 0 {
-		// Create unique nonce for this chunk (same logic as encryption)
-		chunkNonce := make([]byte, len(dr.baseNonce))
-		copy(chunkNonce, dr.baseNonce)
-		
-		// Combine base nonce with counter to ensure uniqueness
-		for i := 0; i < 8 && i < len(chunkNonce); i++ {
-			chunkNonce[len(chunkNonce)-1-i] ^= byte(dr.counter >> (8 * i))
+	if len(dr.decrypted) == 0 {
+		if dr.eof {
+			return 0, io.EOF
+		}
+
+		// Read a full encrypted chunk, which may arrive in several reads from network streams
+		n, err := io.ReadFull(dr.reader, dr.buffer)
+		short := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !short {
+			return 0, err
+		}
+
+		if n == 0 {
+			dr.eof = true
+			if dr.framed {
+				return 0, fmt.Errorf("%w: encrypted data is truncated", ErrDecryption)
+			}
+			return 0, io.EOF
 		}
-		
-		// Decrypt the chunk
-		decrypted, err := dr.cipher.Open(nil, chunkNonce, dr.buffer[:n], nil)
+
+		// Only the final chunk of a framed stream is shorter than a full chunk
+		var aad []byte
+		if dr.framed {
+			aad = chunkAAD(dr.counter, short)
+		}
+		decrypted, err := dr.cipher.Open(nil, chunkNonce(dr.baseNonce, dr.counter), dr.buffer[:n], aad)
 		if err != nil {
-			return 0, fmt.Errorf("decryption failed: %w", err)
+			return 0, fmt.Errorf("%w: %w", ErrDecryption, err)
 		}
 		dr.decrypted = decrypted
 		dr.counter++
-		
-		// Copy to output
-		copied := copy(p, dr.decrypted)
-		dr.decrypted = dr.decrypted[copied:]
-		return copied, nil
-	}
-	
-	if err == io.EOF {
-		dr.eof = true
-		if len(dr.decrypted) > 0 {
-			n := copy(p, dr.decrypted)
-			dr.decrypted = dr.decrypted[n:]
-			return n, nil
+		dr.eof = short
+
+		// The final chunk of a framed stream is empty when the data filled the previous one
+		if len(dr.decrypted) == 0 {
+			return 0, io.EOF
 		}
-		return 0, io.EOF
 	}
-	
-	return 0, nil
-}
 
+	n := copy(p, dr.decrypted)
+	dr.decrypted = dr.decrypted[n:]
+	return n, nil
+}
 
 // WriteEncryptionHeader writes the encryption header to a writer
 func WriteEncryptionHeader(w io.Writer, header *EncryptionHeader) error {
@@ -261,10 +492,48 @@ func WriteEncryptionHeader(w io.Writer, header *EncryptionHeader) error {
 		return fmt.Errorf("failed to write magic bytes: %w", err)
 	}
 	
-	// Write version byte (1)
-	if _, err := w.Write([]byte{1}); err != nil {
+	// Write version byte: version 1 uses the default chunk size, version 2 records it and
+	// version 3 also records the key derivation and its parameters. Version 4 has the layout
+	// of version 3 and marks framed chunks. Version 5, which all new backups use, adds the
+	// verifier block to version 4.
+	chunkSize := header.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = DefaultChunkSize
+	}
+	version := byte(1)
+	if chunkSize != DefaultChunkSize {
+		version = 2
+	}
+	var kdfID byte
+	switch header.KDF {
+	case "", KDF:
+		kdfID = kdfIDPBKDF2
+	case KDFArgon2id:
+		kdfID = kdfIDArgon2id
+		version = 3
+	case KDFKeyfile:
+		kdfID = kdfIDKeyfile
+		version = 3
+	default:
+		return fmt.Errorf("unsupported key derivation %q", header.KDF)
+	}
+	if header.Framed {
+		version = 4
+	}
+	if header.Verifier != nil {
+		if !header.Framed {
+			return fmt.Errorf("a verifier block requires framed chunks")
+		}
+		version = 5
+	}
+	if _, err := w.Write([]byte{version}); err != nil {
 		return fmt.Errorf("failed to write version: %w", err)
 	}
+	if version >= 3 {
+		if _, err := w.Write([]byte{kdfID}); err != nil {
+			return fmt.Errorf("failed to write key derivation: %w", err)
+		}
+	}
 	
 	// Write salt
 	if _, err := w.Write(header.Salt); err != nil {
@@ -275,6 +544,27 @@ func WriteEncryptionHeader(w io.Writer, header *EncryptionHeader) error {
 	if _, err := w.Write(header.Nonce); err != nil {
 		return fmt.Errorf("failed to write nonce: %w", err)
 	}
+
+	// Write chunk size
+	if version >= 2 {
+		if err := binary.Write(w, binary.BigEndian, uint32(chunkSize)); err != nil { // #nosec G115 - chunk size is bounded by MaxChunkSize
+			return fmt.Errorf("failed to write chunk size: %w", err)
+		}
+	}
+
+	// Write key derivation parameters
+	if kdfID == kdfIDArgon2id {
+		if err := binary.Write(w, binary.BigEndian, header.Argon2); err != nil {
+			return fmt.Errorf("failed to write argon2id parameters: %w", err)
+		}
+	}
+
+	// Write verifier block
+	if version >= 5 {
+		if _, err := w.Write(header.Verifier); err != nil {
+			return fmt.Errorf("failed to write verifier: %w", err)
+		}
+	}
 	
 	return nil
 }
@@ -297,9 +587,28 @@ func ReadEncryptionHeader(r io.Reader) (*EncryptionHeader, error) {
 		return nil, fmt.Errorf("failed to read version: %w", err)
 	}
 	
-	if version[0] != 1 {
+	if version[0] < 1 || version[0] > 5 {
 		return nil, fmt.Errorf("unsupported encryption version: %d", version[0])
 	}
+
+	// Read key derivation
+	kdf := KDF
+	if version[0] >= 3 {
+		kdfID := make([]byte, 1)
+		if _, err := io.ReadFull(r, kdfID); err != nil {
+			return nil, fmt.Errorf("failed to read key derivation: %w", err)
+		}
+		switch kdfID[0] {
+		case kdfIDPBKDF2:
+			kdf = KDF
+		case kdfIDArgon2id:
+			kdf = KDFArgon2id
+		case kdfIDKeyfile:
+			kdf = KDFKeyfile
+		default:
+			return nil, fmt.Errorf("unsupported key derivation id: %d", kdfID[0])
+		}
+	}
 	
 	// Read salt
 	salt := make([]byte, SaltSize)
@@ -312,14 +621,118 @@ func ReadEncryptionHeader(r io.Reader) (*EncryptionHeader, error) {
 	if _, err := io.ReadFull(r, nonce); err != nil {
 		return nil, fmt.Errorf("failed to read nonce: %w", err)
 	}
+
+	// Read chunk size
+	chunkSize := DefaultChunkSize
+	if version[0] >= 2 {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return nil, fmt.Errorf("failed to read chunk size: %w", err)
+		}
+		chunkSize = int(size)
+		if err := ValidateChunkSize(chunkSize); err != nil {
+			return nil, fmt.Errorf("invalid encryption header: %w", err)
+		}
+	}
 	
-	return &EncryptionHeader{
-		Salt:  salt,
-		Nonce: nonce,
-	}, nil
+	header := &EncryptionHeader{
+		Salt:      salt,
+		Nonce:     nonce,
+		ChunkSize: chunkSize,
+		KDF:       kdf,
+		Framed:    version[0] >= 4,
+	}
+
+	// Read key derivation parameters
+	if kdf == KDFArgon2id {
+		if err := binary.Read(r, binary.BigEndian, &header.Argon2); err != nil {
+			return nil, fmt.Errorf("failed to read argon2id parameters: %w", err)
+		}
+		if err := validateArgon2Params(header.Argon2); err != nil {
+			return nil, fmt.Errorf("invalid encryption header: %w", err)
+		}
+	}
+
+	// Read verifier block
+	if version[0] >= 5 {
+		header.Verifier = make([]byte, len(verifierMagic)+verifierOverhead)
+		if _, err := io.ReadFull(r, header.Verifier); err != nil {
+			return nil, fmt.Errorf("failed to read verifier: %w", err)
+		}
+	}
+
+	return header, nil
 }
 
 // IsEncrypted checks if data starts with encryption header
 func IsEncrypted(data []byte) bool {
 	return len(data) >= 8 && string(data[:8]) == "DVOM-ENC"
-}
\ No newline at end of file
+}
+
+// EncryptBytes encrypts data with a password into a self-contained blob (header and ciphertext)
+func EncryptBytes(data []byte, password string) ([]byte, error) {
+	encryptReader, header, err := NewEncryptReader(bytes.NewReader(data), password)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := WriteEncryptionHeader(&buf, header); err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(&buf, encryptReader); err != nil {
+		return nil, fmt.Errorf("failed to encrypt data: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DecryptBytes decrypts a blob produced by EncryptBytes
+func DecryptBytes(blob []byte, password string) ([]byte, error) {
+	r := bytes.NewReader(blob)
+	header, err := ReadEncryptionHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	decryptReader, err := NewDecryptReader(r, password, header)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(decryptReader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data (wrong password?): %w", err)
+	}
+
+	return data, nil
+}
+
+// VerifyFirstChunk reads the encryption header and the first encrypted chunk from r and checks
+// that the chunk decrypts with password, without reading the rest of the stream
+func VerifyFirstChunk(r io.Reader, password string) error {
+	header, err := ReadEncryptionHeader(r)
+	if err != nil {
+		return err
+	}
+
+	// Read the whole chunk first; network streams may return it in several reads
+	chunk := make([]byte, header.ChunkSize+16)
+	n, err := io.ReadFull(r, chunk)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return fmt.Errorf("encrypted data is empty")
+		}
+		return fmt.Errorf("failed to read first encrypted chunk: %w", err)
+	}
+
+	decryptReader, err := NewDecryptReader(bytes.NewReader(chunk[:n]), password, header)
+	if err != nil {
+		return err
+	}
+	if _, err := decryptReader.Read(make([]byte, 1)); err != nil && err != io.EOF {
+		return fmt.Errorf("first chunk does not decrypt with the password: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestEncryptedSizeMatchesEncryptReader(t *testing.T) {
+	sizes := []int64{0, 1, DefaultChunkSize - 1, DefaultChunkSize, DefaultChunkSize + 1, 2 * DefaultChunkSize}
+
+	for _, size := range sizes {
+		reader, header, err := NewEncryptReader(bytes.NewReader(make([]byte, size)), "password")
+		if err != nil {
+			t.Fatalf("NewEncryptReader() error = %v", err)
+		}
+		produced, err := io.Copy(io.Discard, reader)
+		if err != nil {
+			t.Fatalf("encrypting %d bytes: %v", size, err)
+		}
+
+		if got := EncryptedSize(size, header.ChunkSize); got != produced {
+			t.Errorf("EncryptedSize(%d, %d) = %d, EncryptReader produced %d bytes", size, header.ChunkSize, got, produced)
+		}
+	}
+}
+
+// encryptFramed encrypts data in chunks of chunkSize and returns the sealed chunks without the
+// header, and the header
+func encryptFramed(t *testing.T, data []byte, chunkSize int) ([]byte, *EncryptionHeader) {
+	t.Helper()
+	reader, header, err := NewEncryptReaderWithChunkSize(bytes.NewReader(data), "password", chunkSize)
+	if err != nil {
+		t.Fatalf("NewEncryptReaderWithChunkSize() error = %v", err)
+	}
+	sealed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("encrypting %d bytes: %v", len(data), err)
+	}
+	return sealed, header
+}
+
+// decryptFramed decrypts sealed chunks with the header they were encrypted with
+func decryptFramed(t *testing.T, sealed []byte, header *EncryptionHeader) ([]byte, error) {
+	t.Helper()
+	reader, err := NewDecryptReader(bytes.NewReader(sealed), "password", header)
+	if err != nil {
+		t.Fatalf("NewDecryptReader() error = %v", err)
+	}
+	return io.ReadAll(reader)
+}
+
+// testData returns size bytes that differ from chunk to chunk
+func testData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+func TestFramedRoundTripAtChunkBoundaries(t *testing.T) {
+	const chunk = MinChunkSize
+	for _, size := range []int{0, chunk - 1, chunk, chunk + 1, 2 * chunk} {
+		data := testData(size)
+		sealed, header := encryptFramed(t, data, chunk)
+
+		decrypted, err := decryptFramed(t, sealed, header)
+		if err != nil {
+			t.Fatalf("%d bytes: decryption error = %v", size, err)
+		}
+		if !bytes.Equal(decrypted, data) {
+			t.Errorf("%d bytes: decrypted data differs from the original", size)
+		}
+	}
+}
+
+func TestFramedDecryptionRejectsTampering(t *testing.T) {
+	const chunk = MinChunkSize
+	sealedChunk := chunk + chunkOverhead
+
+	// Three full chunks and a short final chunk
+	sealed, header := encryptFramed(t, testData(3*chunk+100), chunk)
+	// Two full chunks and an empty final chunk
+	exact, exactHeader := encryptFramed(t, testData(2*chunk), chunk)
+
+	swapped := append([]byte{}, sealed...)
+	copy(swapped[:sealedChunk], sealed[sealedChunk:2*sealedChunk])
+	copy(swapped[sealedChunk:2*sealedChunk], sealed[:sealedChunk])
+
+	tests := []struct {
+		name   string
+		sealed []byte
+		header *EncryptionHeader
+	}{
+		{"chunks swapped", swapped, header},
+		{"cut off at a chunk boundary", sealed[:2*sealedChunk], header},
+		{"final chunk dropped", sealed[:3*sealedChunk], header},
+		{"empty final chunk dropped", exact[:2*sealedChunk], exactHeader},
+		{"data appended after the final chunk", append(append([]byte{}, sealed...), sealed[:sealedChunk]...), header},
+		{"bytes appended after an empty final chunk", append(append([]byte{}, exact...), "trailing"...), exactHeader},
+	}
+
+	for _, tt := range tests {
+		if _, err := decryptFramed(t, tt.sealed, tt.header); !errors.Is(err, ErrDecryption) {
+			t.Errorf("%s: decryption error = %v, want %v", tt.name, err, ErrDecryption)
+		}
+	}
+}
+
+// BenchmarkEncryptDecrypt measures the throughput of sealing and opening 16MB at several chunk
+// sizes. Key derivation is left out of the timing, since it does not depend on the chunk size.
+func BenchmarkEncryptDecrypt(b *testing.B) {
+	data := testData(16 * 1024 * 1024)
+
+	for _, chunkSize := range []int{MinChunkSize, DefaultChunkSize, 1024 * 1024, 4 * 1024 * 1024} {
+		b.Run(fmt.Sprintf("chunk=%dKB", chunkSize/1024), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				encryptor, header, err := NewEncryptReaderWithChunkSize(bytes.NewReader(data), "password", chunkSize)
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+				sealed, err := io.ReadAll(encryptor)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				b.StopTimer()
+				decryptor, err := NewDecryptReader(bytes.NewReader(sealed), "password", header)
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+				if _, err := io.Copy(io.Discard, decryptor); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -2,13 +2,20 @@ package docker
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
 	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/ypeckstadt/dvom/internal/models"
 )
 
@@ -57,8 +64,9 @@ func (c *Client) GetContainer(name string) (*types.Container, error) {
 	return nil, fmt.Errorf("container '%s' not found", name)
 }
 
-// GetContainerVolumes retrieves volume information for a container
-func (c *Client) GetContainerVolumes(containerID string) ([]models.VolumeInfo, error) {
+// GetContainerVolumes retrieves volume information for a container. With includeBinds, its bind
+// mounts are returned as well, named by their host path.
+func (c *Client) GetContainerVolumes(containerID string, includeBinds bool) ([]models.VolumeInfo, error) {
 	containerInfo, err := c.docker.ContainerInspect(context.Background(), containerID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to inspect container: %w", err)
@@ -66,19 +74,36 @@ func (c *Client) GetContainerVolumes(containerID string) ([]models.VolumeInfo, e
 
 	var volumes []models.VolumeInfo
 	for _, mount := range containerInfo.Mounts {
-		if mount.Type == "volume" && mount.Name != "" {
-			volumeInfo := models.VolumeInfo{
+		switch {
+		case mount.Type == "volume" && mount.Name != "":
+			volumes = append(volumes, models.VolumeInfo{
 				Name:        mount.Name,
+				Type:        models.MountTypeVolume,
 				Source:      mount.Source,
 				Destination: mount.Destination,
-			}
-			volumes = append(volumes, volumeInfo)
+			})
+		case mount.Type == "bind" && includeBinds:
+			volumes = append(volumes, models.VolumeInfo{
+				Name:        mount.Source,
+				Type:        models.MountTypeBind,
+				Source:      mount.Source,
+				Destination: mount.Destination,
+			})
 		}
 	}
 
 	return volumes, nil
 }
 
+// GetContainerConfig retrieves the config a container was created with
+func (c *Client) GetContainerConfig(containerID string) (*container.Config, error) {
+	containerInfo, err := c.docker.ContainerInspect(context.Background(), containerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container: %w", err)
+	}
+	return containerInfo.Config, nil
+}
+
 // IsContainerRunning checks if a container is currently running
 func (c *Client) IsContainerRunning(containerID string) (bool, error) {
 	containerInfo, err := c.docker.ContainerInspect(context.Background(), containerID)
@@ -88,24 +113,72 @@ func (c *Client) IsContainerRunning(containerID string) (bool, error) {
 	return containerInfo.State.Running, nil
 }
 
-// StopContainer stops a container and returns whether it was running
-func (c *Client) StopContainer(containerID string) (bool, error) {
+// killedExitCode is the exit code of a container ended by SIGKILL
+const killedExitCode = 137
+
+// killWaitTimeout is how long to wait for a container to exit after SIGKILL
+const killWaitTimeout = 10 * time.Second
+
+// StopContainer stops a container, giving it timeout to exit after SIGTERM, and returns whether
+// it was running and whether it had to be killed. Docker kills a container still running after
+// the timeout; with force, a container the stop request failed for is also killed explicitly.
+func (c *Client) StopContainer(containerID string, timeout time.Duration, force bool) (bool, bool, error) {
 	wasRunning, err := c.IsContainerRunning(containerID)
 	if err != nil {
-		return false, err
+		return false, false, err
+	}
+	if !wasRunning {
+		return false, false, nil
 	}
 
-	if wasRunning {
-		timeout := 30 // seconds
-		err = c.docker.ContainerStop(context.Background(), containerID, container.StopOptions{
-			Timeout: &timeout,
-		})
-		if err != nil {
-			return wasRunning, fmt.Errorf("failed to stop container: %w", err)
+	seconds := int(math.Ceil(timeout.Seconds()))
+	err = c.docker.ContainerStop(context.Background(), containerID, container.StopOptions{
+		Timeout: &seconds,
+	})
+	if err != nil {
+		if !force {
+			return wasRunning, false, fmt.Errorf("failed to stop container: %w", err)
 		}
+		if killErr := c.killContainer(containerID); killErr != nil {
+			return wasRunning, false, fmt.Errorf("failed to stop container: %w (kill also failed: %v)", err, killErr)
+		}
+		return wasRunning, true, nil
+	}
+
+	containerInfo, err := c.docker.ContainerInspect(context.Background(), containerID)
+	if err != nil {
+		return wasRunning, false, nil
+	}
+	if containerInfo.State.Running {
+		if !force {
+			return wasRunning, false, fmt.Errorf("container is still running after stop")
+		}
+		if err := c.killContainer(containerID); err != nil {
+			return wasRunning, false, fmt.Errorf("container is still running after stop and could not be killed: %w", err)
+		}
+		return wasRunning, true, nil
 	}
 
-	return wasRunning, nil
+	return wasRunning, containerInfo.State.ExitCode == killedExitCode, nil
+}
+
+// killContainer sends SIGKILL to a container and waits for it to exit
+func (c *Client) killContainer(containerID string) error {
+	if err := c.docker.ContainerKill(context.Background(), containerID, "SIGKILL"); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), killWaitTimeout)
+	defer cancel()
+	statusCh, errCh := c.docker.ContainerWait(ctx, containerID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return fmt.Errorf("container did not exit after SIGKILL: %w", err)
+		}
+	case <-statusCh:
+	}
+	return nil
 }
 
 // StartContainer starts a container
@@ -117,11 +190,153 @@ func (c *Client) StartContainer(containerID string) error {
 	return nil
 }
 
+// RestartContainer restarts a container, whether it is running or has exited
+func (c *Client) RestartContainer(containerID string) error {
+	timeout := 30 // seconds
+	err := c.docker.ContainerRestart(context.Background(), containerID, container.StopOptions{
+		Timeout: &timeout,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restart container: %w", err)
+	}
+	return nil
+}
+
+// containerPollInterval is how often WaitHealthy inspects the container
+const containerPollInterval = time.Second
+
+// WaitHealthy waits up to timeout for a started container to come up. Containers with a
+// health check must report healthy; containers without one must still be running after
+// settle, so a container that crashes right after starting is caught.
+func (c *Client) WaitHealthy(containerID string, timeout, settle time.Duration) error {
+	started := time.Now()
+	deadline := started.Add(timeout)
+
+	for {
+		info, err := c.docker.ContainerInspect(context.Background(), containerID)
+		if err != nil {
+			return fmt.Errorf("failed to inspect container: %w", err)
+		}
+
+		state := info.State
+		if state == nil {
+			return fmt.Errorf("container state is unavailable")
+		}
+		if !state.Running || state.Restarting {
+			return fmt.Errorf("container is %s (exit code %d)", state.Status, state.ExitCode)
+		}
+
+		if state.Health != nil {
+			switch state.Health.Status {
+			case types.Healthy:
+				return nil
+			case types.Unhealthy:
+				return fmt.Errorf("container is unhealthy%s", lastHealthOutput(state.Health))
+			}
+		} else if time.Since(started) >= settle {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			if state.Health != nil {
+				return fmt.Errorf("container did not become healthy within %s (status: %s)", timeout, state.Health.Status)
+			}
+			return fmt.Errorf("container did not stay running for %s", settle)
+		}
+		time.Sleep(containerPollInterval)
+	}
+}
+
+// lastHealthOutput formats the output of the most recent health check probe
+func lastHealthOutput(health *types.Health) string {
+	if len(health.Log) == 0 {
+		return ""
+	}
+	output := strings.TrimSpace(health.Log[len(health.Log)-1].Output)
+	if output == "" {
+		return ""
+	}
+	return ": " + output
+}
+
 // GetDockerClient returns the underlying Docker client for advanced operations
 func (c *Client) GetDockerClient() *client.Client {
 	return c.docker
 }
 
+// ServerVersion returns the version of the Docker daemon
+func (c *Client) ServerVersion() (string, error) {
+	info, err := c.docker.ServerVersion(context.Background())
+	if err != nil {
+		return "", fmt.Errorf("failed to get Docker version: %w", err)
+	}
+	return info.Version, nil
+}
+
+// ImageExists checks if an image is present on the Docker host
+func (c *Client) ImageExists(ref string) (bool, error) {
+	_, _, err := c.docker.ImageInspectWithRaw(context.Background(), ref)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to inspect image '%s': %w", ref, err)
+	}
+	return true, nil
+}
+
+// EnsureImage checks that an image is available locally and pulls it if it is not. It reports
+// whether the image had to be pulled.
+func (c *Client) EnsureImage(ref string) (bool, error) {
+	exists, err := c.ImageExists(ref)
+	if err != nil || exists {
+		return false, err
+	}
+
+	if err := c.PullImage(ref, nil); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// PullImage pulls an image, calling progress (if not nil) with each status line reported by
+// the daemon, e.g. "Downloading" for a layer
+func (c *Client) PullImage(ref string, progress func(status string)) error {
+	stream, err := c.docker.ImagePull(context.Background(), ref, image.PullOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to pull image '%s': %w", ref, err)
+	}
+	defer func() {
+		if err := stream.Close(); err != nil {
+			Warnf("failed to close image pull: %v", err)
+		}
+	}()
+
+	// The pull only completes once its progress stream has been read to the end, and pull
+	// errors are reported inside the stream
+	decoder := json.NewDecoder(stream)
+	for {
+		var message jsonmessage.JSONMessage
+		if err := decoder.Decode(&message); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("failed to pull image '%s': %w", ref, err)
+		}
+		if message.Error != nil {
+			return fmt.Errorf("failed to pull image '%s': %w", ref, message.Error)
+		}
+		if progress != nil && message.Status != "" {
+			progress(message.Status)
+		}
+	}
+
+	if _, _, err := c.docker.ImageInspectWithRaw(context.Background(), ref); err != nil {
+		return fmt.Errorf("image '%s' is not available after pulling it: %w", ref, err)
+	}
+	return nil
+}
+
 // ListVolumes returns all Docker volumes
 func (c *Client) ListVolumes() ([]models.VolumeInfo, error) {
 	volumeList, err := c.docker.VolumeList(context.Background(), volume.ListOptions{})
@@ -157,11 +372,38 @@ func (c *Client) GetVolume(volumeName string) (*models.VolumeInfo, error) {
 		Destination: vol.Mountpoint,
 		Driver:      vol.Driver,
 		CreatedAt:   vol.CreatedAt,
+		Labels:      vol.Labels,
+		Options:     vol.Options,
 	}
 
 	return volumeInfo, nil
 }
 
+// CreateVolume creates a volume with the given driver ("" for local), labels and driver options
+func (c *Client) CreateVolume(volumeName, driver string, labels, options map[string]string) error {
+	if driver == "" {
+		driver = "local"
+	}
+	_, err := c.docker.VolumeCreate(context.Background(), volume.CreateOptions{
+		Name:       volumeName,
+		Driver:     driver,
+		DriverOpts: options,
+		Labels:     labels,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create volume '%s': %w", volumeName, err)
+	}
+	return nil
+}
+
+// RemoveVolume removes a volume and its data
+func (c *Client) RemoveVolume(volumeName string) error {
+	if err := c.docker.VolumeRemove(context.Background(), volumeName, true); err != nil {
+		return fmt.Errorf("failed to remove volume '%s': %w", volumeName, err)
+	}
+	return nil
+}
+
 // VolumeExists checks if a volume exists
 func (c *Client) VolumeExists(volumeName string) (bool, error) {
 	_, err := c.docker.VolumeInspect(context.Background(), volumeName)
@@ -174,23 +416,68 @@ func (c *Client) VolumeExists(volumeName string) (bool, error) {
 	return true, nil
 }
 
-// GetContainersUsingVolume returns all containers that are using the specified volume
+// Labels of the helper containers dvom creates, so they can be told apart from application
+// containers and removed if dvom exits without cleaning up
+const (
+	HelperLabel        = "dvom"
+	HelperRunLabel     = "dvom.run"
+	HelperPurposeLabel = "dvom.purpose"
+)
+
+// HelperLabels returns the labels of a helper container created for purpose by the dvom run runID
+func HelperLabels(runID, purpose string) map[string]string {
+	return map[string]string{
+		HelperLabel:        "true",
+		HelperRunLabel:     runID,
+		HelperPurposeLabel: purpose,
+	}
+}
+
+// IsHelper reports whether container labels mark a dvom helper container
+func IsHelper(labels map[string]string) bool {
+	return labels[HelperLabel] == "true"
+}
+
+// ListHelperContainers returns every dvom helper container on the host, running or not
+func (c *Client) ListHelperContainers() ([]types.Container, error) {
+	containers, err := c.docker.ContainerList(context.Background(), container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", HelperLabel+"=true")),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	return containers, nil
+}
+
+// RemoveContainer force-removes a container, stopping it first if it is running
+func (c *Client) RemoveContainer(containerID string) error {
+	if err := c.docker.ContainerRemove(context.Background(), containerID, container.RemoveOptions{Force: true}); err != nil {
+		return fmt.Errorf("failed to remove container: %w", err)
+	}
+	return nil
+}
+
+// GetContainersUsingVolume returns all containers other than dvom helpers that are using the
+// specified volume. The daemon filters the containers by volume, and the mounts in the listing
+// are checked instead of inspecting every container on the host.
 func (c *Client) GetContainersUsingVolume(volumeName string) ([]types.Container, error) {
-	containers, err := c.docker.ContainerList(context.Background(), container.ListOptions{All: true})
+	containers, err := c.docker.ContainerList(context.Background(), container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("volume", volumeName)),
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list containers: %w", err)
 	}
 
+	// The volume filter also matches containers with a mount destination of that name. dvom's
+	// own helpers are not users of the volume.
 	var containersUsingVolume []types.Container
 	for _, container := range containers {
-		// Inspect container to get mount details
-		containerInfo, err := c.docker.ContainerInspect(context.Background(), container.ID)
-		if err != nil {
-			continue // Skip containers we can't inspect
+		if IsHelper(container.Labels) {
+			continue
 		}
-
-		// Check if this container uses the volume
-		for _, mount := range containerInfo.Mounts {
+		for _, mount := range container.Mounts {
 			if mount.Type == "volume" && mount.Name == volumeName {
 				containersUsingVolume = append(containersUsingVolume, container)
 				break
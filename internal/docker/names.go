@@ -0,0 +1,11 @@
+package docker
+
+import "regexp"
+
+// volumeNamePattern matches the volume names Docker accepts
+var volumeNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]+$`)
+
+// ValidVolumeName reports whether Docker accepts name as a volume name
+func ValidVolumeName(name string) bool {
+	return volumeNamePattern.MatchString(name)
+}
@@ -0,0 +1,110 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ypeckstadt/dvom/internal/models"
+)
+
+// Entry records a single operation performed by this dvom instance
+type Entry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Operation string    `json:"operation"`
+	Target    string    `json:"target"`
+	Volume    string    `json:"volume,omitempty"`
+	Storage   string    `json:"storage,omitempty"`
+	Result    string    `json:"result"`
+	Error     string    `json:"error,omitempty"`
+	// Containers lists the containers stopped and restarted around the operation
+	Containers []models.ContainerResult `json:"containers,omitempty"`
+}
+
+// Results recorded in history entries
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	// ResultUnchanged records a backup that stored nothing because the volume was unchanged
+	ResultUnchanged = "unchanged"
+)
+
+// DefaultPath returns the default location of the local history log
+func DefaultPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".dvom", "history.log")
+	}
+	return filepath.Join(home, ".dvom", "history.log")
+}
+
+// Append adds an entry to the history log at path, creating the file if needed
+func Append(path string, entry Entry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600) // #nosec G304 - user configured history path
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			Warnf("failed to close history file: %v", err)
+		}
+	}()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history entry: %w", err)
+	}
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write history entry: %w", err)
+	}
+
+	return nil
+}
+
+// Read returns all entries of the history log at path, oldest first.
+// A missing log is treated as an empty history.
+func Read(path string) ([]Entry, error) {
+	file, err := os.Open(path) // #nosec G304 - user configured history path
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			Warnf("failed to close history file: %v", err)
+		}
+	}()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// Skip lines damaged by e.g. an interrupted write
+			Warnf("skipping invalid history entry on line %d: %v", lineNumber, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,12 @@
+package history
+
+import (
+	"fmt"
+	"os"
+)
+
+// Warnf reports a problem that does not fail the operation, such as a history file that cannot
+// be closed. It prints to stderr unless replaced, e.g. by the backup package's logger.
+var Warnf = func(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "Warning: "+format+"\n", args...)
+}
@@ -18,10 +18,39 @@ type BackupMetadata struct {
 
 // VolumeInfo stores volume details
 type VolumeInfo struct {
-	Name        string `json:"name"`
+	Name string `json:"name"`
+	// Type is MountTypeBind for a host path mounted into a container; empty or MountTypeVolume
+	// for a named volume
+	Type        string `json:"type,omitempty"`
 	Source      string `json:"source"`
 	Destination string `json:"destination"`
 	Size        int64  `json:"size,omitempty"`
 	Driver      string `json:"driver,omitempty"`
 	CreatedAt   string `json:"created_at,omitempty"`
+	// Labels and Options are the volume's labels and driver options
+	Labels  map[string]string `json:"labels,omitempty"`
+	Options map[string]string `json:"options,omitempty"`
 }
+
+// Mount types of the sources a backup is taken from
+const (
+	MountTypeVolume = "volume"
+	MountTypeBind   = "bind"
+)
+
+// ContainerResult records what happened to a container stopped around an operation
+type ContainerResult struct {
+	Name   string `json:"name"`
+	ID     string `json:"id"`
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Container actions recorded in a ContainerResult
+const (
+	ContainerStopped        = "stopped"
+	ContainerKilled         = "killed"
+	ContainerAlreadyStopped = "already-stopped"
+	ContainerRestarted      = "restarted"
+	ContainerRestartFailed  = "restart-failed"
+)
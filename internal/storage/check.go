@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+)
+
+// checkObjectID is the ID of the sentinel object written by CheckAccess
+const checkObjectID = "dvom-doctor-check"
+
+// CheckAccess checks that the backend can be written to, read from and deleted from by storing
+// a tiny sentinel object, checking it exists and deleting it again
+func CheckAccess(ctx context.Context, backend Backend) error {
+	payload := []byte("dvom storage check\n")
+	sentinel := &Backup{
+		ID: checkObjectID,
+		Metadata: BackupMetadata{
+			ID:          checkObjectID,
+			Name:        checkObjectID,
+			Type:        "doctor-check",
+			Size:        int64(len(payload)),
+			CreatedAt:   time.Now(),
+			Description: "Sentinel object written by dvom doctor",
+		},
+		DataReader: bytes.NewReader(payload),
+	}
+
+	if err := backend.Store(ctx, sentinel); err != nil {
+		return fmt.Errorf("failed to write sentinel object: %w", err)
+	}
+
+	exists, err := backend.Exists(ctx, checkObjectID)
+	if err != nil {
+		return fmt.Errorf("failed to check sentinel object: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("sentinel object was written but is not found")
+	}
+
+	if err := backend.Delete(ctx, checkObjectID); err != nil {
+		return fmt.Errorf("failed to delete sentinel object %s: %w", checkObjectID, err)
+	}
+	return nil
+}
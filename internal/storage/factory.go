@@ -5,6 +5,11 @@ import (
 	"fmt"
 )
 
+// BackendTypes returns the storage backend types supported by NewBackend
+func BackendTypes() []string {
+	return []string{"local", "gcs", "s3"}
+}
+
 func NewBackend(ctx context.Context, config *Config) (Backend, error) {
 	switch config.Type {
 	case "local":
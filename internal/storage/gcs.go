@@ -3,17 +3,40 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"time"
 
 	"cloud.google.com/go/storage"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/impersonate"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
+const (
+	// DefaultGCSChunkSize is the size of the chunks backups are uploaded to GCS in
+	DefaultGCSChunkSize = 16 * 1024 * 1024
+	// gcsChunkAlignment is the granularity of GCS resumable upload chunks
+	gcsChunkAlignment = 256 * 1024
+)
+
+// ValidateGCSChunkSize checks that a chunk size is accepted by GCS resumable uploads
+func ValidateGCSChunkSize(size int64) error {
+	if size < gcsChunkAlignment || size%gcsChunkAlignment != 0 {
+		return fmt.Errorf("GCS chunk size must be a multiple of %d bytes, got %d", gcsChunkAlignment, size)
+	}
+	return nil
+}
+
 type GCSStorage struct {
-	client *storage.Client
-	bucket string
+	client          *storage.Client
+	bucket          string
+	readConcurrency int
+	chunkSize       int
 }
 
 func NewGCSStorage(ctx context.Context, config *GCSConfig) (*GCSStorage, error) {
@@ -21,31 +44,75 @@ func NewGCSStorage(ctx context.Context, config *GCSConfig) (*GCSStorage, error)
 		return nil, fmt.Errorf("bucket name is required for GCS storage")
 	}
 
+	if config.AccessToken != "" && (config.Credentials != "" || config.Impersonate != "") {
+		return nil, fmt.Errorf("a GCS access token cannot be combined with a credentials file or impersonation")
+	}
+
 	var opts []option.ClientOption
 	if config.Credentials != "" {
 		opts = append(opts, option.WithCredentialsFile(config.Credentials))
 	}
 
+	switch {
+	case config.AccessToken != "":
+		opts = append(opts, option.WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: config.AccessToken})))
+	case config.Impersonate != "":
+		// The base credentials (file or ADC) mint short-lived tokens for the target service account
+		tokenSource, err := impersonate.CredentialsTokenSource(ctx, impersonate.CredentialsConfig{
+			TargetPrincipal: config.Impersonate,
+			Scopes:          []string{storage.ScopeReadWrite},
+		}, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to impersonate service account %s: %w", config.Impersonate, err)
+		}
+		opts = []option.ClientOption{option.WithTokenSource(tokenSource)}
+	}
+
 	client, err := storage.NewClient(ctx, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create GCS client: %w", err)
 	}
 
+	chunkSize := config.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = DefaultGCSChunkSize
+	}
+	if err := ValidateGCSChunkSize(int64(chunkSize)); err != nil {
+		return nil, err
+	}
+
+	// Fail early with a clear error instead of on the first upload
+	if _, err := client.Bucket(config.Bucket).Attrs(ctx); err != nil {
+		if closeErr := client.Close(); closeErr != nil {
+			Warnf("failed to close GCS client: %v", closeErr)
+		}
+		if errors.Is(err, storage.ErrBucketNotExist) {
+			return nil, fmt.Errorf("GCS bucket %s does not exist", config.Bucket)
+		}
+		return nil, fmt.Errorf("cannot access GCS bucket %s (check credentials and permissions): %w", config.Bucket, err)
+	}
+
 	return &GCSStorage{
-		client: client,
-		bucket: config.Bucket,
+		client:          client,
+		bucket:          config.Bucket,
+		readConcurrency: config.ReadConcurrency,
+		chunkSize:       chunkSize,
 	}, nil
 }
 
+// Store streams the backup data to GCS as a resumable upload in chunks, each retried on
+// transient errors, then writes the metadata as a separate object
 func (g *GCSStorage) Store(ctx context.Context, backup *Backup) error {
 	bucket := g.client.Bucket(g.bucket)
 
-	dataObj := bucket.Object(backup.ID + ".tar.gz")
+	// Every chunk carries the same bytes when it is retried, so retrying is always safe
+	dataObj := bucket.Object(dataKey(backup.ID, backup.Metadata)).Retryer(storage.WithPolicy(storage.RetryAlways))
 	w := dataObj.NewWriter(ctx)
+	w.ChunkSize = g.chunkSize
 
 	if _, err := io.Copy(w, backup.DataReader); err != nil {
 		if closeErr := w.Close(); closeErr != nil {
-			fmt.Printf("Warning: failed to close writer: %v\n", closeErr)
+			Warnf("failed to close writer: %v", closeErr)
 		}
 		return fmt.Errorf("failed to write backup data: %w", err)
 	}
@@ -54,12 +121,12 @@ func (g *GCSStorage) Store(ctx context.Context, backup *Backup) error {
 		return fmt.Errorf("failed to close data writer: %w", err)
 	}
 
-	metadataObj := bucket.Object(backup.ID + ".json")
+	metadataObj := bucket.Object(metadataKey(backup.ID))
 	metaWriter := metadataObj.NewWriter(ctx)
 
 	if err := json.NewEncoder(metaWriter).Encode(backup.Metadata); err != nil {
 		if closeErr := metaWriter.Close(); closeErr != nil {
-			fmt.Printf("Warning: failed to close metadata writer: %v\n", closeErr)
+			Warnf("failed to close metadata writer: %v", closeErr)
 		}
 		return fmt.Errorf("failed to write metadata: %w", err)
 	}
@@ -71,20 +138,34 @@ func (g *GCSStorage) Store(ctx context.Context, backup *Backup) error {
 	return nil
 }
 
+// StoreResumable stores the backup like Store. The GCS client cannot continue an upload
+// session of another process, so a resumed upload starts the data object over; only the
+// version and the archive of the interrupted attempt are reused.
+func (g *GCSStorage) StoreResumable(ctx context.Context, backup *Backup, upload *ResumableUpload) error {
+	upload.UploadID = ""
+	upload.PartSize = int64(g.chunkSize)
+	if upload.Started != nil {
+		if err := upload.Started(upload); err != nil {
+			return err
+		}
+	}
+	return g.Store(ctx, backup)
+}
+
 func (g *GCSStorage) Retrieve(ctx context.Context, id string) (*Backup, error) {
 	bucket := g.client.Bucket(g.bucket)
 
-	metadataObj := bucket.Object(id + ".json")
+	metadataObj := bucket.Object(metadataKey(id))
 	metaReader, err := metadataObj.NewReader(ctx)
 	if err != nil {
 		if err == storage.ErrObjectNotExist {
-			return nil, fmt.Errorf("backup not found: %s", id)
+			return nil, fmt.Errorf("backup %w: %s", ErrNotFound, id)
 		}
 		return nil, fmt.Errorf("failed to read metadata: %w", err)
 	}
 	defer func() {
 		if err := metaReader.Close(); err != nil {
-			fmt.Printf("Warning: failed to close metadata reader: %v\n", err)
+			Warnf("failed to close metadata reader: %v", err)
 		}
 	}()
 
@@ -93,7 +174,7 @@ func (g *GCSStorage) Retrieve(ctx context.Context, id string) (*Backup, error) {
 		return nil, fmt.Errorf("failed to decode metadata: %w", err)
 	}
 
-	dataObj := bucket.Object(id + ".tar.gz")
+	dataObj := bucket.Object(dataKey(id, metadata))
 	dataReader, err := dataObj.NewReader(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read backup data: %w", err)
@@ -107,11 +188,19 @@ func (g *GCSStorage) Retrieve(ctx context.Context, id string) (*Backup, error) {
 }
 
 func (g *GCSStorage) List(ctx context.Context) ([]BackupMetadata, error) {
-	bucket := g.client.Bucket(g.bucket)
+	return g.list(ctx, "")
+}
+
+// ListPrefix lists the backups whose ID starts with prefix using a native prefix query
+func (g *GCSStorage) ListPrefix(ctx context.Context, prefix string) ([]BackupMetadata, error) {
+	return g.list(ctx, prefix)
+}
 
-	var backups []BackupMetadata
-	it := bucket.Objects(ctx, &storage.Query{Delimiter: "/"})
+func (g *GCSStorage) list(ctx context.Context, prefix string) ([]BackupMetadata, error) {
+	bucket := g.client.Bucket(g.bucket)
 
+	var keys []string
+	it := bucket.Objects(ctx, &storage.Query{Delimiter: "/", Prefix: prefix})
 	for {
 		attrs, err := it.Next()
 		if err == iterator.Done {
@@ -121,40 +210,58 @@ func (g *GCSStorage) List(ctx context.Context) ([]BackupMetadata, error) {
 			return nil, fmt.Errorf("failed to list objects: %w", err)
 		}
 
-		if len(attrs.Name) > 5 && attrs.Name[len(attrs.Name)-5:] == ".json" {
-			obj := bucket.Object(attrs.Name)
-			reader, err := obj.NewReader(ctx)
-			if err != nil {
-				continue
-			}
+		if isMetadataKey(attrs.Name) {
+			keys = append(keys, attrs.Name)
+		}
+	}
 
-			var metadata BackupMetadata
-			if err := json.NewDecoder(reader).Decode(&metadata); err != nil {
-				if closeErr := reader.Close(); closeErr != nil {
-					fmt.Printf("Warning: failed to close reader: %v\n", closeErr)
-				}
-				continue
-			}
-			if err := reader.Close(); err != nil {
-				fmt.Printf("Warning: failed to close reader: %v\n", err)
-			}
+	return readMetadataObjects(ctx, keys, g.readConcurrency, g.readMetadata)
+}
 
-			backups = append(backups, metadata)
+// readMetadata reads and decodes a metadata object
+func (g *GCSStorage) readMetadata(ctx context.Context, key string) (*BackupMetadata, error) {
+	reader, err := g.client.Bucket(g.bucket).Object(key).NewReader(ctx)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrObjectNotExist):
+			return nil, fmt.Errorf("%w: %v", errMetadataGone, err)
+		case isGCSThrottled(err):
+			return nil, fmt.Errorf("%w: %v", errThrottled, err)
 		}
+		return nil, err
 	}
+	defer func() {
+		if err := reader.Close(); err != nil {
+			Warnf("failed to close reader: %v", err)
+		}
+	}()
 
-	return backups, nil
+	var metadata BackupMetadata
+	if err := json.NewDecoder(reader).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorruptMetadata, err)
+	}
+
+	return &metadata, nil
+}
+
+// isGCSThrottled reports whether a GCS error is a rate limiting response
+func isGCSThrottled(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusTooManyRequests || apiErr.Code == http.StatusServiceUnavailable
+	}
+	return false
 }
 
 func (g *GCSStorage) Delete(ctx context.Context, id string) error {
 	bucket := g.client.Bucket(g.bucket)
 
-	dataObj := bucket.Object(id + ".tar.gz")
+	dataObj := bucket.Object(resolveDataKey(ctx, id, g.RawMetadata, g.dataExists))
 	if err := dataObj.Delete(ctx); err != nil && err != storage.ErrObjectNotExist {
 		return fmt.Errorf("failed to delete backup data: %w", err)
 	}
 
-	metadataObj := bucket.Object(id + ".json")
+	metadataObj := bucket.Object(metadataKey(id))
 	if err := metadataObj.Delete(ctx); err != nil && err != storage.ErrObjectNotExist {
 		return fmt.Errorf("failed to delete metadata: %w", err)
 	}
@@ -164,7 +271,7 @@ func (g *GCSStorage) Delete(ctx context.Context, id string) error {
 
 func (g *GCSStorage) Exists(ctx context.Context, id string) (bool, error) {
 	bucket := g.client.Bucket(g.bucket)
-	obj := bucket.Object(id + ".json")
+	obj := bucket.Object(metadataKey(id))
 
 	_, err := obj.Attrs(ctx)
 	if err != nil {
@@ -177,6 +284,102 @@ func (g *GCSStorage) Exists(ctx context.Context, id string) (bool, error) {
 	return true, nil
 }
 
+// dataExists reports whether a data object is stored under key
+func (g *GCSStorage) dataExists(ctx context.Context, key string) bool {
+	_, err := g.client.Bucket(g.bucket).Object(key).Attrs(ctx)
+	return err == nil
+}
+
+func (g *GCSStorage) StatData(ctx context.Context, id string) (*ObjectInfo, error) {
+	key := resolveDataKey(ctx, id, g.RawMetadata, g.dataExists)
+	attrs, err := g.client.Bucket(g.bucket).Object(key).Attrs(ctx)
+	if err != nil {
+		if err == storage.ErrObjectNotExist {
+			return nil, fmt.Errorf("backup data %w: %s", ErrNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to stat backup data: %w", err)
+	}
+
+	return &ObjectInfo{
+		Key:     key,
+		Size:    attrs.Size,
+		ModTime: attrs.Updated,
+	}, nil
+}
+
+func (g *GCSStorage) OpenData(ctx context.Context, id string) (io.ReadCloser, error) {
+	dataReader, err := g.client.Bucket(g.bucket).Object(resolveDataKey(ctx, id, g.RawMetadata, g.dataExists)).NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup data: %w", err)
+	}
+	return dataReader, nil
+}
+
+func (g *GCSStorage) RawMetadata(ctx context.Context, id string) ([]byte, error) {
+	metaReader, err := g.client.Bucket(g.bucket).Object(metadataKey(id)).NewReader(ctx)
+	if err != nil {
+		if err == storage.ErrObjectNotExist {
+			return nil, fmt.Errorf("backup %w: %s", ErrNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	defer func() {
+		if err := metaReader.Close(); err != nil {
+			Warnf("failed to close metadata reader: %v", err)
+		}
+	}()
+
+	data, err := io.ReadAll(metaReader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	return data, nil
+}
+
+func (g *GCSStorage) PutMetadata(ctx context.Context, id string, metadata BackupMetadata) error {
+	metaWriter := g.client.Bucket(g.bucket).Object(metadataKey(id)).NewWriter(ctx)
+
+	if err := json.NewEncoder(metaWriter).Encode(metadata); err != nil {
+		if closeErr := metaWriter.Close(); closeErr != nil {
+			Warnf("failed to close metadata writer: %v", closeErr)
+		}
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+
+	if err := metaWriter.Close(); err != nil {
+		return fmt.Errorf("failed to close metadata writer: %w", err)
+	}
+
+	return nil
+}
+
+// CopyBackup copies the data object of srcID to dstID within the bucket and writes the
+// metadata of dstID
+func (g *GCSStorage) CopyBackup(ctx context.Context, srcID, dstID string, metadata BackupMetadata) error {
+	bucket := g.client.Bucket(g.bucket)
+	src := bucket.Object(resolveDataKey(ctx, srcID, g.RawMetadata, g.dataExists))
+	dst := bucket.Object(dataKey(dstID, metadata))
+
+	if _, err := dst.CopierFrom(src).Run(ctx); err != nil {
+		return fmt.Errorf("failed to copy backup data: %w", err)
+	}
+	return g.PutMetadata(ctx, dstID, metadata)
+}
+
+// SignedURL returns a V4 signed GET URL of the data object of a backup. Signing needs
+// credentials that can sign, such as a service account key or one allowed to sign blobs.
+func (g *GCSStorage) SignedURL(ctx context.Context, id string, expiry time.Duration) (string, error) {
+	url, err := g.client.Bucket(g.bucket).SignedURL(resolveDataKey(ctx, id, g.RawMetadata, g.dataExists), &storage.SignedURLOptions{
+		Method:  http.MethodGet,
+		Expires: time.Now().Add(expiry),
+		Scheme:  storage.SigningSchemeV4,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to sign backup data URL (the credentials must be able to sign, e.g. a service account key): %w", err)
+	}
+	return url, nil
+}
+
 func (g *GCSStorage) Close() error {
 	return g.client.Close()
 }
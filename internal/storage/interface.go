@@ -2,10 +2,15 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"io"
 	"time"
 )
 
+// ErrNotFound is wrapped by the errors returned for a backup or snapshot that does not exist
+var ErrNotFound = errors.New("not found")
+
 type Backup struct {
 	ID         string
 	Metadata   BackupMetadata
@@ -20,21 +25,121 @@ type BackupMetadata struct {
 	CreatedAt   time.Time `json:"created_at"`
 	ContainerID string    `json:"container_id,omitempty"`
 	VolumeName  string    `json:"volume_name,omitempty"`
-	ImageName   string    `json:"image_name,omitempty"`
-	ImageTag    string    `json:"image_tag,omitempty"`
-	Description string    `json:"description,omitempty"`
-	Version     string    `json:"version,omitempty"`
-	Encrypted   bool      `json:"encrypted,omitempty"`
+	// VolumeDriver, VolumeLabels and VolumeOptions describe the backed up volume, so a restore
+	// can recreate it
+	VolumeDriver  string            `json:"volume_driver,omitempty"`
+	VolumeLabels  map[string]string `json:"volume_labels,omitempty"`
+	VolumeOptions map[string]string `json:"volume_options,omitempty"`
+	// VolumeSize is the apparent size of all files in the volume when it was backed up, sparse
+	// files counted at their full length; 0 if it was not measured
+	VolumeSize int64 `json:"volume_size,omitempty"`
+	// VolumeSizes holds the archive size of each volume in a multi-volume snapshot
+	VolumeSizes map[string]int64 `json:"volume_sizes,omitempty"`
+	// MountTypes records whether each source in VolumeName is a named volume ("volume") or a
+	// host path ("bind"); nil when every source is a named volume
+	MountTypes       map[string]string `json:"mount_types,omitempty"`
+	ImageName        string            `json:"image_name,omitempty"`
+	ImageTag         string            `json:"image_tag,omitempty"`
+	Description      string            `json:"description,omitempty"`
+	Version          string            `json:"version,omitempty"`
+	Encrypted        bool              `json:"encrypted,omitempty"`
+	Checksum         string            `json:"checksum,omitempty"`
+	FileCount        int64             `json:"file_count,omitempty"`
+	UncompressedSize int64             `json:"uncompressed_size,omitempty"`
+	ContentChecksum  string            `json:"content_checksum,omitempty"`
+	// SourceTime is when the volume's files started being read for the backup
+	SourceTime *time.Time `json:"source_time,omitempty"`
+	// Options records how the archive was produced; nil for backups made before it was recorded
+	Options *BackupOptions `json:"options,omitempty"`
+	// Parent is the ID of the version an incremental backup holds the changes since; restoring
+	// it replays the parent chain first. Empty for full backups.
+	Parent string `json:"parent,omitempty"`
+	// Tags are user supplied key/value pairs used to describe and filter snapshots
+	Tags map[string]string `json:"tags,omitempty"`
+	// Container describes the container the backed up volumes were discovered from
+	Container *ContainerInfo `json:"container,omitempty"`
+	Sealed    string         `json:"sealed,omitempty"`
+}
+
+// ContainerInfo records a container whose volumes were backed up, so it could be recreated
+type ContainerInfo struct {
+	Name  string `json:"name"`
+	ID    string `json:"id"`
+	Image string `json:"image,omitempty"`
+	// Mounts maps each backed up volume to the path it is mounted at in the container
+	Mounts map[string]string `json:"mounts"`
+	// Config is the container's Docker config as returned by the engine
+	Config json.RawMessage `json:"config,omitempty"`
 }
 
 type Backend interface {
 	Store(ctx context.Context, backup *Backup) error
 	Retrieve(ctx context.Context, id string) (*Backup, error)
 	List(ctx context.Context) ([]BackupMetadata, error)
+	// ListPrefix lists only the backups whose ID starts with prefix
+	ListPrefix(ctx context.Context, prefix string) ([]BackupMetadata, error)
 	Delete(ctx context.Context, id string) error
 	Exists(ctx context.Context, id string) (bool, error)
 }
 
+// ObjectInfo describes a stored backup data object
+type ObjectInfo struct {
+	// Key is the key the data object is stored under
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// MetadataBackend is implemented by backends that can access a backup's data and
+// metadata objects independently, e.g. to recover from corrupted metadata
+type MetadataBackend interface {
+	StatData(ctx context.Context, id string) (*ObjectInfo, error)
+	OpenData(ctx context.Context, id string) (io.ReadCloser, error)
+	PutMetadata(ctx context.Context, id string, metadata BackupMetadata) error
+	// RawMetadata returns the stored metadata object exactly as written
+	RawMetadata(ctx context.Context, id string) ([]byte, error)
+}
+
+// BackupCopier is implemented by backends that can copy a stored backup to a new ID without
+// downloading it, e.g. with a server-side copy
+type BackupCopier interface {
+	// CopyBackup copies the data object of srcID to dstID and stores metadata as its metadata
+	CopyBackup(ctx context.Context, srcID, dstID string, metadata BackupMetadata) error
+}
+
+// ResumableUpload tracks an upload that can be resumed after it failed or was interrupted
+type ResumableUpload struct {
+	// ID is the versioned snapshot ID the upload stores
+	ID string `json:"id"`
+	// UploadID identifies the backend's upload in progress, empty if the backend cannot
+	// continue an upload started by another process
+	UploadID string `json:"upload_id,omitempty"`
+	// PartSize is the size of the parts the data is uploaded in; a resumed upload must
+	// deliver the same data in the same parts
+	PartSize int64 `json:"part_size,omitempty"`
+	// Started is called once the backend started the upload and set UploadID and PartSize
+	Started func(upload *ResumableUpload) error `json:"-"`
+}
+
+// ResumableBackend is implemented by backends that can store a backup with an upload which
+// is kept when it fails, so a later attempt uploading the same data can resume it
+type ResumableBackend interface {
+	// StoreResumable stores the backup, resuming upload if it has an UploadID
+	StoreResumable(ctx context.Context, backup *Backup, upload *ResumableUpload) error
+}
+
+// MaxSignedURLExpiry is the longest validity of a signed URL accepted by S3 and GCS
+const MaxSignedURLExpiry = 7 * 24 * time.Hour
+
+// SharableBackend is implemented by backends that can sign a URL granting time-limited read
+// access to a backup's data object without credentials
+type SharableBackend interface {
+	SignedURL(ctx context.Context, id string, expiry time.Duration) (string, error)
+}
+
+// DefaultReadConcurrency is the default number of parallel metadata reads when listing
+const DefaultReadConcurrency = 16
+
 // RepositoryBackend extends Backend with repository-aware operations
 type RepositoryBackend interface {
 	Backend
@@ -45,8 +150,10 @@ type RepositoryBackend interface {
 	GetLatestBackup(ctx context.Context, containerName string) (*Backup, error)
 	ListContainers(ctx context.Context) ([]string, error)
 	ListBackups(ctx context.Context, containerName string) ([]*BackupReference, error)
+	ListBackupsSince(ctx context.Context, containerName string, sinceVersion int, since time.Time) ([]*BackupReference, error)
 	GetContainerHistory(ctx context.Context, containerName string) (*ContainerHistory, error)
 	DeleteBackup(ctx context.Context, containerName string, version int) error
+	CompactIndex(ctx context.Context) (int, error)
 	GetRepositoryStats(ctx context.Context) (*RepositoryStats, error)
 }
 
@@ -65,6 +172,14 @@ type GCSConfig struct {
 	Bucket      string
 	ProjectID   string
 	Credentials string
+	// Impersonate is the service account to impersonate with the base credentials
+	Impersonate string
+	// AccessToken is an OAuth2 access token used instead of Application Default Credentials
+	AccessToken string
+	// ReadConcurrency is the number of metadata objects read in parallel when listing
+	ReadConcurrency int
+	// ChunkSize is the size of the chunks backups are uploaded in (0 for DefaultGCSChunkSize)
+	ChunkSize int
 }
 
 type S3Config struct {
@@ -73,4 +188,14 @@ type S3Config struct {
 	Endpoint  string
 	AccessKey string
 	SecretKey string
+	// SessionToken accompanies temporary access keys
+	SessionToken string
+	// ReadConcurrency is the number of metadata objects read in parallel when listing
+	ReadConcurrency int
+	// CreateBucket creates the bucket if it does not exist yet, e.g. on a fresh MinIO server
+	CreateBucket bool
+	// PartSize is the size of the parts backups are uploaded in (0 for DefaultS3PartSize)
+	PartSize int64
+	// UploadConcurrency is the number of parts uploaded in parallel
+	UploadConcurrency int
 }
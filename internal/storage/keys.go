@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// metadataSuffix is appended to a backup ID to form the key of its metadata object
+const metadataSuffix = ".json"
+
+// metadataKey returns the key of a backup's metadata object
+func metadataKey(id string) string {
+	return id + metadataSuffix
+}
+
+// dataSuffix returns the suffix of a data object produced with the given archive options,
+// e.g. ".tar.gz" for a gzip-compressed tar
+func dataSuffix(options BackupOptions) string {
+	format := options.Format
+	if format == "" {
+		format = FormatTar
+	}
+
+	switch options.Compression {
+	case CompressionGzip:
+		return "." + format + ".gz"
+	case CompressionZstd:
+		return "." + format + ".zst"
+	case "", CompressionNone:
+		return "." + format
+	default:
+		return "." + format + "." + options.Compression
+	}
+}
+
+// dataKey returns the key of a backup's data object, derived from the archive options in
+// its metadata
+func dataKey(id string, metadata BackupMetadata) string {
+	return id + dataSuffix(metadata.ArchiveOptions())
+}
+
+// dataLayouts returns the archive options a data object may have been produced with, in the
+// order their keys are probed when the metadata cannot tell
+func dataLayouts() []BackupOptions {
+	var layouts []BackupOptions
+	for _, compression := range []string{CompressionGzip, CompressionZstd, CompressionNone} {
+		options := DefaultBackupOptions()
+		options.Compression = compression
+		layouts = append(layouts, options)
+	}
+	return layouts
+}
+
+// dataKeyOptions returns the archive options of a data object of id stored under key, or
+// false if the key has none of the known data suffixes
+func dataKeyOptions(id, key string) (BackupOptions, bool) {
+	for _, options := range dataLayouts() {
+		if key == id+dataSuffix(options) {
+			return options, true
+		}
+	}
+	return BackupOptions{}, false
+}
+
+// resolveDataKey returns the key of a stored backup's data object for callers that only know
+// the ID. The metadata is read to find the archive options; when it cannot be read or decoded,
+// e.g. while repairing corrupted metadata, the keys of the known data layouts are probed with
+// dataExists, falling back to the key of the default options if none exists.
+func resolveDataKey(ctx context.Context, id string, rawMetadata func(context.Context, string) ([]byte, error), dataExists func(context.Context, string) bool) string {
+	if data, err := rawMetadata(ctx, id); err == nil {
+		var metadata BackupMetadata
+		if err := json.Unmarshal(data, &metadata); err == nil {
+			return dataKey(id, metadata)
+		}
+	}
+
+	for _, options := range dataLayouts() {
+		if key := id + dataSuffix(options); dataExists(ctx, key) {
+			return key
+		}
+	}
+	return id + dataSuffix(DefaultBackupOptions())
+}
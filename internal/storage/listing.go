@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors returned by metadata readers to tell readMetadataObjects how to handle a failed read
+var (
+	// errCorruptMetadata marks a metadata object that was read but could not be decoded
+	errCorruptMetadata = errors.New("corrupt metadata")
+	// errMetadataGone marks a metadata object deleted between listing and reading it
+	errMetadataGone = errors.New("metadata object no longer exists")
+	// errThrottled marks a read rejected by the provider's rate limiting
+	errThrottled = errors.New("request throttled")
+)
+
+const (
+	// throttleRetries is how many times a throttled metadata read is retried
+	throttleRetries = 5
+	// transientRetries is how many times a metadata read failing for another reason is retried
+	transientRetries = 2
+	// throttleBaseDelay is the delay before the first retry, doubled on each further retry
+	throttleBaseDelay = 200 * time.Millisecond
+)
+
+// readMetadataObjects reads the metadata objects with the given keys using up to concurrency
+// parallel reads; the order of keys is kept. Failed reads are retried with exponential backoff.
+// Corrupt objects and objects deleted since listing are skipped, but reads that still fail
+// fail the listing with a summary of the unreadable objects rather than silently leaving
+// backups out.
+func readMetadataObjects(ctx context.Context, keys []string, concurrency int, read func(ctx context.Context, key string) (*BackupMetadata, error)) ([]BackupMetadata, error) {
+	if concurrency < 1 {
+		concurrency = DefaultReadConcurrency
+	}
+
+	results := make([]*BackupMetadata, len(keys))
+	errs := make([]error, len(keys))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, key := range keys {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, key string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			metadata, err := readWithBackoff(ctx, key, read)
+			switch {
+			case err == nil:
+				results[i] = metadata
+			case errors.Is(err, errCorruptMetadata):
+				Warnf("skipping unreadable metadata %s: %v", key, err)
+			case errors.Is(err, errMetadataGone):
+			default:
+				errs[i] = fmt.Errorf("%s: %w", key, err)
+			}
+		}(i, key)
+	}
+	wg.Wait()
+
+	var backups []BackupMetadata
+	for _, metadata := range results {
+		if metadata != nil && !metadata.IsInternal() {
+			backups = append(backups, *metadata)
+		}
+	}
+
+	var failures []string
+	for _, err := range errs {
+		if err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return nil, fmt.Errorf("listed %d backups, %d unreadable (retry the command; no backups were removed): %s", len(backups), len(failures), strings.Join(failures, "; "))
+	}
+
+	return backups, nil
+}
+
+// readWithBackoff reads a metadata object, retrying failed reads with exponential backoff and
+// jitter. Throttled reads are retried more often than other failures; corrupt and deleted
+// objects are not retried.
+func readWithBackoff(ctx context.Context, key string, read func(ctx context.Context, key string) (*BackupMetadata, error)) (*BackupMetadata, error) {
+	delay := throttleBaseDelay
+	for attempt := 0; ; attempt++ {
+		metadata, err := read(ctx, key)
+		if err == nil || errors.Is(err, errCorruptMetadata) || errors.Is(err, errMetadataGone) || ctx.Err() != nil {
+			return metadata, err
+		}
+
+		retries := transientRetries
+		if errors.Is(err, errThrottled) {
+			retries = throttleRetries
+		}
+		if attempt >= retries {
+			return nil, err
+		}
+
+		// #nosec G404 - jitter does not need a secure random source
+		wait := delay + time.Duration(rand.Int63n(int64(delay)))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+}
+
+// internalPrefix is the ID prefix of dvom's own bookkeeping objects, such as the repository index
+const internalPrefix = ".dvom/"
+
+// indexType is the metadata type of the repository index
+const indexType = "index"
+
+// IsInternal reports whether the metadata describes one of dvom's own bookkeeping objects
+// rather than a backup. Internal objects are left out of every listing.
+func (m BackupMetadata) IsInternal() bool {
+	return strings.HasPrefix(m.ID, internalPrefix) || m.Type == indexType
+}
+
+// isMetadataKey reports whether an object key refers to a backup metadata object
+func isMetadataKey(key string) bool {
+	return len(key) > 5 && strings.HasSuffix(key, metadataSuffix) && !strings.HasPrefix(key, internalPrefix)
+}
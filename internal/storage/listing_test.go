@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// metadataReader returns a read function serving the metadata of the given keys after latency,
+// standing in for a bucket that answers every GET after a round trip
+func metadataReader(latency time.Duration, corrupt map[string]bool) func(ctx context.Context, key string) (*BackupMetadata, error) {
+	return func(ctx context.Context, key string) (*BackupMetadata, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(latency):
+		}
+		if corrupt[key] {
+			return nil, fmt.Errorf("%w: unexpected end of JSON input", errCorruptMetadata)
+		}
+		return &BackupMetadata{ID: key}, nil
+	}
+}
+
+// metadataKeys returns n metadata object keys
+func metadataKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("backup-%03d@1%s", i, metadataSuffix)
+	}
+	return keys
+}
+
+func TestReadMetadataObjectsKeepsOrderAndSkipsCorrupt(t *testing.T) {
+	keys := metadataKeys(50)
+	corrupt := map[string]bool{keys[3]: true, keys[40]: true}
+
+	backups, err := readMetadataObjects(context.Background(), keys, DefaultReadConcurrency, metadataReader(time.Millisecond, corrupt))
+	if err != nil {
+		t.Fatalf("readMetadataObjects() error = %v", err)
+	}
+	if len(backups) != len(keys)-len(corrupt) {
+		t.Fatalf("readMetadataObjects() returned %d backups, want %d", len(backups), len(keys)-len(corrupt))
+	}
+
+	i := 0
+	for _, key := range keys {
+		if corrupt[key] {
+			continue
+		}
+		if backups[i].ID != key {
+			t.Errorf("backup %d is %s, want %s", i, backups[i].ID, key)
+		}
+		i++
+	}
+}
+
+// BenchmarkReadMetadataObjects compares reading the metadata of a bucket with many backups one
+// object at a time against the default worker pool, with a simulated 2ms round trip per object
+func BenchmarkReadMetadataObjects(b *testing.B) {
+	keys := metadataKeys(200)
+	read := metadataReader(2*time.Millisecond, nil)
+
+	for _, concurrency := range []int{1, DefaultReadConcurrency} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := readMetadataObjects(context.Background(), keys, concurrency, read); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 type LocalStorage struct {
@@ -28,44 +29,50 @@ func NewLocalStorage(config *LocalConfig) (*LocalStorage, error) {
 }
 
 func (l *LocalStorage) Store(ctx context.Context, backup *Backup) error {
-	backupPath := filepath.Join(l.basePath, backup.ID)
+	dataPath := filepath.Join(l.basePath, dataKey(backup.ID, backup.Metadata))
+	metadataPath := filepath.Join(l.basePath, metadataKey(backup.ID))
 
-	dataFile, err := os.Create(backupPath + ".tar.gz") // #nosec G304 - controlled backup storage path
+	// IDs may contain directories (e.g. repository paths)
+	if err := os.MkdirAll(filepath.Dir(dataPath), 0750); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	dataFile, err := os.Create(dataPath) // #nosec G304 - controlled backup storage path
 	if err != nil {
 		return fmt.Errorf("failed to create backup file: %w", err)
 	}
 	defer func() {
 		if err := dataFile.Close(); err != nil {
-			fmt.Printf("Warning: failed to close data file: %v\n", err)
+			Warnf("failed to close data file: %v", err)
 		}
 	}()
 
 	if _, err := io.Copy(dataFile, backup.DataReader); err != nil {
-		if removeErr := os.Remove(backupPath + ".tar.gz"); removeErr != nil {
-			fmt.Printf("Warning: failed to remove backup file: %v\n", removeErr)
+		if removeErr := os.Remove(dataPath); removeErr != nil {
+			Warnf("failed to remove backup file: %v", removeErr)
 		}
 		return fmt.Errorf("failed to write backup data: %w", err)
 	}
 
-	metadataFile, err := os.Create(backupPath + ".json") // #nosec G304 - controlled backup storage path
+	metadataFile, err := os.Create(metadataPath) // #nosec G304 - controlled backup storage path
 	if err != nil {
-		if removeErr := os.Remove(backupPath + ".tar.gz"); removeErr != nil {
-			fmt.Printf("Warning: failed to remove backup file: %v\n", removeErr)
+		if removeErr := os.Remove(dataPath); removeErr != nil {
+			Warnf("failed to remove backup file: %v", removeErr)
 		}
 		return fmt.Errorf("failed to create metadata file: %w", err)
 	}
 	defer func() {
 		if err := metadataFile.Close(); err != nil {
-			fmt.Printf("Warning: failed to close metadata file: %v\n", err)
+			Warnf("failed to close metadata file: %v", err)
 		}
 	}()
 
 	if err := json.NewEncoder(metadataFile).Encode(backup.Metadata); err != nil {
-		if removeErr := os.Remove(backupPath + ".tar.gz"); removeErr != nil {
-			fmt.Printf("Warning: failed to remove backup file: %v\n", removeErr)
+		if removeErr := os.Remove(dataPath); removeErr != nil {
+			Warnf("failed to remove backup file: %v", removeErr)
 		}
-		if removeErr := os.Remove(backupPath + ".json"); removeErr != nil {
-			fmt.Printf("Warning: failed to remove metadata file: %v\n", removeErr)
+		if removeErr := os.Remove(metadataPath); removeErr != nil {
+			Warnf("failed to remove metadata file: %v", removeErr)
 		}
 		return fmt.Errorf("failed to write metadata: %w", err)
 	}
@@ -74,18 +81,16 @@ func (l *LocalStorage) Store(ctx context.Context, backup *Backup) error {
 }
 
 func (l *LocalStorage) Retrieve(ctx context.Context, id string) (*Backup, error) {
-	backupPath := filepath.Join(l.basePath, id)
-
-	metadataFile, err := os.Open(backupPath + ".json") // #nosec G304 - controlled backup storage path
+	metadataFile, err := os.Open(filepath.Join(l.basePath, metadataKey(id))) // #nosec G304 - controlled backup storage path
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("backup not found: %s", id)
+			return nil, fmt.Errorf("backup %w: %s", ErrNotFound, id)
 		}
 		return nil, fmt.Errorf("failed to open metadata file: %w", err)
 	}
 	defer func() {
 		if err := metadataFile.Close(); err != nil {
-			fmt.Printf("Warning: failed to close metadata file: %v\n", err)
+			Warnf("failed to close metadata file: %v", err)
 		}
 	}()
 
@@ -94,7 +99,7 @@ func (l *LocalStorage) Retrieve(ctx context.Context, id string) (*Backup, error)
 		return nil, fmt.Errorf("failed to decode metadata: %w", err)
 	}
 
-	dataFile, err := os.Open(backupPath + ".tar.gz") // #nosec G304 - controlled backup storage path
+	dataFile, err := os.Open(filepath.Join(l.basePath, dataKey(id, metadata))) // #nosec G304 - controlled backup storage path
 	if err != nil {
 		return nil, fmt.Errorf("failed to open backup file: %w", err)
 	}
@@ -107,6 +112,12 @@ func (l *LocalStorage) Retrieve(ctx context.Context, id string) (*Backup, error)
 }
 
 func (l *LocalStorage) List(ctx context.Context) ([]BackupMetadata, error) {
+	return l.ListPrefix(ctx, "")
+}
+
+// ListPrefix lists the backups whose ID starts with prefix, filtering on file names so
+// that only matching metadata files are read
+func (l *LocalStorage) ListPrefix(ctx context.Context, prefix string) ([]BackupMetadata, error) {
 	entries, err := os.ReadDir(l.basePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read backup directory: %w", err)
@@ -114,26 +125,33 @@ func (l *LocalStorage) List(ctx context.Context) ([]BackupMetadata, error) {
 
 	var backups []BackupMetadata
 	for _, entry := range entries {
-		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".json" {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == metadataSuffix && strings.HasPrefix(entry.Name(), prefix) {
 			metadataPath := filepath.Join(l.basePath, entry.Name())
 
 			metadataFile, err := os.Open(metadataPath) // #nosec G304 - controlled backup storage path
 			if err != nil {
-				continue
+				// Deleted since the directory was read
+				if os.IsNotExist(err) {
+					continue
+				}
+				return nil, fmt.Errorf("failed to open metadata file %s: %w", entry.Name(), err)
 			}
 
 			var metadata BackupMetadata
 			if err := json.NewDecoder(metadataFile).Decode(&metadata); err != nil {
 				if closeErr := metadataFile.Close(); closeErr != nil {
-					fmt.Printf("Warning: failed to close metadata file: %v\n", closeErr)
+					Warnf("failed to close metadata file: %v", closeErr)
 				}
+				Warnf("skipping unreadable metadata %s: %v", entry.Name(), err)
 				continue
 			}
 			if err := metadataFile.Close(); err != nil {
-				fmt.Printf("Warning: failed to close metadata file: %v\n", err)
+				Warnf("failed to close metadata file: %v", err)
 			}
 
-			backups = append(backups, metadata)
+			if !metadata.IsInternal() {
+				backups = append(backups, metadata)
+			}
 		}
 	}
 
@@ -141,13 +159,11 @@ func (l *LocalStorage) List(ctx context.Context) ([]BackupMetadata, error) {
 }
 
 func (l *LocalStorage) Delete(ctx context.Context, id string) error {
-	backupPath := filepath.Join(l.basePath, id)
-
-	if err := os.Remove(backupPath + ".tar.gz"); err != nil && !os.IsNotExist(err) {
+	if err := os.Remove(filepath.Join(l.basePath, resolveDataKey(ctx, id, l.RawMetadata, l.dataExists))); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to remove backup file: %w", err)
 	}
 
-	if err := os.Remove(backupPath + ".json"); err != nil && !os.IsNotExist(err) {
+	if err := os.Remove(filepath.Join(l.basePath, metadataKey(id))); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to remove metadata file: %w", err)
 	}
 
@@ -155,9 +171,7 @@ func (l *LocalStorage) Delete(ctx context.Context, id string) error {
 }
 
 func (l *LocalStorage) Exists(ctx context.Context, id string) (bool, error) {
-	backupPath := filepath.Join(l.basePath, id)
-
-	if _, err := os.Stat(backupPath + ".json"); err != nil {
+	if _, err := os.Stat(filepath.Join(l.basePath, metadataKey(id))); err != nil {
 		if os.IsNotExist(err) {
 			return false, nil
 		}
@@ -166,3 +180,118 @@ func (l *LocalStorage) Exists(ctx context.Context, id string) (bool, error) {
 
 	return true, nil
 }
+
+// dataExists reports whether a data object is stored under key
+func (l *LocalStorage) dataExists(ctx context.Context, key string) bool {
+	_, err := os.Stat(filepath.Join(l.basePath, key))
+	return err == nil
+}
+
+func (l *LocalStorage) StatData(ctx context.Context, id string) (*ObjectInfo, error) {
+	key := resolveDataKey(ctx, id, l.RawMetadata, l.dataExists)
+	stat, err := os.Stat(filepath.Join(l.basePath, key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("backup data %w: %s", ErrNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to stat backup file: %w", err)
+	}
+
+	return &ObjectInfo{
+		Key:     key,
+		Size:    stat.Size(),
+		ModTime: stat.ModTime(),
+	}, nil
+}
+
+func (l *LocalStorage) OpenData(ctx context.Context, id string) (io.ReadCloser, error) {
+	dataFile, err := os.Open(filepath.Join(l.basePath, resolveDataKey(ctx, id, l.RawMetadata, l.dataExists))) // #nosec G304 - controlled backup storage path
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup file: %w", err)
+	}
+	return dataFile, nil
+}
+
+func (l *LocalStorage) RawMetadata(ctx context.Context, id string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(l.basePath, metadataKey(id))) // #nosec G304 - controlled backup storage path
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("backup metadata %w: %s", ErrNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to read metadata file: %w", err)
+	}
+	return data, nil
+}
+
+func (l *LocalStorage) PutMetadata(ctx context.Context, id string, metadata BackupMetadata) error {
+	metadataFile, err := os.Create(filepath.Join(l.basePath, metadataKey(id))) // #nosec G304 - controlled backup storage path
+	if err != nil {
+		return fmt.Errorf("failed to create metadata file: %w", err)
+	}
+	defer func() {
+		if err := metadataFile.Close(); err != nil {
+			Warnf("failed to close metadata file: %v", err)
+		}
+	}()
+
+	if err := json.NewEncoder(metadataFile).Encode(metadata); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+
+	return nil
+}
+
+// CopyBackup hard links the data file of srcID to dstID, falling back to copying it when the
+// file system does not support hard links, and writes the metadata of dstID
+func (l *LocalStorage) CopyBackup(ctx context.Context, srcID, dstID string, metadata BackupMetadata) error {
+	srcPath := filepath.Join(l.basePath, resolveDataKey(ctx, srcID, l.RawMetadata, l.dataExists))
+	dstPath := filepath.Join(l.basePath, dataKey(dstID, metadata))
+
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0750); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	if err := os.Link(srcPath, dstPath); err != nil {
+		if err := copyFile(srcPath, dstPath); err != nil {
+			return err
+		}
+	}
+
+	if err := l.PutMetadata(ctx, dstID, metadata); err != nil {
+		if removeErr := os.Remove(dstPath); removeErr != nil {
+			Warnf("failed to remove backup file: %v", removeErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// copyFile copies the file at srcPath to a new file at dstPath
+func copyFile(srcPath, dstPath string) error {
+	src, err := os.Open(srcPath) // #nosec G304 - controlled backup storage path
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			Warnf("failed to close backup file: %v", err)
+		}
+	}()
+
+	dst, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600) // #nosec G304 - controlled backup storage path
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		if closeErr := dst.Close(); closeErr != nil {
+			Warnf("failed to close backup file: %v", closeErr)
+		}
+		if removeErr := os.Remove(dstPath); removeErr != nil {
+			Warnf("failed to remove backup file: %v", removeErr)
+		}
+		return fmt.Errorf("failed to copy backup data: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("failed to close backup file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestLocalStorage returns a LocalStorage in a temporary directory
+func newTestLocalStorage(t *testing.T) (*LocalStorage, string) {
+	t.Helper()
+	dir := t.TempDir()
+	local, err := NewLocalStorage(&LocalConfig{BasePath: dir})
+	if err != nil {
+		t.Fatalf("NewLocalStorage() error = %v", err)
+	}
+	return local, dir
+}
+
+func TestRepairAndDeleteWithCorruptMetadata(t *testing.T) {
+	for _, compression := range []string{CompressionZstd, CompressionNone} {
+		t.Run(compression, func(t *testing.T) {
+			ctx := context.Background()
+			local, dir := newTestLocalStorage(t)
+			snapshots := NewSnapshotStorage(local)
+
+			id := VersionedID("db", "20250101-120000")
+			options := DefaultBackupOptions()
+			options.Compression = compression
+			data := []byte("archive data")
+			err := local.Store(ctx, &Backup{
+				ID:         id,
+				Metadata:   BackupMetadata{ID: id, Name: "db", Version: "20250101-120000", Size: int64(len(data)), CreatedAt: time.Now(), Options: &options},
+				DataReader: bytes.NewReader(data),
+			})
+			if err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+			dataPath := filepath.Join(dir, id+dataSuffix(options))
+			if err := os.WriteFile(filepath.Join(dir, metadataKey(id)), []byte("{not json"), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			repaired, err := snapshots.RepairSnapshot(ctx, id)
+			if err != nil {
+				t.Fatalf("RepairSnapshot() error = %v", err)
+			}
+			if repaired.Size != int64(len(data)) {
+				t.Errorf("repaired size = %d, want %d", repaired.Size, len(data))
+			}
+			if repaired.Options == nil || repaired.Options.Compression != compression {
+				t.Errorf("repaired options = %+v, want compression %s", repaired.Options, compression)
+			}
+
+			stored, err := local.Retrieve(ctx, id)
+			if err != nil {
+				t.Fatalf("Retrieve() after repair error = %v", err)
+			}
+			if closer, ok := stored.DataReader.(io.Closer); ok {
+				_ = closer.Close()
+			}
+
+			// Corrupt the repaired metadata again; delete must still find the data object
+			if err := os.WriteFile(filepath.Join(dir, metadataKey(id)), []byte("{not json"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := local.Delete(ctx, id); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if _, err := os.Stat(dataPath); !os.IsNotExist(err) {
+				t.Errorf("data object %s left behind after Delete (stat error %v)", dataPath, err)
+			}
+		})
+	}
+}
+
+func TestListingsLeaveOutTheRepositoryIndex(t *testing.T) {
+	ctx := context.Background()
+	local, _ := newTestLocalStorage(t)
+
+	id := VersionedID("db", "20250101-120000")
+	stored := []BackupMetadata{
+		{ID: id, Name: "db", Version: "20250101-120000", CreatedAt: time.Now()},
+		// The index as saved by the repository
+		{ID: repositoryIndexID, Name: "repository-index", Type: indexType, CreatedAt: time.Now()},
+		// An index stored outside .dvom/ is recognised by its type
+		{ID: "index@20250101-120000", Name: "repository-index", Type: indexType, CreatedAt: time.Now()},
+	}
+	for _, metadata := range stored {
+		err := local.Store(ctx, &Backup{ID: metadata.ID, Metadata: metadata, DataReader: bytes.NewReader([]byte("{}"))})
+		if err != nil {
+			t.Fatalf("Store(%s) error = %v", metadata.ID, err)
+		}
+	}
+
+	listings := map[string]func() ([]BackupMetadata, error){
+		"List":                 func() ([]BackupMetadata, error) { return local.List(ctx) },
+		"ListPrefix all":       func() ([]BackupMetadata, error) { return local.ListPrefix(ctx, "") },
+		"ListPrefix internal":  func() ([]BackupMetadata, error) { return local.ListPrefix(ctx, internalPrefix) },
+		"ListPrefix versioned": func() ([]BackupMetadata, error) { return local.ListPrefix(ctx, "index@") },
+	}
+	for name, list := range listings {
+		backups, err := list()
+		if err != nil {
+			t.Fatalf("%s error = %v", name, err)
+		}
+		for _, backup := range backups {
+			if backup.ID != id {
+				t.Errorf("%s listed %s", name, backup.ID)
+			}
+		}
+	}
+
+	snapshots, err := NewSnapshotStorage(local).ListSnapshots(ctx)
+	if err != nil {
+		t.Fatalf("ListSnapshots() error = %v", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Name != "db" {
+		t.Errorf("ListSnapshots() = %+v, want only db", snapshots)
+	}
+}
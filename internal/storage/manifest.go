@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// manifestPrefix is the ID prefix of the file manifests of snapshot versions. Being internal
+// objects, they are left out of every listing.
+const manifestPrefix = internalPrefix + "manifests/"
+
+// manifestType is the metadata type of a file manifest
+const manifestType = "manifest"
+
+// manifestID returns the storage ID of the file manifest of a snapshot version
+func manifestID(versionedID string) string {
+	return manifestPrefix + versionedID
+}
+
+// PutManifest stores the file manifest of a snapshot version. The data is stored as given, so
+// manifests of encrypted backups must be encrypted by the caller.
+func (s *SnapshotStorage) PutManifest(ctx context.Context, versionedID string, data []byte, encrypted bool) error {
+	id := manifestID(versionedID)
+	return s.backend.Store(ctx, &Backup{
+		ID: id,
+		Metadata: BackupMetadata{
+			ID:        id,
+			Type:      manifestType,
+			Size:      int64(len(data)),
+			CreatedAt: time.Now(),
+			Encrypted: encrypted,
+		},
+		DataReader: bytes.NewReader(data),
+	})
+}
+
+// GetManifest returns the file manifest data of a snapshot version and whether it is
+// encrypted. Versions stored without a manifest return an error wrapping ErrNotFound.
+func (s *SnapshotStorage) GetManifest(ctx context.Context, versionedID string) ([]byte, bool, error) {
+	id := manifestID(versionedID)
+	exists, err := s.backend.Exists(ctx, id)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to check for the file manifest of %s: %w", versionedID, err)
+	}
+	if !exists {
+		return nil, false, fmt.Errorf("file manifest of %s %w", versionedID, ErrNotFound)
+	}
+
+	backup, err := s.backend.Retrieve(ctx, id)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to retrieve the file manifest of %s: %w", versionedID, err)
+	}
+	defer func() {
+		if closer, ok := backup.DataReader.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				Warnf("failed to close manifest reader: %v", err)
+			}
+		}
+	}()
+
+	data, err := io.ReadAll(backup.DataReader)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read the file manifest of %s: %w", versionedID, err)
+	}
+	return data, backup.Metadata.Encrypted, nil
+}
+
+// deleteManifest deletes the file manifest of a snapshot version, if it has one
+func (s *SnapshotStorage) deleteManifest(ctx context.Context, versionedID string) error {
+	id := manifestID(versionedID)
+	exists, err := s.backend.Exists(ctx, id)
+	if err != nil || !exists {
+		return err
+	}
+	return s.backend.Delete(ctx, id)
+}
@@ -0,0 +1,52 @@
+package storage
+
+import "time"
+
+// Archive formats and compressions recorded in BackupOptions
+const (
+	FormatTar       = "tar"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+	CompressionNone = "none"
+)
+
+// BackupOptions records how the archive of a backup was produced, so a restore can reverse
+// it exactly even after the defaults of dvom change
+type BackupOptions struct {
+	// Format is the archive format of the volume data
+	Format string `json:"format"`
+	// Compression is the compression algorithm applied to the archive
+	Compression string `json:"compression"`
+	// CompressionLevel is the compression level, 0 for the algorithm's default
+	CompressionLevel int `json:"compression_level,omitempty"`
+	// Strategy is the snapshot strategy that read the volume (tar, btrfs, zfs)
+	Strategy string `json:"strategy,omitempty"`
+	// PreserveOwnership records that file owners were archived and are restored as stored
+	PreserveOwnership bool `json:"preserve_ownership"`
+	// Excludes lists the patterns of files left out of the archive
+	Excludes []string `json:"excludes,omitempty"`
+	// Sparse records that sparse files were archived as sparse
+	Sparse bool `json:"sparse,omitempty"`
+	// ModifiedSince records that only the files modified after this time were archived, for
+	// an incremental backup
+	ModifiedSince *time.Time `json:"modified_since,omitempty"`
+}
+
+// DefaultBackupOptions returns the options every backup was produced with before options
+// were recorded: a gzip-compressed tar at the default level, with file owners preserved
+func DefaultBackupOptions() BackupOptions {
+	return BackupOptions{
+		Format:            FormatTar,
+		Compression:       CompressionGzip,
+		PreserveOwnership: true,
+	}
+}
+
+// ArchiveOptions returns the options the backup was produced with, falling back to
+// DefaultBackupOptions for backups that do not record them
+func (m BackupMetadata) ArchiveOptions() BackupOptions {
+	if m.Options == nil {
+		return DefaultBackupOptions()
+	}
+	return *m.Options
+}
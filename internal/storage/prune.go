@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// PrunePolicy selects the versions of a snapshot kept by PruneVersions. A version is kept if any
+// keep rule keeps it (all versions when there are none), and MaxVersions then caps the number
+// kept. The versions a kept incremental backup is based on are always kept as well.
+type PrunePolicy struct {
+	// KeepLast keeps the newest N versions
+	KeepLast int
+	// KeepWithin keeps the versions created within this duration of now
+	KeepWithin time.Duration
+	// MaxVersions deletes the oldest versions beyond this count, whatever the keep rules say
+	MaxVersions int
+	// Protect is the ID of a version that is always kept; it still counts towards MaxVersions
+	Protect string
+}
+
+// hasKeepRules reports whether the policy has rules selecting versions to keep
+func (p PrunePolicy) hasKeepRules() bool {
+	return p.KeepLast > 0 || p.KeepWithin > 0
+}
+
+// PruneVersions deletes the versions of a snapshot not kept by the policy and returns them,
+// newest first, together with the number of versions the snapshot had. With dryRun nothing is
+// deleted.
+func (s *SnapshotStorage) PruneVersions(ctx context.Context, name string, policy PrunePolicy, dryRun bool) ([]VersionInfo, int, error) {
+	versions, err := s.ListVersions(ctx, name)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list versions for pruning: %w", err)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		if !versions[i].CreatedAt.Equal(versions[j].CreatedAt) {
+			return versions[i].CreatedAt.After(versions[j].CreatedAt)
+		}
+		return versions[i].Version > versions[j].Version
+	})
+
+	// Versions are newest first, so the cap keeps the first MaxVersions versions that the keep
+	// rules keep. The protected version counts towards the cap but is never dropped by it.
+	cutoff := time.Now().Add(-policy.KeepWithin)
+	kept := 0
+	needed := make(map[string]bool)
+	var pruned []VersionInfo
+	for i, version := range versions {
+		keep := !policy.hasKeepRules() ||
+			i < policy.KeepLast ||
+			(policy.KeepWithin > 0 && version.CreatedAt.After(cutoff))
+		if keep && policy.MaxVersions > 0 && kept >= policy.MaxVersions {
+			keep = false
+		}
+		// Parents are older than their increments, so they are reached after them
+		if version.ID == policy.Protect || needed[version.ID] {
+			keep = true
+		}
+		if keep {
+			kept++
+			if version.Parent != "" {
+				needed[version.Parent] = true
+			}
+			continue
+		}
+		pruned = append(pruned, version)
+	}
+
+	if dryRun {
+		return pruned, len(versions), nil
+	}
+
+	defer s.invalidate()
+	for i, version := range pruned {
+		if err := s.backend.Delete(ctx, version.ID); err != nil {
+			return pruned[:i], len(versions), fmt.Errorf("failed to prune version %s: %w", version.ID, err)
+		}
+		s.removeManifest(ctx, version.ID)
+	}
+	return pruned, len(versions), nil
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// RenameSnapshot moves every version of a snapshot to a new name, keeping the version
+// timestamps. All versions are copied first, server-side when the backend supports it, and the
+// old ones are only deleted once every copy exists. It returns the new versioned IDs.
+func (s *SnapshotStorage) RenameSnapshot(ctx context.Context, oldName, newName string) ([]string, error) {
+	oldName = cleanSnapshotName(oldName)
+	newName = cleanSnapshotName(newName)
+
+	if newName == "" {
+		return nil, fmt.Errorf("new snapshot name is required")
+	}
+	if strings.Contains(newName, VersionSeparator) || strings.Contains(newName, LegacyVersionSeparator) {
+		return nil, fmt.Errorf("invalid snapshot name %q: must not contain the version separator", newName)
+	}
+	if newName == oldName {
+		return nil, fmt.Errorf("snapshot is already named '%s'", oldName)
+	}
+
+	versions, err := s.ListVersions(ctx, oldName)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("no snapshots %w with name '%s'", ErrNotFound, oldName)
+	}
+	existing, err := s.ListVersions(ctx, newName)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) > 0 {
+		return nil, fmt.Errorf("snapshot '%s' already exists with %d version(s)", newName, len(existing))
+	}
+
+	// Parents before the incremental versions based on them
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version < versions[j].Version
+	})
+
+	defer s.invalidate()
+	renamed := make([]string, 0, len(versions))
+	for _, version := range versions {
+		newID := VersionedID(newName, version.Version)
+		if err := s.copyVersion(ctx, version.ID, newID, oldName, newName); err != nil {
+			// Leave the snapshot as it was
+			for _, id := range renamed {
+				if deleteErr := s.backend.Delete(ctx, id); deleteErr != nil {
+					Warnf("failed to remove copy %s: %v", id, deleteErr)
+				}
+				s.removeManifest(ctx, id)
+			}
+			return nil, fmt.Errorf("failed to copy %s to %s: %w", version.ID, newID, err)
+		}
+		renamed = append(renamed, newID)
+	}
+
+	for _, version := range versions {
+		if err := s.backend.Delete(ctx, version.ID); err != nil {
+			return renamed, fmt.Errorf("copied every version to '%s', but failed to delete %s: %w", newName, version.ID, err)
+		}
+		s.removeManifest(ctx, version.ID)
+	}
+	return renamed, nil
+}
+
+// copyVersion copies a snapshot version and its file manifest to newID, updating the name in
+// its metadata and the parent of an incremental version based on another version of the
+// snapshot. The data is copied server-side by backends implementing BackupCopier and
+// streamed from the backend back into it otherwise.
+func (s *SnapshotStorage) copyVersion(ctx context.Context, oldID, newID, oldName, newName string) error {
+	if err := s.copyData(ctx, oldID, newID, oldName, newName); err != nil {
+		return err
+	}
+
+	data, encrypted, err := s.GetManifest(ctx, oldID)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err == nil {
+		err = s.PutManifest(ctx, newID, data, encrypted)
+	}
+	if err != nil {
+		if deleteErr := s.backend.Delete(ctx, newID); deleteErr != nil {
+			Warnf("failed to remove copy %s: %v", newID, deleteErr)
+		}
+		return fmt.Errorf("failed to copy the file manifest: %w", err)
+	}
+	return nil
+}
+
+// copyData copies the data and metadata of a snapshot version to newID. A server-side copy
+// only needs the metadata, so the data object is only opened to stream it for backends that
+// cannot copy.
+func (s *SnapshotStorage) copyData(ctx context.Context, oldID, newID, oldName, newName string) error {
+	copier, canCopy := s.backend.(BackupCopier)
+	metadataBackend, hasMetadata := s.backend.(MetadataBackend)
+	if canCopy && hasMetadata {
+		raw, err := metadataBackend.RawMetadata(ctx, oldID)
+		if err != nil {
+			return err
+		}
+		var stored BackupMetadata
+		if err := json.Unmarshal(raw, &stored); err != nil {
+			return fmt.Errorf("failed to decode metadata of %s: %w", oldID, err)
+		}
+		metadata, err := s.renamedMetadata(stored, newID, oldName, newName)
+		if err != nil {
+			return err
+		}
+		return copier.CopyBackup(ctx, oldID, newID, metadata)
+	}
+
+	stored, err := s.backend.Retrieve(ctx, oldID)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closer, ok := stored.DataReader.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				Warnf("failed to close backup data reader: %v", err)
+			}
+		}
+	}()
+
+	metadata, err := s.renamedMetadata(stored.Metadata, newID, oldName, newName)
+	if err != nil {
+		return err
+	}
+	return s.backend.Store(ctx, &Backup{ID: newID, Metadata: metadata, DataReader: stored.DataReader})
+}
+
+// renamedMetadata returns the stored metadata of a version moved to newID. Sealed metadata is
+// opened and sealed again, which requires the metadata password.
+func (s *SnapshotStorage) renamedMetadata(stored BackupMetadata, newID, oldName, newName string) (BackupMetadata, error) {
+	metadata := stored
+	if stored.IsSealed() {
+		if s.metadataPassword == "" {
+			return BackupMetadata{}, fmt.Errorf("metadata of %s is encrypted: the password is required to rename it", stored.ID)
+		}
+		opened, err := OpenMetadata(stored, s.metadataPassword)
+		if err != nil {
+			return BackupMetadata{}, err
+		}
+		metadata = opened
+	}
+
+	metadata.ID = newID
+	metadata.Name = newName
+	if parentName, parentVersion, ok := ParseVersionedID(metadata.Parent); ok && parentName == oldName {
+		metadata.Parent = VersionedID(newName, parentVersion)
+	}
+
+	if stored.IsSealed() {
+		return SealMetadata(metadata, s.metadataPassword)
+	}
+	return metadata, nil
+}
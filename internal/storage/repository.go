@@ -16,6 +16,9 @@ type Repository struct {
 	config  *Config
 }
 
+// repositoryIndexID is the storage ID of the repository index
+const repositoryIndexID = internalPrefix + "index.json"
+
 // Ensure Repository implements RepositoryBackend interface
 var _ RepositoryBackend = (*Repository)(nil)
 
@@ -29,12 +32,13 @@ type RepositoryIndex struct {
 
 // ContainerHistory tracks backup history for a container
 type ContainerHistory struct {
-	Name      string             `json:"name"`
-	ID        string             `json:"id"`
-	Backups   []*BackupReference `json:"backups"`
-	LatestID  string             `json:"latest_id"`
-	CreatedAt time.Time          `json:"created_at"`
-	UpdatedAt time.Time          `json:"updated_at"`
+	Name        string             `json:"name"`
+	ID          string             `json:"id"`
+	Backups     []*BackupReference `json:"backups"`
+	LatestID    string             `json:"latest_id"`
+	NextVersion int                `json:"next_version,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
 }
 
 // BackupReference points to a backup with metadata
@@ -46,6 +50,46 @@ type BackupReference struct {
 	VolumeCount int               `json:"volume_count"`
 	Tags        map[string]string `json:"tags,omitempty"`
 	Description string            `json:"description,omitempty"`
+	Deleted     bool              `json:"deleted,omitempty"`
+	DeletedAt   *time.Time        `json:"deleted_at,omitempty"`
+}
+
+// nextVersion returns the version number to assign to the next backup.
+// Version numbers are never reused, even after deletions or index compaction.
+func (h *ContainerHistory) nextVersion() int {
+	if h.NextVersion > 0 {
+		return h.NextVersion
+	}
+
+	// Older indexes don't track the next version, derive it from the history
+	next := 1
+	for _, backupRef := range h.Backups {
+		if backupRef.Version >= next {
+			next = backupRef.Version + 1
+		}
+	}
+	return next
+}
+
+// findBackup returns the live backup reference with the given version
+func (h *ContainerHistory) findBackup(version int) *BackupReference {
+	for _, backupRef := range h.Backups {
+		if backupRef.Version == version && !backupRef.Deleted {
+			return backupRef
+		}
+	}
+	return nil
+}
+
+// activeBackups returns the backup references that have not been deleted
+func (h *ContainerHistory) activeBackups() []*BackupReference {
+	active := []*BackupReference{}
+	for _, backupRef := range h.Backups {
+		if !backupRef.Deleted {
+			active = append(active, backupRef)
+		}
+	}
+	return active
 }
 
 // NewRepository creates a repository-aware storage layer
@@ -68,28 +112,36 @@ func (r *Repository) initialize() error {
 	ctx := context.Background()
 
 	// Check if repository index exists
-	exists, err := r.backend.Exists(ctx, ".dvom/index.json")
+	exists, err := r.backend.Exists(ctx, repositoryIndexID)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to check for repository index: %w", err)
 	}
 
 	if !exists {
-		// Create initial repository index
-		index := &RepositoryIndex{
-			Version:    "1.0",
-			CreatedAt:  time.Now(),
-			UpdatedAt:  time.Now(),
-			Containers: make(map[string]*ContainerHistory),
-		}
-
-		if err := r.saveIndex(ctx, index); err != nil {
-			return fmt.Errorf("failed to create repository index: %w", err)
+		if _, err := r.createIndex(ctx); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
+// createIndex creates and saves an empty repository index
+func (r *Repository) createIndex(ctx context.Context) (*RepositoryIndex, error) {
+	index := &RepositoryIndex{
+		Version:    "1.0",
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+		Containers: make(map[string]*ContainerHistory),
+	}
+
+	if err := r.saveIndex(ctx, index); err != nil {
+		return nil, fmt.Errorf("failed to create repository index: %w", err)
+	}
+
+	return index, nil
+}
+
 // StoreBackup stores a backup in repository structure
 func (r *Repository) StoreBackup(ctx context.Context, backup *Backup, tags map[string]string, description string) error {
 	// Load current index
@@ -116,7 +168,7 @@ func (r *Repository) StoreBackup(ctx context.Context, backup *Backup, tags map[s
 	}
 
 	// Generate version number
-	version := len(containerHistory.Backups) + 1
+	version := containerHistory.nextVersion()
 
 	// Create backup path: containers/{name}/v{version}/
 	backupPath := fmt.Sprintf("containers/%s/v%d/%s", containerName, version, backup.ID)
@@ -149,6 +201,7 @@ func (r *Repository) StoreBackup(ctx context.Context, backup *Backup, tags map[s
 
 	containerHistory.Backups = append(containerHistory.Backups, backupRef)
 	containerHistory.LatestID = backup.ID
+	containerHistory.NextVersion = version + 1
 	containerHistory.UpdatedAt = time.Now()
 
 	// Update repository index
@@ -172,12 +225,12 @@ func (r *Repository) GetBackup(ctx context.Context, containerName string, versio
 		return nil, fmt.Errorf("container '%s' not found in repository", containerName)
 	}
 
-	if version <= 0 || version > len(containerHistory.Backups) {
+	backupRef := containerHistory.findBackup(version)
+	if backupRef == nil {
 		return nil, fmt.Errorf("version %d not found for container '%s'", version, containerName)
 	}
 
-	backupRef := containerHistory.Backups[version-1]
-	backupPath := fmt.Sprintf("containers/%s/v%d/%s", containerName, version, backupRef.ID)
+	backupPath := fmt.Sprintf("containers/%s/v%d/%s", containerName, backupRef.Version, backupRef.ID)
 
 	return r.backend.Retrieve(ctx, backupPath)
 }
@@ -194,11 +247,12 @@ func (r *Repository) GetLatestBackup(ctx context.Context, containerName string)
 		return nil, fmt.Errorf("container '%s' not found in repository", containerName)
 	}
 
-	if len(containerHistory.Backups) == 0 {
+	activeBackups := containerHistory.activeBackups()
+	if len(activeBackups) == 0 {
 		return nil, fmt.Errorf("no backups found for container '%s'", containerName)
 	}
 
-	latestVersion := len(containerHistory.Backups)
+	latestVersion := activeBackups[len(activeBackups)-1].Version
 	return r.GetBackup(ctx, containerName, latestVersion)
 }
 
@@ -229,7 +283,7 @@ func (r *Repository) ListBackups(ctx context.Context, containerName string) ([]*
 		// Return all backups from all containers
 		var allBackups []*BackupReference
 		for _, containerHistory := range index.Containers {
-			allBackups = append(allBackups, containerHistory.Backups...)
+			allBackups = append(allBackups, containerHistory.activeBackups()...)
 		}
 		return allBackups, nil
 	}
@@ -239,7 +293,34 @@ func (r *Repository) ListBackups(ctx context.Context, containerName string) ([]*
 		return nil, fmt.Errorf("container '%s' not found in repository", containerName)
 	}
 
-	return containerHistory.Backups, nil
+	return containerHistory.activeBackups(), nil
+}
+
+// ListBackupsSince returns the backup references of a container that were added after
+// the given version or, when since is non-zero, created after the given time
+func (r *Repository) ListBackupsSince(ctx context.Context, containerName string, sinceVersion int, since time.Time) ([]*BackupReference, error) {
+	index, err := r.loadIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	containerHistory := index.Containers[containerName]
+	if containerHistory == nil {
+		return nil, fmt.Errorf("container '%s' not found in repository", containerName)
+	}
+
+	newBackups := []*BackupReference{}
+	for _, backupRef := range containerHistory.activeBackups() {
+		if backupRef.Version <= sinceVersion {
+			continue
+		}
+		if !since.IsZero() && !backupRef.CreatedAt.After(since) {
+			continue
+		}
+		newBackups = append(newBackups, backupRef)
+	}
+
+	return newBackups, nil
 }
 
 // GetContainerHistory returns the full history for a container
@@ -269,27 +350,30 @@ func (r *Repository) DeleteBackup(ctx context.Context, containerName string, ver
 		return fmt.Errorf("container '%s' not found in repository", containerName)
 	}
 
-	if version <= 0 || version > len(containerHistory.Backups) {
+	backupRef := containerHistory.findBackup(version)
+	if backupRef == nil {
 		return fmt.Errorf("version %d not found for container '%s'", version, containerName)
 	}
 
-	backupRef := containerHistory.Backups[version-1]
-	backupPath := fmt.Sprintf("containers/%s/v%d/%s", containerName, version, backupRef.ID)
+	backupPath := fmt.Sprintf("containers/%s/v%d/%s", containerName, backupRef.Version, backupRef.ID)
 
 	// Delete from backend storage
 	if err := r.backend.Delete(ctx, backupPath); err != nil {
 		return fmt.Errorf("failed to delete backup from storage: %w", err)
 	}
 
-	// Remove from index (this will shift version numbers - might want to mark as deleted instead)
-	containerHistory.Backups = append(
-		containerHistory.Backups[:version-1],
-		containerHistory.Backups[version:]...,
-	)
+	// Mark as deleted instead of removing so remaining version numbers stay stable
+	deletedAt := time.Now()
+	backupRef.Deleted = true
+	backupRef.DeletedAt = &deletedAt
+	if containerHistory.NextVersion == 0 {
+		containerHistory.NextVersion = containerHistory.nextVersion()
+	}
 
 	// Update latest if needed
-	if len(containerHistory.Backups) > 0 {
-		containerHistory.LatestID = containerHistory.Backups[len(containerHistory.Backups)-1].ID
+	activeBackups := containerHistory.activeBackups()
+	if len(activeBackups) > 0 {
+		containerHistory.LatestID = activeBackups[len(activeBackups)-1].ID
 	} else {
 		containerHistory.LatestID = ""
 	}
@@ -300,28 +384,74 @@ func (r *Repository) DeleteBackup(ctx context.Context, containerName string, ver
 	return r.saveIndex(ctx, index)
 }
 
+// CompactIndex removes the tombstones of deleted backups from the repository index
+// and returns how many were removed. Version numbers of remaining backups are kept.
+func (r *Repository) CompactIndex(ctx context.Context) (int, error) {
+	index, err := r.loadIndex(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, containerHistory := range index.Containers {
+		activeBackups := containerHistory.activeBackups()
+		if len(activeBackups) == len(containerHistory.Backups) {
+			continue
+		}
+
+		// Remember the next version before dropping the tombstones that define it
+		containerHistory.NextVersion = containerHistory.nextVersion()
+		removed += len(containerHistory.Backups) - len(activeBackups)
+		containerHistory.Backups = activeBackups
+		containerHistory.UpdatedAt = time.Now()
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+
+	index.UpdatedAt = time.Now()
+	if err := r.saveIndex(ctx, index); err != nil {
+		return 0, fmt.Errorf("failed to save compacted index: %w", err)
+	}
+
+	return removed, nil
+}
+
 // loadIndex loads the repository index
 func (r *Repository) loadIndex(ctx context.Context) (*RepositoryIndex, error) {
-	backup, err := r.backend.Retrieve(ctx, ".dvom/index.json")
+	// A missing index means a fresh repository, while an unreadable one must not be replaced
+	exists, err := r.backend.Exists(ctx, repositoryIndexID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve repository index: %w", err)
+		return nil, fmt.Errorf("failed to check for repository index: %w", err)
+	}
+	if !exists {
+		return r.createIndex(ctx)
+	}
+
+	backup, err := r.backend.Retrieve(ctx, repositoryIndexID)
+	if err != nil {
+		return nil, fmt.Errorf("repository index %s exists but could not be read: %w", repositoryIndexID, err)
 	}
 
 	data, err := io.ReadAll(backup.DataReader)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read index data: %w", err)
+		return nil, fmt.Errorf("repository index %s exists but could not be read: %w", repositoryIndexID, err)
 	}
 
 	// Close if the reader has a Close method
 	if closer, ok := backup.DataReader.(io.Closer); ok {
 		if err := closer.Close(); err != nil {
-			fmt.Printf("Warning: failed to close data reader: %v\n", err)
+			Warnf("failed to close data reader: %v", err)
 		}
 	}
 
 	var index RepositoryIndex
 	if err := json.Unmarshal(data, &index); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal index: %w", err)
+		return nil, fmt.Errorf("repository index %s is corrupt and was left untouched: %w", repositoryIndexID, err)
+	}
+	if index.Containers == nil {
+		index.Containers = make(map[string]*ContainerHistory)
 	}
 
 	return &index, nil
@@ -335,11 +465,11 @@ func (r *Repository) saveIndex(ctx context.Context, index *RepositoryIndex) erro
 	}
 
 	indexBackup := &Backup{
-		ID: ".dvom/index.json",
+		ID: repositoryIndexID,
 		Metadata: BackupMetadata{
-			ID:        ".dvom/index.json",
+			ID:        repositoryIndexID,
 			Name:      "repository-index",
-			Type:      "index",
+			Type:      indexType,
 			Size:      int64(len(data)),
 			CreatedAt: time.Now(),
 		},
@@ -364,8 +494,9 @@ func (r *Repository) GetRepositoryStats(ctx context.Context) (*RepositoryStats,
 	}
 
 	for _, containerHistory := range index.Containers {
-		stats.BackupCount += len(containerHistory.Backups)
-		for _, backup := range containerHistory.Backups {
+		activeBackups := containerHistory.activeBackups()
+		stats.BackupCount += len(activeBackups)
+		for _, backup := range activeBackups {
 			stats.TotalSize += backup.Size
 		}
 	}
@@ -396,6 +527,10 @@ func (r *Repository) List(ctx context.Context) ([]BackupMetadata, error) {
 	return r.backend.List(ctx)
 }
 
+func (r *Repository) ListPrefix(ctx context.Context, prefix string) ([]BackupMetadata, error) {
+	return r.backend.ListPrefix(ctx, prefix)
+}
+
 func (r *Repository) Delete(ctx context.Context, id string) error {
 	return r.backend.Delete(ctx, id)
 }
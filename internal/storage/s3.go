@@ -4,24 +4,44 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 )
 
 type S3Storage struct {
-	client *s3.Client
-	bucket string
+	client          s3API
+	presign         *s3.PresignClient
+	bucket          string
+	readConcurrency int
+	uploader        *s3Uploader
 }
 
 func NewS3Storage(ctx context.Context, cfg *S3Config) (*S3Storage, error) {
 	if cfg.Bucket == "" {
 		return nil, fmt.Errorf("bucket name is required for S3 storage")
 	}
+	partSize := cfg.PartSize
+	if partSize == 0 {
+		partSize = DefaultS3PartSize
+	}
+	if err := ValidateS3PartSize(partSize); err != nil {
+		return nil, err
+	}
+	uploadConcurrency := cfg.UploadConcurrency
+	if uploadConcurrency < 1 {
+		uploadConcurrency = DefaultS3UploadConcurrency
+	}
 
 	var awsConfig aws.Config
 	var err error
@@ -30,7 +50,7 @@ func NewS3Storage(ctx context.Context, cfg *S3Config) (*S3Storage, error) {
 		awsConfig, err = config.LoadDefaultConfig(ctx,
 			config.WithRegion(cfg.Region),
 			config.WithCredentialsProvider(
-				credentials.NewStaticCredentialsProvider(cfg.AccessKey, cfg.SecretKey, ""),
+				credentials.NewStaticCredentialsProvider(cfg.AccessKey, cfg.SecretKey, cfg.SessionToken),
 			),
 		)
 	} else {
@@ -53,25 +73,30 @@ func NewS3Storage(ctx context.Context, cfg *S3Config) (*S3Storage, error) {
 
 	client := s3.NewFromConfig(awsConfig, clientOptions...)
 
+	if cfg.CreateBucket {
+		if err := ensureS3Bucket(ctx, client, cfg.Bucket, cfg.Region); err != nil {
+			return nil, err
+		}
+	}
+
 	return &S3Storage{
-		client: client,
-		bucket: cfg.Bucket,
+		client:          client,
+		presign:         s3.NewPresignClient(client),
+		bucket:          cfg.Bucket,
+		readConcurrency: cfg.ReadConcurrency,
+		uploader: &s3Uploader{
+			client:      client,
+			bucket:      cfg.Bucket,
+			partSize:    partSize,
+			concurrency: uploadConcurrency,
+		},
 	}, nil
 }
 
+// Store streams the backup data to S3 in parts, then writes the metadata as a separate object
 func (s *S3Storage) Store(ctx context.Context, backup *Backup) error {
-	data, err := io.ReadAll(backup.DataReader)
-	if err != nil {
-		return fmt.Errorf("failed to read backup data: %w", err)
-	}
-
-	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(backup.ID + ".tar.gz"),
-		Body:   bytes.NewReader(data),
-	})
-	if err != nil {
-		return fmt.Errorf("failed to upload backup data: %w", err)
+	if err := s.uploader.upload(ctx, dataKey(backup.ID, backup.Metadata), backup.DataReader); err != nil {
+		return err
 	}
 
 	metadataBytes, err := json.Marshal(backup.Metadata)
@@ -81,7 +106,7 @@ func (s *S3Storage) Store(ctx context.Context, backup *Backup) error {
 
 	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:      aws.String(s.bucket),
-		Key:         aws.String(backup.ID + ".json"),
+		Key:         aws.String(metadataKey(backup.ID)),
 		Body:        bytes.NewReader(metadataBytes),
 		ContentType: aws.String("application/json"),
 	})
@@ -92,17 +117,30 @@ func (s *S3Storage) Store(ctx context.Context, backup *Backup) error {
 	return nil
 }
 
+// StoreResumable streams the backup data to S3 as a multipart upload that is kept when it
+// fails, so a later call with the same upload uploads only the missing parts, then writes the
+// metadata
+func (s *S3Storage) StoreResumable(ctx context.Context, backup *Backup, upload *ResumableUpload) error {
+	if err := s.uploader.uploadResumable(ctx, dataKey(backup.ID, backup.Metadata), backup.DataReader, upload); err != nil {
+		return err
+	}
+	return s.PutMetadata(ctx, backup.ID, backup.Metadata)
+}
+
 func (s *S3Storage) Retrieve(ctx context.Context, id string) (*Backup, error) {
 	metadataResult, err := s.client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
-		Key:    aws.String(id + ".json"),
+		Key:    aws.String(metadataKey(id)),
 	})
 	if err != nil {
+		if isS3NotFound(err) {
+			return nil, fmt.Errorf("backup %w: %s", ErrNotFound, id)
+		}
 		return nil, fmt.Errorf("failed to retrieve metadata: %w", err)
 	}
 	defer func() {
 		if err := metadataResult.Body.Close(); err != nil {
-			fmt.Printf("Warning: failed to close metadata result body: %v\n", err)
+			Warnf("failed to close metadata result body: %v", err)
 		}
 	}()
 
@@ -113,7 +151,7 @@ func (s *S3Storage) Retrieve(ctx context.Context, id string) (*Backup, error) {
 
 	dataResult, err := s.client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
-		Key:    aws.String(id + ".tar.gz"),
+		Key:    aws.String(dataKey(id, metadata)),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve backup data: %w", err)
@@ -127,12 +165,24 @@ func (s *S3Storage) Retrieve(ctx context.Context, id string) (*Backup, error) {
 }
 
 func (s *S3Storage) List(ctx context.Context) ([]BackupMetadata, error) {
-	var backups []BackupMetadata
+	return s.list(ctx, "")
+}
+
+// ListPrefix lists the backups whose ID starts with prefix using a native prefix query
+func (s *S3Storage) ListPrefix(ctx context.Context, prefix string) ([]BackupMetadata, error) {
+	return s.list(ctx, prefix)
+}
 
-	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+func (s *S3Storage) list(ctx context.Context, prefix string) ([]BackupMetadata, error) {
+	input := &s3.ListObjectsV2Input{
 		Bucket: aws.String(s.bucket),
-	})
+	}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
 
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(s.client, input)
 	for paginator.HasMorePages() {
 		output, err := paginator.NextPage(ctx)
 		if err != nil {
@@ -140,38 +190,48 @@ func (s *S3Storage) List(ctx context.Context) ([]BackupMetadata, error) {
 		}
 
 		for _, obj := range output.Contents {
-			if len(*obj.Key) > 5 && (*obj.Key)[len(*obj.Key)-5:] == ".json" {
-				metadataResult, err := s.client.GetObject(ctx, &s3.GetObjectInput{
-					Bucket: aws.String(s.bucket),
-					Key:    obj.Key,
-				})
-				if err != nil {
-					continue
-				}
-
-				var metadata BackupMetadata
-				if err := json.NewDecoder(metadataResult.Body).Decode(&metadata); err != nil {
-					if closeErr := metadataResult.Body.Close(); closeErr != nil {
-						fmt.Printf("Warning: failed to close metadata result body: %v\n", closeErr)
-					}
-					continue
-				}
-				if err := metadataResult.Body.Close(); err != nil {
-					fmt.Printf("Warning: failed to close metadata result body: %v\n", err)
-				}
-
-				backups = append(backups, metadata)
+			if isMetadataKey(*obj.Key) {
+				keys = append(keys, *obj.Key)
 			}
 		}
 	}
 
-	return backups, nil
+	return readMetadataObjects(ctx, keys, s.readConcurrency, s.readMetadata)
+}
+
+// readMetadata reads and decodes a metadata object
+func (s *S3Storage) readMetadata(ctx context.Context, key string) (*BackupMetadata, error) {
+	metadataResult, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		switch {
+		case isS3NotFound(err):
+			return nil, fmt.Errorf("%w: %v", errMetadataGone, err)
+		case isS3Throttled(err):
+			return nil, fmt.Errorf("%w: %v", errThrottled, err)
+		}
+		return nil, err
+	}
+	defer func() {
+		if err := metadataResult.Body.Close(); err != nil {
+			Warnf("failed to close metadata result body: %v", err)
+		}
+	}()
+
+	var metadata BackupMetadata
+	if err := json.NewDecoder(metadataResult.Body).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorruptMetadata, err)
+	}
+
+	return &metadata, nil
 }
 
 func (s *S3Storage) Delete(ctx context.Context, id string) error {
 	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(s.bucket),
-		Key:    aws.String(id + ".tar.gz"),
+		Key:    aws.String(resolveDataKey(ctx, id, s.RawMetadata, s.dataExists)),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to delete backup data: %w", err)
@@ -179,7 +239,7 @@ func (s *S3Storage) Delete(ctx context.Context, id string) error {
 
 	_, err = s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(s.bucket),
-		Key:    aws.String(id + ".json"),
+		Key:    aws.String(metadataKey(id)),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to delete metadata: %w", err)
@@ -191,11 +251,197 @@ func (s *S3Storage) Delete(ctx context.Context, id string) error {
 func (s *S3Storage) Exists(ctx context.Context, id string) (bool, error) {
 	_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(s.bucket),
-		Key:    aws.String(id + ".json"),
+		Key:    aws.String(metadataKey(id)),
 	})
 	if err != nil {
-		return false, nil
+		if isS3NotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check backup existence: %w", err)
 	}
 
 	return true, nil
 }
+
+// ensureS3Bucket creates the bucket in the region unless it exists. A bucket the credentials
+// may not access is reported as such rather than created.
+func ensureS3Bucket(ctx context.Context, client *s3.Client, bucket, region string) error {
+	_, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	if err == nil {
+		return nil
+	}
+	if isS3AccessDenied(err) {
+		return fmt.Errorf("access denied to S3 bucket '%s': check the credentials and bucket policy: %w", bucket, err)
+	}
+	if !isS3NotFound(err) {
+		return fmt.Errorf("failed to check S3 bucket '%s': %w", bucket, err)
+	}
+
+	input := &s3.CreateBucketInput{Bucket: aws.String(bucket)}
+	// us-east-1 is the default location and must not be given as a constraint
+	if region != "" && region != "us-east-1" {
+		input.CreateBucketConfiguration = &types.CreateBucketConfiguration{
+			LocationConstraint: types.BucketLocationConstraint(region),
+		}
+	}
+	if _, err := client.CreateBucket(ctx, input); err != nil {
+		var owned *types.BucketAlreadyOwnedByYou
+		if errors.As(err, &owned) {
+			return nil
+		}
+		if isS3AccessDenied(err) {
+			return fmt.Errorf("S3 bucket '%s' does not exist and the credentials may not create it: %w", bucket, err)
+		}
+		return fmt.Errorf("failed to create S3 bucket '%s': %w", bucket, err)
+	}
+	return nil
+}
+
+// isS3AccessDenied reports whether an S3 error means the credentials lack permission
+func isS3AccessDenied(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "AccessDenied" || apiErr.ErrorCode() == "Forbidden") {
+		return true
+	}
+	var responseErr *awshttp.ResponseError
+	return errors.As(err, &responseErr) && responseErr.HTTPStatusCode() == http.StatusForbidden
+}
+
+// isS3NotFound reports whether an S3 error means the object does not exist
+func isS3NotFound(err error) bool {
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return true
+	}
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return true
+	}
+	var responseErr *awshttp.ResponseError
+	if errors.As(err, &responseErr) && responseErr.HTTPStatusCode() == http.StatusNotFound {
+		return true
+	}
+	return false
+}
+
+// isS3Throttled reports whether an S3 error is a rate limiting response
+func isS3Throttled(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "SlowDown", "Throttling", "ThrottlingException", "RequestLimitExceeded", "TooManyRequests", "TooManyRequestsException":
+			return true
+		}
+	}
+	var responseErr *awshttp.ResponseError
+	if errors.As(err, &responseErr) {
+		status := responseErr.HTTPStatusCode()
+		return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+	}
+	return false
+}
+
+// dataExists reports whether a data object is stored under key
+func (s *S3Storage) dataExists(ctx context.Context, key string) bool {
+	_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err == nil
+}
+
+func (s *S3Storage) StatData(ctx context.Context, id string) (*ObjectInfo, error) {
+	key := resolveDataKey(ctx, id, s.RawMetadata, s.dataExists)
+	head, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat backup data: %w", err)
+	}
+
+	info := &ObjectInfo{
+		Key:  key,
+		Size: aws.ToInt64(head.ContentLength),
+	}
+	if head.LastModified != nil {
+		info.ModTime = *head.LastModified
+	}
+
+	return info, nil
+}
+
+func (s *S3Storage) OpenData(ctx context.Context, id string) (io.ReadCloser, error) {
+	dataResult, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(resolveDataKey(ctx, id, s.RawMetadata, s.dataExists)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve backup data: %w", err)
+	}
+	return dataResult.Body, nil
+}
+
+func (s *S3Storage) RawMetadata(ctx context.Context, id string) ([]byte, error) {
+	metadataResult, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(metadataKey(id)),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, fmt.Errorf("backup %w: %s", ErrNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to retrieve metadata: %w", err)
+	}
+	defer func() {
+		if err := metadataResult.Body.Close(); err != nil {
+			Warnf("failed to close metadata result body: %v", err)
+		}
+	}()
+
+	data, err := io.ReadAll(metadataResult.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	return data, nil
+}
+
+func (s *S3Storage) PutMetadata(ctx context.Context, id string, metadata BackupMetadata) error {
+	metadataBytes, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(metadataKey(id)),
+		Body:        bytes.NewReader(metadataBytes),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload metadata: %w", err)
+	}
+
+	return nil
+}
+
+// CopyBackup copies the data object of srcID to dstID within the bucket and writes the
+// metadata of dstID
+func (s *S3Storage) CopyBackup(ctx context.Context, srcID, dstID string, metadata BackupMetadata) error {
+	if err := s.uploader.copyObject(ctx, resolveDataKey(ctx, srcID, s.RawMetadata, s.dataExists), dataKey(dstID, metadata)); err != nil {
+		return err
+	}
+	return s.PutMetadata(ctx, dstID, metadata)
+}
+
+// SignedURL returns a presigned GET URL of the data object of a backup
+func (s *S3Storage) SignedURL(ctx context.Context, id string, expiry time.Duration) (string, error) {
+	request, err := s.presign.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(resolveDataKey(ctx, id, s.RawMetadata, s.dataExists)),
+	}, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign backup data URL: %w", err)
+	}
+	return request.URL, nil
+}
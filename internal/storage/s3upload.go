@@ -0,0 +1,362 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// DefaultS3PartSize is the size of the parts backups are uploaded to S3 in
+	DefaultS3PartSize = 16 * 1024 * 1024
+	// MinS3PartSize and MaxS3PartSize are the part size limits of S3 multipart uploads
+	MinS3PartSize = 5 * 1024 * 1024
+	MaxS3PartSize = 5 * 1024 * 1024 * 1024
+	// DefaultS3UploadConcurrency is the number of parts uploaded in parallel
+	DefaultS3UploadConcurrency = 4
+	// maxS3Parts is the maximum number of parts of a multipart upload
+	maxS3Parts = 10000
+)
+
+// ValidateS3PartSize checks that a part size is accepted by S3 multipart uploads
+func ValidateS3PartSize(size int64) error {
+	if size < MinS3PartSize || size > MaxS3PartSize {
+		return fmt.Errorf("S3 part size must be between %d and %d bytes, got %d", MinS3PartSize, MaxS3PartSize, size)
+	}
+	return nil
+}
+
+// s3API is the part of the S3 client the storage uses, so tests can substitute a fake
+type s3API interface {
+	manager.UploadAPIClient
+	s3.ListObjectsV2APIClient
+	s3.ListPartsAPIClient
+	s3.HeadObjectAPIClient
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	UploadPartCopy(ctx context.Context, params *s3.UploadPartCopyInput, optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error)
+}
+
+// s3Uploader streams data of unknown size to an S3 object. New uploads go through the S3
+// transfer manager: data that fits in a single part is uploaded with one PutObject, larger
+// data as a multipart upload with up to concurrency parts in flight, so only a few parts are
+// held in memory. The manager cannot continue an upload it did not start or copy objects, so
+// resumable uploads and copies use the multipart API directly.
+type s3Uploader struct {
+	client      s3API
+	bucket      string
+	partSize    int64
+	concurrency int
+}
+
+// upload reads r to the end and stores it under key
+func (u *s3Uploader) upload(ctx context.Context, key string, r io.Reader) error {
+	uploader := manager.NewUploader(u.client, func(m *manager.Uploader) {
+		m.PartSize = u.partSize
+		m.Concurrency = u.concurrency
+		m.MaxUploadParts = maxS3Parts
+		// Failed uploads are aborted below, also when the upload was cancelled
+		m.LeavePartsOnError = true
+	})
+
+	_, err := uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(u.bucket),
+		Key:    aws.String(key),
+		Body:   r,
+	})
+	if err == nil {
+		return nil
+	}
+
+	var failure manager.MultiUploadFailure
+	if errors.As(err, &failure) {
+		// Abort even if the upload was cancelled, so the stored parts are not billed
+		_, abortErr := u.client.AbortMultipartUpload(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(u.bucket),
+			Key:      aws.String(key),
+			UploadId: aws.String(failure.UploadID()),
+		})
+		if abortErr != nil {
+			Warnf("failed to abort multipart upload of %s: %v", key, abortErr)
+		}
+	}
+	return fmt.Errorf("failed to upload backup data: %w", err)
+}
+
+// uploadResumable reads r to the end and stores it under key as a multipart upload. Unlike
+// upload, a failed upload is not aborted: resuming it with the upload ID and part size of the
+// earlier attempt skips the parts that attempt stored, so r must deliver the same data again.
+func (u *s3Uploader) uploadResumable(ctx context.Context, key string, r io.Reader, upload *ResumableUpload) error {
+	var stored map[int32]types.Part
+	if upload.UploadID != "" {
+		var err error
+		stored, err = u.listParts(ctx, key, upload.UploadID)
+		var missing *types.NoSuchUpload
+		if errors.As(err, &missing) {
+			Warnf("multipart upload of %s no longer exists, uploading it again from the start", key)
+			upload.UploadID = ""
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if upload.UploadID == "" {
+		created, err := u.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket: aws.String(u.bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to start multipart upload: %w", err)
+		}
+		upload.UploadID = aws.ToString(created.UploadId)
+		upload.PartSize = u.partSize
+	}
+	if upload.Started != nil {
+		if err := upload.Started(upload); err != nil {
+			return err
+		}
+	}
+
+	first, err := readPart(r, upload.PartSize)
+	if err != nil {
+		return fmt.Errorf("failed to read backup data: %w", err)
+	}
+	parts, err := u.uploadParts(ctx, key, aws.String(upload.UploadID), upload.PartSize, first, r, stored)
+	if err != nil {
+		return err
+	}
+
+	_, err = u.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(u.bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(upload.UploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	return nil
+}
+
+// listParts returns the parts stored so far by a multipart upload, by part number
+func (u *s3Uploader) listParts(ctx context.Context, key, uploadID string) (map[int32]types.Part, error) {
+	parts := make(map[int32]types.Part)
+	paginator := s3.NewListPartsPaginator(u.client, &s3.ListPartsInput{
+		Bucket:   aws.String(u.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list uploaded parts: %w", err)
+		}
+		for _, part := range page.Parts {
+			parts[aws.ToInt32(part.PartNumber)] = part
+		}
+	}
+	return parts, nil
+}
+
+// uploadParts uploads first and the rest of r as the parts of a multipart upload of partSize
+// parts and returns the completed parts in order. Parts found in stored with the size of the
+// data read for them are kept instead of being uploaded again.
+func (u *s3Uploader) uploadParts(ctx context.Context, key string, uploadID *string, partSize int64, first []byte, r io.Reader, stored map[int32]types.Part) ([]types.CompletedPart, error) {
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(u.concurrency)
+
+	var mu sync.Mutex
+	var parts []types.CompletedPart
+
+	part := first
+	for number := int32(1); len(part) > 0; number++ {
+		if number > maxS3Parts {
+			group.Go(func() error {
+				return fmt.Errorf("backup is larger than %d parts of %d bytes, raise the S3 part size", maxS3Parts, partSize)
+			})
+			break
+		}
+
+		data, partNumber := part, number
+		if done, ok := stored[partNumber]; ok && aws.ToInt64(done.Size) == int64(len(data)) {
+			mu.Lock()
+			parts = append(parts, types.CompletedPart{ETag: done.ETag, PartNumber: aws.Int32(partNumber)})
+			mu.Unlock()
+		} else {
+			group.Go(func() error {
+				uploaded, err := u.client.UploadPart(groupCtx, &s3.UploadPartInput{
+					Bucket:     aws.String(u.bucket),
+					Key:        aws.String(key),
+					UploadId:   uploadID,
+					PartNumber: aws.Int32(partNumber),
+					Body:       bytes.NewReader(data),
+				})
+				if err != nil {
+					return fmt.Errorf("failed to upload part %d: %w", partNumber, err)
+				}
+
+				mu.Lock()
+				parts = append(parts, types.CompletedPart{ETag: uploaded.ETag, PartNumber: aws.Int32(partNumber)})
+				mu.Unlock()
+				return nil
+			})
+		}
+
+		// A short part is the last one
+		if int64(len(part)) < partSize || groupCtx.Err() != nil {
+			break
+		}
+		var err error
+		if part, err = readPart(r, partSize); err != nil {
+			group.Go(func() error {
+				return fmt.Errorf("failed to read backup data: %w", err)
+			})
+			break
+		}
+	}
+
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return *parts[i].PartNumber < *parts[j].PartNumber
+	})
+	return parts, nil
+}
+
+// readPart reads up to size bytes from r. It returns fewer only at the end of the data.
+func readPart(r io.Reader, size int64) ([]byte, error) {
+	buf := make([]byte, size)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// copyObject copies the object at srcKey to dstKey within the bucket. Objects larger than a
+// single CopyObject allows are copied as a multipart upload of ranged part copies.
+func (u *s3Uploader) copyObject(ctx context.Context, srcKey, dstKey string) error {
+	source := s3CopySource(u.bucket, srcKey)
+
+	head, err := u.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(u.bucket),
+		Key:    aws.String(srcKey),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to stat backup data: %w", err)
+	}
+	size := aws.ToInt64(head.ContentLength)
+
+	if size <= MaxS3PartSize {
+		_, err := u.client.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(u.bucket),
+			Key:        aws.String(dstKey),
+			CopySource: aws.String(source),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to copy backup data: %w", err)
+		}
+		return nil
+	}
+
+	created, err := u.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(u.bucket),
+		Key:    aws.String(dstKey),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start multipart copy: %w", err)
+	}
+
+	parts, err := u.copyParts(ctx, source, dstKey, created.UploadId, size)
+	if err != nil {
+		_, abortErr := u.client.AbortMultipartUpload(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(u.bucket),
+			Key:      aws.String(dstKey),
+			UploadId: created.UploadId,
+		})
+		if abortErr != nil {
+			Warnf("failed to abort multipart copy of %s: %v", dstKey, abortErr)
+		}
+		return err
+	}
+
+	_, err = u.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(u.bucket),
+		Key:             aws.String(dstKey),
+		UploadId:        created.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart copy: %w", err)
+	}
+	return nil
+}
+
+// copyParts copies size bytes of source as the parts of a multipart upload, with up to
+// concurrency part copies in flight, and returns the completed parts in order
+func (u *s3Uploader) copyParts(ctx context.Context, source, key string, uploadID *string, size int64) ([]types.CompletedPart, error) {
+	partSize := u.partSize
+	if minimum := (size + maxS3Parts - 1) / maxS3Parts; partSize < minimum {
+		partSize = minimum
+	}
+
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(u.concurrency)
+
+	var mu sync.Mutex
+	var parts []types.CompletedPart
+
+	for offset, number := int64(0), int32(1); offset < size; offset, number = offset+partSize, number+1 {
+		end := min(offset+partSize, size) - 1
+		byteRange, partNumber := fmt.Sprintf("bytes=%d-%d", offset, end), number
+		group.Go(func() error {
+			copied, err := u.client.UploadPartCopy(groupCtx, &s3.UploadPartCopyInput{
+				Bucket:          aws.String(u.bucket),
+				Key:             aws.String(key),
+				UploadId:        uploadID,
+				PartNumber:      aws.Int32(partNumber),
+				CopySource:      aws.String(source),
+				CopySourceRange: aws.String(byteRange),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to copy part %d: %w", partNumber, err)
+			}
+
+			mu.Lock()
+			parts = append(parts, types.CompletedPart{ETag: copied.CopyPartResult.ETag, PartNumber: aws.Int32(partNumber)})
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return *parts[i].PartNumber < *parts[j].PartNumber
+	})
+	return parts, nil
+}
+
+// s3CopySource returns the URL-encoded copy source of an object
+func s3CopySource(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return bucket + "/" + strings.Join(segments, "/")
+}
@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// fakeS3 records the uploads made through it. Calls it does not implement panic through the
+// nil embedded interface.
+type fakeS3 struct {
+	s3API
+
+	mu sync.Mutex
+	// source reports how many bytes the data source had delivered, when set
+	source *countingReader
+	// failPart makes the upload of this part number fail
+	failPart int32
+
+	objects     map[string][]byte
+	parts       map[int32][]byte
+	readAtPart  map[int32]int64
+	completed   []int32
+	aborted     []string
+	putKeys     []string
+	contentType map[string]string
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		objects:     make(map[string][]byte),
+		parts:       make(map[int32][]byte),
+		readAtPart:  make(map[int32]int64),
+		contentType: make(map[string]string),
+	}
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := aws.ToString(params.Key)
+	f.objects[key] = data
+	f.putKeys = append(f.putKeys, key)
+	f.contentType[key] = aws.ToString(params.ContentType)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-1")}, nil
+}
+
+func (f *fakeS3) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	number := aws.ToInt32(params.PartNumber)
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	if number == f.failPart {
+		return nil, fmt.Errorf("connection reset")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.parts[number] = data
+	if f.source != nil {
+		f.readAtPart[number] = f.source.count()
+	}
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf("etag-%d", number))}, nil
+}
+
+func (f *fakeS3) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var data []byte
+	for _, part := range params.MultipartUpload.Parts {
+		number := aws.ToInt32(part.PartNumber)
+		if aws.ToString(part.ETag) != fmt.Sprintf("etag-%d", number) {
+			return nil, fmt.Errorf("part %d completed with ETag %s", number, aws.ToString(part.ETag))
+		}
+		f.completed = append(f.completed, number)
+		data = append(data, f.parts[number]...)
+	}
+	f.objects[aws.ToString(params.Key)] = data
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (f *fakeS3) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.aborted = append(f.aborted, aws.ToString(params.UploadId))
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+// countingReader produces size bytes of a repeating pattern without holding them in memory,
+// counting the bytes read so far
+type countingReader struct {
+	mu   sync.Mutex
+	size int64
+	read int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.read >= r.size {
+		return 0, io.EOF
+	}
+	n := int(min(int64(len(p)), r.size-r.read))
+	for i := 0; i < n; i++ {
+		p[i] = patternByte(r.read + int64(i))
+	}
+	r.read += int64(n)
+	return n, nil
+}
+
+func (r *countingReader) count() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.read
+}
+
+// patternByte is the byte at offset of the data produced by countingReader
+func patternByte(offset int64) byte {
+	return byte(offset % 251)
+}
+
+// newTestS3Storage returns an S3Storage storing through fake with parts of MinS3PartSize
+func newTestS3Storage(fake *fakeS3, concurrency int) *S3Storage {
+	return &S3Storage{
+		client: fake,
+		bucket: "backups",
+		uploader: &s3Uploader{
+			client:      fake,
+			bucket:      "backups",
+			partSize:    MinS3PartSize,
+			concurrency: concurrency,
+		},
+	}
+}
+
+func TestS3StoreStreamsOrderedPartsAndSeparateMetadata(t *testing.T) {
+	const parts = 6
+	fake := newFakeS3()
+	source := &countingReader{size: parts*MinS3PartSize + 1234}
+	fake.source = source
+	s := newTestS3Storage(fake, 2)
+
+	backup := &Backup{
+		ID:         "db@20250101-120000",
+		Metadata:   BackupMetadata{ID: "db@20250101-120000", Name: "db", CreatedAt: time.Now()},
+		DataReader: source,
+	}
+	if err := s.Store(context.Background(), backup); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	// Streamed: the first part was uploaded long before the source was read to the end
+	if read := fake.readAtPart[1]; read >= source.size {
+		t.Errorf("the source was read to the end (%d bytes) before the first part was uploaded", read)
+	}
+
+	if len(fake.completed) != parts+1 {
+		t.Fatalf("completed %d parts, want %d", len(fake.completed), parts+1)
+	}
+	for i, number := range fake.completed {
+		if number != int32(i+1) {
+			t.Fatalf("completed parts in order %v, want 1..%d", fake.completed, parts+1)
+		}
+	}
+	data := fake.objects[dataKey(backup.ID, backup.Metadata)]
+	if int64(len(data)) != source.size {
+		t.Fatalf("stored %d bytes, want %d", len(data), source.size)
+	}
+	for offset, b := range data {
+		if b != patternByte(int64(offset)) {
+			t.Fatalf("stored data differs from the source at offset %d", offset)
+		}
+	}
+
+	// The metadata is its own object, written with the only PutObject of a multipart upload
+	key := metadataKey(backup.ID)
+	if len(fake.putKeys) != 1 || fake.putKeys[0] != key {
+		t.Fatalf("PutObject keys = %v, want only %s", fake.putKeys, key)
+	}
+	if fake.contentType[key] != "application/json" {
+		t.Errorf("metadata content type = %q, want application/json", fake.contentType[key])
+	}
+	var stored BackupMetadata
+	if err := json.Unmarshal(fake.objects[key], &stored); err != nil || stored.ID != backup.ID {
+		t.Errorf("stored metadata %s does not decode to the backup's metadata (%v)", fake.objects[key], err)
+	}
+}
+
+func TestS3StoreSmallBackupUsesPutObject(t *testing.T) {
+	fake := newFakeS3()
+	s := newTestS3Storage(fake, 2)
+
+	backup := &Backup{
+		ID:         "db@20250101-120000",
+		Metadata:   BackupMetadata{ID: "db@20250101-120000", Name: "db", CreatedAt: time.Now()},
+		DataReader: bytes.NewReader([]byte("small archive")),
+	}
+	if err := s.Store(context.Background(), backup); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	want := []string{dataKey(backup.ID, backup.Metadata), metadataKey(backup.ID)}
+	if len(fake.putKeys) != 2 || fake.putKeys[0] != want[0] || fake.putKeys[1] != want[1] {
+		t.Errorf("PutObject keys = %v, want %v", fake.putKeys, want)
+	}
+	if len(fake.parts) != 0 {
+		t.Errorf("uploaded %d parts for data smaller than a part", len(fake.parts))
+	}
+}
+
+func TestS3StoreAbortsWhenAPartFails(t *testing.T) {
+	fake := newFakeS3()
+	fake.failPart = 3
+	s := newTestS3Storage(fake, 1)
+
+	backup := &Backup{
+		ID:         "db@20250101-120000",
+		Metadata:   BackupMetadata{ID: "db@20250101-120000", Name: "db", CreatedAt: time.Now()},
+		DataReader: &countingReader{size: 5 * MinS3PartSize},
+	}
+	err := s.Store(context.Background(), backup)
+	if err == nil {
+		t.Fatal("Store() succeeded, want the failed part's error")
+	}
+	if errors.Is(err, context.Canceled) {
+		t.Errorf("Store() error = %v, want the part failure", err)
+	}
+
+	if len(fake.aborted) == 0 || fake.aborted[0] != "upload-1" {
+		t.Errorf("aborted uploads = %v, want upload-1", fake.aborted)
+	}
+	if len(fake.completed) != 0 {
+		t.Errorf("completed parts %v of a failed upload", fake.completed)
+	}
+	if len(fake.putKeys) != 0 {
+		t.Errorf("stored %v after the data upload failed", fake.putKeys)
+	}
+}
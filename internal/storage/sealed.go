@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ypeckstadt/dvom/internal/crypto"
+)
+
+// EncryptedPlaceholder replaces metadata fields that are hidden by metadata encryption
+const EncryptedPlaceholder = "<encrypted>"
+
+// IsSealed reports whether the metadata fields are encrypted
+func (m BackupMetadata) IsSealed() bool {
+	return m.Sealed != ""
+}
+
+// SealMetadata encrypts all metadata fields with the password. Only the ID, the encrypted
+// flag, the sealed blob, which starts with the DVOM-ENC magic, and the archive format and
+// compression, which the data object's key reveals anyway, remain in plaintext.
+func SealMetadata(metadata BackupMetadata, password string) (BackupMetadata, error) {
+	plaintext, err := json.Marshal(metadata)
+	if err != nil {
+		return BackupMetadata{}, fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	blob, err := crypto.EncryptBytes(plaintext, password)
+	if err != nil {
+		return BackupMetadata{}, fmt.Errorf("failed to encrypt metadata: %w", err)
+	}
+
+	sealed := BackupMetadata{
+		ID:        metadata.ID,
+		Encrypted: true,
+		Sealed:    base64.StdEncoding.EncodeToString(blob),
+	}
+	if metadata.Options != nil {
+		sealed.Options = &BackupOptions{
+			Format:      metadata.Options.Format,
+			Compression: metadata.Options.Compression,
+		}
+	}
+	return sealed, nil
+}
+
+// OpenMetadata decrypts metadata sealed by SealMetadata
+func OpenMetadata(metadata BackupMetadata, password string) (BackupMetadata, error) {
+	blob, err := base64.StdEncoding.DecodeString(metadata.Sealed)
+	if err != nil {
+		return BackupMetadata{}, fmt.Errorf("failed to decode sealed metadata: %w", err)
+	}
+
+	plaintext, err := crypto.DecryptBytes(blob, password)
+	if err != nil {
+		return BackupMetadata{}, fmt.Errorf("failed to decrypt metadata: %w", err)
+	}
+
+	var opened BackupMetadata
+	if err := json.Unmarshal(plaintext, &opened); err != nil {
+		return BackupMetadata{}, fmt.Errorf("failed to unmarshal metadata: %w", err)
+	}
+
+	return opened, nil
+}
+
+// maskSealedMetadata fills the fields of sealed metadata that can be derived from the ID
+// and marks the remaining descriptive fields as encrypted
+func maskSealedMetadata(metadata BackupMetadata) BackupMetadata {
+	masked := metadata
+	if name, version, ok := ParseVersionedID(metadata.ID); ok {
+		masked.Name = name
+		masked.Version = version
+		if createdAt, err := time.ParseInLocation(versionFormat, version, time.Local); err == nil {
+			masked.CreatedAt = createdAt
+		}
+	}
+	masked.Type = EncryptedPlaceholder
+	masked.Description = EncryptedPlaceholder
+	masked.VolumeName = EncryptedPlaceholder
+	return masked
+}
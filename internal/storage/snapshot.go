@@ -2,25 +2,179 @@ package storage
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/ypeckstadt/dvom/internal/crypto"
 )
 
-// SnapshotStorage provides volume-centric storage operations
+// LegacyVersionSeparator separates name and version in the IDs of snapshots created
+// before the separator became configurable
+const LegacyVersionSeparator = "@"
+
+// versionFormat is the time layout of snapshot versions
+const versionFormat = "20060102-150405"
+
+// VersionSeparator separates the snapshot name from its version in snapshot IDs
+var VersionSeparator = LegacyVersionSeparator
+
+// SetVersionSeparator changes the separator used for new snapshot IDs. Snapshots stored
+// with the legacy "@" separator remain readable.
+func SetVersionSeparator(separator string) error {
+	if separator == "" {
+		return fmt.Errorf("version separator cannot be empty")
+	}
+	if strings.ContainsAny(separator, "/\\-0123456789") {
+		return fmt.Errorf("invalid version separator %q: must not contain path separators, digits or '-'", separator)
+	}
+	VersionSeparator = separator
+	return nil
+}
+
+// VersionedID builds a snapshot ID from a name and version
+func VersionedID(name, version string) string {
+	return name + VersionSeparator + version
+}
+
+// ParseVersionedID splits a snapshot ID into its name and version. IDs using the
+// legacy "@" separator are recognized when their version is a snapshot timestamp.
+func ParseVersionedID(id string) (name, version string, ok bool) {
+	if i := strings.LastIndex(id, VersionSeparator); i > 0 && i+len(VersionSeparator) < len(id) {
+		return id[:i], id[i+len(VersionSeparator):], true
+	}
+
+	if VersionSeparator != LegacyVersionSeparator {
+		if i := strings.LastIndex(id, LegacyVersionSeparator); i > 0 {
+			version := id[i+len(LegacyVersionSeparator):]
+			if _, err := time.Parse(versionFormat, version); err == nil {
+				return id[:i], version, true
+			}
+		}
+	}
+
+	return "", "", false
+}
+
+// IsVersionedID reports whether an ID refers to a specific snapshot version
+func IsVersionedID(id string) bool {
+	_, _, ok := ParseVersionedID(id)
+	return ok
+}
+
+// SnapshotStorage provides volume-centric storage operations. Listings are cached for
+// the lifetime of the SnapshotStorage and invalidated when it modifies the backend.
 type SnapshotStorage struct {
-	backend Backend
+	backend  Backend
+	mu       sync.Mutex
+	listings map[string][]BackupMetadata
+	// sealMetadata encrypts the metadata of new snapshots with metadataPassword,
+	// which is also used to open sealed metadata when reading
+	sealMetadata     bool
+	metadataPassword string
 }
 
 // NewSnapshotStorage creates a volume-centric storage layer
 func NewSnapshotStorage(backend Backend) *SnapshotStorage {
 	return &SnapshotStorage{
-		backend: backend,
+		backend:  backend,
+		listings: make(map[string][]BackupMetadata),
 	}
 }
 
+// list returns the backups whose ID starts with prefix, using a prefix-scoped backend
+// listing that is cached until the SnapshotStorage modifies the backend
+func (s *SnapshotStorage) list(ctx context.Context, prefix string) ([]BackupMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if backups, ok := s.listings[prefix]; ok {
+		return backups, nil
+	}
+
+	backups, err := s.backend.ListPrefix(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	for i := range backups {
+		backups[i] = s.openMetadata(backups[i])
+	}
+	s.listings[prefix] = backups
+	return backups, nil
+}
+
+// SetMetadataEncryption configures metadata encryption. When seal is set, the metadata of new
+// snapshots is encrypted with the password; the password also opens sealed metadata on reads.
+func (s *SnapshotStorage) SetMetadataEncryption(seal bool, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if password != s.metadataPassword {
+		s.listings = make(map[string][]BackupMetadata)
+	}
+	s.sealMetadata = seal
+	s.metadataPassword = password
+}
+
+// openMetadata decrypts sealed metadata if possible and masks it otherwise
+func (s *SnapshotStorage) openMetadata(metadata BackupMetadata) BackupMetadata {
+	if !metadata.IsSealed() {
+		return metadata
+	}
+	if s.metadataPassword != "" {
+		if opened, err := OpenMetadata(metadata, s.metadataPassword); err == nil {
+			return opened
+		}
+	}
+	return maskSealedMetadata(metadata)
+}
+
+// invalidate drops cached listings after the backend was modified
+func (s *SnapshotStorage) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.listings = make(map[string][]BackupMetadata)
+}
+
 // StoreSnapshot stores a volume snapshot with automatic versioning
 func (s *SnapshotStorage) StoreSnapshot(ctx context.Context, name string, backup *Backup) error {
+	return s.storeSnapshot(ctx, name, "", backup, s.backend.Store)
+}
+
+// StoreSnapshotResumable stores a volume snapshot with an upload that can be resumed. A new
+// upload starts a new version and records its ID in upload.ID; passing the upload of an
+// interrupted attempt back resumes it under the same version. The backend must implement
+// ResumableBackend.
+func (s *SnapshotStorage) StoreSnapshotResumable(ctx context.Context, name string, backup *Backup, upload *ResumableUpload) error {
+	resumable, ok := s.backend.(ResumableBackend)
+	if !ok {
+		return fmt.Errorf("storage backend does not support resumable uploads")
+	}
+
+	version := ""
+	if upload.ID != "" {
+		var ok bool
+		if _, version, ok = ParseVersionedID(upload.ID); !ok {
+			return fmt.Errorf("invalid snapshot version of resumed upload: %s", upload.ID)
+		}
+	}
+	return s.storeSnapshot(ctx, name, version, backup, func(ctx context.Context, snapshotBackup *Backup) error {
+		upload.ID = snapshotBackup.ID
+		return resumable.StoreResumable(ctx, snapshotBackup, upload)
+	})
+}
+
+// storeSnapshot stores a volume snapshot as the given version, a new one if version is empty,
+// using store to write it to the backend
+func (s *SnapshotStorage) storeSnapshot(ctx context.Context, name, version string, backup *Backup, store func(context.Context, *Backup) error) error {
 	if name == "" {
 		return fmt.Errorf("snapshot name is required")
 	}
@@ -29,8 +183,11 @@ func (s *SnapshotStorage) StoreSnapshot(ctx context.Context, name string, backup
 	name = cleanSnapshotName(name)
 
 	// Create versioned snapshot ID
-	timestamp := time.Now().Format("20060102-150405")
-	versionedID := fmt.Sprintf("%s@%s", name, timestamp)
+	timestamp := version
+	if timestamp == "" {
+		timestamp = time.Now().Format(versionFormat)
+	}
+	versionedID := VersionedID(name, timestamp)
 
 	// Update metadata with snapshot info
 	backup.Metadata.Name = name
@@ -48,32 +205,103 @@ func (s *SnapshotStorage) StoreSnapshot(ctx context.Context, name string, backup
 	// Update metadata ID to match the versioned ID
 	snapshotBackup.Metadata.ID = versionedID
 
-	return s.backend.Store(ctx, snapshotBackup)
+	if s.sealMetadata && s.metadataPassword == "" {
+		return fmt.Errorf("metadata encryption requires an encryption password")
+	}
+
+	// Record the checksum and exact size of the stored data, then seal the metadata if
+	// requested. Backends read the data to the end before writing the metadata, so the
+	// metadata is final in time.
+	plainMetadata := snapshotBackup.Metadata
+	snapshotBackup.DataReader = &checksumReader{
+		reader: backup.DataReader,
+		hash:   sha256.New(),
+		onComplete: func(size int64, checksum string) error {
+			plainMetadata.Size = size
+			plainMetadata.Checksum = checksum
+			snapshotBackup.Metadata = plainMetadata
+
+			if s.sealMetadata {
+				sealed, err := SealMetadata(plainMetadata, s.metadataPassword)
+				if err != nil {
+					return err
+				}
+				snapshotBackup.Metadata = sealed
+			}
+			return nil
+		},
+	}
+
+	s.invalidate()
+	if err := store(ctx, snapshotBackup); err != nil {
+		return err
+	}
+
+	backup.ID = versionedID
+	backup.Metadata = plainMetadata
+	return nil
+}
+
+// checksumReader computes the SHA-256 checksum and byte count of the data read
+// through it and reports both to onComplete once the data is fully read
+type checksumReader struct {
+	reader     io.Reader
+	hash       hash.Hash
+	size       int64
+	onComplete func(size int64, checksum string) error
+	completed  bool
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.hash.Write(p[:n])
+		r.size += int64(n)
+	}
+	if err == io.EOF && !r.completed {
+		r.completed = true
+		if completeErr := r.onComplete(r.size, hex.EncodeToString(r.hash.Sum(nil))); completeErr != nil {
+			return n, completeErr
+		}
+	}
+	return n, err
 }
 
 // GetSnapshot retrieves a volume snapshot by name (latest version) or name@version
 func (s *SnapshotStorage) GetSnapshot(ctx context.Context, nameOrVersioned string) (*Backup, error) {
 	nameOrVersioned = cleanSnapshotName(nameOrVersioned)
 
+	versionedID := nameOrVersioned
+
 	// Check if version is specified (name@version format)
-	if strings.Contains(nameOrVersioned, "@") {
-		// Direct versioned lookup
-		return s.backend.Retrieve(ctx, nameOrVersioned)
+	if !IsVersionedID(nameOrVersioned) {
+		// Find latest version for this name
+		latestVersion, err := s.GetLatestVersion(ctx, nameOrVersioned)
+		if err != nil {
+			return nil, err
+		}
+		versionedID = VersionedID(nameOrVersioned, latestVersion)
 	}
 
-	// Find latest version for this name
-	latestVersion, err := s.GetLatestVersion(ctx, nameOrVersioned)
+	backup, err := s.backend.Retrieve(ctx, versionedID)
 	if err != nil {
 		return nil, err
 	}
-
-	versionedID := fmt.Sprintf("%s@%s", nameOrVersioned, latestVersion)
-	return s.backend.Retrieve(ctx, versionedID)
+	backup.Metadata = s.openMetadata(backup.Metadata)
+	return backup, nil
 }
 
 // ListSnapshots returns all volume snapshots grouped by name with version info
 func (s *SnapshotStorage) ListSnapshots(ctx context.Context) ([]SnapshotInfo, error) {
-	backups, err := s.backend.List(ctx)
+	return s.ListSnapshotsBetween(ctx, time.Time{}, time.Time{})
+}
+
+// ListSnapshotsBetween returns the volume snapshots grouped by name, counting only the
+// versions created at or after since and before until. A zero time leaves that end of the
+// window open. Snapshots without versions in the window are left out, and the latest version
+// reported is the latest one within it.
+func (s *SnapshotStorage) ListSnapshotsBetween(ctx context.Context, since, until time.Time) ([]SnapshotInfo, error) {
+	backups, err := s.list(ctx, "")
 	if err != nil {
 		return nil, err
 	}
@@ -81,17 +309,14 @@ func (s *SnapshotStorage) ListSnapshots(ctx context.Context) ([]SnapshotInfo, er
 	// Group by snapshot name
 	snapshotGroups := make(map[string][]BackupMetadata)
 	for _, backup := range backups {
-		// Only include volume snapshots with @ versioning
-		if !strings.Contains(backup.ID, "@") {
+		// Only include versioned volume snapshots
+		name, _, ok := ParseVersionedID(backup.ID)
+		if !ok {
 			continue
 		}
-
-		// Extract name from versioned ID (name@version)
-		parts := strings.SplitN(backup.ID, "@", 2)
-		if len(parts) != 2 {
+		if !InTimeWindow(backup.CreatedAt, since, until) {
 			continue
 		}
-		name := parts[0]
 
 		snapshotGroups[name] = append(snapshotGroups[name], backup)
 	}
@@ -114,6 +339,9 @@ func (s *SnapshotStorage) ListSnapshots(ctx context.Context) ([]SnapshotInfo, er
 			Version:      latestBackup.Version,
 			VersionCount: len(versions),
 			Encrypted:    latestBackup.Encrypted,
+			Tags:         latestBackup.Tags,
+			VolumeSize:   latestBackup.VolumeSize,
+			Parent:       latestBackup.Parent,
 		}
 
 		// Extract volume info if available
@@ -127,14 +355,28 @@ func (s *SnapshotStorage) ListSnapshots(ctx context.Context) ([]SnapshotInfo, er
 	return snapshots, nil
 }
 
+// InTimeWindow reports whether t is at or after since and before until, where a zero time
+// leaves that end of the window open
+func InTimeWindow(t, since, until time.Time) bool {
+	if !since.IsZero() && t.Before(since) {
+		return false
+	}
+	return until.IsZero() || t.Before(until)
+}
+
 // DeleteSnapshot removes volume snapshots by name (all versions) or name@version (specific version)
 func (s *SnapshotStorage) DeleteSnapshot(ctx context.Context, nameOrVersioned string) error {
 	nameOrVersioned = cleanSnapshotName(nameOrVersioned)
+	defer s.invalidate()
 
 	// Check if version is specified
-	if strings.Contains(nameOrVersioned, "@") {
+	if IsVersionedID(nameOrVersioned) {
 		// Delete specific version
-		return s.backend.Delete(ctx, nameOrVersioned)
+		if err := s.backend.Delete(ctx, nameOrVersioned); err != nil {
+			return err
+		}
+		s.removeManifest(ctx, nameOrVersioned)
+		return nil
 	}
 
 	// Delete all versions of this snapshot name
@@ -144,26 +386,34 @@ func (s *SnapshotStorage) DeleteSnapshot(ctx context.Context, nameOrVersioned st
 	}
 
 	if len(versions) == 0 {
-		return fmt.Errorf("no snapshots found with name '%s'", nameOrVersioned)
+		return fmt.Errorf("no snapshots %w with name '%s'", ErrNotFound, nameOrVersioned)
 	}
 
 	// Delete each version
 	for _, version := range versions {
-		versionedID := fmt.Sprintf("%s@%s", nameOrVersioned, version.Version)
-		if err := s.backend.Delete(ctx, versionedID); err != nil {
+		if err := s.backend.Delete(ctx, version.ID); err != nil {
 			return fmt.Errorf("failed to delete version %s: %w", version.Version, err)
 		}
+		s.removeManifest(ctx, version.ID)
 	}
 
 	return nil
 }
 
+// removeManifest deletes the file manifest of a deleted version. A manifest left behind only
+// takes up space, so a failure is reported as a warning.
+func (s *SnapshotStorage) removeManifest(ctx context.Context, versionedID string) {
+	if err := s.deleteManifest(ctx, versionedID); err != nil {
+		Warnf("failed to delete the file manifest of %s: %v", versionedID, err)
+	}
+}
+
 // SnapshotExists checks if a snapshot exists
 func (s *SnapshotStorage) SnapshotExists(ctx context.Context, nameOrVersioned string) (bool, error) {
 	nameOrVersioned = cleanSnapshotName(nameOrVersioned)
 
 	// Check if version is specified
-	if strings.Contains(nameOrVersioned, "@") {
+	if IsVersionedID(nameOrVersioned) {
 		// Check specific version
 		return s.backend.Exists(ctx, nameOrVersioned)
 	}
@@ -188,44 +438,142 @@ type SnapshotInfo struct {
 	Version         string    `json:"version,omitempty"`
 	VersionCount    int       `json:"version_count,omitempty"`
 	Encrypted       bool      `json:"encrypted,omitempty"`
+	// Tags are the tags of the latest version
+	Tags map[string]string `json:"tags,omitempty"`
+	// VolumeSize and Parent are those of the latest version
+	VolumeSize int64  `json:"volume_size,omitempty"`
+	Parent     string `json:"parent,omitempty"`
 }
 
 // VersionInfo contains information about a specific version of a snapshot
 type VersionInfo struct {
+	ID          string    `json:"id"`
 	Version     string    `json:"version"`
 	Size        int64     `json:"size"`
 	CreatedAt   time.Time `json:"created_at"`
 	Description string    `json:"description,omitempty"`
+	// Parent is the version an incremental backup is based on
+	Parent string `json:"parent,omitempty"`
+	// Tags are the key/value pairs the version was tagged with
+	Tags map[string]string `json:"tags,omitempty"`
 }
 
 // ListVersions returns all versions of a snapshot name
 func (s *SnapshotStorage) ListVersions(ctx context.Context, name string) ([]VersionInfo, error) {
 	name = cleanSnapshotName(name)
 
-	backups, err := s.backend.List(ctx)
-	if err != nil {
-		return nil, err
+	var backups []BackupMetadata
+	for _, prefix := range versionPrefixes(name) {
+		prefixBackups, err := s.list(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, prefixBackups...)
 	}
 
 	var versions []VersionInfo
 	for _, backup := range backups {
 		// Check if this backup matches our snapshot name
-		if strings.HasPrefix(backup.ID, name+"@") {
-			parts := strings.SplitN(backup.ID, "@", 2)
-			if len(parts) == 2 {
-				versions = append(versions, VersionInfo{
-					Version:     parts[1],
-					Size:        backup.Size,
-					CreatedAt:   backup.CreatedAt,
-					Description: backup.Description,
-				})
-			}
+		backupName, version, ok := ParseVersionedID(backup.ID)
+		if ok && backupName == name {
+			versions = append(versions, VersionInfo{
+				ID:          backup.ID,
+				Version:     version,
+				Size:        backup.Size,
+				CreatedAt:   backup.CreatedAt,
+				Description: backup.Description,
+				Parent:      backup.Parent,
+				Tags:        backup.Tags,
+			})
+		}
+	}
+
+	return versions, nil
+}
+
+// ListAllVersions returns the versions of every snapshot keyed by snapshot name, newest first
+func (s *SnapshotStorage) ListAllVersions(ctx context.Context) (map[string][]VersionInfo, error) {
+	backups, err := s.list(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string][]VersionInfo)
+	for _, backup := range backups {
+		name, version, ok := ParseVersionedID(backup.ID)
+		if !ok {
+			continue
 		}
+		versions[name] = append(versions[name], VersionInfo{
+			ID:          backup.ID,
+			Version:     version,
+			Size:        backup.Size,
+			CreatedAt:   backup.CreatedAt,
+			Description: backup.Description,
+			Parent:      backup.Parent,
+			Tags:        backup.Tags,
+		})
+	}
+
+	for _, nameVersions := range versions {
+		sort.Slice(nameVersions, func(i, j int) bool {
+			return nameVersions[i].CreatedAt.After(nameVersions[j].CreatedAt)
+		})
 	}
 
 	return versions, nil
 }
 
+// FindVersionByContentChecksum returns the metadata of a version of the snapshot whose
+// content checksum matches, or nil if there is none
+func (s *SnapshotStorage) FindVersionByContentChecksum(ctx context.Context, name, checksum string) (*BackupMetadata, error) {
+	if checksum == "" {
+		return nil, nil
+	}
+	name = cleanSnapshotName(name)
+
+	for _, prefix := range versionPrefixes(name) {
+		backups, err := s.list(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, backup := range backups {
+			backupName, _, ok := ParseVersionedID(backup.ID)
+			if ok && backupName == name && backup.ContentChecksum == checksum {
+				found := backup
+				return &found, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// LatestVersionMetadata returns the metadata of the latest version of the snapshot, or nil if
+// it has no versions
+func (s *SnapshotStorage) LatestVersionMetadata(ctx context.Context, name string) (*BackupMetadata, error) {
+	name = cleanSnapshotName(name)
+
+	var latest *BackupMetadata
+	latestVersion := ""
+	for _, prefix := range versionPrefixes(name) {
+		backups, err := s.list(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, backup := range backups {
+			backupName, version, ok := ParseVersionedID(backup.ID)
+			if ok && backupName == name && version > latestVersion {
+				found := backup
+				latest = &found
+				latestVersion = version
+			}
+		}
+	}
+
+	return latest, nil
+}
+
 // GetLatestVersion returns the version string of the latest snapshot
 func (s *SnapshotStorage) GetLatestVersion(ctx context.Context, name string) (string, error) {
 	versions, err := s.ListVersions(ctx, name)
@@ -234,7 +582,7 @@ func (s *SnapshotStorage) GetLatestVersion(ctx context.Context, name string) (st
 	}
 
 	if len(versions) == 0 {
-		return "", fmt.Errorf("no versions found for snapshot '%s'", name)
+		return "", fmt.Errorf("snapshot '%s' %w: it has no versions", name, ErrNotFound)
 	}
 
 	// Find the latest version by creation time
@@ -248,6 +596,150 @@ func (s *SnapshotStorage) GetLatestVersion(ctx context.Context, name string) (st
 	return latestVersion.Version, nil
 }
 
+// Version selectors accepted by ResolveVersion besides an exact version and ~N
+const (
+	VersionLatest   = "latest"
+	VersionPrevious = "previous"
+)
+
+// ResolveVersion returns the versioned ID of the snapshot version a selector refers to:
+// "latest", "previous" (the one before latest), "~N" (N versions before latest) or an exact
+// version, which is returned without checking that it exists
+func (s *SnapshotStorage) ResolveVersion(ctx context.Context, name, selector string) (string, error) {
+	name = cleanSnapshotName(name)
+
+	back := 0
+	switch {
+	case selector == VersionLatest:
+	case selector == VersionPrevious:
+		back = 1
+	case strings.HasPrefix(selector, "~"):
+		n, err := strconv.Atoi(selector[1:])
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("invalid version %q: use ~N with N the number of versions before latest", selector)
+		}
+		back = n
+	default:
+		return VersionedID(name, selector), nil
+	}
+
+	versions, err := s.ListVersions(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if len(versions) == 0 {
+		return "", fmt.Errorf("snapshot '%s' %w: it has no versions", name, ErrNotFound)
+	}
+	if back >= len(versions) {
+		return "", fmt.Errorf("version %q %w: snapshot '%s' has only %d version(s)", selector, ErrNotFound, name, len(versions))
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].CreatedAt.After(versions[j].CreatedAt)
+	})
+	return versions[back].ID, nil
+}
+
+// RawMetadata returns the stored metadata object of a snapshot by name (latest version) or
+// name@version, exactly as written and without reading the data object. It returns the
+// resolved versioned ID along with the metadata.
+func (s *SnapshotStorage) RawMetadata(ctx context.Context, nameOrVersioned string) (string, []byte, error) {
+	nameOrVersioned = cleanSnapshotName(nameOrVersioned)
+
+	metadataBackend, ok := s.backend.(MetadataBackend)
+	if !ok {
+		return "", nil, fmt.Errorf("storage backend does not support reading raw metadata")
+	}
+
+	versionedID := nameOrVersioned
+	if !IsVersionedID(nameOrVersioned) {
+		latestVersion, err := s.GetLatestVersion(ctx, nameOrVersioned)
+		if err != nil {
+			return "", nil, err
+		}
+		versionedID = VersionedID(nameOrVersioned, latestVersion)
+	}
+
+	data, err := metadataBackend.RawMetadata(ctx, versionedID)
+	if err != nil {
+		return "", nil, err
+	}
+	return versionedID, data, nil
+}
+
+// RepairSnapshot regenerates minimal metadata for a snapshot version from its data object.
+// The name and version come from the versioned ID, the size and creation time from the
+// stored object, the archive options from the key of the data object and the encrypted flag
+// from the data header.
+func (s *SnapshotStorage) RepairSnapshot(ctx context.Context, versionedID string) (*BackupMetadata, error) {
+	versionedID = cleanSnapshotName(versionedID)
+
+	metadataBackend, ok := s.backend.(MetadataBackend)
+	if !ok {
+		return nil, fmt.Errorf("storage backend does not support metadata repair")
+	}
+
+	name, version, ok := ParseVersionedID(versionedID)
+	if !ok {
+		return nil, fmt.Errorf("a versioned snapshot ID (name%sversion) is required for repair", VersionSeparator)
+	}
+
+	info, err := metadataBackend.StatData(ctx, versionedID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Detect encryption from the data header
+	dataReader, err := metadataBackend.OpenData(ctx, versionedID)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 8)
+	n, err := io.ReadFull(dataReader, header)
+	if closeErr := dataReader.Close(); closeErr != nil {
+		Warnf("failed to close data reader: %v", closeErr)
+	}
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("failed to read backup data header: %w", err)
+	}
+
+	metadata := BackupMetadata{
+		ID:          versionedID,
+		Name:        name,
+		Type:        "volume-snapshot",
+		Size:        info.Size,
+		CreatedAt:   info.ModTime,
+		Version:     version,
+		Description: "Metadata regenerated by dvom repair",
+		Encrypted:   crypto.IsEncrypted(header[:n]),
+	}
+	if options, ok := dataKeyOptions(versionedID, info.Key); ok {
+		metadata.Options = &options
+	}
+
+	s.invalidate()
+	if err := metadataBackend.PutMetadata(ctx, versionedID, metadata); err != nil {
+		return nil, err
+	}
+
+	return &metadata, nil
+}
+
+// versionPrefixes returns the ID prefixes of a snapshot's versions, including IDs that use
+// the legacy separator, to scope listings to the snapshot
+func versionPrefixes(name string) []string {
+	prefixes := []string{name + VersionSeparator}
+	if VersionSeparator != LegacyVersionSeparator {
+		prefixes = append(prefixes, name+LegacyVersionSeparator)
+	}
+	return prefixes
+}
+
+// NormalizeSnapshotName returns the name a snapshot with the given name is stored under
+func NormalizeSnapshotName(name string) string {
+	return cleanSnapshotName(name)
+}
+
 // cleanSnapshotName ensures snapshot names are valid for storage
 func cleanSnapshotName(name string) string {
 	// Remove file extensions if provided
@@ -16,8 +16,10 @@ import (
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/client"
 	"github.com/spf13/cobra"
+	"github.com/ypeckstadt/dvom/internal/docker"
 )
 
 const (
@@ -25,6 +27,12 @@ const (
 	MaxCopySize = 100 * 1024 * 1024 * 1024
 )
 
+// warnf prints a warning that does not fail the operation to stderr, keeping stdout for the
+// command's output
+func warnf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "Warning: "+format+"\n", args...)
+}
+
 // limitedCopy copies from src to dst with a size limit to prevent decompression bombs
 func limitedCopy(dst io.Writer, src io.Reader, maxSize int64) (int64, error) {
 	return io.CopyN(dst, src, maxSize)
@@ -231,7 +239,7 @@ func (dc *DockupClient) BackupContainer(containerName, outputFile string, noStop
 			fmt.Println("▶️  Starting container...")
 		}
 		if startErr := dc.StartContainer(container.ID); startErr != nil {
-			fmt.Printf("Warning: failed to restart container: %v\n", startErr)
+			warnf("failed to restart container: %v", startErr)
 		}
 	}
 
@@ -259,14 +267,14 @@ func (dc *DockupClient) createBackupZip(container *types.Container, volumes []Vo
 	}
 	defer func() {
 		if err := zipFile.Close(); err != nil {
-			fmt.Printf("Warning: failed to close zip file: %v\n", err)
+			warnf("failed to close zip file: %v", err)
 		}
 	}()
 
 	writer := zip.NewWriter(zipFile)
 	defer func() {
 		if err := writer.Close(); err != nil {
-			fmt.Printf("Warning: failed to close zip writer: %v\n", err)
+			warnf("failed to close zip writer: %v", err)
 		}
 	}()
 
@@ -324,10 +332,10 @@ func (dc *DockupClient) backupVolume(writer *zip.Writer, vol VolumeInfo) error {
 		context.Background(),
 		&container.Config{
 			Image: "alpine:latest",
-			Cmd:   []string{"tar", "--numeric-owner", "--no-xattrs", "--no-acls", "--format=pax", "czf", "/tmp/volume.tar.gz", "-C", vol.Destination, "."},
+			Cmd:   []string{"tar", "--numeric-owner", "--no-xattrs", "--no-acls", "--format=pax", "czf", "/tmp/volume.tar.gz", "-C", "/data", "."},
 		},
 		&container.HostConfig{
-			Binds: []string{fmt.Sprintf("%s:%s:ro", vol.Name, vol.Destination)},
+			Mounts: []mount.Mount{{Type: mount.TypeVolume, Source: vol.Name, Target: "/data", ReadOnly: true}},
 		},
 		nil,
 		nil,
@@ -339,7 +347,7 @@ func (dc *DockupClient) backupVolume(writer *zip.Writer, vol VolumeInfo) error {
 
 	defer func() {
 		if err := dc.docker.ContainerRemove(context.Background(), resp.ID, container.RemoveOptions{Force: true}); err != nil {
-			fmt.Printf("Warning: failed to remove container %s: %v\n", resp.ID, err)
+			warnf("failed to remove container %s: %v", resp.ID, err)
 		}
 	}()
 
@@ -364,7 +372,7 @@ func (dc *DockupClient) backupVolume(writer *zip.Writer, vol VolumeInfo) error {
 			})
 			if logs != nil {
 				if err := logs.Close(); err != nil {
-					fmt.Printf("Warning: failed to close logs: %v\n", err)
+					warnf("failed to close logs: %v", err)
 				}
 			}
 			return fmt.Errorf("backup container exited with code %d", status.StatusCode)
@@ -378,7 +386,7 @@ func (dc *DockupClient) backupVolume(writer *zip.Writer, vol VolumeInfo) error {
 	}
 	defer func() {
 		if err := reader.Close(); err != nil {
-			fmt.Printf("Warning: failed to close reader: %v\n", err)
+			warnf("failed to close reader: %v", err)
 		}
 	}()
 
@@ -482,7 +490,7 @@ func (dc *DockupClient) RestoreBackup(containerName, backupFile string, dryRun,
 			fmt.Println("▶️  Starting container...")
 		}
 		if startErr := dc.StartContainer(container.ID); startErr != nil {
-			fmt.Printf("Warning: failed to start container: %v\n", startErr)
+			warnf("failed to start container: %v", startErr)
 		}
 	}
 
@@ -505,7 +513,7 @@ func (dc *DockupClient) readBackupMetadata(backupFile string) (*BackupMetadata,
 	}
 	defer func() {
 		if err := reader.Close(); err != nil {
-			fmt.Printf("Warning: failed to close reader: %v\n", err)
+			warnf("failed to close reader: %v", err)
 		}
 	}()
 
@@ -517,7 +525,7 @@ func (dc *DockupClient) readBackupMetadata(backupFile string) (*BackupMetadata,
 			}
 			defer func() {
 				if err := rc.Close(); err != nil {
-					fmt.Printf("Warning: failed to close reader: %v\n", err)
+					warnf("failed to close reader: %v", err)
 				}
 			}()
 
@@ -542,7 +550,7 @@ func (dc *DockupClient) restoreVolumes(backupFile string, volumes []VolumeInfo)
 	}
 	defer func() {
 		if err := reader.Close(); err != nil {
-			fmt.Printf("Warning: failed to close reader: %v\n", err)
+			warnf("failed to close reader: %v", err)
 		}
 	}()
 
@@ -567,8 +575,24 @@ func (dc *DockupClient) restoreVolumes(backupFile string, volumes []VolumeInfo)
 	return nil
 }
 
+// restoreContainerConfig returns the configuration of the container that extracts a volume's
+// archive. The volume is mounted at a fixed path, so the script never contains a value from the
+// backup; the destination recorded in the backup is not used.
+func restoreContainerConfig(vol VolumeInfo) (*container.Config, *container.HostConfig) {
+	return &container.Config{
+		Image: "alpine:latest",
+		Cmd:   []string{"sh", "-c", "find /data -mindepth 1 -delete && tar xzf /tmp/volume.tar.gz -C /data"},
+	}, &container.HostConfig{
+		Mounts: []mount.Mount{{Type: mount.TypeVolume, Source: vol.Name, Target: "/data"}},
+	}
+}
+
 // restoreVolume restores a single volume
 func (dc *DockupClient) restoreVolume(reader *zip.ReadCloser, vol VolumeInfo) error {
+	// The name comes from the backup file, which may not have been written by dockup
+	if !docker.ValidVolumeName(vol.Name) {
+		return fmt.Errorf("invalid volume name in backup: %q", vol.Name)
+	}
 	volumePath := fmt.Sprintf("volumes/%s.tar.gz", vol.Name)
 
 	var volumeFile *zip.File
@@ -589,31 +613,20 @@ func (dc *DockupClient) restoreVolume(reader *zip.ReadCloser, vol VolumeInfo) er
 	}
 	defer func() {
 		if err := rc.Close(); err != nil {
-			fmt.Printf("Warning: failed to close reader: %v\n", err)
+			warnf("failed to close reader: %v", err)
 		}
 	}()
 
 	// Create temporary container to restore volume
-	resp, err := dc.docker.ContainerCreate(
-		context.Background(),
-		&container.Config{
-			Image: "alpine:latest",
-			Cmd:   []string{"sh", "-c", "rm -rf " + vol.Destination + "/* && tar xzf /tmp/volume.tar.gz -C " + vol.Destination},
-		},
-		&container.HostConfig{
-			Binds: []string{fmt.Sprintf("%s:%s", vol.Name, vol.Destination)},
-		},
-		nil,
-		nil,
-		"",
-	)
+	config, hostConfig := restoreContainerConfig(vol)
+	resp, err := dc.docker.ContainerCreate(context.Background(), config, hostConfig, nil, nil, "")
 	if err != nil {
 		return fmt.Errorf("failed to create restore container: %w", err)
 	}
 
 	defer func() {
 		if err := dc.docker.ContainerRemove(context.Background(), resp.ID, container.RemoveOptions{Force: true}); err != nil {
-			fmt.Printf("Warning: failed to remove container %s: %v\n", resp.ID, err)
+			warnf("failed to remove container %s: %v", resp.ID, err)
 		}
 	}()
 
@@ -622,13 +635,13 @@ func (dc *DockupClient) restoreVolume(reader *zip.ReadCloser, vol VolumeInfo) er
 	go func() {
 		defer func() {
 			if err := pipeWriter.Close(); err != nil {
-				fmt.Printf("Warning: failed to close pipe writer: %v\n", err)
+				warnf("failed to close pipe writer: %v", err)
 			}
 		}()
 		tarWriter := tar.NewWriter(pipeWriter)
 		defer func() {
 			if err := tarWriter.Close(); err != nil {
-				fmt.Printf("Warning: failed to close tar writer: %v\n", err)
+				warnf("failed to close tar writer: %v", err)
 			}
 		}()
 
@@ -636,7 +649,7 @@ func (dc *DockupClient) restoreVolume(reader *zip.ReadCloser, vol VolumeInfo) er
 		size := volumeFile.UncompressedSize64
 		var tarSize int64
 		if size > math.MaxInt64 {
-			fmt.Printf("Warning: file size too large, truncating to MaxInt64\n")
+			warnf("file size too large, truncating to MaxInt64")
 			tarSize = math.MaxInt64
 		} else {
 			tarSize = int64(size) // #nosec G115 - bounds check performed above
@@ -653,7 +666,7 @@ func (dc *DockupClient) restoreVolume(reader *zip.ReadCloser, vol VolumeInfo) er
 
 		// Copy the gzipped data
 		if _, err := limitedCopy(tarWriter, rc, MaxCopySize); err != nil {
-			fmt.Printf("Warning: failed to copy data: %v\n", err)
+			warnf("failed to copy data: %v", err)
 		}
 	}()
 
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/mount"
+)
+
+func TestRestoreContainerConfigIgnoresTheDestination(t *testing.T) {
+	const script = "find /data -mindepth 1 -delete && tar xzf /tmp/volume.tar.gz -C /data"
+
+	destinations := []string{
+		"/var/lib/my data",
+		"/data; rm -rf /",
+		"/data/$(reboot)",
+		"/data/`id`",
+		"/a && b",
+		"/'quoted' \"double\"",
+	}
+	for _, destination := range destinations {
+		config, hostConfig := restoreContainerConfig(VolumeInfo{Name: "app_data", Destination: destination})
+
+		want := []string{"sh", "-c", script}
+		if !slices.Equal(config.Cmd, want) {
+			t.Errorf("destination %q: Cmd = %q, want %q", destination, config.Cmd, want)
+		}
+		for _, arg := range config.Cmd {
+			if strings.Contains(arg, destination) {
+				t.Errorf("destination %q appears in the command %q", destination, config.Cmd)
+			}
+		}
+
+		wantMount := mount.Mount{Type: mount.TypeVolume, Source: "app_data", Target: "/data"}
+		if len(hostConfig.Mounts) != 1 || hostConfig.Mounts[0] != wantMount {
+			t.Errorf("destination %q: Mounts = %+v, want %+v", destination, hostConfig.Mounts, wantMount)
+		}
+		if len(hostConfig.Binds) != 0 {
+			t.Errorf("destination %q: Binds = %q, want none", destination, hostConfig.Binds)
+		}
+	}
+}